@@ -0,0 +1,428 @@
+// Package api extracts the exported API surface of Go packages parsed
+// with github.com/yunabe/golang-codelab/customparser/parser, and compares
+// two versions of it.
+//
+// An API is a list of features, written one per line in a stable text
+// format modeled on the api files of the Go distribution:
+//
+//	pkg lib2, func IntSum(...int) int
+//	pkg p, type T struct
+//	pkg p, type T struct, X int
+//	pkg p, type T struct, embedded *Base
+//	pkg p, method (*T) M(string) error
+//	pkg p, type I interface { M, unexported methods }
+//	pkg p, type I interface, M(string) error
+//	pkg p, type ID int
+//	pkg p, const C ID = 1
+//	pkg p, var V *T
+//
+// Features are extracted from the syntax alone, without type checking.
+// Types are written as in the source, except that parameter names are
+// omitted and imported packages are named by the last element of their
+// import path. The type of a variable declared without type is inferred
+// from simple initializers only, and omitted otherwise.
+//
+// Compare classifies the differences between two APIs as compatible or
+// incompatible for the clients of the packages, in the spirit of
+// golang.org/x/exp/apidiff: removing or changing a feature breaks
+// clients, adding one does not, except for methods added to interfaces
+// clients may implement.
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yunabe/golang-codelab/customparser/parser"
+)
+
+// A Feature is an element of the API of a package.
+type Feature struct {
+	Pkg  string // package path, relative to the root of the tree
+	Text string // e.g. "func F(int) error"
+}
+
+func (f Feature) String() string {
+	return "pkg " + f.Pkg + ", " + f.Text
+}
+
+// key identifies the API element described by a feature, so that the
+// features of two versions can be matched: "func F", "method T.M",
+// "type T", "type T, field X", "type T, method M", "type T, embedded X",
+// "const C" or "var V".
+func (f Feature) key() string {
+	return f.Pkg + ", " + key(f.Text)
+}
+
+func key(text string) string {
+	kind, rest := cut(text, " ")
+	switch kind {
+	case "func":
+		return "func " + name(rest)
+	case "method":
+		recv, rest := cut(rest, " ")
+		return "method " + strings.Trim(recv, "(*)") + "." + name(rest)
+	case "type":
+		typ, rest := cut(rest, " ")
+		for _, prefix := range []string{"struct, ", "interface, "} {
+			if !strings.HasPrefix(rest, prefix) {
+				continue
+			}
+			member := rest[len(prefix):]
+			switch {
+			case strings.HasPrefix(member, "embedded "):
+				return "type " + typ + ", embedded " + strings.TrimLeft(member[len("embedded "):], "*")
+			case prefix == "struct, ":
+				return "type " + typ + ", field " + name(member)
+			default:
+				return "type " + typ + ", method " + name(member)
+			}
+		}
+		return "type " + typ
+	}
+	return kind + " " + name(rest)
+}
+
+// name returns the leading name of s.
+func name(s string) string {
+	if i := strings.IndexAny(s, " ("); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+func cut(s, sep string) (before, after string) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):]
+	}
+	return s, ""
+}
+
+// ----------------------------------------------------------------------------
+// Extraction
+
+// Package returns the features of the exported API of pkg, sorted, with
+// the package path path.
+func Package(path string, pkg *ast.Package) []Feature {
+	filenames := make([]string, 0, len(pkg.Files))
+	for filename := range pkg.Files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	x := &extractor{path: path}
+	for _, filename := range filenames {
+		x.file(pkg.Files[filename])
+	}
+	return sortFeatures(x.features)
+}
+
+// sortFeatures sorts features and removes duplicates, such as those of
+// files for different platforms.
+func sortFeatures(features []Feature) []Feature {
+	sort.Slice(features, func(i, j int) bool {
+		return features[i].String() < features[j].String()
+	})
+	list := features[:0]
+	for i, f := range features {
+		if i == 0 || f != features[i-1] {
+			list = append(list, f)
+		}
+	}
+	return list
+}
+
+type extractor struct {
+	path     string
+	features []Feature
+	p        printer // printer of the current file
+}
+
+func (x *extractor) add(format string, args ...interface{}) {
+	x.features = append(x.features, Feature{x.path, fmt.Sprintf(format, args...)})
+}
+
+func (x *extractor) file(f *ast.File) {
+	x.p = printer{imports: make(map[string]string)}
+	for _, spec := range f.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		base := path[strings.LastIndex(path, "/")+1:]
+		local := base
+		if spec.Name != nil {
+			local = spec.Name.Name
+		}
+		x.p.imports[local] = base
+	}
+
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			switch decl.Tok {
+			case token.CONST:
+				x.consts(decl)
+			case token.VAR:
+				x.vars(decl)
+			case token.TYPE:
+				for _, spec := range decl.Specs {
+					x.typeSpec(spec.(*ast.TypeSpec))
+				}
+			}
+		case *ast.FuncDecl:
+			x.funcDecl(decl)
+		}
+	}
+}
+
+// consts adds the exported constants of decl. The value of a constant
+// is written with iota replaced by its value.
+func (x *extractor) consts(decl *ast.GenDecl) {
+	var typ ast.Expr
+	var values []ast.Expr
+	for iota, spec := range decl.Specs {
+		spec := spec.(*ast.ValueSpec)
+		if spec.Type != nil || len(spec.Values) > 0 {
+			typ, values = spec.Type, spec.Values
+		}
+		for i, ident := range spec.Names {
+			if !ident.IsExported() {
+				continue
+			}
+			text := "const " + ident.Name
+			if typ != nil {
+				text += " " + x.p.expr(typ)
+			}
+			if i < len(values) {
+				p := x.p
+				p.iota = strconv.Itoa(iota)
+				text += " = " + p.expr(values[i])
+			}
+			x.add("%s", text)
+		}
+	}
+}
+
+func (x *extractor) vars(decl *ast.GenDecl) {
+	for _, spec := range decl.Specs {
+		spec := spec.(*ast.ValueSpec)
+		for i, ident := range spec.Names {
+			if !ident.IsExported() {
+				continue
+			}
+			typ := spec.Type
+			if typ == nil && len(spec.Values) == len(spec.Names) {
+				typ = inferType(spec.Values[i])
+			}
+			if typ == nil {
+				x.add("var %s", ident.Name)
+			} else {
+				x.add("var %s %s", ident.Name, x.p.expr(typ))
+			}
+		}
+	}
+}
+
+// inferType returns the type of the initializer x if it is obvious from
+// the syntax, or nil.
+func inferType(x ast.Expr) ast.Expr {
+	switch x := x.(type) {
+	case *ast.BasicLit:
+		kinds := map[token.Token]string{token.INT: "int", token.FLOAT: "float64", token.IMAG: "complex128", token.CHAR: "rune", token.STRING: "string"}
+		return ast.NewIdent(kinds[x.Kind])
+	case *ast.CompositeLit:
+		return x.Type
+	case *ast.UnaryExpr:
+		if lit, ok := x.X.(*ast.CompositeLit); ok && x.Op == token.AND && lit.Type != nil {
+			return &ast.StarExpr{X: lit.Type}
+		}
+	case *ast.CallExpr:
+		if sel, ok := x.Fun.(*ast.SelectorExpr); ok {
+			if pkg, ok := sel.X.(*ast.Ident); ok && (pkg.Name == "errors" && sel.Sel.Name == "New" || pkg.Name == "fmt" && sel.Sel.Name == "Errorf") {
+				return ast.NewIdent("error")
+			}
+		}
+	}
+	return nil
+}
+
+func (x *extractor) typeSpec(spec *ast.TypeSpec) {
+	if !spec.Name.IsExported() {
+		return
+	}
+	name := spec.Name.Name
+	switch t := spec.Type.(type) {
+	case *ast.StructType:
+		x.add("type %s struct", name)
+		for _, field := range t.Fields.List {
+			typ := x.p.expr(field.Type)
+			if len(field.Names) == 0 {
+				if ast.IsExported(baseName(field.Type)) {
+					x.add("type %s struct, embedded %s", name, typ)
+				}
+				continue
+			}
+			for _, ident := range field.Names {
+				if ident.IsExported() {
+					x.add("type %s struct, %s %s", name, ident.Name, typ)
+				}
+			}
+		}
+
+	case *ast.InterfaceType:
+		var names []string
+		unexported := false
+		for _, m := range t.Methods.List {
+			if len(m.Names) == 0 {
+				typ := x.p.expr(m.Type)
+				names = append(names, typ)
+				x.add("type %s interface, embedded %s", name, typ)
+				continue
+			}
+			if !m.Names[0].IsExported() {
+				unexported = true
+				continue
+			}
+			names = append(names, m.Names[0].Name)
+			x.add("type %s interface, %s%s", name, m.Names[0].Name, x.p.signature(m.Type.(*ast.FuncType)))
+		}
+		sort.Strings(names)
+		if unexported {
+			names = append(names, "unexported methods")
+		}
+		if len(names) == 0 {
+			x.add("type %s interface {}", name)
+		} else {
+			x.add("type %s interface { %s }", name, strings.Join(names, ", "))
+		}
+
+	default:
+		x.add("type %s %s", name, x.p.expr(spec.Type))
+	}
+}
+
+func (x *extractor) funcDecl(decl *ast.FuncDecl) {
+	if !decl.Name.IsExported() {
+		return
+	}
+	sig := x.p.signature(decl.Type)
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		x.add("func %s%s", decl.Name.Name, sig)
+		return
+	}
+	recv := decl.Recv.List[0].Type
+	base := baseName(recv)
+	if !ast.IsExported(base) {
+		return
+	}
+	if _, ok := unparen(recv).(*ast.StarExpr); ok {
+		base = "*" + base
+	}
+	x.add("method (%s) %s%s", base, decl.Name.Name, sig)
+}
+
+// baseName returns the name of the type x, a possibly qualified type
+// name or a pointer to one.
+func baseName(x ast.Expr) string {
+	switch x := unparen(x).(type) {
+	case *ast.Ident:
+		return x.Name
+	case *ast.SelectorExpr:
+		return x.Sel.Name
+	case *ast.StarExpr:
+		return baseName(x.X)
+	}
+	return ""
+}
+
+func unparen(x ast.Expr) ast.Expr {
+	if p, ok := x.(*ast.ParenExpr); ok {
+		return unparen(p.X)
+	}
+	return x
+}
+
+// Dir returns the features of the packages in the directory tree root,
+// sorted. The package path of a package is its directory relative to
+// root, in slash form ("." for root itself). Test files, main packages
+// and the directories named testdata or starting with "." or "_" are
+// skipped. The bodies of functions are not parsed.
+func Dir(root string) ([]Feature, error) {
+	var features []Feature
+	conf := parser.Config{Mode: parser.SkipFunctionBodies}
+	filter := func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}
+	err := filepath.Walk(root, func(dir string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if name := info.Name(); dir != root && (name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+			return filepath.SkipDir
+		}
+		pkgs, err := conf.ParseDir(token.NewFileSet(), dir, filter)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return err
+		}
+		for name, pkg := range pkgs {
+			if name != "main" && !strings.HasSuffix(name, "_test") {
+				features = append(features, Package(filepath.ToSlash(rel), pkg)...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sortFeatures(features), nil
+}
+
+// ----------------------------------------------------------------------------
+// Text format
+
+// Write writes features to w, one per line.
+func Write(w io.Writer, features []Feature) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range features {
+		fmt.Fprintln(bw, f)
+	}
+	return bw.Flush()
+}
+
+// Read reads the features written by Write from r, sorted. Blank lines
+// and lines starting with # are ignored.
+func Read(r io.Reader) ([]Feature, error) {
+	var features []Feature
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		pkg, rest := cut(text, ", ")
+		if !strings.HasPrefix(pkg, "pkg ") || rest == "" {
+			return nil, fmt.Errorf("line %d: malformed feature %q", line, text)
+		}
+		features = append(features, Feature{strings.TrimPrefix(pkg, "pkg "), rest})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return sortFeatures(features), nil
+}
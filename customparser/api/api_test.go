@@ -0,0 +1,207 @@
+package api
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yunabe/golang-codelab/customparser/parser"
+)
+
+const oldAPI = `pkg ., const Version = "1.0"
+pkg p, const A Kind = 0
+pkg p, const B Kind = 1
+pkg p, const D = "d"
+pkg p, func New(string) *Options
+pkg p, func Old()
+pkg p, method (*Base) Reset()
+pkg p, method (*Options) Apply(io.Writer, ...string) (int, error)
+pkg p, method (Options) String() string
+pkg p, type Base struct
+pkg p, type Handler func(string) error
+pkg p, type Kind int
+pkg p, type Options struct
+pkg p, type Options struct, Name string
+pkg p, type Options struct, Verbose bool
+pkg p, type Options struct, embedded Base
+pkg p, type Reader interface { Read }
+pkg p, type Reader interface, Read([]byte) (int, error)
+pkg p, type Sealed interface { Name, unexported methods }
+pkg p, type Sealed interface, Name() string
+pkg p, var Count int
+pkg p, var Default *Options
+pkg p, var ErrX error
+pkg p, var Limit
+`
+
+func TestDir(t *testing.T) {
+	features, err := Dir("testdata/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, features); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != oldAPI {
+		t.Errorf("got\n%s\nwant\n%s", got, oldAPI)
+	}
+
+	read, err := Read(strings.NewReader("# comment\n\n" + oldAPI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, features) {
+		t.Errorf("read features differ from written ones:\n%v", read)
+	}
+	if _, err := Read(strings.NewReader("pkg p, func F()\nfunc G()\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("got error %v; want a malformed feature on line 2", err)
+	}
+}
+
+func TestBuildShared(t *testing.T) {
+	features, err := Dir("../../buildshared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	Write(&buf, features)
+	const want = `pkg lib0, func GetX() int
+pkg lib0, func GetY() int
+pkg lib1, func GetA() float64
+pkg lib1, func GetB() float64
+pkg lib2, func IntSum(...int) int
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+var featureTests = []struct {
+	src  string
+	want []string
+}{
+	{`import (
+		"net/http"
+		u "net/url"
+		. "strings"
+	)
+	type T struct { A, B *http.Request; u.URL; *Builder; c int }`, []string{
+		"type T struct",
+		"type T struct, A *http.Request",
+		"type T struct, B *http.Request",
+		"type T struct, embedded *Builder",
+		"type T struct, embedded url.URL",
+	}},
+	{`const (
+		X, Y = iota * 10, -iota
+		_, Z
+	)
+	const W float64 = 1 << 3 / 2`, []string{
+		"const W float64 = 1 << 3 / 2",
+		"const X = 0 * 10",
+		"const Y = -0",
+		"const Z = -1",
+	}},
+	{`var A, b = [2]int{1, 2}, 0
+	var F = func(x int) bool { return x > 0 }
+	var M map[string][]chan<- struct{ x, y int }`, []string{
+		"var A [2]int",
+		"var F",
+		"var M map[string][]chan<- struct{ x int; y int }",
+	}},
+	{`type I interface { io.Reader; M(a, b int, c ...string) (x, y bool) }
+	type E interface{}
+	type t int
+	func (t) Exported() {}
+	func (*I) F(f func(int) (string, error)) <-chan interface{ M() }`, []string{
+		"method (*I) F(func(int) (string, error)) <-chan interface{ M() }",
+		"type E interface {}",
+		"type I interface { M, io.Reader }",
+		"type I interface, M(int, int, ...string) (bool, bool)",
+		"type I interface, embedded io.Reader",
+	}},
+}
+
+func TestFeatures(t *testing.T) {
+	for _, test := range featureTests {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "p.go", "package p\n"+test.src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, feature := range Package("p", &ast.Package{Name: "p", Files: map[string]*ast.File{"p.go": f}}) {
+			got = append(got, feature.Text)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s:\ngot  %q\nwant %q", test.src, got, test.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	old, err := Dir("testdata/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := Dir("testdata/new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteText(&buf, Compare(old, new)); err != nil {
+		t.Fatal(err)
+	}
+	const want = `Incompatible changes:
+- pkg ., const Version = "1.0": changed to const Version = "1.1"
+- pkg p, func New(string) *Options: changed to func New(string, ...Options) *Options
+- pkg p, func Old(): removed
+- pkg p, method (Options) String() string: changed to method (*Options) String() string
+- pkg p, type Handler func(string) error: changed to type Handler func(string, int) error
+- pkg p, type Reader interface, Close() error: added
+- pkg p, var Count int: changed to var Count int64
+Compatible changes:
+- pkg p, const C Kind = 2: added
+- pkg p, func Added(): added
+- pkg p, method (*Base) Reset(): changed to method (Base) Reset()
+- pkg p, type Options struct, Timeout int: added
+- pkg p, type Sealed interface, Kind() Kind: added
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	if changes := Compare(new, new); len(changes) != 0 {
+		t.Errorf("got changes %v between identical APIs", changes)
+	}
+}
+
+var compareTests = []struct {
+	old, new   string
+	compatible bool
+}{
+	// new types may implement an interface without unexported methods
+	{"type I interface { M }", "type I interface { M, unexported methods }", false},
+	{"type I interface { M, unexported methods }", "type I interface { M }", true},
+	{"type I interface {}", "type I interface { M }", true},
+	{"type I interface { M }", "type I struct", false},
+	{"method (T) M()", "method (*T) M()", false},
+	{"method (*T) M()", "method (T) M() int", false},
+	{"type T struct, embedded Base", "type T struct, embedded *Base", false},
+}
+
+func TestCompareFeatures(t *testing.T) {
+	for _, test := range compareTests {
+		changes := Compare([]Feature{{"p", test.old}}, []Feature{{"p", test.new}})
+		if test.compatible && len(changes) == 0 {
+			continue
+		}
+		if len(changes) != 1 || changes[0].Kind != Changed || changes[0].Compatible != test.compatible {
+			t.Errorf("%s → %s: got %v; want a change compatible = %v", test.old, test.new, changes, test.compatible)
+		}
+	}
+}
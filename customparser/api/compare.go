@@ -0,0 +1,171 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Kind describes a change.
+type Kind int
+
+const (
+	Added   Kind = iota // feature only in the new API
+	Removed             // feature only in the old API
+	Changed             // feature of both APIs, with a different text
+)
+
+var kindStrings = [...]string{
+	Added:   "added",
+	Removed: "removed",
+	Changed: "changed",
+}
+
+func (k Kind) String() string {
+	if 0 <= k && int(k) < len(kindStrings) {
+		return kindStrings[k]
+	}
+	return "Kind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// A Change is a difference between the old and the new API.
+type Change struct {
+	Kind Kind
+	Old  *Feature // nil if added
+	New  *Feature // nil if removed
+
+	// Compatible reports whether the clients of the old API still
+	// compile with the new one.
+	Compatible bool
+}
+
+func (c *Change) String() string {
+	switch c.Kind {
+	case Added:
+		return c.New.String() + ": added"
+	case Removed:
+		return c.Old.String() + ": removed"
+	}
+	return c.Old.String() + ": changed to " + c.New.Text
+}
+
+// Compare returns the changes from the old API to the new one, sorted by
+// feature. Features are matched by the element they describe: a
+// function, a method, a type, a field, an embedded type or a method of
+// an interface, a constant or a variable.
+//
+// Removed and changed features are incompatible, except a method whose
+// receiver changes from a pointer to a value, and an interface whose
+// list of methods changes only as its method features do. Added
+// features are compatible, except methods and embedded types added to an
+// interface which clients could implement, that is one of the old API
+// without unexported methods.
+func Compare(old, new []Feature) []*Change {
+	oldByKey := index(old)
+	newByKey := index(new)
+
+	var changes []*Change
+	for k, o := range oldByKey {
+		n, ok := newByKey[k]
+		switch {
+		case !ok:
+			changes = append(changes, &Change{Kind: Removed, Old: o})
+		case o.Text != n.Text:
+			c := &Change{Kind: Changed, Old: o, New: n}
+			c.Compatible = compatibleChange(o.Text, n.Text)
+			if c.Compatible && strings.HasPrefix(o.Text, "type ") {
+				continue // interface method list: see the method features
+			}
+			changes = append(changes, c)
+		}
+	}
+	for k, n := range newByKey {
+		if _, ok := oldByKey[k]; ok {
+			continue
+		}
+		c := &Change{Kind: Added, New: n, Compatible: true}
+		if typ, member := cut(n.Text, " interface, "); member != "" {
+			if o := oldByKey[n.Pkg+", "+key(typ)]; o != nil && implementable(o.Text) {
+				c.Compatible = false
+			}
+		}
+		changes = append(changes, c)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].feature().String() < changes[j].feature().String()
+	})
+	return changes
+}
+
+func (c *Change) feature() *Feature {
+	if c.Old != nil {
+		return c.Old
+	}
+	return c.New
+}
+
+// index returns the features by key. Of the features of a key with
+// different texts, such as those of files for different platforms, the
+// first is kept.
+func index(features []Feature) map[string]*Feature {
+	m := make(map[string]*Feature, len(features))
+	for i := range features {
+		f := &features[i]
+		if k := f.key(); m[k] == nil || m[k].String() > f.String() {
+			m[k] = f
+		}
+	}
+	return m
+}
+
+// implementable reports whether the type feature text is an interface
+// without unexported methods.
+func implementable(text string) bool {
+	return strings.Contains(text, " interface {") && !strings.HasSuffix(text, "unexported methods }")
+}
+
+// compatibleChange reports whether changing the feature old into new is
+// compatible.
+func compatibleChange(old, new string) bool {
+	if strings.HasPrefix(old, "method (*") && strings.HasPrefix(new, "method (") {
+		// (*T) → (T): the method set of *T is unchanged and grows for T
+		return "method ("+old[len("method (*"):] == new
+	}
+	if strings.Contains(old, " interface {") && strings.Contains(new, " interface {") {
+		return implementable(old) == implementable(new) || !implementable(old)
+	}
+	return false
+}
+
+// WriteText writes the changes to w, the incompatible ones first:
+//
+//	Incompatible changes:
+//	- pkg p, func F(int): changed to func F(int64)
+//	Compatible changes:
+//	- pkg p, func G(): added
+//
+// A section without changes is omitted.
+func WriteText(w io.Writer, changes []*Change) error {
+	bw := bufio.NewWriter(w)
+	for _, compatible := range []bool{false, true} {
+		header := "Incompatible changes:"
+		if compatible {
+			header = "Compatible changes:"
+		}
+		for _, c := range changes {
+			if c.Compatible != compatible {
+				continue
+			}
+			if header != "" {
+				fmt.Fprintln(bw, header)
+				header = ""
+			}
+			fmt.Fprintf(bw, "- %s\n", c)
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"bytes"
+	"go/ast"
+	"strings"
+)
+
+// A printer writes the types and constant expressions of features in a
+// compact form: parameter names are omitted, imported packages are named
+// by the last element of their import path and function literals and
+// the elements of composite literals are elided.
+type printer struct {
+	imports map[string]string // last element of the import path, by local name
+	iota    string            // value of iota in a constant declaration, or ""
+}
+
+func (p *printer) expr(x ast.Expr) string {
+	var buf bytes.Buffer
+	p.writeExpr(&buf, x)
+	return buf.String()
+}
+
+// signature returns the parameters and results of t, e.g. "(int, ...string) error".
+func (p *printer) signature(t *ast.FuncType) string {
+	var buf bytes.Buffer
+	p.writeSignature(&buf, t)
+	return buf.String()
+}
+
+func (p *printer) writeSignature(buf *bytes.Buffer, t *ast.FuncType) {
+	p.writeFields(buf, "(", t.Params, ", ", ")")
+	if t.Results == nil || len(t.Results.List) == 0 {
+		return
+	}
+	buf.WriteByte(' ')
+	if len(t.Results.List) == 1 && len(t.Results.List[0].Names) <= 1 {
+		p.writeExpr(buf, t.Results.List[0].Type)
+		return
+	}
+	p.writeFields(buf, "(", t.Results, ", ", ")")
+}
+
+// writeFields writes the types of the fields of list, once per name,
+// between open and close.
+func (p *printer) writeFields(buf *bytes.Buffer, open string, list *ast.FieldList, sep, close string) {
+	buf.WriteString(open)
+	if list != nil {
+		i := 0
+		for _, field := range list.List {
+			n := len(field.Names)
+			if n == 0 {
+				n = 1
+			}
+			for j := 0; j < n; j++ {
+				if i > 0 {
+					buf.WriteString(sep)
+				}
+				p.writeExpr(buf, field.Type)
+				i++
+			}
+		}
+	}
+	buf.WriteString(close)
+}
+
+func (p *printer) writeExpr(buf *bytes.Buffer, x ast.Expr) {
+	switch x := x.(type) {
+	case *ast.Ident:
+		if x.Name == "iota" && p.iota != "" {
+			buf.WriteString(p.iota)
+		} else {
+			buf.WriteString(x.Name)
+		}
+
+	case *ast.BasicLit:
+		buf.WriteString(x.Value)
+
+	case *ast.SelectorExpr:
+		if pkg, ok := x.X.(*ast.Ident); ok && p.imports[pkg.Name] != "" {
+			buf.WriteString(p.imports[pkg.Name])
+		} else {
+			p.writeExpr(buf, x.X)
+		}
+		buf.WriteByte('.')
+		buf.WriteString(x.Sel.Name)
+
+	case *ast.StarExpr:
+		buf.WriteByte('*')
+		p.writeExpr(buf, x.X)
+
+	case *ast.ParenExpr:
+		buf.WriteByte('(')
+		p.writeExpr(buf, x.X)
+		buf.WriteByte(')')
+
+	case *ast.UnaryExpr:
+		buf.WriteString(x.Op.String())
+		p.writeExpr(buf, x.X)
+
+	case *ast.BinaryExpr:
+		p.writeExpr(buf, x.X)
+		buf.WriteString(" " + x.Op.String() + " ")
+		p.writeExpr(buf, x.Y)
+
+	case *ast.CallExpr:
+		p.writeExpr(buf, x.Fun)
+		buf.WriteByte('(')
+		for i, arg := range x.Args {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			p.writeExpr(buf, arg)
+		}
+		if x.Ellipsis.IsValid() {
+			buf.WriteString("...")
+		}
+		buf.WriteByte(')')
+
+	case *ast.IndexExpr:
+		p.writeExpr(buf, x.X)
+		buf.WriteByte('[')
+		p.writeExpr(buf, x.Index)
+		buf.WriteByte(']')
+
+	case *ast.SliceExpr:
+		p.writeExpr(buf, x.X)
+		buf.WriteByte('[')
+		for i, y := range []ast.Expr{x.Low, x.High, x.Max} {
+			if i > 0 && (i < 2 || x.Slice3) {
+				buf.WriteByte(':')
+			}
+			if y != nil {
+				p.writeExpr(buf, y)
+			}
+		}
+		buf.WriteByte(']')
+
+	case *ast.TypeAssertExpr:
+		p.writeExpr(buf, x.X)
+		buf.WriteString(".(")
+		p.writeExpr(buf, x.Type)
+		buf.WriteByte(')')
+
+	case *ast.CompositeLit:
+		if x.Type != nil {
+			p.writeExpr(buf, x.Type)
+		}
+		buf.WriteString("{…}")
+
+	case *ast.FuncLit:
+		buf.WriteString("func")
+		p.writeSignature(buf, x.Type)
+		buf.WriteString(" {…}")
+
+	case *ast.KeyValueExpr:
+		p.writeExpr(buf, x.Key)
+		buf.WriteString(": ")
+		p.writeExpr(buf, x.Value)
+
+	case *ast.Ellipsis:
+		buf.WriteString("...")
+		if x.Elt != nil {
+			p.writeExpr(buf, x.Elt)
+		}
+
+	case *ast.ArrayType:
+		buf.WriteByte('[')
+		if x.Len != nil {
+			p.writeExpr(buf, x.Len)
+		}
+		buf.WriteByte(']')
+		p.writeExpr(buf, x.Elt)
+
+	case *ast.MapType:
+		buf.WriteString("map[")
+		p.writeExpr(buf, x.Key)
+		buf.WriteByte(']')
+		p.writeExpr(buf, x.Value)
+
+	case *ast.ChanType:
+		switch x.Dir {
+		case ast.SEND:
+			buf.WriteString("chan<- ")
+		case ast.RECV:
+			buf.WriteString("<-chan ")
+		default:
+			buf.WriteString("chan ")
+		}
+		p.writeExpr(buf, x.Value)
+
+	case *ast.FuncType:
+		buf.WriteString("func")
+		p.writeSignature(buf, x)
+
+	case *ast.StructType:
+		// unexported fields are part of the type, since they make it
+		// a different type
+		var fields []string
+		for _, field := range x.Fields.List {
+			typ := p.expr(field.Type)
+			if len(field.Names) == 0 {
+				fields = append(fields, typ)
+			}
+			for _, name := range field.Names {
+				fields = append(fields, name.Name+" "+typ)
+			}
+		}
+		if len(fields) == 0 {
+			buf.WriteString("struct{}")
+		} else {
+			buf.WriteString("struct{ " + strings.Join(fields, "; ") + " }")
+		}
+
+	case *ast.InterfaceType:
+		var methods []string
+		for _, m := range x.Methods.List {
+			if len(m.Names) == 0 {
+				methods = append(methods, p.expr(m.Type))
+				continue
+			}
+			if ft, ok := m.Type.(*ast.FuncType); ok {
+				methods = append(methods, m.Names[0].Name+p.signature(ft))
+			}
+		}
+		if len(methods) == 0 {
+			buf.WriteString("interface{}")
+		} else {
+			buf.WriteString("interface{ " + strings.Join(methods, "; ") + " }")
+		}
+
+	default:
+		buf.WriteString("?")
+	}
+}
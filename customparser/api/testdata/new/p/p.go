@@ -0,0 +1,57 @@
+package p
+
+import (
+	"errors"
+	"io"
+)
+
+type Kind int
+
+const (
+	A Kind = iota
+	B
+	C
+	D = "d"
+)
+
+var (
+	ErrX    = errors.New("x")
+	Default = &Options{}
+	Count   int64
+	Limit   = compute()
+)
+
+type Options struct {
+	Name    string
+	Verbose bool
+	hidden  int
+	Base
+	Timeout int
+}
+
+type Base struct{}
+
+func (Base) Reset() {}
+
+func (o *Options) Apply(w io.Writer, args ...string) (n int, err error) { return 0, nil }
+
+func (o *Options) String() string { return o.Name }
+
+type Reader interface {
+	Read(p []byte) (int, error)
+	Close() error
+}
+
+type Sealed interface {
+	Name() string
+	Kind() Kind
+	sealed()
+}
+
+type Handler func(string, int) error
+
+func New(name string, opts ...Options) *Options { return &Options{Name: name} }
+
+func Added() {}
+
+func compute() int { return 1 }
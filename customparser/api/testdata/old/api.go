@@ -0,0 +1,5 @@
+// Package api is the root package of the test tree.
+package api
+
+// Version is the version of the tree.
+const Version = "1.0"
@@ -0,0 +1,56 @@
+package p
+
+import (
+	"errors"
+	stdio "io"
+)
+
+type Kind int
+
+const (
+	A Kind = iota
+	B
+	c
+	D = "d"
+)
+
+var (
+	ErrX    = errors.New("x")
+	Default = &Options{}
+	Count   int
+	Limit   = compute()
+)
+
+type Options struct {
+	Name    string
+	Verbose bool
+	hidden  int
+	Base
+}
+
+type Base struct{}
+
+func (*Base) Reset() {}
+
+func (o *Options) Apply(w stdio.Writer, args ...string) (n int, err error) { return 0, nil }
+
+func (o Options) String() string { return o.Name }
+
+type Reader interface {
+	Read(p []byte) (int, error)
+}
+
+type Sealed interface {
+	Name() string
+	sealed()
+}
+
+type Handler func(string) error
+
+func New(name string) *Options { return &Options{Name: name} }
+
+func Old() {}
+
+func compute() int { return 1 }
+
+func (o *Options) internal() {}
@@ -0,0 +1,412 @@
+// Package astdiff computes structural differences between two versions
+// of a Go source file parsed with
+// github.com/yunabe/golang-codelab/customparser/parser.
+//
+// Rather than comparing lines, Diff matches the top-level declarations
+// of the two files by name (and by receiver base type for methods) and
+// reports the declarations that were added, removed, moved or modified,
+// the functions whose signature changed, and the imports that were
+// added, removed or renamed. Declarations are compared structurally:
+// formatting, positions and comments are ignored.
+package astdiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"reflect"
+	"strconv"
+
+	"github.com/yunabe/golang-codelab/customparser/format"
+)
+
+// A Kind describes a change.
+type Kind int
+
+const (
+	Added            Kind = iota // declaration or import only in the new file
+	Removed                      // declaration or import only in the old file
+	Moved                        // declaration at a different place among the declarations
+	Modified                     // declaration changed, or import renamed
+	SignatureChanged             // function signature (receiver, parameters or results) changed
+)
+
+var kindStrings = [...]string{
+	Added:            "added",
+	Removed:          "removed",
+	Moved:            "moved",
+	Modified:         "modified",
+	SignatureChanged: "signature",
+}
+
+func (k Kind) String() string {
+	if 0 <= k && int(k) < len(kindStrings) {
+		return kindStrings[k]
+	}
+	return "Kind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// A Change is a difference between the old and the new file.
+type Change struct {
+	Kind Kind
+
+	// Name identifies the declaration or import, e.g. "func F",
+	// "func T.M" for a method of T or *T, "type T", "var x", "const c"
+	// or `import "fmt"`.
+	Name string
+
+	// Old and New are the positions of the declared name (or import
+	// path) in the old and new file; Old is invalid for additions and
+	// New for removals.
+	Old, New token.Position
+
+	// For SignatureChanged, OldText and NewText are the old and new
+	// signatures; for renamed imports, the old and new import specs.
+	OldText, NewText string
+}
+
+// A decl is a top-level declaration or import of a file.
+type decl struct {
+	name  string
+	pos   token.Pos
+	nodes []interface{} // compared structurally
+	fn    *ast.FuncDecl // function declaration, or nil
+}
+
+// Diff returns the changes from the file old to the file new, both
+// parsed with the file set fset. Changes to imports come first, followed
+// by removed declarations in the order of the old file and the other
+// changes in the order of the new file. A declaration that is both
+// moved and modified is reported twice.
+//
+// Declarations occurring more than once under the same name, such as
+// init functions, are matched in order.
+func Diff(fset *token.FileSet, old, new *ast.File) []*Change {
+	var changes []*Change
+	changes = append(changes, diff(fset, imports(old), imports(new), false)...)
+	changes = append(changes, diff(fset, decls(old), decls(new), true)...)
+	return changes
+}
+
+func diff(fset *token.FileSet, old, new []*decl, order bool) []*Change {
+	change := func(kind Kind, o, n *decl) *Change {
+		c := &Change{Kind: kind}
+		if o != nil {
+			c.Name = o.name
+			c.Old = fset.Position(o.pos)
+		}
+		if n != nil {
+			c.Name = n.name
+			c.New = fset.Position(n.pos)
+		}
+		return c
+	}
+
+	oldIndex := make(map[string]int)
+	for i, d := range old {
+		oldIndex[d.name] = i
+	}
+	matched := make([]bool, len(old))
+	var pairs [][2]int // indices of matched old and new declarations
+	for j, d := range new {
+		if i, ok := oldIndex[d.name]; ok {
+			matched[i] = true
+			pairs = append(pairs, [2]int{i, j})
+		}
+	}
+
+	var changes []*Change
+	for i, d := range old {
+		if !matched[i] {
+			changes = append(changes, change(Removed, d, nil))
+		}
+	}
+	var moved map[int]bool
+	if order {
+		moved = movedPairs(pairs)
+	}
+	p := 0
+	for j, n := range new {
+		if p == len(pairs) || pairs[p][1] != j {
+			changes = append(changes, change(Added, nil, n))
+			continue
+		}
+		o := old[pairs[p][0]]
+		if moved[p] {
+			changes = append(changes, change(Moved, o, n))
+		}
+		p++
+		switch {
+		case o.fn != nil && n.fn != nil && !equal(signature(o.fn), signature(n.fn)):
+			c := change(SignatureChanged, o, n)
+			c.OldText = nodeText(fset, signature(o.fn))
+			c.NewText = nodeText(fset, signature(n.fn))
+			changes = append(changes, c)
+		case !equal(o.nodes, n.nodes):
+			c := change(Modified, o, n)
+			if spec, ok := o.nodes[0].(*ast.ImportSpec); ok {
+				c.OldText = nodeText(fset, spec)
+				c.NewText = nodeText(fset, n.nodes[0].(*ast.ImportSpec))
+			}
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// movedPairs returns the indices of the pairs of matched declarations
+// that moved: the pairs are in the order of the new file, and the
+// declarations that did not move are those of a longest subsequence of
+// pairs in the order of the old file.
+func movedPairs(pairs [][2]int) map[int]bool {
+	// longest increasing subsequence of the old indices
+	n := len(pairs)
+	length := make([]int, n)
+	prev := make([]int, n)
+	best := -1
+	for j := range pairs {
+		length[j], prev[j] = 1, -1
+		for i := 0; i < j; i++ {
+			if pairs[i][0] < pairs[j][0] && length[i]+1 > length[j] {
+				length[j], prev[j] = length[i]+1, i
+			}
+		}
+		if best < 0 || length[j] > length[best] {
+			best = j
+		}
+	}
+	moved := make(map[int]bool)
+	for j := range pairs {
+		moved[j] = true
+	}
+	for j := best; j >= 0; j = prev[j] {
+		delete(moved, j)
+	}
+	return moved
+}
+
+// imports returns the imports of f, named by their path.
+func imports(f *ast.File) []*decl {
+	var list []*decl
+	for _, spec := range f.Imports {
+		if spec.Path == nil {
+			continue
+		}
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		list = append(list, &decl{name: "import " + strconv.Quote(path), pos: spec.Path.Pos(), nodes: []interface{}{spec}})
+	}
+	return uniqueNames(list)
+}
+
+// decls returns the top-level declarations of f other than imports.
+func decls(f *ast.File) []*decl {
+	var list []*decl
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if d.Name == nil {
+				continue
+			}
+			name := "func " + d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				name = "func " + recvBaseName(d.Recv.List[0].Type) + "." + d.Name.Name
+			}
+			list = append(list, &decl{name: name, pos: d.Name.Pos(), nodes: []interface{}{d}, fn: d})
+
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					list = append(list, &decl{name: "type " + spec.Name.Name, pos: spec.Name.Pos(), nodes: []interface{}{spec}})
+				case *ast.ValueSpec:
+					for i, name := range spec.Names {
+						// compare the type and the value of each name
+						// (or all values for a multi-value expression)
+						nodes := []interface{}{name, spec.Type}
+						if len(spec.Values) == len(spec.Names) {
+							nodes = append(nodes, spec.Values[i])
+						} else {
+							nodes = append(nodes, spec.Values)
+						}
+						list = append(list, &decl{name: d.Tok.String() + " " + name.Name, pos: name.Pos(), nodes: nodes})
+					}
+				}
+			}
+		}
+	}
+	return uniqueNames(list)
+}
+
+// uniqueNames numbers repeated names, as in "func init#2", so that
+// repeated declarations are matched in order.
+func uniqueNames(list []*decl) []*decl {
+	count := make(map[string]int)
+	for _, d := range list {
+		count[d.name]++
+		if n := count[d.name]; n > 1 {
+			d.name += "#" + strconv.Itoa(n)
+		}
+	}
+	return list
+}
+
+// recvBaseName returns the base type name of a receiver type, e.g. "T"
+// for *T or T[P].
+func recvBaseName(x ast.Expr) string {
+	for {
+		switch t := x.(type) {
+		case *ast.Ident:
+			return t.Name
+		case *ast.StarExpr:
+			x = t.X
+		case *ast.ParenExpr:
+			x = t.X
+		case *ast.IndexExpr:
+			x = t.X
+		default:
+			return "_"
+		}
+	}
+}
+
+// signature returns fn without its doc comment and body.
+func signature(fn *ast.FuncDecl) *ast.FuncDecl {
+	sig := *fn
+	sig.Doc = nil
+	sig.Body = nil
+	return &sig
+}
+
+func nodeText(fset *token.FileSet, node ast.Node) string {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, node); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+var (
+	posType     = reflect.TypeOf(token.NoPos)
+	objectType  = reflect.TypeOf((*ast.Object)(nil))
+	scopeType   = reflect.TypeOf((*ast.Scope)(nil))
+	commentType = reflect.TypeOf((*ast.CommentGroup)(nil))
+)
+
+// equal reports whether x and y are structurally equal, ignoring
+// positions, comments and the objects and scopes of the parser's
+// identifier resolution.
+func equal(x, y interface{}) bool {
+	return equalValue(reflect.ValueOf(x), reflect.ValueOf(y))
+}
+
+func equalValue(x, y reflect.Value) bool {
+	if x.IsValid() != y.IsValid() {
+		return false
+	}
+	if !x.IsValid() {
+		return true
+	}
+	if x.Type() != y.Type() {
+		return false
+	}
+	switch x.Type() {
+	case posType, objectType, scopeType, commentType:
+		return true
+	}
+	switch x.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if x.IsNil() || y.IsNil() {
+			return x.IsNil() == y.IsNil()
+		}
+		return equalValue(x.Elem(), y.Elem())
+	case reflect.Slice:
+		if x.Len() != y.Len() {
+			return false
+		}
+		for i := 0; i < x.Len(); i++ {
+			if !equalValue(x.Index(i), y.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := 0; i < x.NumField(); i++ {
+			if !equalValue(x.Field(i), y.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return x.Interface() == y.Interface()
+}
+
+// ----------------------------------------------------------------------------
+// Reports
+
+// WriteText writes changes to w, one per line in the form
+//
+//	kind name old -> new
+//
+// where old and new are the positions in the old and new file (only one
+// of them for additions and removals). Changed signatures and renamed
+// imports are followed by the old and new text on lines starting with a
+// tab and "-" or "+".
+func WriteText(w io.Writer, changes []*Change) error {
+	var buf bytes.Buffer
+	for _, c := range changes {
+		fmt.Fprintf(&buf, "%-9s %s ", c.Kind, c.Name)
+		switch {
+		case !c.New.IsValid():
+			fmt.Fprintf(&buf, "%s\n", c.Old)
+		case !c.Old.IsValid():
+			fmt.Fprintf(&buf, "%s\n", c.New)
+		default:
+			fmt.Fprintf(&buf, "%s -> %s\n", c.Old, c.New)
+		}
+		if c.OldText != "" || c.NewText != "" {
+			fmt.Fprintf(&buf, "\t- %s\n\t+ %s\n", c.OldText, c.NewText)
+		}
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// A jsonChange is the JSON representation of a Change.
+type jsonChange struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Old     string `json:"old,omitempty"`
+	New     string `json:"new,omitempty"`
+	OldText string `json:"oldText,omitempty"`
+	NewText string `json:"newText,omitempty"`
+}
+
+// WriteJSON writes changes to w as an indented JSON array of objects
+// with the members "kind", "name", "old" and "new" (positions in
+// file:line:col form) and "oldText" and "newText". Empty members are
+// omitted.
+func WriteJSON(w io.Writer, changes []*Change) error {
+	list := make([]jsonChange, len(changes))
+	for i, c := range changes {
+		list[i] = jsonChange{Kind: c.Kind.String(), Name: c.Name, OldText: c.OldText, NewText: c.NewText}
+		if c.Old.IsValid() {
+			list[i].Old = c.Old.String()
+		}
+		if c.New.IsValid() {
+			list[i].New = c.New.String()
+		}
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = w.Write(data)
+	return err
+}
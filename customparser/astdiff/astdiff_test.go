@@ -0,0 +1,148 @@
+package astdiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yunabe/golang-codelab/customparser/parser"
+)
+
+const oldSrc = `package p
+
+import (
+	"fmt"
+	"os"
+	str "strings"
+)
+
+// T is a type.
+type T struct{ x int }
+
+func (t *T) M(x int) int { return x }
+
+func (t T) Unchanged() {}
+
+const (
+	A = 1
+	B = 2
+)
+
+var x, y = 1, 2
+
+func F() { fmt.Println(os.Args) }
+
+func G() {}
+
+func init() {}
+
+func init() { println(1) }
+
+func Removed() {}
+`
+
+const newSrc = `package p
+
+import (
+	"fmt"
+	"io"
+	strs "strings"
+)
+
+// T is a type
+// with a reformatted doc comment.
+type T struct {
+	x int
+}
+
+func (t *T) M(x, y int) int { return x }
+
+func (t T) Unchanged() {
+	// a comment
+}
+
+func G() {}
+
+const (
+	A = 1
+	B = 3
+)
+
+var x, y = 1, 20
+
+func F() { fmt.Println(io.EOF) }
+
+func init() {}
+
+func init() { println(2) }
+
+func Added() {}
+`
+
+func parse(t *testing.T, fset *token.FileSet, filename, src string) *ast.File {
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestDiff(t *testing.T) {
+	fset := token.NewFileSet()
+	changes := Diff(fset, parse(t, fset, "old.go", oldSrc), parse(t, fset, "new.go", newSrc))
+	var buf bytes.Buffer
+	if err := WriteText(&buf, changes); err != nil {
+		t.Fatal(err)
+	}
+	want := `removed   import "os" old.go:5:2
+added     import "io" new.go:5:2
+modified  import "strings" old.go:6:6 -> new.go:6:7
+	- str "strings"
+	+ strs "strings"
+removed   func Removed old.go:31:6
+signature func T.M old.go:12:13 -> new.go:15:13
+	- func (t *T) M(x int) int
+	+ func (t *T) M(x, y int) int
+moved     func G old.go:25:6 -> new.go:21:6
+modified  const B old.go:18:2 -> new.go:25:2
+modified  var y old.go:21:8 -> new.go:28:8
+modified  func F old.go:23:6 -> new.go:30:6
+modified  func init#2 old.go:29:6 -> new.go:34:6
+added     func Added new.go:36:6
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDiffUnchanged(t *testing.T) {
+	fset := token.NewFileSet()
+	reformatted := strings.Replace(oldSrc, "type T struct{ x int }", "type T struct {\n\tx int // x\n}", 1)
+	if changes := Diff(fset, parse(t, fset, "old.go", oldSrc), parse(t, fset, "new.go", reformatted)); len(changes) != 0 {
+		t.Errorf("got %d changes for a reformatted file; want none", len(changes))
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	fset := token.NewFileSet()
+	changes := Diff(fset, parse(t, fset, "old.go", "package p\nfunc F() {}\n"), parse(t, fset, "new.go", "package p\nfunc F(int) {}\nvar v int\n"))
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, changes); err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	want := []map[string]string{
+		{"kind": "signature", "name": "func F", "old": "old.go:2:6", "new": "new.go:2:6", "oldText": "func F()", "newText": "func F(int)"},
+		{"kind": "added", "name": "var v", "new": "new.go:3:5"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+}
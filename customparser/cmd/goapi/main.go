@@ -0,0 +1,104 @@
+// Command goapi prints the exported API of the Go packages of a
+// directory tree, and checks two versions of it for incompatible
+// changes, using github.com/yunabe/golang-codelab/customparser/api.
+//
+// Usage:
+//
+//	goapi [flags] dir
+//	goapi [flags] old new
+//
+// With one argument, goapi prints the API of the packages in the
+// directory tree dir, one feature per line. With two, it compares the
+// APIs of old and new, each a directory tree or a file written by goapi,
+// and prints the incompatible and the compatible changes. Test files,
+// main packages and the directories named testdata are skipped; the
+// packages are named by their directory relative to the root of the
+// tree. The exit status is 1 if there are incompatible changes and 2 if
+// the command could not run.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/yunabe/golang-codelab/customparser/api"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command with the given arguments and returns the
+// exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("goapi", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	incompatible := flags.Bool("incompatible", false, "print the incompatible changes only")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: goapi [flags] dir\n       goapi [flags] old new\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		return 2
+	}
+
+	var apis [][]api.Feature
+	for _, path := range flags.Args() {
+		features, err := load(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "goapi: %v\n", err)
+			return 2
+		}
+		apis = append(apis, features)
+	}
+	if len(apis) == 1 {
+		if err := api.Write(stdout, apis[0]); err != nil {
+			fmt.Fprintf(stderr, "goapi: %v\n", err)
+			return 2
+		}
+		return 0
+	}
+
+	status := 0
+	var changes []*api.Change
+	for _, c := range api.Compare(apis[0], apis[1]) {
+		if !c.Compatible {
+			status = 1
+		} else if *incompatible {
+			continue
+		}
+		changes = append(changes, c)
+	}
+	if err := api.WriteText(stdout, changes); err != nil {
+		fmt.Fprintf(stderr, "goapi: %v\n", err)
+		return 2
+	}
+	return status
+}
+
+// load returns the API of the directory tree or the API file path.
+func load(path string) ([]api.Feature, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return api.Dir(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	features, err := api.Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return features, nil
+}
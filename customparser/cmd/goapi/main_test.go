@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	oldDir = "../../api/testdata/old"
+	newDir = "../../api/testdata/new"
+)
+
+func runGoapi(args ...string) (status int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	status = run(args, strings.NewReader(""), &out, &errOut)
+	return status, out.String(), errOut.String()
+}
+
+func TestPrint(t *testing.T) {
+	status, out, errOut := runGoapi(oldDir)
+	if status != 0 || errOut != "" {
+		t.Fatalf("got status %d, stderr %q", status, errOut)
+	}
+	if !strings.HasPrefix(out, `pkg ., const Version = "1.0"`+"\n") || !strings.Contains(out, "pkg p, func Old()\n") {
+		t.Errorf("got API\n%s", out)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	status, out, _ := runGoapi(oldDir, newDir)
+	if status != 1 || !strings.Contains(out, "Incompatible changes:\n- pkg ., const Version") || !strings.Contains(out, "Compatible changes:\n") {
+		t.Errorf("got status %d, output\n%s", status, out)
+	}
+	status, out, _ = runGoapi("-incompatible", oldDir, newDir)
+	if status != 1 || strings.Contains(out, "Compatible changes:") {
+		t.Errorf("-incompatible: got status %d, output\n%s", status, out)
+	}
+	if status, out, _ = runGoapi(newDir, newDir); status != 0 || out != "" {
+		t.Errorf("identical trees: got status %d, output %q", status, out)
+	}
+
+	// an API file against a tree
+	dir, err := ioutil.TempDir("", "goapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	_, api, _ := runGoapi(oldDir)
+	file := filepath.Join(dir, "api.txt")
+	if err := ioutil.WriteFile(file, []byte(api), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if status, out, _ := runGoapi(file, oldDir); status != 0 || out != "" {
+		t.Errorf("API file: got status %d, output %q", status, out)
+	}
+	status, out, _ = runGoapi(file, newDir)
+	if want := "- pkg p, func Old(): removed\n"; status != 1 || !strings.Contains(out, want) {
+		t.Errorf("API file: got status %d, output\n%s\nwant %q", status, out, want)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, args := range [][]string{{}, {"a", "b", "c"}, {"-unknown", "x"}, {"nonexistent"}} {
+		if status, _, errOut := runGoapi(args...); status != 2 || errOut == "" {
+			t.Errorf("%q: got status %d, stderr %q; want 2 and an error", args, status, errOut)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Command godocslint checks the Go code blocks of Markdown documents for
+// syntax errors, using
+// github.com/yunabe/golang-codelab/customparser/markdown.
+//
+// Usage:
+//
+//	godocslint [flags] [path ...]
+//
+// Paths may be files or directories; directories are walked for .md
+// files, skipping directories whose name starts with a dot. If no paths
+// are given, a document is read from standard input. Each fenced code
+// block marked as go (```go) is parsed as a source file, a list of
+// declarations or a list of statements, whichever fits, and its syntax
+// errors are printed in file:line:col form, with the line of the
+// Markdown document. The exit status is 1 if any code block contains
+// syntax errors and 2 if the command could not run.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yunabe/golang-codelab/customparser/markdown"
+	"github.com/yunabe/golang-codelab/customparser/parser"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command with the given arguments and returns the
+// exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("godocslint", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var (
+		allErrors = flags.Bool("all", false, "report all errors, not just the first 10 on different lines of a block")
+		verbose   = flags.Bool("v", false, "print each code block and how it was parsed")
+	)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: godocslint [flags] [path ...]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	c := &command{verbose: *verbose, stdout: stdout}
+	if *allErrors {
+		c.mode = parser.AllErrors
+	}
+	if flags.NArg() == 0 {
+		src, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "godocslint: %v\n", err)
+			return 2
+		}
+		c.check("<stdin>", src)
+		return c.status
+	}
+	for _, path := range flags.Args() {
+		err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if name := info.Name(); len(name) > 1 && strings.HasPrefix(name, ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !strings.HasSuffix(path, ".md") {
+				return nil
+			}
+			src, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			c.check(path, src)
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(stderr, "godocslint: %v\n", err)
+			return 2
+		}
+	}
+	return c.status
+}
+
+type command struct {
+	mode    parser.Mode
+	verbose bool
+	stdout  io.Writer
+	status  int
+}
+
+// check parses the code blocks of the document filename with contents
+// src and prints their errors.
+func (c *command) check(filename string, src []byte) {
+	fset := token.NewFileSet()
+	snippets, err := markdown.ParseFile(fset, filename, src, c.mode)
+	if c.verbose {
+		for _, s := range snippets {
+			fmt.Fprintf(c.stdout, "%s:%d: %s\n", filename, s.Block.Line, s.Kind)
+		}
+	}
+	if list, ok := err.(scanner.ErrorList); ok {
+		for _, e := range list {
+			fmt.Fprintln(c.stdout, e)
+		}
+		c.status = 1
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const goodDoc = "# Good\n\n```go\nfmt.Println(1)\n```\n"
+
+const badDoc = "# Bad\n\n```go\nfunc f() {\n\treturn 1 +\n}\n```\n\n```shell\nls (\n```\n"
+
+func runGodocslint(stdin string, args ...string) (status int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	status = run(args, strings.NewReader(stdin), &out, &errOut)
+	return status, out.String(), errOut.String()
+}
+
+func TestStdin(t *testing.T) {
+	if status, out, errOut := runGodocslint(goodDoc); status != 0 || out != "" || errOut != "" {
+		t.Errorf("got status %d, output %q, stderr %q; want 0 and no output", status, out, errOut)
+	}
+	status, out, _ := runGodocslint(badDoc)
+	if want := "<stdin>:6:1: expected operand, found '}'\n"; status != 1 || out != want {
+		t.Errorf("got status %d, output %q; want 1, %q", status, out, want)
+	}
+	_, out, _ = runGodocslint(goodDoc, "-v")
+	if want := "<stdin>:4: statements\n"; out != want {
+		t.Errorf("-v: got %q; want %q", out, want)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godocslint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"README.md":          goodDoc,
+		"docs/bad.md":        badDoc,
+		"docs/notes.txt":     badDoc,
+		".hidden/ignored.md": badDoc,
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status, out, _ := runGodocslint("", dir)
+	bad := filepath.Join(dir, "docs", "bad.md")
+	if want := bad + ":6:1: expected operand, found '}'\n"; status != 1 || out != want {
+		t.Errorf("got status %d, output %q; want 1, %q", status, out, want)
+	}
+	if status, _, _ := runGodocslint("", filepath.Join(dir, "README.md")); status != 0 {
+		t.Errorf("README.md: got status %d; want 0", status)
+	}
+	if status, _, _ := runGodocslint("", filepath.Join(dir, "missing.md")); status != 2 {
+		t.Errorf("missing file: got status %d; want 2", status)
+	}
+}
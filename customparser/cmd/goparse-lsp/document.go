@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yunabe/golang-codelab/customparser/parser"
+)
+
+// A document is an open text document together with its parse result.
+type document struct {
+	uri     string
+	version int
+	src     []byte
+	fset    *token.FileSet
+	file    *token.File
+	ast     *ast.File
+	errors  scanner.ErrorList
+}
+
+const parseMode = parser.ParseComments | parser.AllErrors
+
+func newDocument(uri string, version int, text string) *document {
+	d := &document{
+		uri:     uri,
+		version: version,
+		src:     []byte(text),
+		fset:    token.NewFileSet(),
+	}
+	f, err := parser.ParseFile(d.fset, uriFilename(uri), d.src, parseMode)
+	d.ast = f
+	if list, ok := err.(scanner.ErrorList); ok {
+		d.errors = list
+	}
+	d.fset.Iterate(func(f *token.File) bool {
+		d.file = f
+		return false
+	})
+	// the parser may have stopped before the end of the source
+	d.file.SetLinesForContent(d.src)
+	return d
+}
+
+// uriFilename returns the file name used in position information
+// for the document with the given URI.
+func uriFilename(uri string) string {
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		return u.Path
+	}
+	return uri
+}
+
+// applyChange returns the text resulting from applying change to text.
+func applyChange(text string, change TextDocumentContentChangeEvent) string {
+	if change.Range == nil {
+		return change.Text
+	}
+	start := offsetOf(text, change.Range.Start)
+	end := offsetOf(text, change.Range.End)
+	if end < start {
+		start, end = end, start
+	}
+	return text[:start] + change.Text + text[end:]
+}
+
+// offsetOf returns the byte offset of the LSP position p in text.
+// Positions past the end of a line or of the text are clamped.
+func offsetOf(text string, p Position) int {
+	offs := 0
+	for line := 0; line < p.Line; line++ {
+		i := strings.IndexByte(text[offs:], '\n')
+		if i < 0 {
+			return len(text)
+		}
+		offs += i + 1
+	}
+	return offs + characterOffset(text[offs:], p.Character)
+}
+
+// characterOffset returns the byte offset in the line starting text of
+// the LSP character offset n, clamped to the line.
+func characterOffset(text string, n int) int {
+	offs := 0
+	for i := 0; i < n && offs < len(text) && text[offs] != '\n'; {
+		r, size := utf8.DecodeRuneInString(text[offs:])
+		i += utf16Len(r)
+		offs += size
+	}
+	return offs
+}
+
+// utf16Len returns the number of UTF-16 code units encoding r.
+func utf16Len(r rune) int {
+	if r >= 0x10000 && r <= unicode.MaxRune {
+		return 2
+	}
+	return 1
+}
+
+// offsetPosition returns the LSP position of the byte offset offs.
+func (d *document) offsetPosition(offs int) Position {
+	if offs > len(d.src) {
+		offs = len(d.src)
+	}
+	if d.file.LineCount() == 0 {
+		return Position{} // empty source
+	}
+	line := d.file.Line(d.file.Pos(offs))
+	start := d.file.Offset(d.file.LineStart(line))
+	if i := bytes.IndexByte(d.src[start:offs], '\n'); i >= 0 {
+		// the empty line ending the source, which has no line start
+		line++
+		start += i + 1
+	}
+	character := 0
+	for b := d.src[start:offs]; len(b) > 0; {
+		r, size := utf8.DecodeRune(b)
+		character += utf16Len(r)
+		b = b[size:]
+	}
+	return Position{Line: line - 1, Character: character}
+}
+
+// position returns the LSP position of pos.
+func (d *document) position(pos token.Pos) Position {
+	return d.offsetPosition(d.offset(pos))
+}
+
+// offset returns the byte offset of pos, clamped to the document.
+func (d *document) offset(pos token.Pos) int {
+	base := d.file.Base()
+	switch {
+	case int(pos) < base:
+		return 0
+	case int(pos) > base+d.file.Size():
+		return d.file.Size()
+	}
+	return int(pos) - base
+}
+
+// nodeRange returns the LSP range covered by n.
+func (d *document) nodeRange(n ast.Node) Range {
+	return Range{Start: d.position(n.Pos()), End: d.position(n.End())}
+}
+
+// pos returns the token.Pos of the LSP position p, clamped to the
+// document.
+func (d *document) pos(p Position) token.Pos {
+	switch {
+	case p.Line < 0:
+		return d.file.Pos(0)
+	case p.Line >= d.file.LineCount():
+		return d.file.Pos(len(d.src))
+	}
+	start := d.file.Offset(d.file.LineStart(p.Line + 1))
+	end := len(d.src)
+	if p.Line+1 < d.file.LineCount() {
+		end = d.file.Offset(d.file.LineStart(p.Line + 2))
+	}
+	return d.file.Pos(start + characterOffset(string(d.src[start:end]), p.Character))
+}
+
+// diagnostics returns the syntax errors of d as LSP diagnostics.
+func (d *document) diagnostics() []Diagnostic {
+	diags := make([]Diagnostic, 0, len(d.errors))
+	for _, e := range d.errors {
+		start := e.Pos.Offset
+		end := start
+		if end < len(d.src) && d.src[end] != '\n' {
+			_, size := utf8.DecodeRune(d.src[end:])
+			end += size
+		}
+		diags = append(diags, Diagnostic{
+			Range:    Range{Start: d.offsetPosition(start), End: d.offsetPosition(end)},
+			Severity: severityError,
+			Source:   "goparse",
+			Message:  e.Msg,
+		})
+	}
+	return diags
+}
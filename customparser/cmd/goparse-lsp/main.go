@@ -0,0 +1,25 @@
+// Command goparse-lsp is a Language Server Protocol server for Go source
+// files built on github.com/yunabe/golang-codelab/customparser/parser.
+//
+// It communicates over stdin and stdout and provides syntax diagnostics
+// (on didOpen and didChange), document symbols, folding ranges and
+// selection ranges. It does not type-check and therefore works on a
+// single file at a time without any build configuration.
+//
+// Usage:
+//
+//	goparse-lsp
+package main
+
+import (
+	"log"
+	"os"
+)
+
+func main() {
+	log.SetPrefix("goparse-lsp: ")
+	log.SetFlags(0)
+	if err := newServer(os.Stdin, os.Stdout).run(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import "github.com/yunabe/golang-codelab/customparser/parser"
+
+// documentSymbols returns the outline of d as computed by parser.Symbols.
+func (d *document) documentSymbols() []DocumentSymbol {
+	return d.convertSymbols(parser.Symbols(d.ast), true)
+}
+
+var symbolKinds = map[parser.SymbolKind]int{
+	parser.ConstSymbol:     kindConstant,
+	parser.VarSymbol:       kindVariable,
+	parser.TypeSymbol:      kindClass,
+	parser.StructSymbol:    kindStruct,
+	parser.InterfaceSymbol: kindInterface,
+	parser.FuncSymbol:      kindFunction,
+	parser.MethodSymbol:    kindMethod,
+	parser.FieldSymbol:     kindField,
+}
+
+func (d *document) convertSymbols(syms []*parser.Symbol, topLevel bool) []DocumentSymbol {
+	list := []DocumentSymbol{}
+	for _, s := range syms {
+		sym := DocumentSymbol{
+			Name:           s.Name,
+			Detail:         s.Recv,
+			Kind:           symbolKinds[s.Kind],
+			Range:          Range{Start: d.position(s.Pos), End: d.position(s.End)},
+			SelectionRange: Range{Start: d.position(s.NamePos), End: d.position(s.NameEnd)},
+		}
+		if topLevel && s.Recv != "" {
+			// method of a type declared elsewhere
+			sym.Name = "(" + s.Recv + ")." + s.Name
+		}
+		if len(s.Children) > 0 {
+			sym.Children = d.convertSymbols(s.Children, false)
+		}
+		list = append(list, sym)
+	}
+	return list
+}
+
+// foldingRanges returns the foldable regions of d as computed by
+// parser.FoldingRanges.
+func (d *document) foldingRanges() []FoldingRange {
+	ranges := []FoldingRange{}
+	for _, r := range parser.FoldingRanges(d.fset, d.ast) {
+		fr := FoldingRange{StartLine: d.position(r.Pos).Line, EndLine: d.position(r.End).Line}
+		switch r.Kind {
+		case parser.FoldImports:
+			fr.Kind = "imports"
+		case parser.FoldComment:
+			fr.Kind = "comment"
+		}
+		ranges = append(ranges, fr)
+	}
+	return ranges
+}
+
+// selectionRange returns the chain of syntactic ranges enclosing p,
+// innermost first, as computed by parser.SelectionRanges. The outermost
+// range is the whole document.
+func (d *document) selectionRange(p Position) SelectionRange {
+	ranges := parser.SelectionRanges(d.fset, d.ast, d.pos(p))
+	sr := &SelectionRange{Range: Range{End: d.offsetPosition(len(d.src))}}
+	for i := len(ranges) - 1; i >= 0; i-- {
+		r := Range{Start: d.position(ranges[i].Pos), End: d.position(ranges[i].End)}
+		if r != sr.Range {
+			sr = &SelectionRange{Range: r, Parent: sr}
+		}
+	}
+	return *sr
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// A server is a Language Server Protocol server reading requests from
+// in and writing responses and notifications to out. Requests are
+// processed sequentially in the order they are received.
+type server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	initialized bool
+	shutdown    bool
+	docs        map[string]*document
+}
+
+func newServer(in io.Reader, out io.Writer) *server {
+	return &server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: make(map[string]*document),
+	}
+}
+
+// errExit is returned by run after an exit notification following
+// a shutdown request.
+var errExit = errors.New("exit")
+
+// run processes messages until the input is closed or an exit
+// notification is received. It returns nil on an orderly exit.
+func (s *server) run() error {
+	for {
+		msg, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.handle(msg); err == errExit {
+			if !s.shutdown {
+				return errors.New("exit without shutdown")
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// read reads one message in the base protocol framing:
+// a Content-Length header, an empty line, and a JSON body.
+func (s *server) read() (*message, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("reading header: %v", err)
+	}
+	n, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, fmt.Errorf("reading body: %v", err)
+	}
+	msg := new(message)
+	if err := json.Unmarshal(body, msg); err != nil {
+		// A malformed message has no usable id.
+		return &message{Method: "$/invalid"}, nil
+	}
+	return msg, nil
+}
+
+func (s *server) write(msg *message) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = s.out.Write(body)
+	return err
+}
+
+// null is used as the result of requests without a result value.
+var null = json.RawMessage("null")
+
+func (s *server) reply(id *json.RawMessage, result interface{}, rerr *responseError) error {
+	if id == nil {
+		return nil // notification
+	}
+	if result == nil && rerr == nil {
+		result = null
+	}
+	return s.write(&message{ID: id, Result: result, Error: rerr})
+}
+
+func (s *server) notify(method string, params interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	raw := json.RawMessage(data)
+	return s.write(&message{Method: method, Params: &raw})
+}
+
+func (s *server) handle(msg *message) error {
+	if msg.Method == "$/invalid" {
+		return s.write(&message{ID: &null, Error: &responseError{Code: codeParseError, Message: "invalid JSON"}})
+	}
+	if msg.Method == "exit" {
+		return errExit
+	}
+	if !s.initialized && msg.Method != "initialize" {
+		return s.reply(msg.ID, nil, &responseError{Code: codeServerNotInitialized, Message: "server not initialized"})
+	}
+	if s.shutdown && msg.ID != nil {
+		return s.reply(msg.ID, nil, &responseError{Code: codeInvalidRequest, Message: "server is shut down"})
+	}
+
+	result, rerr := s.dispatch(msg)
+	if uri, ok := result.(string); ok && uri != "" && rerr == nil && msg.ID == nil && strings.HasPrefix(msg.Method, "textDocument/did") {
+		return s.publishDiagnostics(msg.Method, uri)
+	}
+	return s.reply(msg.ID, result, rerr)
+}
+
+// dispatch calls the handler for msg. For the didOpen, didChange and
+// didClose notifications, the result is the affected URI; other
+// notifications have no result.
+func (s *server) dispatch(msg *message) (interface{}, *responseError) {
+	switch msg.Method {
+	case "initialize":
+		s.initialized = true
+		return &InitializeResult{
+			Capabilities: ServerCapabilities{
+				TextDocumentSync:       syncFull,
+				DocumentSymbolProvider: true,
+				FoldingRangeProvider:   true,
+				SelectionRangeProvider: true,
+			},
+			ServerInfo: ServerInfo{Name: "goparse-lsp"},
+		}, nil
+
+	case "initialized":
+		return nil, nil
+
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if rerr := unmarshalParams(msg, &params); rerr != nil {
+			return nil, rerr
+		}
+		doc := params.TextDocument
+		s.docs[doc.URI] = newDocument(doc.URI, doc.Version, doc.Text)
+		return doc.URI, nil
+
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if rerr := unmarshalParams(msg, &params); rerr != nil {
+			return nil, rerr
+		}
+		uri := params.TextDocument.URI
+		d := s.docs[uri]
+		if d == nil {
+			return nil, &responseError{Code: codeInvalidParams, Message: "document not open: " + uri}
+		}
+		text := string(d.src)
+		for _, change := range params.ContentChanges {
+			text = applyChange(text, change)
+		}
+		s.docs[uri] = newDocument(uri, params.TextDocument.Version, text)
+		return uri, nil
+
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if rerr := unmarshalParams(msg, &params); rerr != nil {
+			return nil, rerr
+		}
+		delete(s.docs, params.TextDocument.URI)
+		return params.TextDocument.URI, nil
+
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		d, rerr := s.document(msg, &params, &params.TextDocument)
+		if rerr != nil {
+			return nil, rerr
+		}
+		return d.documentSymbols(), nil
+
+	case "textDocument/foldingRange":
+		var params FoldingRangeParams
+		d, rerr := s.document(msg, &params, &params.TextDocument)
+		if rerr != nil {
+			return nil, rerr
+		}
+		return d.foldingRanges(), nil
+
+	case "textDocument/selectionRange":
+		var params SelectionRangeParams
+		d, rerr := s.document(msg, &params, &params.TextDocument)
+		if rerr != nil {
+			return nil, rerr
+		}
+		ranges := make([]SelectionRange, len(params.Positions))
+		for i, p := range params.Positions {
+			ranges[i] = d.selectionRange(p)
+		}
+		return ranges, nil
+	}
+
+	if msg.ID == nil {
+		return nil, nil // unknown notifications are ignored
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not supported: " + msg.Method}
+}
+
+// document decodes the parameters of msg into params and returns the
+// open document identified by id, which must be part of params.
+func (s *server) document(msg *message, params interface{}, id *TextDocumentIdentifier) (*document, *responseError) {
+	if rerr := unmarshalParams(msg, params); rerr != nil {
+		return nil, rerr
+	}
+	d := s.docs[id.URI]
+	if d == nil {
+		return nil, &responseError{Code: codeInvalidParams, Message: "document not open: " + id.URI}
+	}
+	return d, nil
+}
+
+func unmarshalParams(msg *message, params interface{}) *responseError {
+	if msg.Params == nil {
+		return &responseError{Code: codeInvalidParams, Message: "missing params"}
+	}
+	if err := json.Unmarshal(*msg.Params, params); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// publishDiagnostics sends the syntax errors of the document affected
+// by a didOpen, didChange or didClose notification.
+func (s *server) publishDiagnostics(method, uri string) error {
+	params := PublishDiagnosticsParams{URI: uri, Diagnostics: []Diagnostic{}}
+	if d := s.docs[uri]; d != nil && method != "textDocument/didClose" {
+		params.Version = d.version
+		params.Diagnostics = d.diagnostics()
+	}
+	return s.notify("textDocument/publishDiagnostics", params)
+}
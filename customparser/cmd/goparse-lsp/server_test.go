@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// A client is a scripted in-process LSP client talking to a server
+// running in a separate goroutine.
+type client struct {
+	t      *testing.T
+	w      io.WriteCloser
+	r      *bufio.Reader
+	nextID int
+	done   chan error
+
+	notifications []*message // received but not yet consumed
+}
+
+func newClient(t *testing.T) *client {
+	// the requests go through a buffered pipe, so that a message the
+	// server sends unexpectedly fails the test rather than deadlocks it
+	sr, cw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr, sw := io.Pipe()
+	c := &client{t: t, w: cw, r: bufio.NewReader(cr), done: make(chan error, 1)}
+	go func() {
+		err := newServer(sr, sw).run()
+		sw.Close()
+		sr.Close()
+		c.done <- err
+	}()
+	return c
+}
+
+func (c *client) send(msg *message) {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) read() *message {
+	header, err := textproto.NewReader(c.r).ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatalf("reading header: %v", err)
+	}
+	n, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		c.t.Fatal(err)
+	}
+	var msg message
+	var raw struct {
+		Result *json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		c.t.Fatal(err)
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		c.t.Fatal(err)
+	}
+	if raw.Result != nil {
+		msg.Result = raw.Result
+	}
+	return &msg
+}
+
+func rawParams(c *client, params interface{}) *json.RawMessage {
+	data, err := json.Marshal(params)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	raw := json.RawMessage(data)
+	return &raw
+}
+
+// call sends a request and decodes the result of the response into
+// result. It returns the response error, if any.
+func (c *client) call(method string, params, result interface{}) *responseError {
+	c.nextID++
+	id := json.RawMessage(strconv.Itoa(c.nextID))
+	c.send(&message{ID: &id, Method: method, Params: rawParams(c, params)})
+	for {
+		msg := c.read()
+		if msg.ID == nil {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+		if string(*msg.ID) != string(id) {
+			c.t.Fatalf("%s: got response for id %s; want %s", method, *msg.ID, id)
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result != nil {
+			if err := json.Unmarshal(*msg.Result.(*json.RawMessage), result); err != nil {
+				c.t.Fatalf("%s: decoding result: %v", method, err)
+			}
+		}
+		return nil
+	}
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.send(&message{Method: method, Params: rawParams(c, params)})
+}
+
+// diagnostics returns the next published diagnostics.
+func (c *client) diagnostics() PublishDiagnosticsParams {
+	var msg *message
+	if len(c.notifications) > 0 {
+		msg, c.notifications = c.notifications[0], c.notifications[1:]
+	} else {
+		msg = c.read()
+	}
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("got %s; want textDocument/publishDiagnostics", msg.Method)
+	}
+	var params PublishDiagnosticsParams
+	if err := json.Unmarshal(*msg.Params, &params); err != nil {
+		c.t.Fatal(err)
+	}
+	return params
+}
+
+func (c *client) exit() {
+	if rerr := c.call("shutdown", nil, nil); rerr != nil {
+		c.t.Fatalf("shutdown: %s", rerr.Message)
+	}
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		c.t.Fatalf("server exited with error: %v", err)
+	}
+	c.w.Close()
+}
+
+const uri = "file:///tmp/p.go"
+
+const src0 = `package p
+
+import (
+	"fmt"
+	"os"
+)
+
+// T is a type.
+type T struct {
+	x, y int
+	io.Reader
+}
+
+type I interface {
+	M() error
+}
+
+const c = 1
+
+var v = []int{
+	1,
+	2,
+}
+
+func (t *T) M() error {
+	fmt.Println(t.x + t.y)
+	return nil
+}
+
+func main() {
+	os.Exit(0)
+}
+
+func (s *S) M() {}
+`
+
+func initialize(t *testing.T) *client {
+	c := newClient(t)
+	var result InitializeResult
+	if rerr := c.call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}}, &result); rerr != nil {
+		t.Fatalf("initialize: %s", rerr.Message)
+	}
+	if result.Capabilities.TextDocumentSync != syncFull || !result.Capabilities.DocumentSymbolProvider {
+		t.Errorf("unexpected capabilities: %+v", result.Capabilities)
+	}
+	c.notify("initialized", map[string]interface{}{})
+	return c
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := initialize(t)
+
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, LanguageID: "go", Version: 1, Text: src0},
+	})
+	if diags := c.diagnostics(); len(diags.Diagnostics) != 0 || diags.URI != uri || diags.Version != 1 {
+		t.Errorf("didOpen: got %+v; want no diagnostics for version 1", diags)
+	}
+
+	// notifications without a document change publish nothing
+	c.notify("textDocument/didSave", DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}})
+	c.notify("textDocument/willSave", DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}})
+	if rerr := c.call("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: uri}}, nil); rerr != nil {
+		t.Fatalf("documentSymbol: %s", rerr.Message)
+	}
+	if len(c.notifications) != 0 {
+		t.Errorf("didSave: got notifications %+v; want none", c.notifications)
+		c.notifications = nil
+	}
+
+	// introduce a syntax error: "func main() {" -> "func main() {)"
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument: VersionedTextDocumentIdentifier{URI: uri, Version: 2},
+		ContentChanges: []TextDocumentContentChangeEvent{{
+			Range: &Range{Start: Position{Line: 29, Character: 13}, End: Position{Line: 29, Character: 13}},
+			Text:  ")",
+		}},
+	})
+	diags := c.diagnostics()
+	if len(diags.Diagnostics) == 0 {
+		t.Fatal("didChange: got no diagnostics; want a syntax error")
+	}
+	want := Range{Start: Position{Line: 29, Character: 13}, End: Position{Line: 29, Character: 14}}
+	if d := diags.Diagnostics[0]; d.Range != want || d.Severity != severityError {
+		t.Errorf("didChange: got diagnostic %+v; want error at %+v", d, want)
+	}
+
+	// full document change fixes the error
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: 3},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: src0}},
+	})
+	if diags := c.diagnostics(); len(diags.Diagnostics) != 0 || diags.Version != 3 {
+		t.Errorf("didChange: got %+v; want no diagnostics for version 3", diags)
+	}
+
+	c.notify("textDocument/didClose", DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}})
+	if diags := c.diagnostics(); len(diags.Diagnostics) != 0 {
+		t.Errorf("didClose: got %+v; want no diagnostics", diags)
+	}
+	if rerr := c.call("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: uri}}, nil); rerr == nil || rerr.Code != codeInvalidParams {
+		t.Errorf("documentSymbol on closed document: got %v; want invalid params error", rerr)
+	}
+
+	c.exit()
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	c := initialize(t)
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, LanguageID: "go", Version: 1, Text: src0},
+	})
+	c.diagnostics()
+
+	var syms []DocumentSymbol
+	if rerr := c.call("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &syms); rerr != nil {
+		t.Fatal(rerr.Message)
+	}
+	var got []string
+	var walk func(prefix string, syms []DocumentSymbol)
+	walk = func(prefix string, syms []DocumentSymbol) {
+		for _, s := range syms {
+			got = append(got, fmt.Sprintf("%s%s:%d@%d", prefix, s.Name, s.Kind, s.SelectionRange.Start.Line))
+			walk(prefix+s.Name+".", s.Children)
+		}
+	}
+	walk("", syms)
+	want := []string{
+		"T:23@8", "T.x:8@9", "T.y:8@9", "T.Reader:8@10", "T.M:6@24",
+		"I:11@13", "I.M:6@14",
+		"c:14@17",
+		"v:13@19",
+		"main:12@29",
+		"(*S).M:6@33",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got symbols\n\t%v\nwant\n\t%v", got, want)
+	}
+
+	c.exit()
+}
+
+func TestFoldingAndSelectionRanges(t *testing.T) {
+	c := initialize(t)
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, LanguageID: "go", Version: 1, Text: src0},
+	})
+	c.diagnostics()
+
+	var folds []FoldingRange
+	if rerr := c.call("textDocument/foldingRange", FoldingRangeParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &folds); rerr != nil {
+		t.Fatal(rerr.Message)
+	}
+	var got []string
+	for _, f := range folds {
+		got = append(got, fmt.Sprintf("%d-%d%s", f.StartLine, f.EndLine, f.Kind))
+	}
+	want := []string{"2-5imports", "8-11", "13-15", "19-22", "24-27", "29-31"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got folding ranges %v; want %v", got, want)
+	}
+
+	// selection ranges at "t.x" in "fmt.Println(t.x + t.y)"
+	var sels []SelectionRange
+	params := SelectionRangeParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Positions:    []Position{{Line: 25, Character: 15}},
+	}
+	if rerr := c.call("textDocument/selectionRange", params, &sels); rerr != nil {
+		t.Fatal(rerr.Message)
+	}
+	if len(sels) != 1 {
+		t.Fatalf("got %d selection ranges; want 1", len(sels))
+	}
+	got = nil
+	for sr := &sels[0]; sr != nil; sr = sr.Parent {
+		r := sr.Range
+		got = append(got, fmt.Sprintf("%d:%d-%d:%d", r.Start.Line, r.Start.Character, r.End.Line, r.End.Character))
+	}
+	want = []string{
+		"25:15-25:16", // x
+		"25:13-25:16", // t.x
+		"25:13-25:22", // t.x + t.y
+		"25:1-25:23",  // fmt.Println(...)
+		"25:1-26:11",  // statement list
+		"24:22-27:1",  // body
+		"24:0-27:1",   // func decl
+		"0:0-33:18",   // package clause to last declaration
+		"0:0-34:0",    // whole document
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got selection ranges\n\t%v\nwant\n\t%v", got, want)
+	}
+
+	c.exit()
+}
+
+func TestProtocolErrors(t *testing.T) {
+	c := newClient(t)
+	if rerr := c.call("textDocument/documentSymbol", nil, nil); rerr == nil || rerr.Code != codeServerNotInitialized {
+		t.Errorf("request before initialize: got %v; want server not initialized error", rerr)
+	}
+	c.call("initialize", map[string]interface{}{}, nil)
+	if rerr := c.call("workspace/symbol", map[string]interface{}{}, nil); rerr == nil || rerr.Code != codeMethodNotFound {
+		t.Errorf("unsupported method: got %v; want method not found error", rerr)
+	}
+	c.exit()
+}
+
+func TestPositions(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"\n",
+		"package p\n",
+		"package p",
+		"package p\n\n// héllo, 世界 𝄞!\nvar x = \"𝄞𝄞\"\n\n",
+		"package p\r\nvar \xff = 1",
+	} {
+		d := newDocument("file:///a.go", 1, text)
+		line, character := 0, 0
+		for offs := 0; offs <= len(text); {
+			want := Position{Line: line, Character: character}
+			if got := d.offsetPosition(offs); got != want {
+				t.Errorf("%q: offsetPosition(%d) = %v; want %v", text, offs, got, want)
+			}
+			if got := d.file.Offset(d.pos(want)); got != offs {
+				t.Errorf("%q: pos(%v) at offset %d; want %d", text, want, got, offs)
+			}
+			if offs == len(text) {
+				break
+			}
+			r, size := utf8.DecodeRuneInString(text[offs:])
+			if r == '\n' {
+				line, character = line+1, 0
+			} else {
+				character += len(utf16.Encode([]rune{r}))
+			}
+			offs += size
+		}
+		// positions past the end of a line or of the text are clamped
+		if got, want := d.file.Offset(d.pos(Position{Line: 0, Character: 1000})), strings.IndexByte(text+"\n", '\n'); got != want {
+			t.Errorf("%q: end of line 0 at offset %d; want %d", text, got, want)
+		}
+		if got := d.file.Offset(d.pos(Position{Line: 1000})); got != len(text) {
+			t.Errorf("%q: line 1000 at offset %d; want %d", text, got, len(text))
+		}
+	}
+}
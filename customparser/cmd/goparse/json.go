@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/token"
+	"io"
+	"reflect"
+)
+
+// printJSON writes f as JSON. Each node is an object whose first member
+// "NodeType" names the node type (e.g., "FuncDecl"), followed by the
+// node's fields in declaration order. Positions are "file:line:col"
+// strings, tokens are written in source form, and objects are reduced
+// to their kind and name to break the cycles in the AST. Scopes are
+// omitted.
+func printJSON(w io.Writer, fset *token.FileSet, f *ast.File) error {
+	data, err := json.Marshal(jsonValue(fset, reflect.ValueOf(f)))
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+var (
+	posType    = reflect.TypeOf(token.NoPos)
+	tokenType  = reflect.TypeOf(token.ILLEGAL)
+	objKind    = reflect.TypeOf(ast.Bad)
+	objectType = reflect.TypeOf((*ast.Object)(nil))
+	scopeType  = reflect.TypeOf((*ast.Scope)(nil))
+)
+
+// A member is a name/value pair of a JSON object.
+type member struct {
+	name  string
+	value interface{}
+}
+
+// An object is a JSON object with ordered members.
+type object []member
+
+func (obj object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range obj {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(m.name)
+		buf.Write(name)
+		buf.WriteByte(':')
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func jsonValue(fset *token.FileSet, v reflect.Value) interface{} {
+	switch v.Type() {
+	case posType:
+		if pos := token.Pos(v.Int()); pos.IsValid() {
+			return fset.Position(pos).String()
+		}
+		return nil
+	case tokenType:
+		return token.Token(v.Int()).String()
+	case objKind:
+		return ast.ObjKind(v.Int()).String()
+	case objectType:
+		if v.IsNil() {
+			return nil
+		}
+		obj := v.Interface().(*ast.Object)
+		return object{{"Kind", obj.Kind.String()}, {"Name", obj.Name}}
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return jsonValue(fset, v.Elem())
+	case reflect.Slice:
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = jsonValue(fset, v.Index(i))
+		}
+		return list
+	case reflect.Struct:
+		t := v.Type()
+		obj := object{{"NodeType", t.Name()}}
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).Type == scopeType {
+				continue
+			}
+			obj = append(obj, member{t.Field(i).Name, jsonValue(fset, v.Field(i))})
+		}
+		return obj
+	}
+	return v.Interface()
+}
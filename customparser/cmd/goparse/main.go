@@ -0,0 +1,209 @@
+// Command goparse parses Go source files with
+// github.com/yunabe/golang-codelab/customparser/parser and prints the
+// result.
+//
+// Usage:
+//
+//	goparse [flags] [file ...]
+//	goparse -diff [flags] old new
+//
+// If no files are given, or a file is named "-", the source is read from
+// standard input. The output format is selected with -format:
+//
+//	tree    the AST as an indented tree (default)
+//	json    the AST as JSON
+//	errors  only the syntax errors
+//
+// Syntax errors are always reported, one per line in file:line:col form;
+// with -format=errors they are written to standard output, otherwise to
+// standard error. The exit status is 1 if any file contains syntax errors
+// and 2 if the command could not run. With -trace, the trace of the
+// parsed productions of each file is written to standard output before
+// the output for the file.
+//
+// With -diff, exactly two files, an old and a new version of a file, must
+// be given, and the structural differences between them are printed
+// instead: declarations added, removed, moved or modified, changed
+// function signatures and changed imports (see package
+// github.com/yunabe/golang-codelab/customparser/astdiff). The -format
+// flag selects a text report (tree) or a JSON report (json). Files with
+// syntax errors are not compared.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/yunabe/golang-codelab/customparser/astdiff"
+	"github.com/yunabe/golang-codelab/customparser/parser"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command with the given arguments and returns the
+// exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("goparse", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var (
+		importsOnly   = flags.Bool("imports", false, "stop parsing after import declarations (ImportsOnly)")
+		parseComments = flags.Bool("comments", false, "parse comments and add them to the AST (ParseComments)")
+		allErrors     = flags.Bool("all", false, "report all errors, not just the first 10 on different lines (AllErrors)")
+		declErrors    = flags.Bool("decl", false, "report declaration errors (DeclarationErrors)")
+		trace         = flags.Bool("trace", false, "print a trace of parsed productions (Trace)")
+		format        = flags.String("format", "tree", "output format: tree, json or errors")
+		diff          = flags.Bool("diff", false, "print the structural differences between two files")
+	)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: goparse [flags] [file ...]\n")
+		fmt.Fprintf(stderr, "       goparse -diff [flags] old new\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var mode parser.Mode
+	if *importsOnly {
+		mode |= parser.ImportsOnly
+	}
+	if *parseComments {
+		mode |= parser.ParseComments
+	}
+	if *allErrors {
+		mode |= parser.AllErrors
+	}
+	if *declErrors {
+		mode |= parser.DeclarationErrors
+	}
+	if *trace {
+		mode |= parser.Trace
+	}
+
+	if *diff {
+		return runDiff(flags, mode, *format, stdin, stdout, stderr)
+	}
+
+	var print func(w io.Writer, fset *token.FileSet, f *ast.File) error
+	errOut := stderr
+	switch *format {
+	case "tree":
+		print = func(w io.Writer, fset *token.FileSet, f *ast.File) error {
+			return ast.Fprint(w, fset, f, ast.NotNilFilter)
+		}
+	case "json":
+		print = printJSON
+	case "errors":
+		errOut = stdout
+	default:
+		fmt.Fprintf(stderr, "goparse: unknown format %q\n", *format)
+		flags.Usage()
+		return 2
+	}
+
+	filenames := flags.Args()
+	if len(filenames) == 0 {
+		filenames = []string{"-"}
+	}
+
+	status := 0
+	fset := token.NewFileSet()
+	conf := parser.Config{Mode: mode, TraceOutput: stdout}
+	for _, filename := range filenames {
+		filename, src, err := readFile(filename, stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "goparse: %v\n", err)
+			return 2
+		}
+
+		f, err := conf.ParseFile(fset, filename, src)
+		if err != nil {
+			list, ok := err.(scanner.ErrorList)
+			if !ok {
+				fmt.Fprintf(stderr, "goparse: %v\n", err)
+				return 2
+			}
+			for _, e := range list {
+				fmt.Fprintln(errOut, e)
+			}
+			status = 1
+		}
+		if print != nil {
+			if err := print(stdout, fset, f); err != nil {
+				fmt.Fprintf(stderr, "goparse: %v\n", err)
+				return 2
+			}
+		}
+	}
+	return status
+}
+
+// readFile reads the named file, or standard input if filename is "-",
+// and returns the name to use for positions and the source.
+func readFile(filename string, stdin io.Reader) (string, []byte, error) {
+	if filename == "-" {
+		src, err := ioutil.ReadAll(stdin)
+		return "<stdin>", src, err
+	}
+	src, err := ioutil.ReadFile(filename)
+	return filename, src, err
+}
+
+// runDiff executes the command in -diff mode.
+func runDiff(flags *flag.FlagSet, mode parser.Mode, format string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var write func(w io.Writer, changes []*astdiff.Change) error
+	switch format {
+	case "tree":
+		write = astdiff.WriteText
+	case "json":
+		write = astdiff.WriteJSON
+	default:
+		fmt.Fprintf(stderr, "goparse: format %q not supported with -diff\n", format)
+		return 2
+	}
+	if flags.NArg() != 2 {
+		fmt.Fprintf(stderr, "goparse: -diff requires two files\n")
+		flags.Usage()
+		return 2
+	}
+
+	fset := token.NewFileSet()
+	conf := parser.Config{Mode: mode, TraceOutput: stdout}
+	var files [2]*ast.File
+	status := 0
+	for i, filename := range flags.Args() {
+		filename, src, err := readFile(filename, stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "goparse: %v\n", err)
+			return 2
+		}
+		files[i], err = conf.ParseFile(fset, filename, src)
+		if err != nil {
+			list, ok := err.(scanner.ErrorList)
+			if !ok {
+				fmt.Fprintf(stderr, "goparse: %v\n", err)
+				return 2
+			}
+			for _, e := range list {
+				fmt.Fprintln(stderr, e)
+			}
+			status = 1
+		}
+	}
+	if status != 0 {
+		return status
+	}
+	if err := write(stdout, astdiff.Diff(fset, files[0], files[1])); err != nil {
+		fmt.Fprintf(stderr, "goparse: %v\n", err)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const validSrc = `package p
+
+import "fmt"
+
+// f prints.
+func f() { fmt.Println(1) }
+`
+
+const invalidSrc = `package p
+
+func f() {
+	x := 1 +
+}
+`
+
+// twoErrorsSrc has two errors on the same line.
+const twoErrorsSrc = `package p; var _ = a[[]int{}:]; var _ = ( )
+`
+
+func runGoparse(t *testing.T, stdin string, args ...string) (status int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	status = run(args, strings.NewReader(stdin), &out, &errOut)
+	return status, out.String(), errOut.String()
+}
+
+func TestTree(t *testing.T) {
+	status, out, errOut := runGoparse(t, validSrc)
+	if status != 0 || errOut != "" {
+		t.Fatalf("got status %d, stderr %q; want 0 and no errors", status, errOut)
+	}
+	for _, want := range []string{"*ast.File {", "Name: \"f\"", "Value: \"\\\"fmt\\\"\"", "Sel: *ast.Ident"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("tree output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "// f prints.") {
+		t.Errorf("comments present without -comments:\n%s", out)
+	}
+
+	_, out, _ = runGoparse(t, validSrc, "-comments")
+	if !strings.Contains(out, "// f prints.") {
+		t.Errorf("comments missing with -comments:\n%s", out)
+	}
+
+	_, out, _ = runGoparse(t, validSrc, "-imports")
+	if strings.Contains(out, "FuncDecl") {
+		t.Errorf("function declaration parsed with -imports:\n%s", out)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	status, out, errOut := runGoparse(t, validSrc, "-trace", "-format=errors")
+	if status != 0 || errOut != "" {
+		t.Fatalf("got status %d, stderr %q; want 0 and no errors", status, errOut)
+	}
+	for _, want := range []string{"    1:  1: File (\n", ". . FunctionDecl (\n", ". . . IDENT f\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("trace does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	status, out, errOut := runGoparse(t, validSrc, "-format=json", "-comments")
+	if status != 0 || errOut != "" {
+		t.Fatalf("got status %d, stderr %q; want 0 and no errors", status, errOut)
+	}
+	var file struct {
+		NodeType string
+		Package  string
+		Name     struct{ Name string }
+		Decls    []struct {
+			NodeType string
+			Doc      *struct{ List []struct{ Text string } }
+		}
+	}
+	if err := json.Unmarshal([]byte(out), &file); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if file.NodeType != "File" || file.Package != "<stdin>:1:1" || file.Name.Name != "p" {
+		t.Errorf("got %+v", file)
+	}
+	if len(file.Decls) != 2 || file.Decls[0].NodeType != "GenDecl" || file.Decls[1].NodeType != "FuncDecl" {
+		t.Fatalf("got declarations %+v", file.Decls)
+	}
+	if doc := file.Decls[1].Doc; doc == nil || doc.List[0].Text != "// f prints." {
+		t.Errorf("got doc %+v; want // f prints.", doc)
+	}
+	if !strings.HasPrefix(out, "{\n  \"NodeType\": \"File\",\n  \"Doc\": null,\n  \"Package\"") {
+		t.Errorf("members not in declaration order:\n%s", out[:80])
+	}
+}
+
+func TestErrors(t *testing.T) {
+	status, out, _ := runGoparse(t, invalidSrc, "-format=errors")
+	if status != 1 {
+		t.Errorf("got status %d; want 1", status)
+	}
+	want := "<stdin>:5:1: expected operand, found '}'\n"
+	if out != want {
+		t.Errorf("got\n%s\nwant\n%s", out, want)
+	}
+
+	// without -all, only the first error on a line is reported
+	_, out, _ = runGoparse(t, twoErrorsSrc, "-format=errors")
+	if n := strings.Count(out, "\n"); n != 1 {
+		t.Errorf("got %d errors without -all; want 1:\n%s", n, out)
+	}
+	_, out, _ = runGoparse(t, twoErrorsSrc, "-format=errors", "-all")
+	if n := strings.Count(out, "\n"); n < 2 {
+		t.Errorf("got %d errors with -all; want more than 1:\n%s", n, out)
+	}
+
+	// in tree mode, errors go to stderr and the partial AST is printed
+	status, out, errOut := runGoparse(t, invalidSrc)
+	if status != 1 || errOut != want || !strings.Contains(out, "BadExpr") {
+		t.Errorf("got status %d, stderr %q; want 1, %q and a partial AST", status, errOut, want)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	good := filepath.Join(dir, "good.go")
+	bad := filepath.Join(dir, "bad.go")
+	if err := ioutil.WriteFile(good, []byte(validSrc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(bad, []byte(invalidSrc), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if status, _, _ := runGoparse(t, "", "-format=errors", good); status != 0 {
+		t.Errorf("%s: got status %d; want 0", good, status)
+	}
+	status, out, _ := runGoparse(t, "", "-format=errors", good, bad)
+	if status != 1 || !strings.HasPrefix(out, bad+":5:1: ") {
+		t.Errorf("got status %d, output %q; want 1 and an error in %s", status, out, bad)
+	}
+	if status, _, _ := runGoparse(t, "", filepath.Join(dir, "missing.go")); status != 2 {
+		t.Errorf("missing file: got status %d; want 2", status)
+	}
+	if status, _, _ := runGoparse(t, "", "-format=xml", good); status != 2 {
+		t.Errorf("unknown format: got status %d; want 2", status)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	old := filepath.Join(dir, "old.go")
+	new := filepath.Join(dir, "new.go")
+	if err := ioutil.WriteFile(old, []byte(validSrc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	newSrc := strings.Replace(validSrc, "func f()", "func f(n int)", 1)
+	if err := ioutil.WriteFile(new, []byte(newSrc), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	status, out, errOut := runGoparse(t, "", "-diff", old, new)
+	if status != 0 || errOut != "" {
+		t.Fatalf("got status %d, stderr %q; want 0 and no errors", status, errOut)
+	}
+	want := "signature func f " + old + ":6:6 -> " + new + ":6:6\n" +
+		"\t- func f()\n" +
+		"\t+ func f(n int)\n"
+	if out != want {
+		t.Errorf("got\n%s\nwant\n%s", out, want)
+	}
+
+	// JSON report, with the new version read from standard input
+	_, out, _ = runGoparse(t, newSrc, "-diff", "-format=json", old, "-")
+	var changes []struct{ Kind, Name, New string }
+	if err := json.Unmarshal([]byte(out), &changes); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if len(changes) != 1 || changes[0].Kind != "signature" || changes[0].Name != "func f" || changes[0].New != "<stdin>:6:6" {
+		t.Errorf("got %+v", changes)
+	}
+
+	if status, _, _ := runGoparse(t, "", "-diff", old); status != 2 {
+		t.Errorf("one file: got status %d; want 2", status)
+	}
+	if status, _, _ := runGoparse(t, invalidSrc, "-diff", old, "-"); status != 1 {
+		t.Errorf("syntax error: got status %d; want 1", status)
+	}
+}
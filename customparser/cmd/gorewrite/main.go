@@ -0,0 +1,168 @@
+// Command gorewrite rewrites Go source files with a pattern rule, using
+// github.com/yunabe/golang-codelab/customparser/rewrite.
+//
+// Usage:
+//
+//	gorewrite -r 'pattern -> replacement' [flags] [path ...]
+//
+// For example:
+//
+//	gorewrite -r 'fmt.Sprintf("%s", $x) -> $x' -d ./...
+//
+// Paths may be files or directories; directories are walked for .go
+// files, and a trailing "/..." is allowed as in package patterns. As with
+// the go tool, the walk skips testdata and vendor directories, and the
+// files and directories whose names begin with "." or "_". If no paths
+// are given, the source is read from standard input.
+// By default the rewritten sources are written to standard output; with
+// -d, unified diffs of the changes are printed instead, and with -w the
+// files are rewritten in place. The exit status is 1 if a file could not
+// be parsed and 2 if the command could not run.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yunabe/golang-codelab/customparser/parser"
+	"github.com/yunabe/golang-codelab/customparser/rewrite"
+	"github.com/yunabe/golang-codelab/customparser/textedit"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command with the given arguments and returns the
+// exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("gorewrite", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var (
+		ruleFlag = flags.String("r", "", "rewrite rule (e.g., 'fmt.Sprintf(\"%s\", $x) -> $x')")
+		diff     = flags.Bool("d", false, "print unified diffs instead of rewritten sources")
+		write    = flags.Bool("w", false, "write results to the source files")
+		list     = flags.Bool("l", false, "list files whose sources are changed")
+	)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: gorewrite -r 'pattern -> replacement' [flags] [path ...]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *ruleFlag == "" {
+		fmt.Fprintf(stderr, "gorewrite: missing -r rule\n")
+		flags.Usage()
+		return 2
+	}
+	rule, err := rewrite.ParseRule(*ruleFlag)
+	if err != nil {
+		fmt.Fprintf(stderr, "gorewrite: %v\n", err)
+		return 2
+	}
+
+	c := &command{rule: rule, diff: *diff, write: *write, list: *list, stdout: stdout, stderr: stderr}
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintf(stderr, "gorewrite: cannot use -w with standard input\n")
+			return 2
+		}
+		src, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "gorewrite: %v\n", err)
+			return 2
+		}
+		c.process("<stdin>", src)
+		return c.status
+	}
+	for _, root := range flags.Args() {
+		if root == "..." {
+			root = "."
+		}
+		root = strings.TrimSuffix(root, "/...")
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != root && ignored(info.Name()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() || !strings.HasSuffix(path, ".go") {
+				return nil
+			}
+			src, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			c.process(path, src)
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(stderr, "gorewrite: %v\n", err)
+			return 2
+		}
+	}
+	return c.status
+}
+
+// ignored reports whether the file or directory name is skipped when
+// walking a directory.
+func ignored(name string) bool {
+	return name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
+
+type command struct {
+	rule              *rewrite.Rule
+	diff, write, list bool
+	stdout, stderr    io.Writer
+	status            int
+}
+
+// process rewrites the file filename with contents src and reports the
+// result according to the flags.
+func (c *command) process(filename string, src []byte) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+		c.status = 1
+		return
+	}
+	res, err := textedit.Apply(src, c.rule.Apply(fset, f, src))
+	if err != nil {
+		fmt.Fprintf(c.stderr, "gorewrite: %s: %v\n", filename, err)
+		c.status = 2
+		return
+	}
+	changed := !bytes.Equal(src, res)
+	if c.list && changed {
+		fmt.Fprintln(c.stdout, filename)
+	}
+	if c.write && changed {
+		perm := os.FileMode(0644)
+		if fi, err := os.Stat(filename); err == nil {
+			perm = fi.Mode().Perm()
+		}
+		if err := ioutil.WriteFile(filename, res, perm); err != nil {
+			fmt.Fprintf(c.stderr, "gorewrite: %v\n", err)
+			c.status = 2
+		}
+	}
+	switch {
+	case c.diff:
+		c.stdout.Write(textedit.Diff("a/"+filename, src, "b/"+filename, res))
+	case !c.list && !c.write:
+		c.stdout.Write(res)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const src = `package p
+
+import "fmt"
+
+func f(name string) string {
+	return fmt.Sprintf("%s", name)
+}
+`
+
+const rule = `fmt.Sprintf("%s", $x) -> $x`
+
+func runGorewrite(stdin string, args ...string) (status int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	status = run(args, strings.NewReader(stdin), &out, &errOut)
+	return status, out.String(), errOut.String()
+}
+
+func TestStdin(t *testing.T) {
+	status, out, errOut := runGorewrite(src, "-r", rule)
+	if status != 0 || errOut != "" {
+		t.Fatalf("got status %d, stderr %q", status, errOut)
+	}
+	if want := strings.Replace(src, `fmt.Sprintf("%s", name)`, "name", 1); out != want {
+		t.Errorf("got\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	_, out, _ := runGorewrite(src, "-r", rule, "-d")
+	want := "--- a/<stdin>\n" +
+		"+++ b/<stdin>\n" +
+		"@@ -3,5 +3,5 @@\n" +
+		" import \"fmt\"\n" +
+		" \n" +
+		" func f(name string) string {\n" +
+		"-\treturn fmt.Sprintf(\"%s\", name)\n" +
+		"+\treturn name\n" +
+		" }\n"
+	if out != want {
+		t.Errorf("got\n%s\nwant\n%s", out, want)
+	}
+
+	// no diff for unchanged files
+	_, out, _ = runGorewrite(src, "-r", "a -> b", "-d")
+	if out != "" {
+		t.Errorf("got diff for unchanged source:\n%s", out)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorewrite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	changed := filepath.Join(dir, "a.go")
+	unchanged := filepath.Join(dir, "b.go")
+	ioutil.WriteFile(changed, []byte(src), 0644)
+	ioutil.WriteFile(unchanged, []byte("package p\n"), 0644)
+
+	status, out, errOut := runGorewrite("", "-r", rule, "-w", "-l", dir)
+	if status != 0 || errOut != "" {
+		t.Fatalf("got status %d, stderr %q", status, errOut)
+	}
+	if out != changed+"\n" {
+		t.Errorf("got list %q; want %q", out, changed+"\n")
+	}
+	data, _ := ioutil.ReadFile(changed)
+	if !strings.Contains(string(data), "return name\n") {
+		t.Errorf("file not rewritten:\n%s", data)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, test := range []struct {
+		stdin  string
+		args   []string
+		status int
+	}{
+		{src, nil, 2},
+		{src, []string{"-r", "f($x)"}, 2},
+		{src, []string{"-r", rule, "-w"}, 2},
+		{"package p; func f( {", []string{"-r", rule}, 1},
+	} {
+		if status, _, _ := runGorewrite(test.stdin, test.args...); status != test.status {
+			t.Errorf("%v: got status %d; want %d", test.args, status, test.status)
+		}
+	}
+}
+
+func TestWalk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorewrite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.go", "sub/b.go", "testdata/c.go", "vendor/d.go", ".git/e.go", "_x/f.go", "sub/_g.go"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, []byte(src), 0644)
+	}
+
+	want := filepath.Join(dir, "a.go") + "\n" + filepath.Join(dir, "sub", "b.go") + "\n"
+	for _, arg := range []string{dir, dir + "/..."} {
+		status, out, errOut := runGorewrite("", "-r", rule, "-l", arg)
+		if status != 0 || errOut != "" {
+			t.Fatalf("%s: got status %d, stderr %q", arg, status, errOut)
+		}
+		if out != want {
+			t.Errorf("%s: got list %q; want %q", arg, out, want)
+		}
+	}
+
+	// from within the directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	status, out, errOut := runGorewrite("", "-r", rule, "-l", "./...")
+	if want := "a.go\nsub/b.go\n"; status != 0 || out != want {
+		t.Errorf("./...: got status %d, list %q, stderr %q; want list %q", status, out, errOut, want)
+	}
+}
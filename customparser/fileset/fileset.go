@@ -0,0 +1,278 @@
+// Package fileset implements a managed token.FileSet for long-running
+// processes that parse files repeatedly with
+// github.com/yunabe/golang-codelab/customparser/parser.
+//
+// A token.FileSet only grows: every parsed file occupies a range of
+// positions and its line table for as long as the file set lives. A Set
+// tracks the files it parsed, frees the files that are released, and
+// compacts the position space on demand by moving the live files to new
+// bases and rewriting the positions stored in their ASTs.
+package fileset
+
+import (
+	"bytes"
+	"encoding/gob"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/yunabe/golang-codelab/customparser/parser"
+)
+
+// A Set parses files into a token.FileSet it owns. It is safe for
+// concurrent use, except that Compact must not run while the ASTs of
+// the set are being used.
+type Set struct {
+	mu   sync.RWMutex // held for writing while the file set is replaced
+	fset *token.FileSet
+
+	filesMu  sync.Mutex
+	files    map[*ast.File]*token.File
+	released int // size of the position ranges of released files
+}
+
+// New returns an empty set.
+func New() *Set {
+	return &Set{
+		fset:  token.NewFileSet(),
+		files: make(map[*ast.File]*token.File),
+	}
+}
+
+// FileSet returns the file set holding the positions of the live files.
+// The file set is replaced by Compact; it must not be retained across
+// calls of Compact, nor be used to add files by other means than the
+// methods of s.
+func (s *Set) FileSet() *token.FileSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.fset
+}
+
+// ParseFile is like parser.ParseFile, using the file set of s. The file
+// stays in s until it is released.
+func (s *Set) ParseFile(filename string, src interface{}, mode parser.Mode) (*ast.File, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, err := parser.ParseFile(s.fset, filename, src, mode)
+	if f == nil {
+		return nil, err
+	}
+
+	s.filesMu.Lock()
+	defer s.filesMu.Unlock()
+	file := s.fset.File(f.Package)
+	if file == nil {
+		// no package clause: find the untracked file of that name
+		tracked := make(map[*token.File]bool)
+		for _, file := range s.files {
+			tracked[file] = true
+		}
+		s.fset.Iterate(func(ff *token.File) bool {
+			if ff.Name() == filename && !tracked[ff] {
+				file = ff
+			}
+			return true
+		})
+	}
+	if file != nil {
+		s.files[f] = file
+	}
+	return f, err
+}
+
+// Release removes the file of f, which must have been returned by
+// s.ParseFile, from the set. The positions of f become invalid.
+func (s *Set) Release(f *ast.File) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.filesMu.Lock()
+	defer s.filesMu.Unlock()
+	file, ok := s.files[f]
+	if !ok {
+		return
+	}
+	delete(s.files, f)
+	s.fset.RemoveFile(file)
+	s.released += file.Size() + 1
+}
+
+// Len returns the number of live files.
+func (s *Set) Len() int {
+	s.filesMu.Lock()
+	defer s.filesMu.Unlock()
+	return len(s.files)
+}
+
+// Released returns the size of the position space held by released
+// files, which Compact reclaims.
+func (s *Set) Released() int {
+	s.filesMu.Lock()
+	defer s.filesMu.Unlock()
+	return s.released
+}
+
+// Compact moves the live files to a new file set, next to each other and
+// in their original order, and rewrites the positions in their ASTs
+// accordingly. Afterwards, FileSet returns the new file set, and the
+// positions of the live ASTs refer to it. Positions held outside the
+// ASTs (and obtained before Compact) become invalid.
+//
+// Compact must not run concurrently with any use of the ASTs of s.
+func (s *Set) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filesMu.Lock()
+	defer s.filesMu.Unlock()
+
+	type live struct {
+		f    *ast.File
+		file *token.File
+	}
+	list := make([]live, 0, len(s.files))
+	for f, file := range s.files {
+		list = append(list, live{f, file})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].file.Base() < list[j].file.Base()
+	})
+
+	// Serialize the live files, which preserves their line tables and
+	// //line information, with new bases.
+	var old serializedFileSet
+	if err := decodeFileSet(s.fset, &old); err != nil {
+		return err
+	}
+	byBase := make(map[int]serializedFile, len(old.Files))
+	for _, sf := range old.Files {
+		byBase[sf.Base] = sf
+	}
+	var set serializedFileSet
+	base := token.NewFileSet().Base()
+	for _, l := range list {
+		sf := byBase[l.file.Base()]
+		sf.Base = base
+		set.Files = append(set.Files, sf)
+		base += sf.Size + 1
+	}
+	set.Base = base
+	fset, err := encodeFileSet(&set)
+	if err != nil {
+		return err
+	}
+
+	files := make(map[*ast.File]*token.File, len(list))
+	for i, l := range list {
+		newBase := set.Files[i].Base
+		if newBase != l.file.Base() {
+			shiftPositions(l.f, l.file, newBase-l.file.Base())
+		}
+		files[l.f] = fset.File(token.Pos(newBase))
+	}
+	s.fset = fset
+	s.files = files
+	s.released = 0
+	return nil
+}
+
+// The types serializedFileSet and serializedFile mirror those passed by
+// (*token.FileSet).Write and Read, which encoding/gob matches by field
+// names.
+
+type serializedFileSet struct {
+	Base  int
+	Files []serializedFile
+}
+
+type serializedFile struct {
+	Name  string
+	Base  int
+	Size  int
+	Lines []int
+	Infos []lineInfo
+}
+
+type lineInfo struct {
+	Offset       int
+	Filename     string
+	Line, Column int
+}
+
+func decodeFileSet(fset *token.FileSet, set *serializedFileSet) error {
+	var buf bytes.Buffer
+	if err := fset.Write(gob.NewEncoder(&buf).Encode); err != nil {
+		return err
+	}
+	return gob.NewDecoder(&buf).Decode(set)
+}
+
+func encodeFileSet(set *serializedFileSet) (*token.FileSet, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(set); err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	if err := fset.Read(gob.NewDecoder(&buf).Decode); err != nil {
+		return nil, err
+	}
+	return fset, nil
+}
+
+var posType = reflect.TypeOf(token.NoPos)
+
+// shiftPositions adds delta to the positions of file in the AST f,
+// including those of the objects and scopes of f.
+func shiftPositions(f *ast.File, file *token.File, delta int) {
+	s := &shifter{
+		lo:    token.Pos(file.Base()),
+		hi:    token.Pos(file.Base() + file.Size()),
+		delta: token.Pos(delta),
+		seen:  make(map[interface{}]bool),
+	}
+	s.walk(reflect.ValueOf(f))
+}
+
+type shifter struct {
+	lo, hi token.Pos // positions of the file
+	delta  token.Pos
+	seen   map[interface{}]bool // visited pointers
+}
+
+func (s *shifter) walk(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		// every pointer is visited once, so that shared nodes and
+		// objects are shifted once
+		if x := v.Interface(); !s.seen[x] {
+			s.seen[x] = true
+			s.walk(v.Elem())
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			s.walk(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			s.walk(v.Field(i))
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			s.walk(v.Index(i))
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			s.walk(v.MapIndex(k))
+		}
+	case reflect.Int:
+		if v.Type() == posType && v.CanSet() {
+			if p := token.Pos(v.Int()); s.lo <= p && p <= s.hi {
+				v.SetInt(int64(p + s.delta))
+			}
+		}
+	}
+}
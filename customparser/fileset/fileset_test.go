@@ -0,0 +1,150 @@
+package fileset
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/yunabe/golang-codelab/customparser/parser"
+)
+
+// positions returns the positions of all nodes of f, and of the
+// declarations of the objects identifiers refer to.
+func positions(fset *token.FileSet, f *ast.File) string {
+	var buf strings.Builder
+	ast.Inspect(f, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		fmt.Fprintf(&buf, "%T %s-%s\n", n, fset.Position(n.Pos()), fset.Position(n.End()))
+		if id, ok := n.(*ast.Ident); ok && id.Obj != nil {
+			if d, ok := id.Obj.Decl.(ast.Node); ok {
+				fmt.Fprintf(&buf, "\tdecl %s\n", fset.Position(d.Pos()))
+			}
+		}
+		return true
+	})
+	for _, c := range f.Comments {
+		fmt.Fprintf(&buf, "comment %s\n", fset.Position(c.Pos()))
+	}
+	return buf.String()
+}
+
+func source(i int) string {
+	return fmt.Sprintf(`package p%d
+
+// F is a function.
+func F(x int) int {
+	y := x + %d
+	return y
+}
+//line other.go:100
+var V = F(1)
+`, i, i)
+}
+
+func TestCompact(t *testing.T) {
+	s := New()
+	var files []*ast.File
+	for i := 0; i < 10; i++ {
+		f, err := s.ParseFile(fmt.Sprintf("f%d.go", i), source(i), parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	// a file without package clause
+	if _, err := s.ParseFile("bad.go", "func", 0); err == nil {
+		t.Fatal("expected error")
+	}
+	if got := s.Len(); got != 11 {
+		t.Fatalf("got %d files; want 11", got)
+	}
+
+	var want []string
+	var live []*ast.File
+	for i, f := range files {
+		if i%3 == 0 {
+			live = append(live, f)
+			want = append(want, positions(s.FileSet(), f))
+		} else {
+			s.Release(f)
+		}
+	}
+	s.Release(files[1]) // released twice
+	size := s.FileSet().Base()
+	if s.Released() == 0 {
+		t.Error("no position space released")
+	}
+
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Len(); got != len(live)+1 {
+		t.Errorf("got %d files after Compact; want %d", got, len(live)+1)
+	}
+	if s.Released() != 0 {
+		t.Errorf("Released() = %d after Compact; want 0", s.Released())
+	}
+	if base := s.FileSet().Base(); base >= size {
+		t.Errorf("Base() = %d after Compact; want < %d", base, size)
+	}
+	for i, f := range live {
+		if got := positions(s.FileSet(), f); got != want[i] {
+			t.Errorf("positions of %s changed:\ngot\n%s\nwant\n%s", s.FileSet().Position(f.Package).Filename, got, want[i])
+		}
+	}
+
+	// the reclaimed range is reused
+	f, err := s.ParseFile("new.go", source(20), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base := s.FileSet().File(f.Package).Base(); base >= size {
+		t.Errorf("new file at base %d; want < %d", base, size)
+	}
+	if got := s.FileSet().Position(f.Decls[1].Pos()).String(); got != "other.go:100" {
+		t.Errorf("got position %s; want other.go:100", got)
+	}
+
+	// positions are still resolvable after releasing everything
+	for _, f := range live {
+		s.Release(f)
+	}
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.FileSet().Position(f.Name.Pos()).String(); got != "new.go:1:9" {
+		t.Errorf("got position %s; want new.go:1:9", got)
+	}
+}
+
+// TestGrowth checks that a set parsing and releasing files in a loop
+// stays bounded when compacted.
+func TestGrowth(t *testing.T) {
+	s := New()
+	var prev *ast.File
+	for i := 0; i < 100; i++ {
+		f, err := s.ParseFile("f.go", source(i), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prev != nil {
+			s.Release(prev)
+		}
+		prev = f
+		if s.Released() > 1000 {
+			if err := s.Compact(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if base := s.FileSet().Base(); base > 2000 {
+		t.Errorf("Base() = %d; want <= 2000", base)
+	}
+	if got := s.FileSet().Position(prev.Name.Pos()).String(); got != "f.go:1:9" {
+		t.Errorf("got position %s; want f.go:1:9", got)
+	}
+}
@@ -0,0 +1,261 @@
+// Package format implements standard formatting of Go source parsed with
+// github.com/yunabe/golang-codelab/customparser/parser.
+//
+// In the default configuration the output is identical to gofmt. A Config
+// enables the extensions our team uses on top of gofmt: grouping imports
+// into standard library and third-party blocks, and wrapping call argument
+// lists that make a line exceed a maximum length.
+package format
+
+import (
+	"bytes"
+	"go/ast"
+	goformat "go/format"
+	"go/token"
+	"io"
+	"strings"
+
+	"github.com/yunabe/golang-codelab/customparser/imports"
+	"github.com/yunabe/golang-codelab/customparser/parser"
+	"github.com/yunabe/golang-codelab/customparser/textedit"
+)
+
+// A Config controls the formatting extensions. The zero Config formats
+// exactly like gofmt.
+type Config struct {
+	// GroupImports splits every parenthesized import declaration into a
+	// group of standard library imports followed by a group of
+	// third-party imports, separated by a blank line.
+	GroupImports bool
+
+	// MaxLineLength, if > 0, is the line length beyond which the
+	// argument lists of single-line calls are wrapped, one argument per
+	// line. Wrapping starts with the outermost call on a line.
+	MaxLineLength int
+
+	// TabWidth is the width of a leading tab when measuring line length;
+	// if <= 0, a width of 8 is used.
+	TabWidth int
+}
+
+// maxPasses bounds the number of wrapping passes over a file.
+const maxPasses = 100
+
+// Node formats node in canonical gofmt style and writes the result to dst.
+// The node may be any value accepted by go/format.Node, typically an
+// *ast.File produced by the customparser.
+func Node(dst io.Writer, fset *token.FileSet, node interface{}) error {
+	return goformat.Node(dst, fset, node)
+}
+
+// Source parses src as a Go source file with the customparser and returns
+// it formatted in canonical gofmt style.
+func Source(src []byte) ([]byte, error) {
+	return (&Config{}).Source(src)
+}
+
+// Fprint formats the file f according to the configuration and writes the
+// result to dst.
+func (cfg *Config) Fprint(dst io.Writer, fset *token.FileSet, f *ast.File) error {
+	var buf bytes.Buffer
+	if err := Node(&buf, fset, f); err != nil {
+		return err
+	}
+	out, err := cfg.apply(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(out)
+	return err
+}
+
+// Source parses src as a Go source file with the customparser and returns
+// it formatted according to the configuration.
+func (cfg *Config) Source(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := cfg.Fprint(&buf, fset, f); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// apply applies the enabled extensions to src, which is in gofmt form.
+func (cfg *Config) apply(src []byte) ([]byte, error) {
+	var err error
+	if cfg.GroupImports {
+		if src, err = rewrite(src, groupImports); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.MaxLineLength > 0 {
+		for pass := 0; pass < maxPasses; pass++ {
+			changed := false
+			src, err = rewrite(src, func(fset *token.FileSet, f *ast.File, src []byte) []textedit.Edit {
+				edits := cfg.wrapCalls(fset, f, src)
+				changed = len(edits) > 0
+				return edits
+			})
+			if err != nil {
+				return nil, err
+			}
+			if !changed {
+				break
+			}
+		}
+	}
+	return src, nil
+}
+
+// rewrite parses src, applies the edits computed by fn, and returns the
+// result in gofmt form. If fn returns no edits, src is returned unchanged.
+func rewrite(src []byte, fn func(fset *token.FileSet, f *ast.File, src []byte) []textedit.Edit) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	edits := fn(fset, f, src)
+	if len(edits) == 0 {
+		return src, nil
+	}
+	if src, err = textedit.Apply(src, edits); err != nil {
+		return nil, err
+	}
+	return goformat.Source(src)
+}
+
+// lineStart returns the offset of the beginning of the line containing offs.
+func lineStart(src []byte, offs int) int {
+	return bytes.LastIndexByte(src[:offs], '\n') + 1
+}
+
+// lineEnd returns the offset of the newline ending the line containing offs,
+// or len(src).
+func lineEnd(src []byte, offs int) int {
+	if i := bytes.IndexByte(src[offs:], '\n'); i >= 0 {
+		return offs + i
+	}
+	return len(src)
+}
+
+// groupImports returns the edits that regroup the specs of the
+// parenthesized import declarations of f. Declarations containing
+// comments not attached to a spec are left alone.
+func groupImports(fset *token.FileSet, f *ast.File, src []byte) []textedit.Edit {
+	file := fset.File(f.Pos())
+	var edits []textedit.Edit
+	for _, decl := range f.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT {
+			break // imports come first
+		}
+		if !d.Lparen.IsValid() || len(d.Specs) < 2 {
+			continue
+		}
+
+		// the text of each spec, including its comments, on whole lines
+		var std, other []string
+		attached := 0
+		for _, s := range d.Specs {
+			spec := s.(*ast.ImportSpec)
+			start, end := spec.Pos(), spec.End()
+			if spec.Doc != nil {
+				start = spec.Doc.Pos()
+				attached++
+			}
+			if spec.Comment != nil {
+				end = spec.Comment.End()
+				attached++
+			}
+			text := string(src[lineStart(src, file.Offset(start)):lineEnd(src, file.Offset(end))])
+			if imports.IsStandard(imports.Path(spec)) {
+				std = append(std, text)
+			} else {
+				other = append(other, text)
+			}
+		}
+		if countComments(f, d.Lparen, d.Rparen) != attached {
+			continue
+		}
+
+		var groups []string
+		if len(std) > 0 {
+			groups = append(groups, strings.Join(std, "\n"))
+		}
+		if len(other) > 0 {
+			groups = append(groups, strings.Join(other, "\n"))
+		}
+		start := lineEnd(src, file.Offset(d.Lparen)) + 1
+		end := lineStart(src, file.Offset(d.Rparen))
+		edits = append(edits, textedit.Edit{Start: start, End: end, New: strings.Join(groups, "\n\n") + "\n"})
+	}
+	return edits
+}
+
+// countComments returns the number of comment groups of f between pos and end.
+func countComments(f *ast.File, pos, end token.Pos) int {
+	n := 0
+	for _, g := range f.Comments {
+		if pos < g.Pos() && g.End() <= end {
+			n++
+		}
+	}
+	return n
+}
+
+// wrapCalls returns the edits that wrap the outermost wrappable call of
+// every line longer than cfg.MaxLineLength. A call is wrappable if it has
+// arguments, fits on a single line, and contains no comments.
+func (cfg *Config) wrapCalls(fset *token.FileSet, f *ast.File, src []byte) []textedit.Edit {
+	file := fset.File(f.Pos())
+	wrapped := make(map[int]bool) // lines already wrapped in this pass
+	var edits []textedit.Edit
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 || !call.Rparen.IsValid() {
+			return true
+		}
+		line := file.Line(call.Lparen)
+		if wrapped[line] || file.Line(call.Rparen) != line || cfg.lineLength(src, file.Offset(call.Lparen)) <= cfg.MaxLineLength {
+			return true
+		}
+		if countComments(f, call.Lparen, call.Rparen) > 0 {
+			return true
+		}
+		wrapped[line] = true
+		lparen := file.Offset(call.Lparen) + 1
+		edits = append(edits, textedit.Edit{Start: lparen, End: lparen, New: "\n"})
+		for i, arg := range call.Args {
+			if i+1 < len(call.Args) {
+				// replace the space after the comma
+				offs := file.Offset(call.Args[i+1].Pos())
+				edits = append(edits, textedit.Edit{Start: file.Offset(arg.End()) + 1, End: offs, New: "\n"})
+			}
+		}
+		end := file.Offset(call.Rparen)
+		edits = append(edits, textedit.Edit{Start: end, End: end, New: ",\n"})
+		return false
+	})
+	return edits
+}
+
+// lineLength returns the length of the line containing offs, counting
+// leading tabs as cfg.TabWidth columns.
+func (cfg *Config) lineLength(src []byte, offs int) int {
+	tabWidth := cfg.TabWidth
+	if tabWidth <= 0 {
+		tabWidth = 8
+	}
+	line := src[lineStart(src, offs):lineEnd(src, offs)]
+	n := 0
+	for len(line) > 0 && line[0] == '\t' {
+		n += tabWidth
+		line = line[1:]
+	}
+	return n + len(bytes.Runes(line))
+}
@@ -0,0 +1,188 @@
+package format
+
+import (
+	"bytes"
+	goformat "go/format"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/yunabe/golang-codelab/customparser/parser"
+)
+
+// TestGOROOT verifies that the default configuration formats the files
+// of GOROOT exactly like gofmt. Files the customparser cannot parse are
+// skipped. With -short, only the go/... packages are checked.
+func TestGOROOT(t *testing.T) {
+	root := filepath.Join(runtime.GOROOT(), "src")
+	if testing.Short() {
+		root = filepath.Join(root, "go")
+	}
+	n := 0
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == "testdata" {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+		if err != nil {
+			return nil // syntax not supported by the customparser
+		}
+		want, err := goformat.Source(src)
+		if err != nil {
+			return nil
+		}
+		var buf bytes.Buffer
+		if err := new(Config).Fprint(&buf, fset, f); err != nil {
+			t.Errorf("%s: %v", path, err)
+			return nil
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("%s: output differs from gofmt", path)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Fatal("no files formatted")
+	}
+}
+
+func TestSource(t *testing.T) {
+	const src = "package p\nfunc f( ) {x:=1 // c\n_=x}\n"
+	const want = "package p\n\nfunc f() {\n\tx := 1 // c\n\t_ = x\n}\n"
+	got, err := Source([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := Source([]byte("package p\nfunc f( {")); err == nil {
+		t.Error("expected syntax error")
+	}
+}
+
+func TestGroupImports(t *testing.T) {
+	const src = `package p
+
+import (
+	"github.com/foo/bar"
+	// Doc comment.
+	"golang.org/x/tools/go/ast" // line comment
+	"os"
+
+	x "net/http"
+	"fmt"
+)
+
+import "example.com/single"
+
+import (
+	"strings"
+	"example.com/a"
+	// free-floating comment
+
+	"errors"
+)
+`
+	const want = `package p
+
+import (
+	"fmt"
+	x "net/http"
+	"os"
+
+	"github.com/foo/bar"
+	// Doc comment.
+	"golang.org/x/tools/go/ast" // line comment
+)
+
+import "example.com/single"
+
+import (
+	"example.com/a"
+	"strings"
+	// free-floating comment
+
+	"errors"
+)
+`
+	cfg := &Config{GroupImports: true}
+	got, err := cfg.Source([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWrapCalls(t *testing.T) {
+	const src = `package p
+
+func f() {
+	short(a, b)
+	g(alpha, beta, h(gamma, delta, epsilon, zeta), omicron, args...)
+	commented(alpha, beta /* c */, gamma, delta, epsilon, zeta, eta, theta, iota)
+}
+`
+	const want = `package p
+
+func f() {
+	short(a, b)
+	g(
+		alpha,
+		beta,
+		h(gamma, delta, epsilon, zeta),
+		omicron,
+		args...,
+	)
+	commented(alpha, beta /* c */, gamma, delta, epsilon, zeta, eta, theta, iota)
+}
+`
+	cfg := &Config{MaxLineLength: 60, TabWidth: 4}
+	got, err := cfg.Source([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// with a smaller limit, the inner call is wrapped in a second pass
+	cfg.MaxLineLength = 30
+	got, err = cfg.Source([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), "\t\th(\n\t\t\tgamma,\n") {
+		t.Errorf("inner call not wrapped:\n%s", got)
+	}
+	// the result is stable
+	again, err := cfg.Source(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, got) {
+		t.Errorf("wrapping is not idempotent:\n%s\nthen\n%s", got, again)
+	}
+}
@@ -0,0 +1,475 @@
+// Package imports implements the manipulation of the import declarations
+// of Go source files parsed with
+// github.com/yunabe/golang-codelab/customparser/parser.
+//
+// The functions of this package do not modify the AST. They return
+// textual edits of the source the file was parsed from, which preserve
+// the comments attached to the affected imports. The result of applying
+// the edits is valid Go source but not necessarily formatted; run it
+// through gofmt or customparser/format as needed.
+package imports
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yunabe/golang-codelab/customparser/parser"
+	"github.com/yunabe/golang-codelab/customparser/textedit"
+)
+
+// IsStandard reports whether path is the import path of a standard
+// library package: the first path element of other packages contains a
+// dot.
+func IsStandard(path string) bool {
+	i := strings.Index(path, "/")
+	if i < 0 {
+		i = len(path)
+	}
+	elem := path[:i]
+	return !strings.Contains(elem, ".")
+}
+
+// Path returns the unquoted import path of spec.
+func Path(spec *ast.ImportSpec) string {
+	path, err := strconv.Unquote(spec.Path.Value)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// Name returns the name under which the package imported by spec is
+// referred to in the file: the explicit name if any, or else the name
+// assumed from the import path. The assumed name is the last path
+// element, skipping major version suffixes like "v2", without a "go-"
+// prefix and truncated at the first character not allowed in an
+// identifier.
+func Name(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+	name, _ := guessName(Path(spec))
+	return name
+}
+
+// guessName returns the name assumed for the package of path, as
+// described for Name, and whether it is the last path element unchanged.
+// Otherwise the package may well be named differently, e.g. "v1" for
+// "k8s.io/api/core/v1".
+func guessName(path string) (name string, exact bool) {
+	elems := strings.Split(path, "/")
+	base := elems[len(elems)-1]
+	name = base
+	if len(elems) > 1 && isVersion(name) {
+		name = elems[len(elems)-2]
+	}
+	name = strings.TrimPrefix(name, "go-")
+	if i := strings.IndexFunc(name, func(r rune) bool {
+		return !(r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r))
+	}); i >= 0 {
+		name = name[:i]
+	}
+	return name, name == base
+}
+
+// isVersion reports whether s is a major version suffix like "v2".
+func isVersion(s string) bool {
+	if len(s) < 2 || s[0] != 'v' {
+		return false
+	}
+	for _, r := range s[1:] {
+		if r < '0' || '9' < r {
+			return false
+		}
+	}
+	return true
+}
+
+// specString returns the source form of an import of path named name.
+func specString(name, path string) string {
+	if name != "" {
+		return name + " " + strconv.Quote(path)
+	}
+	return strconv.Quote(path)
+}
+
+// checkImport returns an error if name and path do not form a valid import.
+func checkImport(name, path string) error {
+	if !parser.ValidImportPath(path) {
+		return fmt.Errorf("invalid import path: %q", path)
+	}
+	if name != "" && name != "_" && name != "." && !isIdent(name) {
+		return fmt.Errorf("invalid import name: %q", name)
+	}
+	return nil
+}
+
+func isIdent(s string) bool {
+	for i, r := range s {
+		if !(r == '_' || unicode.IsLetter(r) || i > 0 && unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return s != "" && token.Lookup(s) == token.IDENT
+}
+
+// importDecls returns the import declarations of f.
+func importDecls(f *ast.File) []*ast.GenDecl {
+	var decls []*ast.GenDecl
+	for _, decl := range f.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT {
+			break // imports come first
+		}
+		decls = append(decls, d)
+	}
+	return decls
+}
+
+// Add returns the edits adding an import of path to f, which was parsed
+// from src. The name may be "" for an unnamed import, "_" for a blank
+// import, "." for a dot import, or an identifier. No edits are returned
+// if f already contains the import. The import is added to the first
+// parenthesized import declaration, next to the imports with the closest
+// paths of the same kind (standard library or not), or else in a new
+// declaration following the existing ones.
+func Add(fset *token.FileSet, f *ast.File, src []byte, name, path string) ([]textedit.Edit, error) {
+	if err := checkImport(name, path); err != nil {
+		return nil, err
+	}
+	for _, spec := range f.Imports {
+		if Path(spec) == path && specName(spec) == name {
+			return nil, nil
+		}
+	}
+	file := fset.File(f.Pos())
+	text := specString(name, path)
+
+	decls := importDecls(f)
+	for _, d := range decls {
+		if !d.Lparen.IsValid() || len(d.Specs) == 0 {
+			continue
+		}
+		// insert after the last spec of the same kind sorting before
+		// path, or before the first spec of the same kind, or after the
+		// last spec
+		std := IsStandard(path)
+		var after, before *ast.ImportSpec
+		for _, s := range d.Specs {
+			spec := s.(*ast.ImportSpec)
+			if IsStandard(Path(spec)) != std {
+				continue
+			}
+			if Path(spec) < path {
+				after = spec
+			} else if before == nil {
+				before = spec
+			}
+		}
+		if after == nil && before == nil {
+			after = d.Specs[len(d.Specs)-1].(*ast.ImportSpec)
+		}
+		if after != nil {
+			end := after.End()
+			if after.Comment != nil {
+				end = after.Comment.End()
+			}
+			offs := file.Offset(end)
+			return []textedit.Edit{{Start: offs, End: offs, New: "\n\t" + text}}, nil
+		}
+		start := before.Pos()
+		if before.Doc != nil {
+			start = before.Doc.Pos()
+		}
+		offs := file.Offset(start)
+		return []textedit.Edit{{Start: offs, End: offs, New: text + "\n\t"}}, nil
+	}
+
+	// add a new declaration
+	var end token.Pos
+	if len(decls) > 0 {
+		end = decls[len(decls)-1].End()
+	} else {
+		end = f.Name.End()
+	}
+	offs := lineEnd(src, file.Offset(end))
+	return []textedit.Edit{{Start: offs, End: offs, New: "\n\nimport " + text}}, nil
+}
+
+// specName returns the explicit name of spec, or "".
+func specName(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+	return ""
+}
+
+// Delete returns the edits deleting the imports of path named name from
+// f, which was parsed from src. The name "" selects unnamed imports only.
+// Declarations left without imports are deleted along with their doc
+// comments.
+func Delete(fset *token.FileSet, f *ast.File, src []byte, name, path string) []textedit.Edit {
+	del := make(map[*ast.ImportSpec]bool)
+	for _, spec := range f.Imports {
+		if Path(spec) == path && specName(spec) == name {
+			del[spec] = true
+		}
+	}
+	return deleteSpecs(fset, f, src, del)
+}
+
+// DeleteUnused returns the edits deleting the imports of f that are not
+// used, where f was parsed from src. An import is used if an identifier
+// unresolved in f (see ast.File.Unresolved) has its name. Blank and dot
+// imports are never deleted, nor are unnamed imports whose name is not
+// the last element of their path (see Name), since the package may be
+// named otherwise.
+//
+// The file must have been parsed with object resolution and not with
+// ImportsOnly, or all imports appear unused.
+func DeleteUnused(fset *token.FileSet, f *ast.File, src []byte) []textedit.Edit {
+	used := make(map[string]bool)
+	for _, id := range f.Unresolved {
+		used[id.Name] = true
+	}
+	del := make(map[*ast.ImportSpec]bool)
+	for _, spec := range f.Imports {
+		if spec.Name == nil {
+			if name, exact := guessName(Path(spec)); exact && !used[name] {
+				del[spec] = true
+			}
+		} else if name := spec.Name.Name; name != "_" && name != "." && !used[name] {
+			del[spec] = true
+		}
+	}
+	return deleteSpecs(fset, f, src, del)
+}
+
+func deleteSpecs(fset *token.FileSet, f *ast.File, src []byte, del map[*ast.ImportSpec]bool) []textedit.Edit {
+	if len(del) == 0 {
+		return nil
+	}
+	file := fset.File(f.Pos())
+	var edits []textedit.Edit
+	for _, d := range importDecls(f) {
+		n := 0
+		for _, s := range d.Specs {
+			if del[s.(*ast.ImportSpec)] {
+				n++
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		if n == len(d.Specs) {
+			start := d.Pos()
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			}
+			edits = append(edits, deleteRange(src, file.Offset(start), file.Offset(declEnd(f, d))))
+			continue
+		}
+		for _, s := range d.Specs {
+			spec := s.(*ast.ImportSpec)
+			if !del[spec] {
+				continue
+			}
+			start, end := spec.Pos(), spec.End()
+			if spec.Doc != nil {
+				start = spec.Doc.Pos()
+			}
+			if spec.Comment != nil {
+				end = spec.Comment.End()
+			}
+			edits = append(edits, deleteRange(src, file.Offset(start), file.Offset(end)))
+		}
+	}
+	return edits
+}
+
+// declEnd returns the end of d including a line comment following it.
+func declEnd(f *ast.File, d *ast.GenDecl) token.Pos {
+	end := d.End()
+	if !d.Lparen.IsValid() {
+		if spec := d.Specs[0].(*ast.ImportSpec); spec.Comment != nil {
+			end = spec.Comment.End()
+		}
+	}
+	return end
+}
+
+// deleteRange returns the edit deleting src[start:end], extended to whole
+// lines if the range is alone on its lines.
+func deleteRange(src []byte, start, end int) textedit.Edit {
+	ls, le := lineStart(src, start), lineEnd(src, end)
+	if isBlank(src[ls:start]) && isBlank(src[end:le]) {
+		start, end = ls, le
+		if end < len(src) {
+			end++ // newline
+		}
+		// don't leave two blank lines behind
+		if ls >= 2 && src[ls-1] == '\n' && src[ls-2] == '\n' && end < len(src) && src[end] == '\n' {
+			end++
+		}
+		return textedit.Edit{Start: start, End: end}
+	}
+	// delete the terminating semicolon of a declaration within a line
+	rest := bytes.TrimLeft(src[end:le], " \t")
+	if len(rest) > 0 && rest[0] == ';' {
+		end = le - len(bytes.TrimLeft(rest[1:], " \t"))
+	}
+	return textedit.Edit{Start: start, End: end}
+}
+
+func isBlank(b []byte) bool {
+	return len(bytes.TrimLeft(b, " \t")) == 0
+}
+
+// lineStart returns the offset of the beginning of the line containing offs.
+func lineStart(src []byte, offs int) int {
+	return bytes.LastIndexByte(src[:offs], '\n') + 1
+}
+
+// lineEnd returns the offset of the newline ending the line containing
+// offs, or len(src).
+func lineEnd(src []byte, offs int) int {
+	if i := bytes.IndexByte(src[offs:], '\n'); i >= 0 {
+		return offs + i
+	}
+	return len(src)
+}
+
+// An entry is an import to be written by Merge with its comments.
+type entry struct {
+	name, path string
+	comments   []string // comment groups preceding the import
+	line       string   // line comment, or ""
+}
+
+type byPath []*entry
+
+func (a byPath) Len() int      { return len(a) }
+func (a byPath) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byPath) Less(i, j int) bool {
+	x, y := a[i], a[j]
+	if sx, sy := IsStandard(x.path), IsStandard(y.path); sx != sy {
+		return sx
+	}
+	if x.path != y.path {
+		return x.path < y.path
+	}
+	return x.name < y.name
+}
+
+// Merge returns the edits merging the import declarations of f, which
+// was parsed from src, into a single declaration. The imports are
+// deduplicated, and sorted by path in two groups: standard library
+// imports followed by other imports. Doc and line comments of imports,
+// and other comments within the declarations, are kept with the import
+// following them. No edits are returned if the declarations are already
+// merged and sorted this way, in particular if f has no imports.
+func Merge(fset *token.FileSet, f *ast.File, src []byte) []textedit.Edit {
+	decls := importDecls(f)
+	if len(decls) == 0 {
+		return nil
+	}
+	file := fset.File(f.Pos())
+	start := decls[0].Pos()
+	if decls[0].Doc != nil {
+		start = decls[0].Doc.Pos()
+	}
+	end := declEnd(f, decls[len(decls)-1])
+
+	// comment groups within the declarations, in order
+	var comments []*ast.CommentGroup
+	for _, g := range f.Comments {
+		if start <= g.Pos() && g.End() <= end {
+			comments = append(comments, g)
+		}
+	}
+	text := func(n ast.Node) string {
+		return string(src[file.Offset(n.Pos()):file.Offset(n.End())])
+	}
+
+	var entries []*entry
+	seen := make(map[[2]string]*entry)
+	for _, d := range decls {
+		for _, s := range d.Specs {
+			spec := s.(*ast.ImportSpec)
+			e := &entry{name: specName(spec), path: Path(spec)}
+			for len(comments) > 0 && comments[0].Pos() < spec.Pos() {
+				if comments[0] != decls[0].Doc {
+					e.comments = append(e.comments, text(comments[0]))
+				}
+				comments = comments[1:]
+			}
+			end := spec.End()
+			if spec.Comment != nil {
+				e.line = text(spec.Comment)
+				end = spec.Comment.End()
+			}
+			for len(comments) > 0 && comments[0].End() <= end {
+				// the line comment or a comment within the spec
+				comments = comments[1:]
+			}
+			key := [2]string{e.name, e.path}
+			if prev := seen[key]; prev != nil {
+				// keep the comments of the duplicate
+				prev.comments = append(prev.comments, e.comments...)
+				if prev.line == "" {
+					prev.line = e.line
+				} else if e.line != "" {
+					prev.comments = append(prev.comments, e.line)
+				}
+				continue
+			}
+			seen[key] = e
+			entries = append(entries, e)
+		}
+	}
+
+	sort.Stable(byPath(entries))
+
+	var buf bytes.Buffer
+	if decls[0].Doc != nil {
+		buf.WriteString(text(decls[0].Doc))
+		buf.WriteByte('\n')
+	}
+	if len(entries) == 1 && len(entries[0].comments) == 0 && len(comments) == 0 {
+		buf.WriteString("import " + specString(entries[0].name, entries[0].path))
+		if entries[0].line != "" {
+			buf.WriteString(" " + entries[0].line)
+		}
+	} else {
+		buf.WriteString("import (\n")
+		for i, e := range entries {
+			if i > 0 && IsStandard(e.path) != IsStandard(entries[i-1].path) {
+				buf.WriteByte('\n')
+			}
+			for _, c := range e.comments {
+				buf.WriteString("\t" + c + "\n")
+			}
+			buf.WriteString("\t" + specString(e.name, e.path))
+			if e.line != "" {
+				buf.WriteString(" " + e.line)
+			}
+			buf.WriteByte('\n')
+		}
+		// comments following the last import
+		for _, g := range comments {
+			buf.WriteString("\t" + text(g) + "\n")
+		}
+		buf.WriteString(")")
+	}
+	offs, endOffs := file.Offset(start), file.Offset(end)
+	if buf.String() == string(src[offs:endOffs]) {
+		return nil
+	}
+	return []textedit.Edit{{Start: offs, End: endOffs, New: buf.String()}}
+}
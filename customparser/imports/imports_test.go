@@ -0,0 +1,301 @@
+package imports
+
+import (
+	"go/ast"
+	"go/token"
+	"testing"
+
+	"github.com/yunabe/golang-codelab/customparser/parser"
+	"github.com/yunabe/golang-codelab/customparser/textedit"
+)
+
+// edit parses src, computes edits with fn and returns the edited source.
+func edit(t *testing.T, src string, fn func(fset *token.FileSet, f *ast.File, src []byte) []textedit.Edit) string {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := textedit.Apply([]byte(src), fn(fset, f, []byte(src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the result must be valid
+	if _, err := parser.ParseFile(token.NewFileSet(), "", res, 0); err != nil {
+		t.Errorf("invalid result: %v\n%s", err, res)
+	}
+	return string(res)
+}
+
+var addTests = []struct {
+	src, name, path, want string
+}{
+	{
+		"package p\n",
+		"", "fmt",
+		"package p\n\nimport \"fmt\"\n",
+	},
+	{
+		"package p // comment\n\nvar x int\n",
+		"_", "embed",
+		"package p // comment\n\nimport _ \"embed\"\n\nvar x int\n",
+	},
+	{
+		"package p\n\nimport \"os\"\n",
+		"", "fmt",
+		"package p\n\nimport \"os\"\n\nimport \"fmt\"\n",
+	},
+	{
+		"package p\n\nimport (\n\t\"fmt\"\n\t\"os\" // os\n\n\t\"example.com/x\"\n)\n",
+		"", "io",
+		"package p\n\nimport (\n\t\"fmt\"\n\t\"io\"\n\t\"os\" // os\n\n\t\"example.com/x\"\n)\n",
+	},
+	{
+		"package p\n\nimport (\n\t\"fmt\"\n\t\"os\" // os\n\n\t\"example.com/x\"\n)\n",
+		"", "strings",
+		"package p\n\nimport (\n\t\"fmt\"\n\t\"os\" // os\n\t\"strings\"\n\n\t\"example.com/x\"\n)\n",
+	},
+	{
+		"package p\n\nimport (\n\t\"fmt\"\n\n\t// X.\n\t\"example.com/x\"\n)\n",
+		".", "example.com/a",
+		"package p\n\nimport (\n\t\"fmt\"\n\n\t. \"example.com/a\"\n\t// X.\n\t\"example.com/x\"\n)\n",
+	},
+	{
+		"package p\n\nimport (\n\t\"fmt\"\n)\n",
+		"y", "example.com/x",
+		"package p\n\nimport (\n\t\"fmt\"\n\ty \"example.com/x\"\n)\n",
+	},
+	{
+		// already present
+		"package p\n\nimport x \"example.com/x\"\n",
+		"x", "example.com/x",
+		"package p\n\nimport x \"example.com/x\"\n",
+	},
+}
+
+func TestAdd(t *testing.T) {
+	for _, test := range addTests {
+		got := edit(t, test.src, func(fset *token.FileSet, f *ast.File, src []byte) []textedit.Edit {
+			edits, err := Add(fset, f, src, test.name, test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return edits
+		})
+		if got != test.want {
+			t.Errorf("Add(%q, %q) to\n%s\ngot\n%s\nwant\n%s", test.name, test.path, test.src, got, test.want)
+		}
+	}
+}
+
+func TestAddErrors(t *testing.T) {
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, "", "package p", 0)
+	for _, test := range []struct{ name, path string }{
+		{"", ""},
+		{"", "a b"},
+		{"", "a\"b"},
+		{"1x", "fmt"},
+		{"func", "fmt"},
+	} {
+		if _, err := Add(fset, f, []byte("package p"), test.name, test.path); err == nil {
+			t.Errorf("Add(%q, %q): expected error", test.name, test.path)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	const src = `package p
+
+// Doc.
+import "os" // os
+
+import (
+	"fmt"
+	// X.
+	x "example.com/x" // x
+	"example.com/x"
+)
+`
+	for _, test := range []struct{ name, path, want string }{
+		{"", "os", `package p
+
+import (
+	"fmt"
+	// X.
+	x "example.com/x" // x
+	"example.com/x"
+)
+`},
+		{"x", "example.com/x", `package p
+
+// Doc.
+import "os" // os
+
+import (
+	"fmt"
+	"example.com/x"
+)
+`},
+		{"", "io", src},
+	} {
+		got := edit(t, src, func(fset *token.FileSet, f *ast.File, src []byte) []textedit.Edit {
+			return Delete(fset, f, src, test.name, test.path)
+		})
+		if got != test.want {
+			t.Errorf("Delete(%q, %q):\ngot\n%s\nwant\n%s", test.name, test.path, got, test.want)
+		}
+	}
+
+	// single line
+	got := edit(t, `package p; import "fmt"; var x int`, func(fset *token.FileSet, f *ast.File, src []byte) []textedit.Edit {
+		return Delete(fset, f, src, "", "fmt")
+	})
+	if want := `package p; var x int`; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestDeleteUnused(t *testing.T) {
+	const src = `package p
+
+import (
+	"fmt"
+	"os"
+	_ "embed"
+	. "math"
+	yaml "gopkg.in/yaml.v2"
+	"github.com/go-sql/driver"
+	"example.com/mod/v2"
+	"example.com/unused"
+	u "example.com/unused/v3"
+	"example.com/unsure/v3"
+	"k8s.io/api/core/v1"
+	"github.com/x/go-unsure"
+	"gopkg.in/unsure.v1"
+)
+
+var os = 1 // shadows the import
+
+var _ v1.Pod
+
+func f() {
+	fmt.Println(Pi, yaml.Marshal, driver.Open, mod.X)
+}
+`
+	// imports whose package name is guessed are kept
+	const want = `package p
+
+import (
+	"fmt"
+	_ "embed"
+	. "math"
+	yaml "gopkg.in/yaml.v2"
+	"github.com/go-sql/driver"
+	"example.com/mod/v2"
+	"example.com/unsure/v3"
+	"k8s.io/api/core/v1"
+	"github.com/x/go-unsure"
+	"gopkg.in/unsure.v1"
+)
+
+var os = 1 // shadows the import
+
+var _ v1.Pod
+
+func f() {
+	fmt.Println(Pi, yaml.Marshal, driver.Open, mod.X)
+}
+`
+	got := edit(t, src, DeleteUnused)
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestName(t *testing.T) {
+	for path, want := range map[string]string{
+		"fmt":                      "fmt",
+		"go/ast":                   "ast",
+		"gopkg.in/yaml.v2":         "yaml",
+		"github.com/foo/go-bar":    "bar",
+		"github.com/foo/bar-go":    "bar",
+		"example.com/mod/v2":       "mod",
+		"github.com/foo/bar.baz/q": "q",
+		"k8s.io/api/core/v1":       "core",
+	} {
+		spec := &ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: `"` + path + `"`}}
+		if got := Name(spec); got != want {
+			t.Errorf("Name(%q) = %q; want %q", path, got, want)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	const src = `package p
+
+// Doc.
+import "os"
+
+import (
+	"example.com/b" // b
+
+	// Fmt.
+	"fmt"
+	"os"
+)
+
+// About x.
+import x "example.com/a"
+
+import (
+	"io" // io
+	// trailing
+)
+
+func f() {}
+`
+	const want = `package p
+
+// Doc.
+import (
+	// Fmt.
+	"fmt"
+	"io" // io
+	"os"
+
+	// About x.
+	x "example.com/a"
+	"example.com/b" // b
+	// trailing
+)
+
+func f() {}
+`
+	got := edit(t, src, Merge)
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// a single import stays unparenthesized
+	got = edit(t, "package p\n\nimport (\n\t\"fmt\" // c\n)\n", Merge)
+	if want := "package p\n\nimport \"fmt\" // c\n"; got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// no edits for merged declarations
+	for _, src := range []string{
+		"package p\n",
+		"package p\n\nimport \"fmt\" // c\n",
+		want,
+	} {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if edits := Merge(fset, f, []byte(src)); edits != nil {
+			t.Errorf("Merge of\n%s\nreturned edits %v", src, edits)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+// Package markdown extracts the Go code blocks of Markdown documents and
+// parses them with github.com/yunabe/golang-codelab/customparser/parser.
+//
+// A Go code block is a fenced code block (delimited by ``` or ~~~) whose
+// info string starts with "go" or "golang". Since documentation rarely
+// shows complete files, each block is parsed as a source file if it
+// starts with a package clause, and otherwise as a list of declarations
+// or a list of statements, whichever fits. Positions, and thus errors,
+// refer to the lines of the Markdown document.
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/yunabe/golang-codelab/customparser/parser"
+)
+
+// A Block is a Go code block of a Markdown document.
+type Block struct {
+	Info string // info string of the opening fence, e.g. "go"
+	Line int    // line of the first line of code in the document
+	Src  []byte // code, with the indentation of the document
+}
+
+// Blocks returns the Go code blocks of the Markdown document src, in
+// document order. A block without closing fence extends to the end of
+// the document.
+func Blocks(src []byte) []*Block {
+	var blocks []*Block
+	var b *Block
+	var fence string // fence of the current block, e.g. "```"
+	var code bool    // in a code block, Go or not
+	lines := bytes.SplitAfter(src, []byte("\n"))
+	for i, line := range lines {
+		trimmed := strings.TrimRight(string(line), "\r\n")
+		if code {
+			if isClosingFence(trimmed, fence) {
+				code = false
+				if b != nil {
+					blocks = append(blocks, b)
+					b = nil
+				}
+			} else if b != nil {
+				b.Src = append(b.Src, line...)
+			}
+			continue
+		}
+		var info string
+		fence, info = openingFence(trimmed)
+		if fence == "" {
+			continue
+		}
+		code = true
+		if lang := strings.Fields(info); len(lang) > 0 && (lang[0] == "go" || lang[0] == "golang") {
+			b = &Block{Info: info, Line: i + 2}
+		}
+	}
+	if b != nil {
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+// openingFence returns the fence and the info string of an opening code
+// fence line: at least three backticks or tildes, indented by up to three
+// spaces. A backtick fence cannot have backticks in its info string.
+func openingFence(line string) (fence, info string) {
+	s := strings.TrimLeft(line, " ")
+	if len(line)-len(s) > 3 || len(s) < 3 || (s[0] != '`' && s[0] != '~') {
+		return "", ""
+	}
+	n := 0
+	for n < len(s) && s[n] == s[0] {
+		n++
+	}
+	if n < 3 {
+		return "", ""
+	}
+	info = strings.TrimSpace(s[n:])
+	if s[0] == '`' && strings.Contains(info, "`") {
+		return "", ""
+	}
+	return s[:n], info
+}
+
+// isClosingFence reports whether line closes a code block opened with
+// fence: it must consist of at least as many of the fence characters,
+// indented by up to three spaces.
+func isClosingFence(line, fence string) bool {
+	s := strings.TrimLeft(line, " ")
+	if len(line)-len(s) > 3 {
+		return false
+	}
+	s = strings.TrimRight(s, " \t")
+	return len(s) >= len(fence) && strings.Trim(s, fence[:1]) == ""
+}
+
+// A Kind describes how a block was parsed.
+type Kind int
+
+const (
+	FileKind  Kind = iota // a source file
+	DeclsKind             // a list of declarations
+	StmtsKind             // a list of statements
+)
+
+var kindStrings = [...]string{
+	FileKind:  "file",
+	DeclsKind: "declarations",
+	StmtsKind: "statements",
+}
+
+func (k Kind) String() string {
+	if 0 <= k && int(k) < len(kindStrings) {
+		return kindStrings[k]
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// A Snippet is a parsed code block.
+type Snippet struct {
+	Block *Block
+	Kind  Kind
+
+	// File is the parsed block. Declarations are parsed in a file of
+	// package p, and statements in the body of the single function of a
+	// file of package p.
+	File *ast.File
+
+	// Err is the scanner.ErrorList of the syntax errors of the block,
+	// or nil.
+	Err error
+}
+
+// Stmts returns the statements of a snippet of kind StmtsKind.
+func (s *Snippet) Stmts() []ast.Stmt {
+	if s.Kind != StmtsKind || len(s.File.Decls) == 0 {
+		return nil
+	}
+	fn, ok := s.File.Decls[len(s.File.Decls)-1].(*ast.FuncDecl)
+	if !ok || fn.Body == nil {
+		return nil
+	}
+	return fn.Body.List
+}
+
+// ParseBlock parses the block b of the Markdown document filename. If b
+// does not start with a package clause, it is parsed as a list of
+// declarations and as a list of statements; if both have syntax errors,
+// the snippet whose first error comes later in the block is returned.
+func ParseBlock(fset *token.FileSet, filename string, b *Block, mode parser.Mode) *Snippet {
+	if startsWithPackage(b.Src) {
+		return parseSnippet(fset, filename, b, FileKind, "", "", mode)
+	}
+	decls := parseSnippet(fset, filename, b, DeclsKind, "package p\n", "", mode)
+	if decls.Err == nil {
+		return decls
+	}
+	stmts := parseSnippet(fset, filename, b, StmtsKind, "package p; func _() {\n", "}\n", mode)
+	if stmts.Err == nil || after(firstError(stmts.Err), firstError(decls.Err)) {
+		return stmts
+	}
+	return decls
+}
+
+// parseSnippet parses the code of b between prefix and suffix. A line
+// directive maps the code to its lines in the document; the suffix is on
+// the line of the closing fence.
+func parseSnippet(fset *token.FileSet, filename string, b *Block, kind Kind, prefix, suffix string, mode parser.Mode) *Snippet {
+	var src bytes.Buffer
+	src.WriteString(prefix)
+	fmt.Fprintf(&src, "//line %s:%d:1\n", filename, b.Line)
+	src.Write(b.Src)
+	if len(b.Src) > 0 && b.Src[len(b.Src)-1] != '\n' {
+		src.WriteByte('\n')
+	}
+	src.WriteString(suffix)
+	f, err := parser.ParseFile(fset, filename, src.Bytes(), mode)
+	return &Snippet{Block: b, Kind: kind, File: f, Err: err}
+}
+
+// startsWithPackage reports whether the first token of src is the package
+// keyword.
+func startsWithPackage(src []byte) bool {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", -1, len(src)), src, nil, 0)
+	_, tok, _ := s.Scan()
+	return tok == token.PACKAGE
+}
+
+func firstError(err error) token.Position {
+	if list, ok := err.(scanner.ErrorList); ok && len(list) > 0 {
+		return list[0].Pos
+	}
+	return token.Position{}
+}
+
+// after reports whether the position p comes after q in the document.
+func after(p, q token.Position) bool {
+	return p.Line > q.Line || p.Line == q.Line && p.Column > q.Column
+}
+
+// ParseFile parses the Go code blocks of the Markdown document filename.
+// The source is provided as for parser.ParseFile. The returned error is
+// a scanner.ErrorList of the syntax errors of all blocks, sorted by
+// position, or the error reading the source.
+func ParseFile(fset *token.FileSet, filename string, src interface{}, mode parser.Mode) ([]*Snippet, error) {
+	text, err := readSource(filename, src)
+	if err != nil {
+		return nil, err
+	}
+	var snippets []*Snippet
+	var errors scanner.ErrorList
+	for _, b := range Blocks(text) {
+		s := ParseBlock(fset, filename, b, mode)
+		if list, ok := s.Err.(scanner.ErrorList); ok {
+			errors = append(errors, list...)
+		}
+		snippets = append(snippets, s)
+	}
+	errors.Sort()
+	return snippets, errors.Err()
+}
+
+func readSource(filename string, src interface{}) ([]byte, error) {
+	switch s := src.(type) {
+	case nil:
+		return ioutil.ReadFile(filename)
+	case string:
+		return []byte(s), nil
+	case []byte:
+		return s, nil
+	case io.Reader:
+		return ioutil.ReadAll(s)
+	}
+	return nil, fmt.Errorf("markdown: invalid source type %T", src)
+}
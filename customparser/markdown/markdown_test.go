@@ -0,0 +1,130 @@
+package markdown
+
+import (
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"reflect"
+	"testing"
+)
+
+const doc = "# Example\n" + // 1
+	"\n" + // 2
+	"```go\n" + // 3
+	"package main\n" + // 4
+	"\n" + // 5
+	"func main() {}\n" + // 6
+	"```\n" + // 7
+	"\n" + // 8
+	"```shell\n" + // 9
+	"go run main.go\n" + // 10
+	"```\n" + // 11
+	"\n" + // 12
+	"- A list item:\n" + // 13
+	"  ~~~~ golang title=decls\n" + // 14
+	"  type T struct{}\n" + // 15
+	"  func (T) M() {}\n" + // 16
+	"  ~~~~\n" + // 17
+	"\n" + // 18
+	"```go\n" + // 19
+	"x := 1\n" + // 20
+	"fmt.Println(x +)\n" + // 21
+	"```\n" + // 22
+	"\n" + // 23
+	"````go\n" + // 24
+	"if x {\n" + // 25
+	"```\n" + // 26
+	"}\n" // 27
+
+func TestBlocks(t *testing.T) {
+	type block struct {
+		info string
+		line int
+		src  string
+	}
+	var got []block
+	for _, b := range Blocks([]byte(doc)) {
+		got = append(got, block{b.Info, b.Line, string(b.Src)})
+	}
+	want := []block{
+		{"go", 4, "package main\n\nfunc main() {}\n"},
+		{"golang title=decls", 15, "  type T struct{}\n  func (T) M() {}\n"},
+		{"go", 20, "x := 1\nfmt.Println(x +)\n"},
+		// the block is not closed by a shorter fence
+		{"go", 25, "if x {\n```\n}\n"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	fset := token.NewFileSet()
+	snippets, err := ParseFile(fset, "README.md", doc, 0)
+	var kinds []Kind
+	for _, s := range snippets {
+		kinds = append(kinds, s.Kind)
+	}
+	if want := []Kind{FileKind, DeclsKind, StmtsKind, StmtsKind}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("got kinds %v; want %v", kinds, want)
+	}
+
+	// errors are reported at their position in the document
+	list, ok := err.(scanner.ErrorList)
+	if !ok {
+		t.Fatalf("got error %v; want a scanner.ErrorList", err)
+	}
+	var got []string
+	for _, e := range list {
+		got = append(got, e.Error())
+	}
+	want := []string{
+		"README.md:21:16: expected operand, found ')'",
+		// the end of the function wrapping the statements is on the
+		// line of the closing fence, or after the document
+		"README.md:22:3: missing ',' in argument list",
+		"README.md:26:3: raw string literal not terminated",
+		"README.md:28:3: expected '}', found 'EOF'",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors\n%q\nwant\n%q", got, want)
+	}
+
+	// positions of the AST
+	decl := snippets[1].File.Decls[1].(*ast.FuncDecl)
+	if pos := fset.Position(decl.Name.Pos()); pos.Filename != "README.md" || pos.Line != 16 || pos.Column != 12 {
+		t.Errorf("got position %s of M; want README.md:16:12", pos)
+	}
+	stmts := snippets[2].Stmts()
+	if len(stmts) != 2 {
+		t.Fatalf("got %d statements; want 2", len(stmts))
+	}
+	if pos := fset.Position(stmts[1].Pos()); pos.Line != 21 || pos.Column != 1 {
+		t.Errorf("got position %s of the second statement; want README.md:21:1", pos)
+	}
+	if snippets[0].Stmts() != nil {
+		t.Errorf("got statements for a file snippet")
+	}
+}
+
+func TestParseBlock(t *testing.T) {
+	for _, test := range []struct {
+		src  string
+		kind Kind
+		err  bool
+	}{
+		{"package p\nvar x int\n", FileKind, false},
+		{"// Comment.\npackage p\n", FileKind, false},
+		{"var x int\n", DeclsKind, false},
+		{"import \"fmt\"\n\nfunc f() { fmt.Println() }\n", DeclsKind, false},
+		{"var x int\nx++\n", StmtsKind, false},
+		{"for {}\n", StmtsKind, false},
+		{"func f() {\n\treturn 1 +\n}\n", DeclsKind, true},
+		{"for i := 0; i < 10 {\n}\n", StmtsKind, true},
+	} {
+		s := ParseBlock(token.NewFileSet(), "doc.md", &Block{Line: 1, Src: []byte(test.src)}, 0)
+		if s.Kind != test.kind || (s.Err != nil) != test.err {
+			t.Errorf("%q: got kind %v, error %v; want %v, error %v", test.src, s.Kind, s.Err, test.kind, test.err)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// Package metrics computes code metrics of the functions of Go source
+// files parsed with github.com/yunabe/golang-codelab/customparser/parser:
+// cyclomatic complexity, maximum nesting depth, statement count,
+// parameter count and length in lines. Metrics can be checked against
+// thresholds and written as CSV or JSON reports.
+package metrics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Func holds the metrics of a function or method declaration. Function
+// literals count towards their enclosing declaration.
+type Func struct {
+	Name string         // function name, or "T.M" for a method M of T or *T
+	Pos  token.Position // position of the name
+
+	// Complexity is the cyclomatic complexity: 1, plus 1 for each if,
+	// for and range statement, non-default case of a switch or select
+	// statement, and && and || operator.
+	Complexity int
+
+	// Nesting is the maximum nesting depth of if, for, range, switch
+	// and select statements and function literals; else-if chains do not
+	// nest.
+	Nesting int
+
+	Statements int // number of statements, not counting blocks and case clauses
+	Params     int // number of parameters, not counting the receiver
+	Lines      int // number of lines of the declaration
+}
+
+// Compute returns the metrics of the function and method declarations of
+// f, in source order. Declarations without a body are skipped.
+func Compute(fset *token.FileSet, f *ast.File) []*Func {
+	var funcs []*Func
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Name == nil || fn.Body == nil {
+			continue
+		}
+		m := &Func{
+			Name:       fn.Name.Name,
+			Pos:        fset.Position(fn.Name.Pos()),
+			Complexity: 1,
+			Lines:      fset.Position(fn.End()).Line - fset.Position(fn.Pos()).Line + 1,
+		}
+		if fn.Recv != nil && len(fn.Recv.List) > 0 {
+			m.Name = recvBaseName(fn.Recv.List[0].Type) + "." + m.Name
+		}
+		if fn.Type.Params != nil {
+			m.Params = fn.Type.Params.NumFields()
+		}
+		v := &visitor{m: m}
+		ast.Walk(v, fn.Body)
+		funcs = append(funcs, m)
+	}
+	return funcs
+}
+
+// recvBaseName returns the base type name of a receiver type.
+func recvBaseName(x ast.Expr) string {
+	for {
+		switch t := x.(type) {
+		case *ast.Ident:
+			return t.Name
+		case *ast.StarExpr:
+			x = t.X
+		case *ast.ParenExpr:
+			x = t.X
+		case *ast.IndexExpr:
+			x = t.X
+		default:
+			return "_"
+		}
+	}
+}
+
+// A visitor accumulates the metrics of a function body; each nested
+// construct is walked with a visitor of the nested depth.
+type visitor struct {
+	m     *Func
+	depth int
+}
+
+func (v *visitor) Visit(n ast.Node) ast.Visitor {
+	switch n.(type) {
+	case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+		// blocks
+	case ast.Stmt:
+		v.m.Statements++
+	}
+
+	switch n := n.(type) {
+	case *ast.IfStmt:
+		v.m.Complexity++
+		return v.nest(n)
+	case *ast.ForStmt, *ast.RangeStmt:
+		v.m.Complexity++
+		return v.nest(n)
+	case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+		return v.nest(n)
+	case *ast.FuncLit:
+		return v.nest(n)
+	case *ast.CaseClause:
+		if n.List != nil {
+			v.m.Complexity++
+		}
+	case *ast.CommClause:
+		if n.Comm != nil {
+			v.m.Complexity++
+		}
+	case *ast.BinaryExpr:
+		if n.Op == token.LAND || n.Op == token.LOR {
+			v.m.Complexity++
+		}
+	}
+	return v
+}
+
+// nest walks the children of the nesting construct n one level deeper.
+func (v *visitor) nest(n ast.Node) ast.Visitor {
+	w := &visitor{m: v.m, depth: v.depth + 1}
+	if w.depth > v.m.Nesting {
+		v.m.Nesting = w.depth
+	}
+	if s, ok := n.(*ast.IfStmt); ok && s.Else != nil {
+		// walk the if statement without its else branch, and an else-if
+		// at the depth of the if statement
+		if s.Init != nil {
+			ast.Walk(w, s.Init)
+		}
+		ast.Walk(w, s.Cond)
+		ast.Walk(w, s.Body)
+		if elif, ok := s.Else.(*ast.IfStmt); ok {
+			ast.Walk(v, elif)
+		} else {
+			ast.Walk(w, s.Else)
+		}
+		return nil
+	}
+	return w
+}
+
+// ----------------------------------------------------------------------------
+// Thresholds
+
+// Metric names, as used in violations and reports.
+const (
+	Complexity = "complexity"
+	Nesting    = "nesting"
+	Statements = "statements"
+	Params     = "params"
+	Lines      = "lines"
+)
+
+// Thresholds are the maximum values of the metrics of a function. A zero
+// threshold is not checked.
+type Thresholds struct {
+	Complexity int
+	Nesting    int
+	Statements int
+	Params     int
+	Lines      int
+}
+
+// A Violation is a metric of a function exceeding its threshold.
+type Violation struct {
+	Metric string
+	Value  int
+	Limit  int
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s %d exceeds %d", v.Metric, v.Value, v.Limit)
+}
+
+// Check returns the metrics of fn that exceed the thresholds t.
+func (t Thresholds) Check(fn *Func) []Violation {
+	var list []Violation
+	check := func(metric string, value, limit int) {
+		if limit > 0 && value > limit {
+			list = append(list, Violation{metric, value, limit})
+		}
+	}
+	check(Complexity, fn.Complexity, t.Complexity)
+	check(Nesting, fn.Nesting, t.Nesting)
+	check(Statements, fn.Statements, t.Statements)
+	check(Params, fn.Params, t.Params)
+	check(Lines, fn.Lines, t.Lines)
+	return list
+}
+
+// ----------------------------------------------------------------------------
+// Reports
+
+// WriteCSV writes funcs to w as CSV with a header line and the columns
+// file, line, column, function, complexity, nesting, statements, params,
+// lines and violations. The violations column lists the metrics of the
+// function exceeding the thresholds t, separated by semicolons.
+func WriteCSV(w io.Writer, funcs []*Func, t Thresholds) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"file", "line", "column", "function", Complexity, Nesting, Statements, Params, Lines, "violations"})
+	for _, fn := range funcs {
+		var violations []string
+		for _, v := range t.Check(fn) {
+			violations = append(violations, v.Metric)
+		}
+		cw.Write([]string{
+			fn.Pos.Filename,
+			strconv.Itoa(fn.Pos.Line),
+			strconv.Itoa(fn.Pos.Column),
+			fn.Name,
+			strconv.Itoa(fn.Complexity),
+			strconv.Itoa(fn.Nesting),
+			strconv.Itoa(fn.Statements),
+			strconv.Itoa(fn.Params),
+			strconv.Itoa(fn.Lines),
+			strings.Join(violations, ";"),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// jsonFunc and jsonViolation are the JSON representations of a Func and
+// a Violation.
+type jsonFunc struct {
+	Function   string          `json:"function"`
+	Pos        string          `json:"pos"`
+	Complexity int             `json:"complexity"`
+	Nesting    int             `json:"nesting"`
+	Statements int             `json:"statements"`
+	Params     int             `json:"params"`
+	Lines      int             `json:"lines"`
+	Violations []jsonViolation `json:"violations,omitempty"`
+}
+
+type jsonViolation struct {
+	Metric string `json:"metric"`
+	Value  int    `json:"value"`
+	Limit  int    `json:"limit"`
+}
+
+// WriteJSON writes funcs to w as an indented JSON array of objects with
+// the members "function", "pos" (in file:line:col form), the metrics,
+// and "violations", the metrics exceeding the thresholds t, if any.
+func WriteJSON(w io.Writer, funcs []*Func, t Thresholds) error {
+	list := make([]jsonFunc, len(funcs))
+	for i, fn := range funcs {
+		list[i] = jsonFunc{
+			Function:   fn.Name,
+			Pos:        fn.Pos.String(),
+			Complexity: fn.Complexity,
+			Nesting:    fn.Nesting,
+			Statements: fn.Statements,
+			Params:     fn.Params,
+			Lines:      fn.Lines,
+		}
+		for _, v := range t.Check(fn) {
+			list[i].Violations = append(list[i].Violations, jsonViolation{v.Metric, v.Value, v.Limit})
+		}
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/token"
+	"reflect"
+	"testing"
+
+	"github.com/yunabe/golang-codelab/customparser/parser"
+)
+
+const src = `package p
+
+func empty() {}
+
+func (t *T) branches(a, b int, c string) int {
+	if a > 0 && b > 0 {
+		return 1
+	} else if a < 0 || b < 0 {
+		return 2
+	} else {
+		a++
+	}
+	switch c {
+	case "x", "y":
+		return 3
+	case "z":
+	default:
+		return 4
+	}
+	return 0
+}
+
+func nested(ch chan int, xs []int) {
+	for _, x := range xs {
+		for i := 0; i < x; i++ {
+			if i%2 == 0 {
+				f := func() {
+					select {
+					case <-ch:
+					default:
+					}
+				}
+				f()
+			}
+		}
+	}
+}
+
+func decl(int)
+`
+
+func compute(t *testing.T) []*Func {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Compute(fset, f)
+}
+
+func TestCompute(t *testing.T) {
+	type metrics struct {
+		name                                            string
+		line, complexity, nesting, stmts, params, lines int
+	}
+	want := []metrics{
+		{"empty", 3, 1, 0, 0, 0, 1},
+		// if, &&, else if, ||, 2 cases
+		{"T.branches", 5, 7, 1, 9, 3, 17},
+		// range, for, if, select case
+		{"nested", 23, 5, 5, 9, 2, 15},
+	}
+	var got []metrics
+	for _, fn := range compute(t) {
+		got = append(got, metrics{fn.Name, fn.Pos.Line, fn.Complexity, fn.Nesting, fn.Statements, fn.Params, fn.Lines})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestThresholds(t *testing.T) {
+	funcs := compute(t)
+	th := Thresholds{Complexity: 5, Nesting: 3, Lines: 15}
+	if v := th.Check(funcs[0]); v != nil {
+		t.Errorf("empty: got violations %v", v)
+	}
+	want := []Violation{{Complexity, 7, 5}, {Lines, 17, 15}}
+	if v := th.Check(funcs[1]); !reflect.DeepEqual(v, want) {
+		t.Errorf("branches: got violations %v; want %v", v, want)
+	}
+	if v := th.Check(funcs[2]); len(v) != 1 || v[0].String() != "nesting 5 exceeds 3" {
+		t.Errorf("nested: got violations %v", v)
+	}
+}
+
+func TestReports(t *testing.T) {
+	funcs := compute(t)
+	th := Thresholds{Complexity: 5}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, funcs, th); err != nil {
+		t.Fatal(err)
+	}
+	want := `file,line,column,function,complexity,nesting,statements,params,lines,violations
+p.go,3,6,empty,1,0,0,0,1,
+p.go,5,13,T.branches,7,1,9,3,17,complexity
+p.go,23,6,nested,5,5,9,2,15,
+`
+	if got := buf.String(); got != want {
+		t.Errorf("CSV: got\n%s\nwant\n%s", got, want)
+	}
+
+	buf.Reset()
+	if err := WriteJSON(&buf, funcs, th); err != nil {
+		t.Fatal(err)
+	}
+	var list []struct {
+		Function   string
+		Pos        string
+		Complexity int
+		Violations []struct {
+			Metric       string
+			Value, Limit int
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &list); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if len(list) != 3 || list[1].Function != "T.branches" || list[1].Pos != "p.go:5:13" || list[1].Complexity != 7 {
+		t.Fatalf("got %+v", list)
+	}
+	if v := list[1].Violations; len(v) != 1 || v[0].Metric != "complexity" || v[0].Value != 7 || v[0].Limit != 5 {
+		t.Errorf("got violations %+v", v)
+	}
+	if list[0].Violations != nil {
+		t.Errorf("got violations %+v for empty", list[0].Violations)
+	}
+}
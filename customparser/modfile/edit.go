@@ -0,0 +1,365 @@
+package modfile
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/yunabe/golang-codelab/customparser/textedit"
+)
+
+// noSpan is the span of a line added by an edit.
+var noSpan = [2]int{-1, -1}
+
+// AddGoStmt sets the version of the go statement, adding the statement
+// after the module statement if there is none.
+func (f *File) AddGoStmt(version string) error {
+	if !goVersionRx.MatchString(version) {
+		return fmt.Errorf("invalid go version %q", version)
+	}
+	if f.Go != nil {
+		f.Go.Version = version
+		setTokens(f.Go.Syntax, "go", version)
+		return nil
+	}
+	var after *Line
+	if f.Module != nil {
+		after = f.Module.Syntax
+	}
+	f.Go = &Go{Version: version, Syntax: f.insertLineAfter(after, "\n", "go", version)}
+	return nil
+}
+
+// AddToolchainStmt sets the name of the toolchain statement, adding the
+// statement after the go statement (or the module statement) if there is
+// none.
+func (f *File) AddToolchainStmt(name string) error {
+	if !toolchainRx.MatchString(name) {
+		return fmt.Errorf("invalid toolchain name %q", name)
+	}
+	if f.Toolchain != nil {
+		f.Toolchain.Name = name
+		setTokens(f.Toolchain.Syntax, "toolchain", name)
+		return nil
+	}
+	var after *Line
+	sep := ""
+	switch {
+	case f.Go != nil:
+		after = f.Go.Syntax
+	case f.Module != nil:
+		after, sep = f.Module.Syntax, "\n"
+	}
+	f.Toolchain = &Toolchain{Name: name, Syntax: f.insertLineAfter(after, sep, "toolchain", name)}
+	return nil
+}
+
+// AddRequire sets the version of the requirement of the module path,
+// adding the requirement if there is none.
+func (f *File) AddRequire(path, version string) error {
+	if !semverRx.MatchString(version) {
+		return fmt.Errorf("invalid module version %q", version)
+	}
+	for _, r := range f.Require {
+		if r.Mod.Path == path {
+			r.Mod.Version = version
+			setTokens(r.Syntax, "require", path, version)
+			return nil
+		}
+	}
+	f.Require = append(f.Require, &Require{Mod: Version{path, version}, Syntax: f.addLine("require", path, version)})
+	return nil
+}
+
+// DropRequire removes the requirements of the module path.
+func (f *File) DropRequire(path string) {
+	list := f.Require[:0]
+	for _, r := range f.Require {
+		if r.Mod.Path == path {
+			r.Syntax.deleted = true
+		} else {
+			list = append(list, r)
+		}
+	}
+	f.Require = list
+}
+
+// AddExclude adds an exclusion of the module version, unless it is
+// excluded already.
+func (f *File) AddExclude(path, version string) error {
+	if !semverRx.MatchString(version) {
+		return fmt.Errorf("invalid module version %q", version)
+	}
+	for _, x := range f.Exclude {
+		if x.Mod.Path == path && x.Mod.Version == version {
+			return nil
+		}
+	}
+	f.Exclude = append(f.Exclude, &Exclude{Mod: Version{path, version}, Syntax: f.addLine("exclude", path, version)})
+	return nil
+}
+
+// DropExclude removes the exclusion of the module version.
+func (f *File) DropExclude(path, version string) {
+	list := f.Exclude[:0]
+	for _, x := range f.Exclude {
+		if x.Mod.Path == path && x.Mod.Version == version {
+			x.Syntax.deleted = true
+		} else {
+			list = append(list, x)
+		}
+	}
+	f.Exclude = list
+}
+
+// AddReplace sets the replacement of the module oldPath at version
+// oldVersion (all versions if empty) to newPath at newVersion, which
+// must be empty if newPath is a directory. An existing replacement of
+// the same module version is changed.
+func (f *File) AddReplace(oldPath, oldVersion, newPath, newVersion string) error {
+	if oldVersion != "" && !semverRx.MatchString(oldVersion) {
+		return fmt.Errorf("invalid module version %q", oldVersion)
+	}
+	if IsDirectoryPath(newPath) {
+		if newVersion != "" {
+			return fmt.Errorf("replacement directory %s cannot have version", newPath)
+		}
+	} else if !semverRx.MatchString(newVersion) {
+		return fmt.Errorf("invalid module version %q", newVersion)
+	}
+
+	args := []string{oldPath}
+	if oldVersion != "" {
+		args = append(args, oldVersion)
+	}
+	args = append(args, "=>", newPath)
+	if newVersion != "" {
+		args = append(args, newVersion)
+	}
+	newMod := Version{newPath, newVersion}
+	for _, r := range f.Replace {
+		if r.Old.Path == oldPath && r.Old.Version == oldVersion {
+			r.New = newMod
+			setTokens(r.Syntax, append([]string{"replace"}, args...)...)
+			return nil
+		}
+	}
+	line := f.addLine("replace", args...)
+	f.Replace = append(f.Replace, &Replace{Old: Version{oldPath, oldVersion}, New: newMod, Syntax: line})
+	return nil
+}
+
+// DropReplace removes the replacement of the module oldPath at version
+// oldVersion.
+func (f *File) DropReplace(oldPath, oldVersion string) {
+	list := f.Replace[:0]
+	for _, r := range f.Replace {
+		if r.Old.Path == oldPath && r.Old.Version == oldVersion {
+			r.Syntax.deleted = true
+		} else {
+			list = append(list, r)
+		}
+	}
+	f.Replace = list
+}
+
+// AddUse adds the directory path to a go.work file, unless it is used
+// already.
+func (f *File) AddUse(path string) error {
+	if !f.work {
+		return fmt.Errorf("use directive in go.mod file")
+	}
+	for _, u := range f.Use {
+		if u.Path == path {
+			return nil
+		}
+	}
+	f.Use = append(f.Use, &Use{Path: path, Syntax: f.addLine("use", path)})
+	return nil
+}
+
+// DropUse removes the directory path from a go.work file.
+func (f *File) DropUse(path string) {
+	list := f.Use[:0]
+	for _, u := range f.Use {
+		if u.Path == path {
+			u.Syntax.deleted = true
+		} else {
+			list = append(list, u)
+		}
+	}
+	f.Use = list
+}
+
+// setTokens sets the tokens of line, a statement with the given verb and
+// arguments (without the verb in a block).
+func setTokens(line *Line, verbAndArgs ...string) {
+	if line.InBlock {
+		verbAndArgs = verbAndArgs[1:]
+	}
+	line.Token = verbAndArgs
+	line.modified = true
+}
+
+// addLine adds a statement with the given verb and arguments: to the last
+// block of the verb, after the last statement of the verb, or at the end
+// of the file.
+func (f *File) addLine(verb string, args ...string) *Line {
+	var block *LineBlock
+	var last *Line
+	for _, stmt := range f.Syntax.Stmt {
+		switch stmt := stmt.(type) {
+		case *LineBlock:
+			if len(stmt.Token) == 1 && stmt.Token[0] == verb {
+				block = stmt
+			}
+		case *Line:
+			if !stmt.deleted && stmt.Token[0] == verb {
+				last = stmt
+			}
+		}
+	}
+	if block != nil {
+		line := &Line{Token: args, InBlock: true, span: noSpan, insertAt: block.closeOff}
+		block.Line = append(block.Line, line)
+		return line
+	}
+	if last != nil {
+		return f.insertLineAfter(last, "", append([]string{verb}, args...)...)
+	}
+	sep := ""
+	if len(f.Syntax.src) > 0 {
+		sep = "\n"
+	}
+	line := &Line{Token: append([]string{verb}, args...), span: noSpan, insertAt: len(f.Syntax.src), sep: sep}
+	f.Syntax.Stmt = append(f.Syntax.Stmt, line)
+	return line
+}
+
+// insertLineAfter inserts a top-level statement after the statement
+// after, or at the beginning of the file if after is nil. The statement
+// is separated from the previous one, if any, by sep.
+func (f *File) insertLineAfter(after *Line, sep string, tokens ...string) *Line {
+	line := &Line{Token: tokens, span: noSpan}
+	i := 0
+	if after != nil {
+		line.sep = sep
+		line.insertAt = after.span[1]
+		if after.span[0] < 0 {
+			line.insertAt = after.insertAt
+		}
+		for j, stmt := range f.Syntax.Stmt {
+			if stmt == Expr(after) {
+				i = j + 1
+			}
+		}
+	}
+	stmts := f.Syntax.Stmt
+	f.Syntax.Stmt = append(stmts[:i:i], line)
+	f.Syntax.Stmt = append(f.Syntax.Stmt, stmts[i:]...)
+	return line
+}
+
+// ----------------------------------------------------------------------------
+// Writing
+
+// Edits returns the textual edits transforming the source of the file
+// into the source of the modified file. Modified lines keep their
+// indentation and comments; deleted lines are removed with their
+// comment lines, and blocks are removed when all their lines are.
+func (f *File) Edits() []textedit.Edit {
+	src := f.Syntax.src
+	w := &editWriter{src: src, blank: -1}
+	for _, stmt := range f.Syntax.Stmt {
+		switch stmt := stmt.(type) {
+		case *Line:
+			w.line(stmt, "")
+		case *LineBlock:
+			empty := len(stmt.Line) > 0
+			for _, line := range stmt.Line {
+				if !line.deleted {
+					empty = false
+				}
+			}
+			if empty {
+				w.delete(stmt.span, true)
+				continue
+			}
+			for _, line := range stmt.Line {
+				w.line(line, "\t")
+			}
+		}
+	}
+	return w.edits
+}
+
+// Format returns the source of the modified file. The File still
+// describes the original source; it must be parsed again to be edited
+// further.
+func (f *File) Format() ([]byte, error) {
+	return textedit.Apply(f.Syntax.src, f.Edits())
+}
+
+type editWriter struct {
+	src        []byte
+	edits      []textedit.Edit
+	terminated bool // a newline was added to the unterminated last line
+	blank      int  // offset of src before which the output ends with a blank line, or -1
+}
+
+func (w *editWriter) line(line *Line, indent string) {
+	switch {
+	case line.span[0] < 0:
+		if line.deleted {
+			return
+		}
+		sep := line.sep
+		if line.insertAt == w.blank {
+			sep = "" // the deleted lines before were separated by a blank line
+		}
+		w.blank = -1
+		text := sep + indent + formatLine(line) + "\n"
+		if line.insertAt == len(w.src) && len(w.src) > 0 && w.src[len(w.src)-1] != '\n' && !w.terminated {
+			text = "\n" + text
+			w.terminated = true
+		}
+		w.edits = append(w.edits, textedit.Edit{Start: line.insertAt, End: line.insertAt, New: text})
+	case line.deleted:
+		w.delete(line.span, !line.InBlock)
+	case line.modified:
+		w.edits = append(w.edits, textedit.Edit{Start: line.content[0], End: line.content[1], New: formatLine(line)})
+	}
+}
+
+// delete removes the text of span. Deleting a top-level statement
+// between blank lines removes one of them too.
+func (w *editWriter) delete(span [2]int, topLevel bool) {
+	start, end := span[0], span[1]
+	if topLevel && (start == 0 || start >= 2 && w.src[start-1] == '\n' && w.src[start-2] == '\n') {
+		if end < len(w.src) && w.src[end] == '\n' {
+			end++
+		}
+		w.blank = end
+	}
+	w.edits = append(w.edits, textedit.Edit{Start: start, End: end})
+}
+
+// formatLine returns the tokens and suffix comments of line.
+func formatLine(line *Line) string {
+	var parts []string
+	for _, t := range line.Token {
+		parts = append(parts, quote(t))
+	}
+	for _, c := range line.Suffix {
+		parts = append(parts, c.Text)
+	}
+	return strings.Join(parts, " ")
+}
+
+// quote quotes a token if it cannot be written as a word.
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n()\"`") || strings.Contains(s, "//") {
+		return strconv.Quote(s)
+	}
+	return s
+}
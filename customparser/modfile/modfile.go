@@ -0,0 +1,369 @@
+// Package modfile parses go.mod and go.work files, the module files of
+// the go command.
+//
+// Parse and ParseWork return a File holding both the typed directives of
+// the file (module, go, toolchain, godebug, require, replace, exclude,
+// retract, tool and use) and its syntax, which preserves the comments.
+// Syntax errors and invalid directives are reported as a
+// scanner.ErrorList, like those of
+// github.com/yunabe/golang-codelab/customparser/parser, with positions
+// recorded in a token.FileSet.
+//
+// The methods of File modifying the directives, such as AddRequire and
+// DropReplace, keep track of the changes, so that Format can write the
+// file back with minimal edits: the text of the unchanged lines,
+// comments included, is kept as is.
+package modfile
+
+import (
+	"go/scanner"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A File is a parsed go.mod or go.work file.
+type File struct {
+	Module    *Module // go.mod only
+	Go        *Go
+	Toolchain *Toolchain
+	Godebug   []*Godebug
+	Require   []*Require // go.mod only
+	Exclude   []*Exclude // go.mod only
+	Replace   []*Replace
+	Retract   []*Retract // go.mod only
+	Tool      []*Tool    // go.mod only
+	Use       []*Use     // go.work only
+
+	Syntax *FileSyntax
+
+	work bool
+}
+
+// A Version is a module path and version. The version is empty for
+// replacements of all versions of a module, and for replacements by a
+// directory.
+type Version struct {
+	Path    string
+	Version string
+}
+
+func (v Version) String() string {
+	if v.Version == "" {
+		return v.Path
+	}
+	return v.Path + "@" + v.Version
+}
+
+// A Module is the module statement.
+type Module struct {
+	Mod        Version // the path of the module, without version
+	Deprecated string  // deprecation message from a "Deprecated:" comment, if any
+	Syntax     *Line
+}
+
+// A Go is the go statement.
+type Go struct {
+	Version string // e.g. "1.21" or "1.21.0"
+	Syntax  *Line
+}
+
+// A Toolchain is the toolchain statement.
+type Toolchain struct {
+	Name   string // e.g. "go1.21.0" or "default"
+	Syntax *Line
+}
+
+// A Godebug is a single godebug key=value setting.
+type Godebug struct {
+	Key    string
+	Value  string
+	Syntax *Line
+}
+
+// A Require is a single requirement.
+type Require struct {
+	Mod      Version
+	Indirect bool // has "// indirect" comment
+	Syntax   *Line
+}
+
+// An Exclude is a single exclusion.
+type Exclude struct {
+	Mod    Version
+	Syntax *Line
+}
+
+// A Replace is a single replacement.
+type Replace struct {
+	Old    Version
+	New    Version // a directory if New.Version is empty and New.Path is a file path
+	Syntax *Line
+}
+
+// A Retract is a single retraction of a version or a closed interval of
+// versions.
+type Retract struct {
+	Low, High string // equal for a single version
+	Rationale string // text of the comments of the retraction
+	Syntax    *Line
+}
+
+// A Tool is a single tool of a go.mod file.
+type Tool struct {
+	Path   string
+	Syntax *Line
+}
+
+// A Use is a single directory of a go.work file.
+type Use struct {
+	Path   string
+	Syntax *Line
+}
+
+// Parse parses the go.mod file filename with contents src and adds it to
+// fset. If there are errors, Parse returns the directives that could be
+// parsed along with a scanner.ErrorList sorted by position.
+func Parse(fset *token.FileSet, filename string, src []byte) (*File, error) {
+	return parse(fset, filename, src, false)
+}
+
+// ParseWork is like Parse for go.work files.
+func ParseWork(fset *token.FileSet, filename string, src []byte) (*File, error) {
+	return parse(fset, filename, src, true)
+}
+
+// A fileParser decodes the directives of a file from its syntax.
+type fileParser struct {
+	f      *File
+	errors scanner.ErrorList
+}
+
+func (p *fileParser) error(pos token.Pos, msg string) {
+	p.errors.Add(p.f.Syntax.file.Position(pos), msg)
+}
+
+func parse(fset *token.FileSet, filename string, src []byte, work bool) (*File, error) {
+	file := fset.AddFile(filename, -1, len(src))
+	file.SetLinesForContent(src)
+	syntax, errors := parseSyntax(file, filename, src)
+	p := &fileParser{f: &File{Syntax: syntax, work: work}, errors: errors}
+	for _, stmt := range syntax.Stmt {
+		switch stmt := stmt.(type) {
+		case *Line:
+			p.directive(stmt.Token[0], stmt.Token[1:], stmt)
+		case *LineBlock:
+			if len(stmt.Token) == 0 {
+				continue // reported by parseSyntax
+			}
+			if len(stmt.Token) > 1 {
+				p.error(stmt.Lparen, "unexpected token "+stmt.Token[1]+" before (")
+			}
+			verb := stmt.Token[0]
+			switch verb {
+			case "module", "go", "toolchain":
+				p.error(stmt.Lparen, verb+" directive cannot be a block")
+				continue
+			}
+			for _, line := range stmt.Line {
+				p.directive(verb, line.Token, line)
+			}
+		}
+	}
+	p.errors.Sort()
+	return p.f, p.errors.Err()
+}
+
+var (
+	goVersionRx = regexp.MustCompile(`^([1-9][0-9]*)\.(0|[1-9][0-9]*)(\.(0|[1-9][0-9]*))?((rc|beta)[1-9][0-9]*)?$`)
+	toolchainRx = regexp.MustCompile(`^(default|go1(\.(0|[1-9][0-9]*)){0,2}((rc|beta)[1-9][0-9]*)?(-[^ ]+)?)$`)
+	semverRx    = regexp.MustCompile(`^v(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+)
+
+// directive decodes the directive verb with arguments args on line.
+func (p *fileParser) directive(verb string, args []string, line *Line) {
+	f := p.f
+	pos := line.Start
+	allowed := map[string]bool{"go": true, "toolchain": true, "godebug": true, "replace": true}
+	if f.work {
+		allowed["use"] = true
+	} else {
+		for _, v := range []string{"module", "require", "exclude", "retract", "tool"} {
+			allowed[v] = true
+		}
+	}
+	if !allowed[verb] {
+		p.error(pos, "unknown directive: "+verb)
+		return
+	}
+
+	switch verb {
+	case "module":
+		if f.Module != nil {
+			p.error(pos, "repeated module statement")
+			return
+		}
+		if len(args) != 1 {
+			p.error(pos, "usage: module module/path")
+			return
+		}
+		f.Module = &Module{Mod: Version{Path: args[0]}, Syntax: line}
+		for _, c := range append(line.Before, line.Suffix...) {
+			text := strings.TrimSpace(strings.TrimPrefix(c.Text, "//"))
+			if strings.HasPrefix(text, "Deprecated:") {
+				f.Module.Deprecated = strings.TrimSpace(strings.TrimPrefix(text, "Deprecated:"))
+			}
+		}
+
+	case "go":
+		if f.Go != nil {
+			p.error(pos, "repeated go statement")
+			return
+		}
+		if len(args) != 1 {
+			p.error(pos, "usage: go 1.23")
+			return
+		}
+		if !goVersionRx.MatchString(args[0]) {
+			p.error(pos, "invalid go version '"+args[0]+"': must match format 1.23.0")
+			return
+		}
+		f.Go = &Go{Version: args[0], Syntax: line}
+
+	case "toolchain":
+		if f.Toolchain != nil {
+			p.error(pos, "repeated toolchain statement")
+			return
+		}
+		if len(args) != 1 {
+			p.error(pos, "usage: toolchain go1.23.0")
+			return
+		}
+		if !toolchainRx.MatchString(args[0]) {
+			p.error(pos, "invalid toolchain name '"+args[0]+"': must match format go1.23.0 or default")
+			return
+		}
+		f.Toolchain = &Toolchain{Name: args[0], Syntax: line}
+
+	case "godebug":
+		if len(args) != 1 || strings.ContainsAny(args[0], "\"`',") {
+			p.error(pos, "usage: godebug key=value")
+			return
+		}
+		i := strings.Index(args[0], "=")
+		if i <= 0 {
+			p.error(pos, "usage: godebug key=value")
+			return
+		}
+		f.Godebug = append(f.Godebug, &Godebug{Key: args[0][:i], Value: args[0][i+1:], Syntax: line})
+
+	case "require", "exclude":
+		if len(args) != 2 {
+			p.error(pos, "usage: "+verb+" module/path v1.2.3")
+			return
+		}
+		if !p.checkVersion(pos, args[1]) {
+			return
+		}
+		mod := Version{args[0], args[1]}
+		if verb == "require" {
+			f.Require = append(f.Require, &Require{Mod: mod, Indirect: isIndirect(line), Syntax: line})
+		} else {
+			f.Exclude = append(f.Exclude, &Exclude{Mod: mod, Syntax: line})
+		}
+
+	case "replace":
+		const usage = "usage: replace module/path [v1.2.3] => other/module v1.4\n\t or replace module/path [v1.2.3] => ../local/directory"
+		arrow := 1
+		if len(args) > 1 && args[1] != "=>" {
+			arrow = 2
+		}
+		if len(args) <= arrow || args[arrow] != "=>" || len(args) < arrow+2 || len(args) > arrow+3 {
+			p.error(pos, usage)
+			return
+		}
+		r := &Replace{Old: Version{Path: args[0]}, New: Version{Path: args[arrow+1]}, Syntax: line}
+		if arrow == 2 {
+			if !p.checkVersion(pos, args[1]) {
+				return
+			}
+			r.Old.Version = args[1]
+		}
+		if len(args) == arrow+3 {
+			if IsDirectoryPath(r.New.Path) {
+				p.error(pos, "replacement module directory path "+r.New.Path+" cannot have version")
+				return
+			}
+			if !p.checkVersion(pos, args[arrow+2]) {
+				return
+			}
+			r.New.Version = args[arrow+2]
+		} else if !IsDirectoryPath(r.New.Path) {
+			p.error(pos, "replacement module without version must be directory path (rooted or starting with ./ or ../)")
+			return
+		}
+		f.Replace = append(f.Replace, r)
+
+	case "retract":
+		r := &Retract{Syntax: line}
+		switch {
+		case len(args) == 1 && !strings.HasPrefix(args[0], "["):
+			r.Low, r.High = args[0], args[0]
+		case len(args) == 2 && strings.HasPrefix(args[0], "[") && strings.HasSuffix(args[0], ",") && strings.HasSuffix(args[1], "]"):
+			r.Low = strings.TrimSuffix(strings.TrimPrefix(args[0], "["), ",")
+			r.High = strings.TrimSuffix(args[1], "]")
+		default:
+			p.error(pos, "usage: retract v1.2.3 or retract [v1.0.0, v1.2.3]")
+			return
+		}
+		if !p.checkVersion(pos, r.Low) || !p.checkVersion(pos, r.High) {
+			return
+		}
+		var rationale []string
+		for _, c := range append(line.Before, line.Suffix...) {
+			rationale = append(rationale, strings.TrimSpace(strings.TrimPrefix(c.Text, "//")))
+		}
+		r.Rationale = strings.Join(rationale, "\n")
+		f.Retract = append(f.Retract, r)
+
+	case "tool":
+		if len(args) != 1 {
+			p.error(pos, "usage: tool module/path/cmd")
+			return
+		}
+		f.Tool = append(f.Tool, &Tool{Path: args[0], Syntax: line})
+
+	case "use":
+		if len(args) != 1 {
+			p.error(pos, "usage: use local/dir")
+			return
+		}
+		f.Use = append(f.Use, &Use{Path: args[0], Syntax: line})
+	}
+}
+
+// checkVersion reports an error if v is not a semantic version.
+func (p *fileParser) checkVersion(pos token.Pos, v string) bool {
+	if !semverRx.MatchString(v) {
+		p.error(pos, "invalid module version "+v+": must be of the form v1.2.3")
+		return false
+	}
+	return true
+}
+
+// isIndirect reports whether line has an "// indirect" comment.
+func isIndirect(line *Line) bool {
+	if len(line.Suffix) == 0 {
+		return false
+	}
+	f := strings.Fields(strings.TrimPrefix(line.Suffix[0].Text, "//"))
+	return len(f) > 0 && (f[0] == "indirect" || f[0] == "indirect;")
+}
+
+// IsDirectoryPath reports whether the path of a replacement is a
+// directory: a rooted path or a path starting with ./ or ../.
+func IsDirectoryPath(path string) bool {
+	return strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../") || path == "." || path == ".." ||
+		strings.HasPrefix(path, "/") || filepath.IsAbs(path)
+}
@@ -0,0 +1,357 @@
+package modfile
+
+import (
+	"go/scanner"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const gomod = `// Deprecated: use example.com/m/v2.
+module example.com/m
+
+go 1.21
+
+toolchain go1.21.3
+
+require example.com/a v1.0.0
+
+require (
+	// b is needed by the tests.
+	example.com/b v1.2.0 // indirect
+	"example.com/c" v0.1.0
+)
+
+exclude example.com/a v0.9.0
+
+replace example.com/b => ../b
+
+replace example.com/c v0.1.0 => example.com/c2 v0.2.0
+
+retract (
+	v1.0.1 // published accidentally
+	[v0.5.0, v0.6.0]
+)
+
+godebug (
+	default=go1.21
+	panicnil=1
+)
+
+tool example.com/m/cmd/gen
+`
+
+func TestParse(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := Parse(fset, "go.mod", []byte(gomod))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.Module.Mod.Path, "example.com/m"; got != want {
+		t.Errorf("module %q; want %q", got, want)
+	}
+	if got, want := f.Module.Deprecated, "use example.com/m/v2."; got != want {
+		t.Errorf("deprecated %q; want %q", got, want)
+	}
+	if f.Go.Version != "1.21" || f.Toolchain.Name != "go1.21.3" {
+		t.Errorf("go %q, toolchain %q", f.Go.Version, f.Toolchain.Name)
+	}
+
+	var reqs []string
+	for _, r := range f.Require {
+		s := r.Mod.String()
+		if r.Indirect {
+			s += " indirect"
+		}
+		reqs = append(reqs, s)
+	}
+	if want := []string{"example.com/a@v1.0.0", "example.com/b@v1.2.0 indirect", "example.com/c@v0.1.0"}; !reflect.DeepEqual(reqs, want) {
+		t.Errorf("require %q; want %q", reqs, want)
+	}
+	if len(f.Exclude) != 1 || f.Exclude[0].Mod.String() != "example.com/a@v0.9.0" {
+		t.Errorf("exclude %v", f.Exclude)
+	}
+
+	var reps []string
+	for _, r := range f.Replace {
+		reps = append(reps, r.Old.String()+" => "+r.New.String())
+	}
+	if want := []string{"example.com/b => ../b", "example.com/c@v0.1.0 => example.com/c2@v0.2.0"}; !reflect.DeepEqual(reps, want) {
+		t.Errorf("replace %q; want %q", reps, want)
+	}
+
+	if len(f.Retract) != 2 {
+		t.Fatalf("got %d retractions; want 2", len(f.Retract))
+	}
+	if r := f.Retract[0]; r.Low != "v1.0.1" || r.High != "v1.0.1" || r.Rationale != "published accidentally" {
+		t.Errorf("retract %+v", r)
+	}
+	if r := f.Retract[1]; r.Low != "v0.5.0" || r.High != "v0.6.0" || r.Rationale != "" {
+		t.Errorf("retract %+v", r)
+	}
+	if len(f.Godebug) != 2 || f.Godebug[1].Key != "panicnil" || f.Godebug[1].Value != "1" {
+		t.Errorf("godebug %+v", f.Godebug)
+	}
+	if len(f.Tool) != 1 || f.Tool[0].Path != "example.com/m/cmd/gen" {
+		t.Errorf("tool %+v", f.Tool)
+	}
+
+	// comments and positions
+	b := f.Require[1].Syntax
+	if len(b.Before) != 1 || b.Before[0].Text != "// b is needed by the tests." {
+		t.Errorf("comments before b: %v", b.Before)
+	}
+	if pos := fset.Position(b.Start); pos.Line != 12 || pos.Column != 2 {
+		t.Errorf("b at %v; want go.mod:12:2", pos)
+	}
+	if _, ok := f.Syntax.Stmt[0].(*Line); !ok || len(f.Syntax.Stmt[0].Comment().Before) != 1 {
+		t.Errorf("module statement without its comment: %#v", f.Syntax.Stmt[0])
+	}
+}
+
+func TestParseWork(t *testing.T) {
+	const gowork = "go 1.22\n\ngodebug default=go1.22\n\nuse (\n\t./a\n\t./b // the b module\n)\n\nreplace example.com/a v1.0.0 => ./a\n"
+	f, err := ParseWork(token.NewFileSet(), "go.work", []byte(gowork))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dirs []string
+	for _, u := range f.Use {
+		dirs = append(dirs, u.Path)
+	}
+	if want := []string{"./a", "./b"}; !reflect.DeepEqual(dirs, want) {
+		t.Errorf("use %q; want %q", dirs, want)
+	}
+	if len(f.Replace) != 1 || len(f.Godebug) != 1 {
+		t.Errorf("got %d replacements, %d godebug settings; want 1, 1", len(f.Replace), len(f.Godebug))
+	}
+
+	if _, err := Parse(token.NewFileSet(), "go.mod", []byte(gowork)); err == nil || !strings.Contains(err.Error(), "unknown directive: use") {
+		t.Errorf("use in go.mod: got %v", err)
+	}
+	if _, err := ParseWork(token.NewFileSet(), "go.work", []byte("module m\n")); err == nil {
+		t.Errorf("module in go.work: expected error")
+	}
+	if _, err := ParseWork(token.NewFileSet(), "go.work", []byte("tool example.com/cmd\n")); err == nil {
+		t.Errorf("tool in go.work: expected error")
+	}
+}
+
+var errorTests = []struct {
+	src  string
+	want []string // "line:col: msg" prefixes
+}{
+	{"module m\nmodule n\n", []string{"2:1: repeated module statement"}},
+	{"go 1.21.x\n", []string{"1:1: invalid go version '1.21.x'"}},
+	{"require m 1.0\n", []string{"1:1: invalid module version 1.0"}},
+	{"require m\n", []string{"1:1: usage: require"}},
+	{"replace m => n\n", []string{"1:1: replacement module without version"}},
+	{"replace m => ./n v1.0.0\n", []string{"1:1: replacement module directory path ./n cannot have version"}},
+	{"require (\n\tm v1.0.0\n", []string{"2:11: unterminated block"}},
+	{"require (\n\tm v1.0.0\n) x\n", []string{"3:3: unexpected x after )"}},
+	{"module \"m\n", []string{"1:8: unterminated quoted string"}},
+	{"frobnicate x\nrequire m\n", []string{"1:1: unknown directive: frobnicate", "2:1: usage: require"}},
+	{"go (\n\t1.21\n)\n", []string{"1:4: go directive cannot be a block"}},
+	{"retract [v1.0.0 v2.0.0]\n", []string{"1:1: usage: retract"}},
+	{"godebug panicnil\ngodebug =1\n", []string{"1:1: usage: godebug", "2:1: usage: godebug"}},
+	{"tool a b\n", []string{"1:1: usage: tool"}},
+}
+
+func TestErrors(t *testing.T) {
+	for _, test := range errorTests {
+		_, err := Parse(token.NewFileSet(), "go.mod", []byte(test.src))
+		list, ok := err.(scanner.ErrorList)
+		if !ok {
+			t.Errorf("%q: got %v; want scanner.ErrorList", test.src, err)
+			continue
+		}
+		if len(list) != len(test.want) {
+			t.Errorf("%q: got %v; want %d errors", test.src, list, len(test.want))
+			continue
+		}
+		for i, e := range list {
+			if !strings.HasPrefix(e.Error(), "go.mod:"+test.want[i]) {
+				t.Errorf("%q: got %q; want go.mod:%s...", test.src, e, test.want[i])
+			}
+		}
+	}
+}
+
+var editTests = []struct {
+	name string
+	src  string
+	edit func(f *File) error
+	want string
+}{
+	{
+		"update requirement in block",
+		"module m\n\nrequire (\n\ta v1.0.0 // indirect\n\tb v1.0.0\n)\n",
+		func(f *File) error { return f.AddRequire("a", "v1.1.0") },
+		"module m\n\nrequire (\n\ta v1.1.0 // indirect\n\tb v1.0.0\n)\n",
+	},
+	{
+		"add requirement to block",
+		"module m\n\nrequire (\n\ta v1.0.0\n)\n\n// trailing\n",
+		func(f *File) error { return f.AddRequire("b", "v2.0.0") },
+		"module m\n\nrequire (\n\ta v1.0.0\n\tb v2.0.0\n)\n\n// trailing\n",
+	},
+	{
+		"add requirement after line",
+		"module m\n\nrequire a v1.0.0\n\nexclude a v0.1.0\n",
+		func(f *File) error { return f.AddRequire("b", "v2.0.0") },
+		"module m\n\nrequire a v1.0.0\nrequire b v2.0.0\n\nexclude a v0.1.0\n",
+	},
+	{
+		"add requirement at end",
+		"module m",
+		func(f *File) error { return f.AddRequire("example.com/b c", "v2.0.0") },
+		"module m\n\nrequire \"example.com/b c\" v2.0.0\n",
+	},
+	{
+		"drop requirement with comments",
+		"module m\n\nrequire (\n\t// a is old\n\ta v1.0.0\n\tb v1.0.0\n)\n",
+		func(f *File) error { f.DropRequire("a"); return nil },
+		"module m\n\nrequire (\n\tb v1.0.0\n)\n",
+	},
+	{
+		"drop block",
+		"module m\n\n// requirements\nrequire (\n\ta v1.0.0\n)\n\ngo 1.21\n",
+		func(f *File) error { f.DropRequire("a"); return nil },
+		"module m\n\ngo 1.21\n",
+	},
+	{
+		"add go and toolchain",
+		"// the module\nmodule m // main\n\nrequire a v1.0.0\n",
+		func(f *File) error {
+			if err := f.AddGoStmt("1.22"); err != nil {
+				return err
+			}
+			return f.AddToolchainStmt("go1.22.1")
+		},
+		"// the module\nmodule m // main\n\ngo 1.22\ntoolchain go1.22.1\n\nrequire a v1.0.0\n",
+	},
+	{
+		"update go",
+		"module m\n\ngo 1.21 // minimum\n",
+		func(f *File) error { return f.AddGoStmt("1.22.0") },
+		"module m\n\ngo 1.22.0 // minimum\n",
+	},
+	{
+		"replace and exclude",
+		"module m\n\nreplace a => ../a\n",
+		func(f *File) error {
+			f.DropReplace("a", "")
+			if err := f.AddReplace("b", "v1.0.0", "c", "v1.1.0"); err != nil {
+				return err
+			}
+			return f.AddExclude("b", "v0.1.0")
+		},
+		"module m\n\nreplace b v1.0.0 => c v1.1.0\n\nexclude b v0.1.0\n",
+	},
+	{
+		"use",
+		"go 1.22\n\nuse ./a\n",
+		func(f *File) error {
+			f.DropUse("./a")
+			return f.AddUse("./b")
+		},
+		"go 1.22\n\nuse ./b\n",
+	},
+	{
+		"drop requirements between blank lines and add one",
+		"module m\n\nrequire a v1.0.0\n\nrequire d v1.0.0\n",
+		func(f *File) error {
+			f.DropRequire("a")
+			f.DropRequire("d")
+			return f.AddRequire("x", "v1.0.0")
+		},
+		"module m\n\nrequire x v1.0.0\n",
+	},
+	{
+		"drop first line and add",
+		"require a v1.0.0\n",
+		func(f *File) error {
+			f.DropRequire("a")
+			return f.AddExclude("b", "v1.0.0")
+		},
+		"exclude b v1.0.0\n",
+	},
+	{
+		"add go without module",
+		"require a v1.0.0\n",
+		func(f *File) error { return f.AddGoStmt("1.21") },
+		"go 1.21\nrequire a v1.0.0\n",
+	},
+}
+
+func TestFormat(t *testing.T) {
+	for _, test := range editTests {
+		parse := Parse
+		if strings.HasPrefix(test.src, "go ") {
+			parse = ParseWork
+		}
+		f, err := parse(token.NewFileSet(), "go.mod", []byte(test.src))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if err := test.edit(f); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		got, err := f.Format()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, got, test.want)
+		}
+		if _, err := parse(token.NewFileSet(), "go.mod", got); err != nil {
+			t.Errorf("%s: formatted file: %v", test.name, err)
+		}
+	}
+}
+
+func TestFormatUnchanged(t *testing.T) {
+	f, err := Parse(token.NewFileSet(), "go.mod", []byte(gomod))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edits := f.Edits(); len(edits) != 0 {
+		t.Errorf("got edits %v for unchanged file", edits)
+	}
+	if err := f.AddRequire("example.com/a", "v1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != gomod {
+		t.Errorf("setting the same version changed the file:\n%s", got)
+	}
+}
+
+func TestEditErrors(t *testing.T) {
+	f, err := Parse(token.NewFileSet(), "go.mod", []byte("module m\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range []error{
+		f.AddGoStmt("go1.21"),
+		f.AddToolchainStmt("1.21"),
+		f.AddRequire("a", "latest"),
+		f.AddReplace("a", "", "./a", "v1.0.0"),
+		f.AddReplace("a", "", "b", ""),
+		f.AddUse("./a"),
+	} {
+		if err == nil {
+			t.Errorf("expected error")
+		}
+	}
+	if edits := f.Edits(); len(edits) != 0 {
+		t.Errorf("failed edits changed the file: %v", edits)
+	}
+}
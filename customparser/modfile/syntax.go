@@ -0,0 +1,342 @@
+package modfile
+
+import (
+	"go/scanner"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// A Comment is a // comment, including the slashes.
+type Comment struct {
+	Slash token.Pos
+	Text  string
+}
+
+// Comments are the comments attached to a syntax node: the comment lines
+// immediately before it and the comments at the end of its line.
+type Comments struct {
+	Before []Comment
+	Suffix []Comment
+}
+
+// An Expr is a statement of the syntax of a file: a *Line, a *LineBlock
+// or a *CommentBlock.
+type Expr interface {
+	Span() (start, end token.Pos)
+	Comment() *Comments
+}
+
+// A Line is a statement on a single line, such as "require m v1.0.0",
+// either at the top level or within a block. The tokens of a line in a
+// block do not include the verb of the block.
+type Line struct {
+	Comments
+	Token      []string // tokens, unquoted
+	InBlock    bool
+	Start, End token.Pos // extent of the tokens
+
+	// editing state
+	span     [2]int // offsets of the line with its comments, including the newline; or -1
+	content  [2]int // offsets of the tokens and suffix comments
+	modified bool   // tokens or suffix comments changed
+	deleted  bool
+	insertAt int    // offset at which a new line is inserted
+	sep      string // text written before a new line, e.g. a blank line
+}
+
+func (l *Line) Span() (start, end token.Pos) { return l.Start, l.End }
+func (l *Line) Comment() *Comments           { return &l.Comments }
+
+// A LineBlock is a factored block of lines, such as
+//
+//	require (
+//		m v1.0.0
+//	)
+type LineBlock struct {
+	Comments
+	Token          []string // verb
+	Lparen, Rparen token.Pos
+	Line           []*Line
+
+	span     [2]int // offsets of the block with its comments, including the final newline
+	closeOff int    // offset of the line of the closing parenthesis
+	deleted  bool
+}
+
+func (b *LineBlock) Span() (start, end token.Pos) { return b.Lparen, b.Rparen + 1 }
+func (b *LineBlock) Comment() *Comments           { return &b.Comments }
+
+// A CommentBlock is a group of comment lines not attached to a statement.
+type CommentBlock struct {
+	Comments
+	Start, End token.Pos
+}
+
+func (c *CommentBlock) Span() (start, end token.Pos) { return c.Start, c.End }
+func (c *CommentBlock) Comment() *Comments           { return &c.Comments }
+
+// FileSyntax is the syntax of a file.
+type FileSyntax struct {
+	Name string // file name
+	Stmt []Expr
+
+	file *token.File
+	src  []byte
+}
+
+// ----------------------------------------------------------------------------
+// Lexing
+
+// A token kind of the lexer.
+const (
+	tokWord    = iota // unquoted word, e.g. "require" or "=>"
+	tokString         // quoted string
+	tokLparen         // (
+	tokRparen         // )
+	tokComment        // // comment
+)
+
+type lexToken struct {
+	kind     int
+	text     string // as written
+	off, end int
+}
+
+// A syntaxParser builds the syntax of a file.
+type syntaxParser struct {
+	file   *token.File
+	src    []byte
+	off    int // offset of the next line
+	errors scanner.ErrorList
+}
+
+func (p *syntaxParser) error(off int, msg string) {
+	p.errors.Add(p.file.Position(p.file.Pos(off)), msg)
+}
+
+// lexLine returns the tokens of the line starting at p.off, and advances
+// p.off to the next line.
+func (p *syntaxParser) lexLine() (toks []lexToken, lineStart int) {
+	src := p.src
+	i := p.off
+	lineStart = i
+	for i < len(src) && src[i] != '\n' {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			j := i
+			for j < len(src) && src[j] != '\n' {
+				j++
+			}
+			text := strings.TrimRight(string(src[i:j]), "\r")
+			toks = append(toks, lexToken{tokComment, text, i, i + len(text)})
+			i = j
+		case c == '(' || c == ')':
+			kind := tokLparen
+			if c == ')' {
+				kind = tokRparen
+			}
+			toks = append(toks, lexToken{kind, string(c), i, i + 1})
+			i++
+		case c == '"' || c == '`':
+			j := i + 1
+			for j < len(src) && src[j] != c && src[j] != '\n' {
+				if c == '"' && src[j] == '\\' && j+1 < len(src) && src[j+1] != '\n' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) || src[j] != c {
+				p.error(i, "unterminated quoted string")
+				toks = append(toks, lexToken{tokString, string(src[i:j]) + string(c), i, j})
+				i = j
+				continue
+			}
+			toks = append(toks, lexToken{tokString, string(src[i : j+1]), i, j + 1})
+			i = j + 1
+		default:
+			j := i
+			for j < len(src) && !strings.ContainsRune(" \t\r\n()\"`", rune(src[j])) && !(src[j] == '/' && j+1 < len(src) && src[j+1] == '/') {
+				j++
+			}
+			toks = append(toks, lexToken{tokWord, string(src[i:j]), i, j})
+			i = j
+		}
+	}
+	if i < len(src) {
+		i++ // newline
+	}
+	p.off = i
+	return toks, lineStart
+}
+
+// ----------------------------------------------------------------------------
+// Parsing
+
+// parseSyntax parses the statements of src, the content of file.
+func parseSyntax(file *token.File, name string, src []byte) (*FileSyntax, scanner.ErrorList) {
+	p := &syntaxParser{file: file, src: src}
+	syntax := &FileSyntax{Name: name, file: file, src: src}
+
+	// comment lines not attached to a statement yet
+	var comments []Comment
+	commentStart := -1
+	flush := func() {
+		if len(comments) > 0 {
+			last := comments[len(comments)-1]
+			syntax.Stmt = append(syntax.Stmt, &CommentBlock{
+				Comments: Comments{Before: comments},
+				Start:    comments[0].Slash,
+				End:      last.Slash + token.Pos(len(last.Text)),
+			})
+		}
+		comments, commentStart = nil, -1
+	}
+
+	for p.off < len(src) {
+		toks, lineStart := p.lexLine()
+		switch {
+		case len(toks) == 0:
+			flush() // a blank line detaches comments
+			continue
+		case toks[0].kind == tokComment:
+			if commentStart < 0 {
+				commentStart = lineStart
+			}
+			comments = append(comments, p.comment(toks[0]))
+			continue
+		}
+
+		start := lineStart
+		if commentStart >= 0 {
+			start = commentStart
+		}
+		code, suffix := splitComments(toks)
+		if n := len(code); n > 0 && code[n-1].kind == tokLparen {
+			b := p.parseBlock(code[:n-1], code[n-1], start)
+			b.Before = comments
+			b.Suffix = p.comments(suffix)
+			syntax.Stmt = append(syntax.Stmt, b)
+		} else {
+			line := p.line(code, suffix, start)
+			line.Before = comments
+			syntax.Stmt = append(syntax.Stmt, line)
+		}
+		comments, commentStart = nil, -1
+	}
+	flush()
+	return syntax, p.errors
+}
+
+// parseBlock parses the lines of a block up to its closing parenthesis;
+// verb are the tokens before the opening parenthesis lparen, and start
+// is the offset of the first comment line of the block, if any.
+func (p *syntaxParser) parseBlock(verb []lexToken, lparen lexToken, start int) *LineBlock {
+	b := &LineBlock{Lparen: p.file.Pos(lparen.off)}
+	for _, t := range verb {
+		b.Token = append(b.Token, p.unquote(t))
+	}
+	if len(verb) == 0 {
+		p.error(lparen.off, "block without verb")
+	}
+
+	var comments []Comment
+	commentStart := -1
+	for p.off < len(p.src) {
+		toks, lineStart := p.lexLine()
+		switch {
+		case len(toks) == 0:
+			continue
+		case toks[0].kind == tokComment:
+			if commentStart < 0 {
+				commentStart = lineStart
+			}
+			comments = append(comments, p.comment(toks[0]))
+			continue
+		case toks[0].kind == tokRparen:
+			b.Rparen = p.file.Pos(toks[0].off)
+			b.closeOff = lineStart
+			for _, t := range toks[1:] {
+				if t.kind != tokComment {
+					p.error(t.off, "unexpected "+t.text+" after )")
+				}
+			}
+			b.span = [2]int{start, p.off}
+			return b
+		}
+		lstart := lineStart
+		if commentStart >= 0 {
+			lstart = commentStart
+		}
+		code, suffix := splitComments(toks)
+		line := p.line(code, suffix, lstart)
+		line.Before = comments
+		line.InBlock = true
+		b.Line = append(b.Line, line)
+		comments, commentStart = nil, -1
+	}
+	p.error(len(p.src), "unterminated block: missing )")
+	b.Rparen = p.file.Pos(len(p.src))
+	b.closeOff = len(p.src)
+	b.span = [2]int{start, len(p.src)}
+	return b
+}
+
+// line returns the line of the tokens code and the comments suffix; start
+// is the offset of its first comment line, if any.
+func (p *syntaxParser) line(code, suffix []lexToken, start int) *Line {
+	line := &Line{span: [2]int{start, p.off}}
+	for _, t := range code {
+		if t.kind == tokLparen || t.kind == tokRparen {
+			p.error(t.off, "unexpected "+t.text)
+		}
+		line.Token = append(line.Token, p.unquote(t))
+	}
+	line.Suffix = p.comments(suffix)
+	first, last := code[0], code[len(code)-1]
+	line.Start = p.file.Pos(first.off)
+	line.End = p.file.Pos(last.end)
+	line.content = [2]int{first.off, last.end}
+	if len(suffix) > 0 {
+		line.content[1] = suffix[len(suffix)-1].end
+	}
+	return line
+}
+
+// splitComments splits the tokens of a line into code and comments.
+func splitComments(toks []lexToken) (code, comments []lexToken) {
+	for i, t := range toks {
+		if t.kind == tokComment {
+			return toks[:i], toks[i:]
+		}
+	}
+	return toks, nil
+}
+
+func (p *syntaxParser) comment(t lexToken) Comment {
+	return Comment{p.file.Pos(t.off), t.text}
+}
+
+func (p *syntaxParser) comments(toks []lexToken) []Comment {
+	var list []Comment
+	for _, t := range toks {
+		list = append(list, p.comment(t))
+	}
+	return list
+}
+
+// unquote returns the value of a token.
+func (p *syntaxParser) unquote(t lexToken) string {
+	if t.kind != tokString {
+		return t.text
+	}
+	s, err := strconv.Unquote(t.text)
+	if err != nil {
+		p.error(t.off, "invalid quoted string "+t.text)
+		return t.text
+	}
+	return s
+}
@@ -0,0 +1,301 @@
+// Package parsecache implements an on-disk cache of the results of
+// github.com/yunabe/golang-codelab/customparser/parser.ParseFile.
+//
+// Cache entries are keyed by a hash of the source content, the parse
+// mode and the version of the parser, and hold the serialized AST and
+// syntax errors. A warm lookup reads the entry and rebuilds the AST with
+// its positions in the caller's token.FileSet, without parsing.
+//
+// The key also covers the build of the parser, the Go release and the
+// layout of the go/ast types, so entries written by a different parser
+// are never used. The build is identified by the version and checksum of
+// the parser module if the program was built with a downloaded module,
+// or else by a hash of the executable of the program, which changes with
+// any change to the parser source; parser.Version covers programs whose
+// executable cannot be read. Unreadable or corrupt entries are ignored
+// and overwritten.
+package parsecache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/yunabe/golang-codelab/customparser/parser"
+)
+
+// formatVersion is the version of the cache entry encoding.
+const formatVersion = 1
+
+// magic starts every cache entry.
+const magic = "parsecache\n"
+
+var (
+	versionOnce sync.Once
+	version     string // identifies the parser and the entry encoding
+)
+
+func parserVersion() string {
+	versionOnce.Do(func() {
+		version = fmt.Sprintf("%s %s %d %s %s", parser.Version, buildID(), formatVersion, runtime.Version(), schema())
+	})
+	return version
+}
+
+// buildID identifies the build of the parser in the running program, as
+// described in the package documentation, or returns "".
+func buildID() string {
+	pkg := reflect.TypeOf(parser.Config{}).PkgPath()
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, m := range info.Deps {
+			if strings.HasPrefix(pkg, m.Path+"/") && m.Replace == nil && m.Sum != "" {
+				return m.Path + "@" + m.Version + " " + m.Sum
+			}
+		}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// A Cache is an on-disk parse cache. It is safe for concurrent use, also
+// by multiple processes sharing the directory.
+type Cache struct {
+	dir string
+}
+
+// New returns a cache storing its entries in dir, which is created if
+// it does not exist.
+func New(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// Dir returns the directory of the cache.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// key returns the cache key for parsing src with mode.
+func key(src []byte, mode parser.Mode) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\nmode %d\n", parserVersion(), mode)
+	h.Write(src)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// ParseFile is like parser.ParseFile but returns the cached result if
+// the same source was parsed with the same mode before. A cache miss
+// parses the source and stores the result. The file is added to fset in
+// either case, and the returned AST and errors are indistinguishable
+// from those of parser.ParseFile.
+//
+// Parsing with the Trace mode, with the CheckTemplates mode (whose result
+// depends on embedded files), and sources containing //line directives
+// (whose effect on positions is not stored), bypass the cache. Errors
+// writing the cache are ignored.
+func (c *Cache) ParseFile(fset *token.FileSet, filename string, src interface{}, mode parser.Mode) (*ast.File, error) {
+	text, err := readSource(filename, src)
+	if err != nil {
+		return nil, err
+	}
+	if mode&(parser.Trace|parser.CheckTemplates) != 0 || hasLineDirective(text) {
+		return parser.ParseFile(fset, filename, text, mode)
+	}
+
+	k := key(text, mode)
+	if data, err := ioutil.ReadFile(c.path(k)); err == nil {
+		if f, err, ok := decodeEntry(fset, filename, text, data); ok {
+			return f, err
+		}
+	}
+
+	f, err := parser.ParseFile(fset, filename, text, mode)
+	if _, ok := err.(scanner.ErrorList); err == nil || ok {
+		if data, encErr := encodeEntry(fset, f, err); encErr == nil {
+			c.write(k, data)
+		}
+	}
+	return f, err
+}
+
+// write stores an entry atomically.
+func (c *Cache) write(key string, data []byte) {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), key+".tmp")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// Clear removes all entries from the cache.
+func (c *Cache) Clear() error {
+	list, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range list {
+		if fi.IsDir() && len(fi.Name()) == 2 {
+			if err := os.RemoveAll(filepath.Join(c.dir, fi.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hasLineDirective reports whether src contains a //line or /*line
+// comment.
+func hasLineDirective(src []byte) bool {
+	return bytes.Contains(src, []byte("//line ")) || bytes.Contains(src, []byte("/*line "))
+}
+
+// readSource is like the parser's readSource.
+func readSource(filename string, src interface{}) ([]byte, error) {
+	if src == nil {
+		return ioutil.ReadFile(filename)
+	}
+	switch s := src.(type) {
+	case string:
+		return []byte(s), nil
+	case []byte:
+		return s, nil
+	case *bytes.Buffer:
+		if s != nil {
+			return s.Bytes(), nil
+		}
+	case io.Reader:
+		return ioutil.ReadAll(s)
+	}
+	return nil, fmt.Errorf("invalid source")
+}
+
+// An entry is laid out as the magic, the parser version, the number of
+// errors followed by their offsets and messages, and the encoded AST.
+
+func encodeEntry(fset *token.FileSet, f *ast.File, err error) ([]byte, error) {
+	file := fset.File(f.Package)
+	if file == nil {
+		// the AST returned for sources without a package clause has
+		// no positions identifying the file
+		return nil, fmt.Errorf("parsecache: no package clause")
+	}
+	e := newEncoder(file.Base())
+	e.buf = append(e.buf, magic...)
+	v := parserVersion()
+	e.string(&v)
+	list, _ := err.(scanner.ErrorList)
+	e.uint(uint64(len(list)))
+	for _, err := range list {
+		e.uint(uint64(err.Pos.Offset))
+		e.string(&err.Msg)
+	}
+	e.file(&f)
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.buf, nil
+}
+
+// decodeEntry decodes the entry data for the source text, adding the
+// file to fset. The result ok is false if the entry is invalid, in which
+// case fset is unchanged.
+func decodeEntry(fset *token.FileSet, filename string, text, data []byte) (f *ast.File, err error, ok bool) {
+	// Positions are decoded for the base the file will most likely get,
+	// and decoded again in the rare case that another file was added to
+	// fset concurrently.
+	base := fset.Base()
+	f, list, ok := decode(data, text, base)
+	if !ok {
+		return nil, nil, false
+	}
+	file := fset.AddFile(filename, -1, len(text))
+	if file.Base() != base {
+		f, list, _ = decode(data, text, file.Base())
+	}
+	file.SetLinesForContent(text)
+	if len(list) > 0 {
+		for _, e := range list {
+			e.Pos = file.Position(file.Pos(e.Pos.Offset))
+		}
+		err = list
+	}
+	return f, err, true
+}
+
+// decode decodes the entry data for the source text with positions of
+// the file with the given base. The positions of the returned errors
+// only have their offsets set.
+func decode(data, text []byte, base int) (*ast.File, scanner.ErrorList, bool) {
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return nil, nil, false
+	}
+	d := newDecoder(data[len(magic):], base)
+	var v string
+	if d.string(&v); v != parserVersion() {
+		return nil, nil, false
+	}
+	n := d.uint(0)
+	if d.err != nil || n > uint64(len(text))+1 {
+		return nil, nil, false
+	}
+	var list scanner.ErrorList
+	for i := uint64(0); i < n; i++ {
+		e := new(scanner.Error)
+		e.Pos.Offset = int(d.uint(0))
+		d.string(&e.Msg)
+		if e.Pos.Offset > len(text) {
+			d.fail(errCorrupt)
+		}
+		list = append(list, e)
+	}
+	var f *ast.File
+	d.file(&f)
+	if d.err != nil || len(d.data) > 0 || f == nil {
+		return nil, nil, false
+	}
+	return f, list, true
+}
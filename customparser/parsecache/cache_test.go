@@ -0,0 +1,256 @@
+package parsecache
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/yunabe/golang-codelab/customparser/parser"
+)
+
+const mode = parser.ParseComments | parser.AllErrors
+
+// dump returns a textual representation of the result of parsing a file,
+// including positions and the sharing of objects. Scopes are omitted as
+// ast.Fprint prints maps in random order; the objects are printed where
+// identifiers refer to them.
+func dump(fset *token.FileSet, f *ast.File, err error) string {
+	var buf bytes.Buffer
+	ast.Fprint(&buf, fset, f, func(name string, v reflect.Value) bool {
+		return name != "Scope"
+	})
+	fmt.Fprintf(&buf, "error: %v\n", err)
+	return buf.String()
+}
+
+func newCache(t testing.TB) (*Cache, func()) {
+	dir, err := ioutil.TempDir("", "parsecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, func() { os.RemoveAll(dir) }
+}
+
+// sourceFiles returns the Go and test source files used for testing.
+func sourceFiles(t testing.TB) []string {
+	var files []string
+	for _, pattern := range []string{
+		"../parser/testdata/*.src",
+		"../parser/*.go",
+		filepath.Join(runtime.GOROOT(), "src", "go", "*", "*.go"),
+	} {
+		list, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, list...)
+	}
+	if len(files) == 0 {
+		t.Fatal("no source files")
+	}
+	return files
+}
+
+func TestRoundTrip(t *testing.T) {
+	c, cleanup := newCache(t)
+	defer cleanup()
+
+	for _, filename := range sourceFiles(t) {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a file set with another file, so that the bases differ
+		// between the runs
+		fset := token.NewFileSet()
+		fset.AddFile("other", -1, 100)
+		f, err := parser.ParseFile(fset, filename, src, mode)
+		want := dump(fset, f, err)
+
+		for i, what := range []string{"cold", "warm"} {
+			fset := token.NewFileSet()
+			fset.AddFile("other", -1, 100*i)
+			f, err := c.ParseFile(fset, filename, src, mode)
+			if got := dump(fset, f, err); got != want {
+				t.Errorf("%s: %s result differs from parser.ParseFile", filename, what)
+			}
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	c, cleanup := newCache(t)
+	defer cleanup()
+
+	const src = "package p\n\n// f.\nfunc f() {}\n"
+	fset := token.NewFileSet()
+	c.ParseFile(fset, "a.go", src, 0)
+	c.ParseFile(fset, "b.go", src, 0)               // same key
+	c.ParseFile(fset, "a.go", src, mode)            // other mode
+	c.ParseFile(fset, "a.go", src+"\nvar x int", 0) // other source
+	if n := countEntries(t, c); n != 3 {
+		t.Errorf("got %d cache entries; want 3", n)
+	}
+
+	// the file name is taken from the caller
+	f, err := c.ParseFile(fset, "c.go", src+"\nvar x = ", 0)
+	f, err = c.ParseFile(fset, "c.go", src+"\nvar x = ", 0)
+	if err == nil || !strings.HasPrefix(err.Error(), "c.go:6:") {
+		t.Errorf("got error %v; want error in c.go:6", err)
+	}
+	if got := fset.Position(f.Name.Pos()).Filename; got != "c.go" {
+		t.Errorf("got file name %q; want c.go", got)
+	}
+}
+
+func countEntries(t *testing.T, c *Cache) int {
+	n := 0
+	filepath.Walk(c.Dir(), func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+func TestInvalidation(t *testing.T) {
+	c, cleanup := newCache(t)
+	defer cleanup()
+
+	const src = "package p; var x = 1"
+	fset := token.NewFileSet()
+	c.ParseFile(fset, "a.go", src, 0)
+	path := c.path(key([]byte(src), 0))
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an entry written by another parser version is not used
+	other := bytes.Replace(data, []byte(parser.Version), []byte("other-parser"), 1)
+	if _, _, ok := decodeEntry(token.NewFileSet(), "a.go", []byte(src), other); ok {
+		t.Error("entry of another parser version accepted")
+	}
+
+	// nor one written by another build of the parser, e.g. after a
+	// change to its source without a change of parser.Version
+	id := buildID()
+	if id == "" {
+		t.Fatal("no build ID")
+	}
+	other = bytes.Replace(data, []byte(id), []byte(strings.Repeat("0", len(id))), 1)
+	if bytes.Equal(other, data) {
+		t.Fatal("build ID not found in the entry")
+	}
+	if _, _, ok := decodeEntry(token.NewFileSet(), "a.go", []byte(src), other); ok {
+		t.Error("entry of another parser build accepted")
+	}
+
+	// corrupt entries are ignored and replaced
+	for _, corrupt := range [][]byte{nil, data[:len(data)/2], data[:len(data)-1], append(data[:len(data):len(data)], 0xff)} {
+		fset := token.NewFileSet()
+		if _, _, ok := decodeEntry(fset, "a.go", []byte(src), corrupt); ok {
+			t.Errorf("corrupt entry of length %d accepted", len(corrupt))
+		}
+		if fset.Base() != 1 {
+			t.Errorf("file set changed by invalid entry")
+		}
+		ioutil.WriteFile(path, corrupt, 0666)
+		f, err := c.ParseFile(fset, "a.go", src, 0)
+		if err != nil || f.Decls == nil {
+			t.Errorf("got %v, %v for corrupt entry", f, err)
+		}
+	}
+	if got, _ := ioutil.ReadFile(path); !bytes.Equal(got, data) {
+		t.Error("corrupt entry not replaced")
+	}
+}
+
+func TestBypass(t *testing.T) {
+	c, cleanup := newCache(t)
+	defer cleanup()
+
+	fset := token.NewFileSet()
+	c.ParseFile(fset, "a.go", "package p\n//line b.go:10\nvar x int\n", 0)
+	c.ParseFile(fset, "a.go", "var x int", 0) // no package clause
+	if n := countEntries(t, c); n != 0 {
+		t.Errorf("got %d cache entries; want none", n)
+	}
+}
+
+// readSources returns the source files used for benchmarks, leaving out
+// those that bypass the cache.
+func readSources(b *testing.B) ([]string, [][]byte) {
+	var files []string
+	var srcs [][]byte
+	for _, filename := range sourceFiles(b) {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if hasLineDirective(src) || !bytes.Contains(src, []byte("package ")) {
+			continue
+		}
+		files = append(files, filename)
+		srcs = append(srcs, src)
+	}
+	return files, srcs
+}
+
+func benchmarkParse(b *testing.B, parse func(fset *token.FileSet, filename string, src []byte)) {
+	files, srcs := readSources(b)
+	size := 0
+	for _, src := range srcs {
+		size += len(src)
+	}
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fset := token.NewFileSet()
+		for j, filename := range files {
+			parse(fset, filename, srcs[j])
+		}
+	}
+}
+
+func BenchmarkParseFile(b *testing.B) {
+	benchmarkParse(b, func(fset *token.FileSet, filename string, src []byte) {
+		parser.ParseFile(fset, filename, src, mode)
+	})
+}
+
+func BenchmarkCold(b *testing.B) {
+	c, cleanup := newCache(b)
+	defer cleanup()
+	benchmarkParse(b, func(fset *token.FileSet, filename string, src []byte) {
+		c.ParseFile(fset, filename, src, mode)
+		b.StopTimer()
+		c.Clear()
+		b.StartTimer()
+	})
+}
+
+func BenchmarkWarm(b *testing.B) {
+	c, cleanup := newCache(b)
+	defer cleanup()
+	files, srcs := readSources(b)
+	for i, filename := range files {
+		c.ParseFile(token.NewFileSet(), filename, srcs[i], mode)
+	}
+	benchmarkParse(b, func(fset *token.FileSet, filename string, src []byte) {
+		c.ParseFile(fset, filename, src, mode)
+	})
+}
@@ -0,0 +1,1893 @@
+package parsecache
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"sort"
+)
+
+// This file implements the serialization of ASTs. A codec walks an AST
+// field by field, either writing the fields (encoding) or setting them
+// (decoding); the same methods implement both directions, which keeps
+// the two in sync. The encoding is:
+//
+//	pointer     0 for nil, the ID of a pointer seen before, or a new ID
+//	            followed by the pointee
+//	interface   the tag of the dynamic type (tagNil for nil) followed by
+//	            the value
+//	slice       0 for nil, or the length+1 followed by the elements
+//	map         the length followed by the keys and values, sorted by key
+//	token.Pos   0 for NoPos, or the offset+1 relative to the file base
+//	string      the length followed by the bytes
+//	integers    varints; booleans 0 or 1
+//
+// Pointer IDs preserve the sharing of nodes and objects within the AST
+// (identifiers referring to the same ast.Object, scopes and their
+// declarations), including cycles.
+
+var errCorrupt = errors.New("parsecache: corrupt cache entry")
+
+// A codec encodes or decodes an AST.
+type codec struct {
+	enc  bool
+	base int // base of the file
+	err  error
+
+	// encoding
+	buf []byte
+	ids map[interface{}]uint64 // pointers to their IDs
+
+	// decoding
+	text   string        // the input, shared by the decoded strings
+	data   []byte        // remaining input
+	ptrs   []interface{} // pointers by ID-1
+	idents []ast.Ident   // preallocated identifiers
+}
+
+func newEncoder(base int) *codec {
+	return &codec{enc: true, base: base, ids: make(map[interface{}]uint64)}
+}
+
+// newDecoder returns a decoder of data producing positions of the file
+// with the given base.
+func newDecoder(data []byte, base int) *codec {
+	// a rough estimate of the number of pointers, to avoid growing ptrs
+	return &codec{base: base, text: string(data), data: data, ptrs: make([]interface{}, 0, len(data)/8)}
+}
+
+func (c *codec) fail(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+	c.data = nil
+}
+
+// uint codes x and returns the decoded value.
+func (c *codec) uint(x uint64) uint64 {
+	if c.enc {
+		c.buf = binary.AppendUvarint(c.buf, x)
+		return x
+	}
+	x, n := binary.Uvarint(c.data)
+	if n <= 0 {
+		c.fail(errCorrupt)
+		return 0
+	}
+	c.data = c.data[n:]
+	return x
+}
+
+// int codes x and returns the decoded value.
+func (c *codec) int(x int) int {
+	if c.enc {
+		c.buf = binary.AppendVarint(c.buf, int64(x))
+		return x
+	}
+	y, n := binary.Varint(c.data)
+	if n <= 0 {
+		c.fail(errCorrupt)
+		return 0
+	}
+	c.data = c.data[n:]
+	return int(y)
+}
+
+func (c *codec) string(p *string) {
+	n := c.uint(uint64(len(*p)))
+	if c.enc {
+		c.buf = append(c.buf, *p...)
+		return
+	}
+	if n > uint64(len(c.data)) {
+		c.fail(errCorrupt)
+		return
+	}
+	start := len(c.text) - len(c.data)
+	*p = c.text[start : start+int(n)]
+	c.data = c.data[n:]
+}
+
+func (c *codec) bool(p *bool) {
+	x := uint64(0)
+	if *p {
+		x = 1
+	}
+	*p = c.uint(x) != 0
+}
+
+func (c *codec) token(p *token.Token) {
+	*p = token.Token(c.int(int(*p)))
+}
+
+func (c *codec) pos(p *token.Pos) {
+	x := uint64(0)
+	if *p != token.NoPos {
+		x = uint64(int(*p) - c.base + 1)
+	}
+	if x = c.uint(x); x != 0 {
+		*p = token.Pos(c.base + int(x) - 1)
+	}
+}
+
+// length codes the length n of a slice and whether it is nil, and
+// returns the decoded length, or -1 for nil.
+func (c *codec) length(n int, isNil bool) int {
+	x := uint64(n + 1)
+	if isNil {
+		x = 0
+	}
+	x = c.uint(x)
+	if !c.enc && x > uint64(len(c.data))+1 {
+		// each element takes at least a byte
+		c.fail(errCorrupt)
+		return -1
+	}
+	return int(x) - 1
+}
+
+// ref codes the identity of the pointer x, which is nil if isNil. It
+// reports whether the pointee is new and must be coded; otherwise it
+// returns the pointer: x when encoding, and the pointer decoded before
+// or nil when decoding. A new pointee being decoded must be registered
+// with add.
+func (c *codec) ref(x interface{}, isNil bool) (interface{}, bool) {
+	if c.enc {
+		if isNil {
+			c.uint(0)
+			return x, false
+		}
+		if id, ok := c.ids[x]; ok {
+			c.uint(id)
+			return x, false
+		}
+		id := uint64(len(c.ids) + 1)
+		c.ids[x] = id
+		c.uint(id)
+		return x, true
+	}
+	id := c.uint(0)
+	switch {
+	case id == 0 || c.err != nil:
+		return nil, false
+	case id <= uint64(len(c.ptrs)):
+		return c.ptrs[id-1], false
+	case id == uint64(len(c.ptrs)+1):
+		return nil, true
+	}
+	c.fail(errCorrupt)
+	return nil, false
+}
+
+// add registers a new decoded pointer.
+func (c *codec) add(x interface{}) {
+	c.ptrs = append(c.ptrs, x)
+}
+
+// Tags of the dynamic types of interface values. The order is part of
+// the encoding.
+const (
+	tagNil = iota
+	tagBadExpr
+	tagIdent
+	tagEllipsis
+	tagBasicLit
+	tagFuncLit
+	tagCompositeLit
+	tagParenExpr
+	tagSelectorExpr
+	tagIndexExpr
+	tagSliceExpr
+	tagTypeAssertExpr
+	tagCallExpr
+	tagStarExpr
+	tagUnaryExpr
+	tagBinaryExpr
+	tagKeyValueExpr
+	tagArrayType
+	tagStructType
+	tagFuncType
+	tagInterfaceType
+	tagMapType
+	tagChanType
+	tagBadStmt
+	tagDeclStmt
+	tagEmptyStmt
+	tagLabeledStmt
+	tagExprStmt
+	tagSendStmt
+	tagIncDecStmt
+	tagAssignStmt
+	tagGoStmt
+	tagDeferStmt
+	tagReturnStmt
+	tagBranchStmt
+	tagBlockStmt
+	tagIfStmt
+	tagCaseClause
+	tagSwitchStmt
+	tagTypeSwitchStmt
+	tagCommClause
+	tagSelectStmt
+	tagForStmt
+	tagRangeStmt
+	tagImportSpec
+	tagValueSpec
+	tagTypeSpec
+	tagBadDecl
+	tagGenDecl
+	tagFuncDecl
+	tagField
+	tagFieldList
+	tagFile
+	tagScope // ast.Object data
+	tagInt   // ast.Object data
+)
+
+// tagOf returns the tag of the dynamic type of x, or -1.
+func tagOf(x interface{}) int {
+	switch x.(type) {
+	case nil:
+		return tagNil
+	case *ast.BadExpr:
+		return tagBadExpr
+	case *ast.Ident:
+		return tagIdent
+	case *ast.Ellipsis:
+		return tagEllipsis
+	case *ast.BasicLit:
+		return tagBasicLit
+	case *ast.FuncLit:
+		return tagFuncLit
+	case *ast.CompositeLit:
+		return tagCompositeLit
+	case *ast.ParenExpr:
+		return tagParenExpr
+	case *ast.SelectorExpr:
+		return tagSelectorExpr
+	case *ast.IndexExpr:
+		return tagIndexExpr
+	case *ast.SliceExpr:
+		return tagSliceExpr
+	case *ast.TypeAssertExpr:
+		return tagTypeAssertExpr
+	case *ast.CallExpr:
+		return tagCallExpr
+	case *ast.StarExpr:
+		return tagStarExpr
+	case *ast.UnaryExpr:
+		return tagUnaryExpr
+	case *ast.BinaryExpr:
+		return tagBinaryExpr
+	case *ast.KeyValueExpr:
+		return tagKeyValueExpr
+	case *ast.ArrayType:
+		return tagArrayType
+	case *ast.StructType:
+		return tagStructType
+	case *ast.FuncType:
+		return tagFuncType
+	case *ast.InterfaceType:
+		return tagInterfaceType
+	case *ast.MapType:
+		return tagMapType
+	case *ast.ChanType:
+		return tagChanType
+	case *ast.BadStmt:
+		return tagBadStmt
+	case *ast.DeclStmt:
+		return tagDeclStmt
+	case *ast.EmptyStmt:
+		return tagEmptyStmt
+	case *ast.LabeledStmt:
+		return tagLabeledStmt
+	case *ast.ExprStmt:
+		return tagExprStmt
+	case *ast.SendStmt:
+		return tagSendStmt
+	case *ast.IncDecStmt:
+		return tagIncDecStmt
+	case *ast.AssignStmt:
+		return tagAssignStmt
+	case *ast.GoStmt:
+		return tagGoStmt
+	case *ast.DeferStmt:
+		return tagDeferStmt
+	case *ast.ReturnStmt:
+		return tagReturnStmt
+	case *ast.BranchStmt:
+		return tagBranchStmt
+	case *ast.BlockStmt:
+		return tagBlockStmt
+	case *ast.IfStmt:
+		return tagIfStmt
+	case *ast.CaseClause:
+		return tagCaseClause
+	case *ast.SwitchStmt:
+		return tagSwitchStmt
+	case *ast.TypeSwitchStmt:
+		return tagTypeSwitchStmt
+	case *ast.CommClause:
+		return tagCommClause
+	case *ast.SelectStmt:
+		return tagSelectStmt
+	case *ast.ForStmt:
+		return tagForStmt
+	case *ast.RangeStmt:
+		return tagRangeStmt
+	case *ast.ImportSpec:
+		return tagImportSpec
+	case *ast.ValueSpec:
+		return tagValueSpec
+	case *ast.TypeSpec:
+		return tagTypeSpec
+	case *ast.BadDecl:
+		return tagBadDecl
+	case *ast.GenDecl:
+		return tagGenDecl
+	case *ast.FuncDecl:
+		return tagFuncDecl
+	case *ast.Field:
+		return tagField
+	case *ast.FieldList:
+		return tagFieldList
+	case *ast.File:
+		return tagFile
+	case *ast.Scope:
+		return tagScope
+	case int:
+		return tagInt
+	}
+	return -1
+}
+
+// value codes an interface value: a node, or the data of an ast.Object.
+// It returns the decoded value.
+func (c *codec) value(x interface{}) interface{} {
+	tag := 0
+	if c.enc {
+		if tag = tagOf(x); tag < 0 {
+			c.fail(fmt.Errorf("parsecache: cannot encode value of type %T", x))
+			return nil
+		}
+	}
+	switch c.uint(uint64(tag)) {
+	case tagNil:
+		return nil
+	case tagBadExpr:
+		n, _ := x.(*ast.BadExpr)
+		c.badExpr(&n)
+		return n
+	case tagIdent:
+		n, _ := x.(*ast.Ident)
+		c.ident(&n)
+		return n
+	case tagEllipsis:
+		n, _ := x.(*ast.Ellipsis)
+		c.ellipsis(&n)
+		return n
+	case tagBasicLit:
+		n, _ := x.(*ast.BasicLit)
+		c.basicLit(&n)
+		return n
+	case tagFuncLit:
+		n, _ := x.(*ast.FuncLit)
+		c.funcLit(&n)
+		return n
+	case tagCompositeLit:
+		n, _ := x.(*ast.CompositeLit)
+		c.compositeLit(&n)
+		return n
+	case tagParenExpr:
+		n, _ := x.(*ast.ParenExpr)
+		c.parenExpr(&n)
+		return n
+	case tagSelectorExpr:
+		n, _ := x.(*ast.SelectorExpr)
+		c.selectorExpr(&n)
+		return n
+	case tagIndexExpr:
+		n, _ := x.(*ast.IndexExpr)
+		c.indexExpr(&n)
+		return n
+	case tagSliceExpr:
+		n, _ := x.(*ast.SliceExpr)
+		c.sliceExpr(&n)
+		return n
+	case tagTypeAssertExpr:
+		n, _ := x.(*ast.TypeAssertExpr)
+		c.typeAssertExpr(&n)
+		return n
+	case tagCallExpr:
+		n, _ := x.(*ast.CallExpr)
+		c.callExpr(&n)
+		return n
+	case tagStarExpr:
+		n, _ := x.(*ast.StarExpr)
+		c.starExpr(&n)
+		return n
+	case tagUnaryExpr:
+		n, _ := x.(*ast.UnaryExpr)
+		c.unaryExpr(&n)
+		return n
+	case tagBinaryExpr:
+		n, _ := x.(*ast.BinaryExpr)
+		c.binaryExpr(&n)
+		return n
+	case tagKeyValueExpr:
+		n, _ := x.(*ast.KeyValueExpr)
+		c.keyValueExpr(&n)
+		return n
+	case tagArrayType:
+		n, _ := x.(*ast.ArrayType)
+		c.arrayType(&n)
+		return n
+	case tagStructType:
+		n, _ := x.(*ast.StructType)
+		c.structType(&n)
+		return n
+	case tagFuncType:
+		n, _ := x.(*ast.FuncType)
+		c.funcType(&n)
+		return n
+	case tagInterfaceType:
+		n, _ := x.(*ast.InterfaceType)
+		c.interfaceType(&n)
+		return n
+	case tagMapType:
+		n, _ := x.(*ast.MapType)
+		c.mapType(&n)
+		return n
+	case tagChanType:
+		n, _ := x.(*ast.ChanType)
+		c.chanType(&n)
+		return n
+	case tagBadStmt:
+		n, _ := x.(*ast.BadStmt)
+		c.badStmt(&n)
+		return n
+	case tagDeclStmt:
+		n, _ := x.(*ast.DeclStmt)
+		c.declStmt(&n)
+		return n
+	case tagEmptyStmt:
+		n, _ := x.(*ast.EmptyStmt)
+		c.emptyStmt(&n)
+		return n
+	case tagLabeledStmt:
+		n, _ := x.(*ast.LabeledStmt)
+		c.labeledStmt(&n)
+		return n
+	case tagExprStmt:
+		n, _ := x.(*ast.ExprStmt)
+		c.exprStmt(&n)
+		return n
+	case tagSendStmt:
+		n, _ := x.(*ast.SendStmt)
+		c.sendStmt(&n)
+		return n
+	case tagIncDecStmt:
+		n, _ := x.(*ast.IncDecStmt)
+		c.incDecStmt(&n)
+		return n
+	case tagAssignStmt:
+		n, _ := x.(*ast.AssignStmt)
+		c.assignStmt(&n)
+		return n
+	case tagGoStmt:
+		n, _ := x.(*ast.GoStmt)
+		c.goStmt(&n)
+		return n
+	case tagDeferStmt:
+		n, _ := x.(*ast.DeferStmt)
+		c.deferStmt(&n)
+		return n
+	case tagReturnStmt:
+		n, _ := x.(*ast.ReturnStmt)
+		c.returnStmt(&n)
+		return n
+	case tagBranchStmt:
+		n, _ := x.(*ast.BranchStmt)
+		c.branchStmt(&n)
+		return n
+	case tagBlockStmt:
+		n, _ := x.(*ast.BlockStmt)
+		c.blockStmt(&n)
+		return n
+	case tagIfStmt:
+		n, _ := x.(*ast.IfStmt)
+		c.ifStmt(&n)
+		return n
+	case tagCaseClause:
+		n, _ := x.(*ast.CaseClause)
+		c.caseClause(&n)
+		return n
+	case tagSwitchStmt:
+		n, _ := x.(*ast.SwitchStmt)
+		c.switchStmt(&n)
+		return n
+	case tagTypeSwitchStmt:
+		n, _ := x.(*ast.TypeSwitchStmt)
+		c.typeSwitchStmt(&n)
+		return n
+	case tagCommClause:
+		n, _ := x.(*ast.CommClause)
+		c.commClause(&n)
+		return n
+	case tagSelectStmt:
+		n, _ := x.(*ast.SelectStmt)
+		c.selectStmt(&n)
+		return n
+	case tagForStmt:
+		n, _ := x.(*ast.ForStmt)
+		c.forStmt(&n)
+		return n
+	case tagRangeStmt:
+		n, _ := x.(*ast.RangeStmt)
+		c.rangeStmt(&n)
+		return n
+	case tagImportSpec:
+		n, _ := x.(*ast.ImportSpec)
+		c.importSpec(&n)
+		return n
+	case tagValueSpec:
+		n, _ := x.(*ast.ValueSpec)
+		c.valueSpec(&n)
+		return n
+	case tagTypeSpec:
+		n, _ := x.(*ast.TypeSpec)
+		c.typeSpec(&n)
+		return n
+	case tagBadDecl:
+		n, _ := x.(*ast.BadDecl)
+		c.badDecl(&n)
+		return n
+	case tagGenDecl:
+		n, _ := x.(*ast.GenDecl)
+		c.genDecl(&n)
+		return n
+	case tagFuncDecl:
+		n, _ := x.(*ast.FuncDecl)
+		c.funcDecl(&n)
+		return n
+	case tagField:
+		n, _ := x.(*ast.Field)
+		c.field(&n)
+		return n
+	case tagFieldList:
+		n, _ := x.(*ast.FieldList)
+		c.fieldList(&n)
+		return n
+	case tagFile:
+		n, _ := x.(*ast.File)
+		c.file(&n)
+		return n
+	case tagScope:
+		n, _ := x.(*ast.Scope)
+		c.scope(&n)
+		return n
+	case tagInt:
+		n, _ := x.(int)
+		return c.int(n)
+	}
+	c.fail(errCorrupt)
+	return nil
+}
+
+// The interface types of the AST.
+
+func (c *codec) expr(p *ast.Expr) {
+	x := c.value(*p)
+	if !c.enc {
+		var ok bool
+		if *p, ok = x.(ast.Expr); x != nil && !ok {
+			c.fail(errCorrupt)
+		}
+	}
+}
+
+func (c *codec) stmt(p *ast.Stmt) {
+	x := c.value(*p)
+	if !c.enc {
+		var ok bool
+		if *p, ok = x.(ast.Stmt); x != nil && !ok {
+			c.fail(errCorrupt)
+		}
+	}
+}
+
+func (c *codec) decl(p *ast.Decl) {
+	x := c.value(*p)
+	if !c.enc {
+		var ok bool
+		if *p, ok = x.(ast.Decl); x != nil && !ok {
+			c.fail(errCorrupt)
+		}
+	}
+}
+
+func (c *codec) spec(p *ast.Spec) {
+	x := c.value(*p)
+	if !c.enc {
+		var ok bool
+		if *p, ok = x.(ast.Spec); x != nil && !ok {
+			c.fail(errCorrupt)
+		}
+	}
+}
+
+// Slices.
+
+func (c *codec) exprList(p *[]ast.Expr) {
+	n := c.length(len(*p), *p == nil)
+	if !c.enc && n >= 0 {
+		*p = make([]ast.Expr, n)
+	}
+	for i := 0; i < n && c.err == nil; i++ {
+		c.expr(&(*p)[i])
+	}
+}
+
+func (c *codec) stmtList(p *[]ast.Stmt) {
+	n := c.length(len(*p), *p == nil)
+	if !c.enc && n >= 0 {
+		*p = make([]ast.Stmt, n)
+	}
+	for i := 0; i < n && c.err == nil; i++ {
+		c.stmt(&(*p)[i])
+	}
+}
+
+func (c *codec) declList(p *[]ast.Decl) {
+	n := c.length(len(*p), *p == nil)
+	if !c.enc && n >= 0 {
+		*p = make([]ast.Decl, n)
+	}
+	for i := 0; i < n && c.err == nil; i++ {
+		c.decl(&(*p)[i])
+	}
+}
+
+func (c *codec) specList(p *[]ast.Spec) {
+	n := c.length(len(*p), *p == nil)
+	if !c.enc && n >= 0 {
+		*p = make([]ast.Spec, n)
+	}
+	for i := 0; i < n && c.err == nil; i++ {
+		c.spec(&(*p)[i])
+	}
+}
+
+func (c *codec) identList(p *[]*ast.Ident) {
+	n := c.length(len(*p), *p == nil)
+	if !c.enc && n >= 0 {
+		*p = make([]*ast.Ident, n)
+	}
+	for i := 0; i < n && c.err == nil; i++ {
+		c.ident(&(*p)[i])
+	}
+}
+
+func (c *codec) fieldSlice(p *[]*ast.Field) {
+	n := c.length(len(*p), *p == nil)
+	if !c.enc && n >= 0 {
+		*p = make([]*ast.Field, n)
+	}
+	for i := 0; i < n && c.err == nil; i++ {
+		c.field(&(*p)[i])
+	}
+}
+
+func (c *codec) importSpecList(p *[]*ast.ImportSpec) {
+	n := c.length(len(*p), *p == nil)
+	if !c.enc && n >= 0 {
+		*p = make([]*ast.ImportSpec, n)
+	}
+	for i := 0; i < n && c.err == nil; i++ {
+		c.importSpec(&(*p)[i])
+	}
+}
+
+func (c *codec) commentList(p *[]*ast.Comment) {
+	n := c.length(len(*p), *p == nil)
+	if !c.enc && n >= 0 {
+		*p = make([]*ast.Comment, n)
+	}
+	for i := 0; i < n && c.err == nil; i++ {
+		c.comment(&(*p)[i])
+	}
+}
+
+func (c *codec) commentGroupList(p *[]*ast.CommentGroup) {
+	n := c.length(len(*p), *p == nil)
+	if !c.enc && n >= 0 {
+		*p = make([]*ast.CommentGroup, n)
+	}
+	for i := 0; i < n && c.err == nil; i++ {
+		c.commentGroup(&(*p)[i])
+	}
+}
+
+// Comments, objects and scopes.
+
+func (c *codec) comment(p **ast.Comment) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.Comment); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.Comment)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Slash)
+	c.string(&n.Text)
+}
+
+func (c *codec) commentGroup(p **ast.CommentGroup) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.CommentGroup); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.CommentGroup)
+		c.add(*p)
+	}
+	c.commentList(&(*p).List)
+}
+
+func (c *codec) object(p **ast.Object) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.Object); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.Object)
+		c.add(*p)
+	}
+	n := *p
+	n.Kind = ast.ObjKind(c.int(int(n.Kind)))
+	c.string(&n.Name)
+	n.Decl = c.value(n.Decl)
+	n.Data = c.value(n.Data)
+	n.Type = c.value(n.Type)
+}
+
+func (c *codec) scope(p **ast.Scope) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.Scope); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.Scope)
+		c.add(*p)
+	}
+	n := *p
+	c.scope(&n.Outer)
+	if c.enc {
+		names := make([]string, 0, len(n.Objects))
+		for name := range n.Objects {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		c.uint(uint64(len(names)))
+		for _, name := range names {
+			obj := n.Objects[name]
+			c.string(&name)
+			c.object(&obj)
+		}
+		return
+	}
+	k := c.uint(0)
+	if k > uint64(len(c.data)) {
+		c.fail(errCorrupt)
+		return
+	}
+	n.Objects = make(map[string]*ast.Object, k)
+	for i := uint64(0); i < k && c.err == nil; i++ {
+		var name string
+		var obj *ast.Object
+		c.string(&name)
+		c.object(&obj)
+		n.Objects[name] = obj
+	}
+}
+
+// Nodes.
+
+func (c *codec) file(p **ast.File) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.File); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.File)
+		c.add(*p)
+	}
+	n := *p
+	c.commentGroup(&n.Doc)
+	c.pos(&n.Package)
+	c.ident(&n.Name)
+	c.declList(&n.Decls)
+	c.pos(&n.FileStart)
+	c.pos(&n.FileEnd)
+	c.scope(&n.Scope)
+	c.importSpecList(&n.Imports)
+	c.identList(&n.Unresolved)
+	c.commentGroupList(&n.Comments)
+	c.string(&n.GoVersion)
+}
+
+func (c *codec) field(p **ast.Field) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.Field); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.Field)
+		c.add(*p)
+	}
+	n := *p
+	c.commentGroup(&n.Doc)
+	c.identList(&n.Names)
+	c.expr(&n.Type)
+	c.basicLit(&n.Tag)
+	c.commentGroup(&n.Comment)
+}
+
+func (c *codec) fieldList(p **ast.FieldList) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.FieldList); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.FieldList)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Opening)
+	c.fieldSlice(&n.List)
+	c.pos(&n.Closing)
+}
+
+func (c *codec) badExpr(p **ast.BadExpr) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.BadExpr); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.BadExpr)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.From)
+	c.pos(&n.To)
+}
+
+func (c *codec) ident(p **ast.Ident) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.Ident); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		if len(c.idents) == 0 {
+			c.idents = make([]ast.Ident, 256)
+		}
+		*p = &c.idents[0]
+		c.idents = c.idents[1:]
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.NamePos)
+	c.string(&n.Name)
+	c.object(&n.Obj)
+}
+
+func (c *codec) ellipsis(p **ast.Ellipsis) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.Ellipsis); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.Ellipsis)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Ellipsis)
+	c.expr(&n.Elt)
+}
+
+func (c *codec) basicLit(p **ast.BasicLit) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.BasicLit); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.BasicLit)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.ValuePos)
+	c.pos(&n.ValueEnd)
+	c.token(&n.Kind)
+	c.string(&n.Value)
+}
+
+func (c *codec) funcLit(p **ast.FuncLit) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.FuncLit); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.FuncLit)
+		c.add(*p)
+	}
+	n := *p
+	c.funcType(&n.Type)
+	c.blockStmt(&n.Body)
+}
+
+func (c *codec) compositeLit(p **ast.CompositeLit) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.CompositeLit); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.CompositeLit)
+		c.add(*p)
+	}
+	n := *p
+	c.expr(&n.Type)
+	c.pos(&n.Lbrace)
+	c.exprList(&n.Elts)
+	c.pos(&n.Rbrace)
+	c.bool(&n.Incomplete)
+}
+
+func (c *codec) parenExpr(p **ast.ParenExpr) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.ParenExpr); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.ParenExpr)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Lparen)
+	c.expr(&n.X)
+	c.pos(&n.Rparen)
+}
+
+func (c *codec) selectorExpr(p **ast.SelectorExpr) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.SelectorExpr); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.SelectorExpr)
+		c.add(*p)
+	}
+	n := *p
+	c.expr(&n.X)
+	c.ident(&n.Sel)
+}
+
+func (c *codec) indexExpr(p **ast.IndexExpr) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.IndexExpr); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.IndexExpr)
+		c.add(*p)
+	}
+	n := *p
+	c.expr(&n.X)
+	c.pos(&n.Lbrack)
+	c.expr(&n.Index)
+	c.pos(&n.Rbrack)
+}
+
+func (c *codec) sliceExpr(p **ast.SliceExpr) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.SliceExpr); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.SliceExpr)
+		c.add(*p)
+	}
+	n := *p
+	c.expr(&n.X)
+	c.pos(&n.Lbrack)
+	c.expr(&n.Low)
+	c.expr(&n.High)
+	c.expr(&n.Max)
+	c.bool(&n.Slice3)
+	c.pos(&n.Rbrack)
+}
+
+func (c *codec) typeAssertExpr(p **ast.TypeAssertExpr) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.TypeAssertExpr); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.TypeAssertExpr)
+		c.add(*p)
+	}
+	n := *p
+	c.expr(&n.X)
+	c.pos(&n.Lparen)
+	c.expr(&n.Type)
+	c.pos(&n.Rparen)
+}
+
+func (c *codec) callExpr(p **ast.CallExpr) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.CallExpr); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.CallExpr)
+		c.add(*p)
+	}
+	n := *p
+	c.expr(&n.Fun)
+	c.pos(&n.Lparen)
+	c.exprList(&n.Args)
+	c.pos(&n.Ellipsis)
+	c.pos(&n.Rparen)
+}
+
+func (c *codec) starExpr(p **ast.StarExpr) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.StarExpr); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.StarExpr)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Star)
+	c.expr(&n.X)
+}
+
+func (c *codec) unaryExpr(p **ast.UnaryExpr) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.UnaryExpr); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.UnaryExpr)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.OpPos)
+	c.token(&n.Op)
+	c.expr(&n.X)
+}
+
+func (c *codec) binaryExpr(p **ast.BinaryExpr) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.BinaryExpr); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.BinaryExpr)
+		c.add(*p)
+	}
+	n := *p
+	c.expr(&n.X)
+	c.pos(&n.OpPos)
+	c.token(&n.Op)
+	c.expr(&n.Y)
+}
+
+func (c *codec) keyValueExpr(p **ast.KeyValueExpr) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.KeyValueExpr); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.KeyValueExpr)
+		c.add(*p)
+	}
+	n := *p
+	c.expr(&n.Key)
+	c.pos(&n.Colon)
+	c.expr(&n.Value)
+}
+
+func (c *codec) arrayType(p **ast.ArrayType) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.ArrayType); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.ArrayType)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Lbrack)
+	c.expr(&n.Len)
+	c.expr(&n.Elt)
+}
+
+func (c *codec) structType(p **ast.StructType) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.StructType); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.StructType)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Struct)
+	c.fieldList(&n.Fields)
+	c.bool(&n.Incomplete)
+}
+
+func (c *codec) funcType(p **ast.FuncType) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.FuncType); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.FuncType)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Func)
+	c.fieldList(&n.TypeParams)
+	c.fieldList(&n.Params)
+	c.fieldList(&n.Results)
+}
+
+func (c *codec) interfaceType(p **ast.InterfaceType) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.InterfaceType); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.InterfaceType)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Interface)
+	c.fieldList(&n.Methods)
+	c.bool(&n.Incomplete)
+}
+
+func (c *codec) mapType(p **ast.MapType) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.MapType); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.MapType)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Map)
+	c.expr(&n.Key)
+	c.expr(&n.Value)
+}
+
+func (c *codec) chanType(p **ast.ChanType) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.ChanType); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.ChanType)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Begin)
+	c.pos(&n.Arrow)
+	n.Dir = ast.ChanDir(c.int(int(n.Dir)))
+	c.expr(&n.Value)
+}
+
+func (c *codec) badStmt(p **ast.BadStmt) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.BadStmt); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.BadStmt)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.From)
+	c.pos(&n.To)
+}
+
+func (c *codec) declStmt(p **ast.DeclStmt) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.DeclStmt); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.DeclStmt)
+		c.add(*p)
+	}
+	c.decl(&(*p).Decl)
+}
+
+func (c *codec) emptyStmt(p **ast.EmptyStmt) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.EmptyStmt); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.EmptyStmt)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Semicolon)
+	c.bool(&n.Implicit)
+}
+
+func (c *codec) labeledStmt(p **ast.LabeledStmt) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.LabeledStmt); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.LabeledStmt)
+		c.add(*p)
+	}
+	n := *p
+	c.ident(&n.Label)
+	c.pos(&n.Colon)
+	c.stmt(&n.Stmt)
+}
+
+func (c *codec) exprStmt(p **ast.ExprStmt) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.ExprStmt); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.ExprStmt)
+		c.add(*p)
+	}
+	c.expr(&(*p).X)
+}
+
+func (c *codec) sendStmt(p **ast.SendStmt) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.SendStmt); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.SendStmt)
+		c.add(*p)
+	}
+	n := *p
+	c.expr(&n.Chan)
+	c.pos(&n.Arrow)
+	c.expr(&n.Value)
+}
+
+func (c *codec) incDecStmt(p **ast.IncDecStmt) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.IncDecStmt); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.IncDecStmt)
+		c.add(*p)
+	}
+	n := *p
+	c.expr(&n.X)
+	c.pos(&n.TokPos)
+	c.token(&n.Tok)
+}
+
+func (c *codec) assignStmt(p **ast.AssignStmt) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.AssignStmt); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.AssignStmt)
+		c.add(*p)
+	}
+	n := *p
+	c.exprList(&n.Lhs)
+	c.pos(&n.TokPos)
+	c.token(&n.Tok)
+	c.exprList(&n.Rhs)
+}
+
+func (c *codec) goStmt(p **ast.GoStmt) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.GoStmt); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.GoStmt)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Go)
+	c.callExpr(&n.Call)
+}
+
+func (c *codec) deferStmt(p **ast.DeferStmt) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.DeferStmt); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.DeferStmt)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Defer)
+	c.callExpr(&n.Call)
+}
+
+func (c *codec) returnStmt(p **ast.ReturnStmt) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.ReturnStmt); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.ReturnStmt)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Return)
+	c.exprList(&n.Results)
+}
+
+func (c *codec) branchStmt(p **ast.BranchStmt) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.BranchStmt); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.BranchStmt)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.TokPos)
+	c.token(&n.Tok)
+	c.ident(&n.Label)
+}
+
+func (c *codec) blockStmt(p **ast.BlockStmt) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.BlockStmt); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.BlockStmt)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Lbrace)
+	c.stmtList(&n.List)
+	c.pos(&n.Rbrace)
+}
+
+func (c *codec) ifStmt(p **ast.IfStmt) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.IfStmt); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.IfStmt)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.If)
+	c.stmt(&n.Init)
+	c.expr(&n.Cond)
+	c.blockStmt(&n.Body)
+	c.stmt(&n.Else)
+}
+
+func (c *codec) caseClause(p **ast.CaseClause) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.CaseClause); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.CaseClause)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Case)
+	c.exprList(&n.List)
+	c.pos(&n.Colon)
+	c.stmtList(&n.Body)
+}
+
+func (c *codec) switchStmt(p **ast.SwitchStmt) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.SwitchStmt); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.SwitchStmt)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Switch)
+	c.stmt(&n.Init)
+	c.expr(&n.Tag)
+	c.blockStmt(&n.Body)
+}
+
+func (c *codec) typeSwitchStmt(p **ast.TypeSwitchStmt) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.TypeSwitchStmt); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.TypeSwitchStmt)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Switch)
+	c.stmt(&n.Init)
+	c.stmt(&n.Assign)
+	c.blockStmt(&n.Body)
+}
+
+func (c *codec) commClause(p **ast.CommClause) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.CommClause); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.CommClause)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Case)
+	c.stmt(&n.Comm)
+	c.pos(&n.Colon)
+	c.stmtList(&n.Body)
+}
+
+func (c *codec) selectStmt(p **ast.SelectStmt) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.SelectStmt); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.SelectStmt)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.Select)
+	c.blockStmt(&n.Body)
+}
+
+func (c *codec) forStmt(p **ast.ForStmt) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.ForStmt); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.ForStmt)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.For)
+	c.stmt(&n.Init)
+	c.expr(&n.Cond)
+	c.stmt(&n.Post)
+	c.blockStmt(&n.Body)
+}
+
+func (c *codec) rangeStmt(p **ast.RangeStmt) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.RangeStmt); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.RangeStmt)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.For)
+	c.expr(&n.Key)
+	c.expr(&n.Value)
+	c.pos(&n.TokPos)
+	c.token(&n.Tok)
+	c.pos(&n.Range)
+	c.expr(&n.X)
+	c.blockStmt(&n.Body)
+}
+
+func (c *codec) importSpec(p **ast.ImportSpec) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.ImportSpec); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.ImportSpec)
+		c.add(*p)
+	}
+	n := *p
+	c.commentGroup(&n.Doc)
+	c.ident(&n.Name)
+	c.basicLit(&n.Path)
+	c.commentGroup(&n.Comment)
+	c.pos(&n.EndPos)
+}
+
+func (c *codec) valueSpec(p **ast.ValueSpec) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.ValueSpec); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.ValueSpec)
+		c.add(*p)
+	}
+	n := *p
+	c.commentGroup(&n.Doc)
+	c.identList(&n.Names)
+	c.expr(&n.Type)
+	c.exprList(&n.Values)
+	c.commentGroup(&n.Comment)
+}
+
+func (c *codec) typeSpec(p **ast.TypeSpec) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.TypeSpec); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.TypeSpec)
+		c.add(*p)
+	}
+	n := *p
+	c.commentGroup(&n.Doc)
+	c.ident(&n.Name)
+	c.fieldList(&n.TypeParams)
+	c.pos(&n.Assign)
+	c.expr(&n.Type)
+	c.commentGroup(&n.Comment)
+}
+
+func (c *codec) badDecl(p **ast.BadDecl) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.BadDecl); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.BadDecl)
+		c.add(*p)
+	}
+	n := *p
+	c.pos(&n.From)
+	c.pos(&n.To)
+}
+
+func (c *codec) genDecl(p **ast.GenDecl) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.GenDecl); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.GenDecl)
+		c.add(*p)
+	}
+	n := *p
+	c.commentGroup(&n.Doc)
+	c.pos(&n.TokPos)
+	c.token(&n.Tok)
+	c.pos(&n.Lparen)
+	c.specList(&n.Specs)
+	c.pos(&n.Rparen)
+}
+
+func (c *codec) funcDecl(p **ast.FuncDecl) {
+	x, isNew := c.ref(*p, *p == nil)
+	if !isNew {
+		var ok bool
+		if *p, ok = x.(*ast.FuncDecl); !ok && x != nil {
+			c.fail(errCorrupt)
+		}
+		return
+	}
+	if *p == nil {
+		*p = new(ast.FuncDecl)
+		c.add(*p)
+	}
+	n := *p
+	c.commentGroup(&n.Doc)
+	c.fieldList(&n.Recv)
+	c.ident(&n.Name)
+	c.funcType(&n.Type)
+	c.blockStmt(&n.Body)
+}
+
+// codedTypes lists the struct types handled by the codec.
+var codedTypes = []interface{}{
+	ast.Comment{}, ast.CommentGroup{}, ast.Field{}, ast.FieldList{},
+	ast.BadExpr{}, ast.Ident{}, ast.Ellipsis{}, ast.BasicLit{}, ast.FuncLit{},
+	ast.CompositeLit{}, ast.ParenExpr{}, ast.SelectorExpr{}, ast.IndexExpr{},
+	ast.SliceExpr{}, ast.TypeAssertExpr{}, ast.CallExpr{}, ast.StarExpr{},
+	ast.UnaryExpr{}, ast.BinaryExpr{}, ast.KeyValueExpr{}, ast.ArrayType{},
+	ast.StructType{}, ast.FuncType{}, ast.InterfaceType{}, ast.MapType{},
+	ast.ChanType{}, ast.BadStmt{}, ast.DeclStmt{}, ast.EmptyStmt{},
+	ast.LabeledStmt{}, ast.ExprStmt{}, ast.SendStmt{}, ast.IncDecStmt{},
+	ast.AssignStmt{}, ast.GoStmt{}, ast.DeferStmt{}, ast.ReturnStmt{},
+	ast.BranchStmt{}, ast.BlockStmt{}, ast.IfStmt{}, ast.CaseClause{},
+	ast.SwitchStmt{}, ast.TypeSwitchStmt{}, ast.CommClause{}, ast.SelectStmt{},
+	ast.ForStmt{}, ast.RangeStmt{}, ast.ImportSpec{}, ast.ValueSpec{},
+	ast.TypeSpec{}, ast.BadDecl{}, ast.GenDecl{}, ast.FuncDecl{}, ast.File{},
+	ast.Scope{}, ast.Object{},
+}
+
+// schema returns a fingerprint of the layout of the types handled by the
+// codec, so that encodings become invalid if the go/ast types change.
+func schema() string {
+	h := sha256.New()
+	for _, x := range codedTypes {
+		t := reflect.TypeOf(x)
+		fmt.Fprintf(h, "%s{", t)
+		for i := 0; i < t.NumField(); i++ {
+			fmt.Fprintf(h, "%s %s;", t.Field(i).Name, t.Field(i).Type)
+		}
+		fmt.Fprintf(h, "}\n")
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
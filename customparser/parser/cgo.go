@@ -0,0 +1,289 @@
+// This file implements the ParseCgo pass: the cgo preamble in the doc
+// comment of an import "C" declaration is extracted and its #cgo
+// directives are parsed and validated, like the go command does.
+
+package parser
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// A CgoPreamble is the C source in the doc comment of an import "C"
+// declaration.
+//
+type CgoPreamble struct {
+	Doc        *ast.CommentGroup // comment holding the preamble
+	Text       string            // C source, without comment markers
+	Directives []*CgoDirective   // valid #cgo directives, in source order
+}
+
+// A CgoDirective is a #cgo line of a preamble:
+//
+//	#cgo [conditions] VERB: args
+//	#cgo noescape|nocallback function
+//
+type CgoDirective struct {
+	Pos        token.Pos // position of "#cgo"
+	Conditions []string  // build constraints, e.g. "linux,amd64" or "!windows"
+	Verb       string    // CFLAGS, CPPFLAGS, CXXFLAGS, FFLAGS, LDFLAGS, pkg-config, noescape or nocallback
+	Args       []string  // arguments, unquoted
+}
+
+// cgoVerbs lists the valid verbs of #cgo directives.
+var cgoVerbs = map[string]bool{
+	"CFLAGS":     true,
+	"CPPFLAGS":   true,
+	"CXXFLAGS":   true,
+	"FFLAGS":     true,
+	"LDFLAGS":    true,
+	"pkg-config": true,
+}
+
+// checkCgo parses the preambles of the import "C" declarations of f,
+// records them in info (if not nil), and reports malformed #cgo
+// directives.
+//
+func (p *parser) checkCgo(f *ast.File, info *Info) {
+	for _, d := range f.Decls {
+		d, ok := d.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT {
+			continue
+		}
+		for _, s := range d.Specs {
+			s := s.(*ast.ImportSpec)
+			if s.Path.Value != `"C"` {
+				continue
+			}
+			// same rule as cmd/cgo
+			doc := s.Doc
+			if doc == nil && len(d.Specs) == 1 {
+				doc = d.Doc
+			}
+			pre := p.parseCgoPreamble(doc)
+			if info != nil {
+				if info.Cgo == nil {
+					info.Cgo = make(map[*ast.ImportSpec]*CgoPreamble)
+				}
+				info.Cgo[s] = pre
+			}
+		}
+	}
+}
+
+func (p *parser) parseCgoPreamble(doc *ast.CommentGroup) *CgoPreamble {
+	pre := &CgoPreamble{Doc: doc}
+	if doc == nil {
+		return pre
+	}
+	var text []string
+	for _, c := range doc.List {
+		// the lines of the comment with their positions
+		var lines []string
+		var pos []token.Pos
+		if c.Text[1] == '/' {
+			lines = []string{c.Text[2:]}
+			pos = []token.Pos{c.Slash + 2}
+		} else {
+			offs := 2
+			for _, line := range strings.Split(c.Text[2:len(c.Text)-2], "\n") {
+				lines = append(lines, line)
+				pos = append(pos, c.Slash+token.Pos(offs))
+				offs += len(line) + 1
+			}
+		}
+		for i, line := range lines {
+			text = append(text, line)
+			if d := p.parseCgoDirective(line, pos[i]); d != nil {
+				pre.Directives = append(pre.Directives, d)
+			}
+		}
+	}
+	pre.Text = strings.Join(text, "\n") + "\n"
+	return pre
+}
+
+// parseCgoDirective parses the preamble line at pos. It returns nil if
+// the line is not a valid #cgo directive, reporting the malformed ones.
+//
+func (p *parser) parseCgoDirective(line string, pos token.Pos) *CgoDirective {
+	trimmed := strings.TrimLeft(line, " \t")
+	if !strings.HasPrefix(trimmed, "#cgo") {
+		return nil
+	}
+	offs := len(line) - len(trimmed)
+	if len(trimmed) > 4 && trimmed[4] != ' ' && trimmed[4] != '\t' && trimmed[4] != ':' {
+		return nil // e.g. #cgoflags, not a directive
+	}
+	d := &CgoDirective{Pos: pos + token.Pos(offs)}
+	rest := trimmed[4:]
+	if words := cgoFields(rest, offs+4); len(words) > 0 && (words[0].text == "noescape" || words[0].text == "nocallback") {
+		// #cgo noescape/nocallback function
+		if len(words) != 2 {
+			p.error(d.Pos, MsgCgoExpectedFunction, words[0].text)
+			return nil
+		}
+		d.Verb = words[0].text
+		d.Args = []string{words[1].text}
+		return d
+	}
+	colon := strings.Index(rest, ":")
+	if colon < 0 {
+		p.error(d.Pos, MsgCgoMissingColon)
+		return nil
+	}
+	words := cgoFields(rest[:colon], offs+4)
+	if len(words) == 0 {
+		p.error(d.Pos, MsgCgoMissingVerb)
+		return nil
+	}
+	verb := words[len(words)-1]
+	if !cgoVerbs[verb.text] {
+		p.error(pos+token.Pos(verb.offs), MsgCgoVerb, verb.text)
+		return nil
+	}
+	d.Verb = verb.text
+	for _, w := range words[:len(words)-1] {
+		if !validCgoCondition(w.text) {
+			p.error(pos+token.Pos(w.offs), MsgCgoCondition, w.text)
+			return nil
+		}
+		d.Conditions = append(d.Conditions, w.text)
+	}
+
+	args, errOffs, msg := splitQuoted(rest[colon+1:])
+	if msg.ID != "" {
+		p.error(pos+token.Pos(offs+4+colon+1+errOffs), msg.ID, msg.Args...)
+		return nil
+	}
+	for _, a := range args {
+		if d.Verb == "pkg-config" && !validPkgConfigName(a.text) {
+			p.error(pos+token.Pos(offs+4+colon+1+a.offs), MsgPkgConfigName, a.text)
+			return nil
+		}
+		d.Args = append(d.Args, a.text)
+	}
+	return d
+}
+
+type cgoWord struct {
+	text string
+	offs int // offset in the line
+}
+
+// cgoFields splits s, starting at offset base in its line, into fields
+// separated by white space.
+//
+func cgoFields(s string, base int) []cgoWord {
+	var words []cgoWord
+	start := -1
+	for i := 0; i <= len(s); i++ {
+		if i == len(s) || s[i] == ' ' || s[i] == '\t' {
+			if start >= 0 {
+				words = append(words, cgoWord{s[start:i], base + start})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	return words
+}
+
+// validCgoCondition reports whether cond is a valid build condition of
+// a #cgo directive: a comma-separated list of optionally negated words.
+//
+func validCgoCondition(cond string) bool {
+	for _, term := range strings.Split(cond, ",") {
+		term = strings.TrimPrefix(term, "!")
+		if term == "" {
+			return false
+		}
+		for _, c := range term {
+			if !isLetter(c) && !isDigit(c) && c != '.' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isLetter(ch rune) bool { return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' }
+func isDigit(ch rune) bool  { return '0' <= ch && ch <= '9' }
+
+// validPkgConfigName reports whether name is a valid pkg-config package
+// name or option, as accepted by the go command.
+//
+func validPkgConfigName(name string) bool {
+	if name == "" || (name[0] == '-' && !strings.HasPrefix(name, "--")) {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !isLetter(rune(c)) && !isDigit(rune(c)) && !strings.ContainsRune("-._+=/", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitQuoted splits s into arguments separated by white space, using
+// the quoting rules of the go command: single or double quotes group
+// characters, and a backslash escapes the next character. If s is
+// malformed, it returns the offset of the problem and a message.
+//
+func splitQuoted(s string) (args []cgoWord, errOffs int, msg Message) {
+	var arg []byte
+	start := -1
+	quote := byte(0)
+	quoteOffs := 0
+	escaped := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+			if start < 0 {
+				start = i
+			}
+			continue
+		case quote != 0:
+			if c == quote {
+				quote = 0
+				continue
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			quoteOffs = i
+			if start < 0 {
+				start = i
+			}
+			continue
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if start >= 0 {
+				args = append(args, cgoWord{string(arg), start})
+				arg = arg[:0]
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		arg = append(arg, c)
+	}
+	if quote != 0 {
+		return nil, quoteOffs, Message{ID: MsgCgoUnclosedQuote, Args: []interface{}{strconv.QuoteRune(rune(quote))}}
+	}
+	if escaped {
+		return nil, len(s) - 1, Message{ID: MsgCgoUnfinishedEscape}
+	}
+	if start >= 0 {
+		args = append(args, cgoWord{string(arg), start})
+	}
+	return args, 0, Message{}
+}
@@ -0,0 +1,131 @@
+package parser
+
+import (
+	"go/scanner"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const cgoSrc = `package p
+
+// #cgo CFLAGS: -DPNG_DEBUG=1 "-I/with space"
+// #cgo linux,amd64 !windows LDFLAGS: -lm
+// #cgo pkg-config: png cairo
+// #cgo noescape f
+// #include <math.h>
+import "C"
+
+import (
+	"fmt"
+
+	/*
+	#cgo CFLAGS -O2
+	#cgo linux CXXFLAGS: -x
+	#cgo windows/386 LDFLAGS: -lm
+	#cgo darwin FOO: -x
+	#cgo LDFLAGS: "-lm
+	#cgo pkg-config: -bad
+	#cgo: -x
+	#cgoflags are not directives
+	*/
+	"C"
+)
+
+var _ = fmt.Println
+`
+
+func TestParseCgo(t *testing.T) {
+	fset := token.NewFileSet()
+	info := &Info{}
+	conf := Config{Mode: ParseCgo | AllErrors, Info: info}
+	f, err := conf.ParseFile(fset, "p.go", cgoSrc)
+	list, ok := err.(scanner.ErrorList)
+	if !ok {
+		t.Fatalf("got %v; want errors", err)
+	}
+	want := []string{
+		`p.go:14:2: invalid #cgo line: missing ':'`,
+		`p.go:16:7: invalid #cgo condition: windows/386`,
+		`p.go:17:14: invalid #cgo verb: FOO`,
+		`p.go:18:16: malformed #cgo argument: unclosed quote '"'`,
+		`p.go:19:19: invalid pkg-config package name: -bad`,
+		`p.go:20:2: invalid #cgo line: missing verb`,
+	}
+	var got []string
+	for _, err := range list {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got errors\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if f.Comments == nil {
+		t.Error("ParseCgo doesn't imply ParseComments")
+	}
+
+	if len(info.Cgo) != 2 {
+		t.Fatalf("got %d preambles; want 2", len(info.Cgo))
+	}
+	pre := info.Cgo[f.Imports[0]]
+	if pre == nil || pre.Doc == nil {
+		t.Fatal("no preamble for the first import")
+	}
+	if want := " #include <math.h>\n"; !strings.HasSuffix(pre.Text, want) {
+		t.Errorf("got text %q; want suffix %q", pre.Text, want)
+	}
+	file := fset.File(f.Package)
+	var dirs []CgoDirective
+	for _, d := range pre.Directives {
+		dirs = append(dirs, *d)
+	}
+	wantDirs := []CgoDirective{
+		{file.Pos(strings.Index(cgoSrc, "#cgo CFLAGS: -D")), nil, "CFLAGS", []string{"-DPNG_DEBUG=1", "-I/with space"}},
+		{file.Pos(strings.Index(cgoSrc, "#cgo linux,amd64")), []string{"linux,amd64", "!windows"}, "LDFLAGS", []string{"-lm"}},
+		{file.Pos(strings.Index(cgoSrc, "#cgo pkg-config: png")), nil, "pkg-config", []string{"png", "cairo"}},
+		{file.Pos(strings.Index(cgoSrc, "#cgo noescape")), nil, "noescape", []string{"f"}},
+	}
+	if !reflect.DeepEqual(dirs, wantDirs) {
+		t.Errorf("got directives\n%v\nwant\n%v", dirs, wantDirs)
+	}
+
+	pre = info.Cgo[f.Imports[2]]
+	if pre == nil || len(pre.Directives) != 1 || pre.Directives[0].Verb != "CXXFLAGS" {
+		t.Errorf("got %+v; want a single CXXFLAGS directive", pre)
+	}
+	if pos := fset.Position(pre.Directives[0].Pos).String(); pos != "p.go:15:2" {
+		t.Errorf("got position %s; want p.go:15:2", pos)
+	}
+
+	// without the mode, the preambles are not checked
+	if _, err := ParseFile(token.NewFileSet(), "p.go", cgoSrc, 0); err != nil {
+		t.Errorf("got %v without ParseCgo", err)
+	}
+}
+
+func TestSplitQuoted(t *testing.T) {
+	for _, test := range []struct {
+		s    string
+		args []string
+		msg  string // in English
+	}{
+		{"", nil, ""},
+		{` a  'b c' "d\"e" f\ g`, []string{"a", "b c", `d"e`, "f g"}, ""},
+		{`a'b'c`, []string{"abc"}, ""},
+		{`'a`, nil, `malformed #cgo argument: unclosed quote '\''`},
+		{`a\`, nil, "malformed #cgo argument: unfinished escaping"},
+	} {
+		args, _, m := splitQuoted(test.s)
+		msg := ""
+		if m.ID != "" {
+			msg = m.Text("en")
+		}
+		var got []string
+		for _, a := range args {
+			got = append(got, a.text)
+		}
+		if !reflect.DeepEqual(got, test.args) || msg != test.msg {
+			t.Errorf("splitQuoted(%q) = %q, %q; want %q, %q", test.s, got, msg, test.args, test.msg)
+		}
+	}
+}
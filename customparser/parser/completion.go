@@ -0,0 +1,383 @@
+// This file implements code-completion support: the syntactic context
+// at a cursor position in (possibly incomplete) source, and the objects
+// in scope there, as recorded by the parser's scope chain.
+
+package parser
+
+import (
+	"errors"
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+// A CompletionKind describes the syntactic context of a completion.
+//
+type CompletionKind int
+
+const (
+	CompletionNone     CompletionKind = iota // no identifier expected
+	CompletionExpr                           // identifier in an expression
+	CompletionSelector                       // selector of X, as in X.sel
+	CompletionField                          // field name in a composite literal
+	CompletionImport                         // import path
+	CompletionType                           // type
+	CompletionStmt                           // start of a statement
+)
+
+var completionKinds = [...]string{
+	CompletionNone:     "none",
+	CompletionExpr:     "expression",
+	CompletionSelector: "selector",
+	CompletionField:    "field",
+	CompletionImport:   "import",
+	CompletionType:     "type",
+	CompletionStmt:     "statement",
+}
+
+func (k CompletionKind) String() string {
+	if 0 <= k && int(k) < len(completionKinds) {
+		return completionKinds[k]
+	}
+	return "CompletionKind(?)"
+}
+
+// A Completion is the completion context at a cursor position.
+//
+type Completion struct {
+	Kind   CompletionKind
+	File   *ast.File         // parsed file
+	Prefix string            // partial identifier (or import path) before the cursor
+	X      ast.Expr          // operand of the selector (CompletionSelector)
+	Lit    *ast.CompositeLit // composite literal (CompletionField)
+
+	// Objects lists the objects in scope at the cursor, from the
+	// innermost scope to the package scope and sorted by name within a
+	// scope. Shadowed objects and local objects declared after the
+	// cursor are omitted. Imported package names are not objects and
+	// are not listed.
+	Objects []*ast.Object
+}
+
+// Complete parses the source of a single file, which may be incomplete,
+// and returns the completion context at the byte offset cursor. The
+// source is provided as for ParseFile. Syntax errors are expected and
+// ignored; the returned error is only about reading the source.
+//
+func Complete(fset *token.FileSet, filename string, src interface{}, cursor int) (*Completion, error) {
+	text, err := readSource(filename, src)
+	if err != nil {
+		return nil, err
+	}
+	if cursor < 0 || cursor > len(text) {
+		return nil, errors.New("parser: cursor out of range")
+	}
+
+	var p parser
+	var f *ast.File
+	func() {
+		defer func() {
+			if e := recover(); e != nil {
+				if _, ok := e.(bailout); !ok {
+					panic(e)
+				}
+			}
+		}()
+		p.init(fset, filename, text, AllErrors)
+		p.cursor = p.file.Pos(cursor)
+		f = p.parseFile()
+	}()
+	if f == nil {
+		// invalid package clause
+		return &Completion{File: &ast.File{Name: new(ast.Ident), Scope: ast.NewScope(nil)}}, nil
+	}
+
+	c := &Completion{File: f}
+	c.classify(pathTo(f, p.cursor), p.cursor)
+	c.Objects = p.objectsAt(f)
+	return c, nil
+}
+
+// ----------------------------------------------------------------------------
+// Scopes
+
+// A scopeExtent is the source range of a scope: start is the end of the
+// token preceding the scope, end the end of the last token of the scope
+// (or NoPos if the scope was not closed).
+type scopeExtent struct {
+	scope      *ast.Scope
+	start, end token.Pos
+	stmt       bool // scope of an if, switch or for statement
+}
+
+func tokenLen(tok token.Token, lit string) int {
+	if lit != "" {
+		return len(lit)
+	}
+	return len(tok.String())
+}
+
+func (p *parser) scopeOpened() {
+	if p.cursor.IsValid() {
+		p.extents = append(p.extents, scopeExtent{scope: p.topScope, start: p.prevEnd})
+	}
+}
+
+func (p *parser) stmtScopeOpened() {
+	if p.cursor.IsValid() {
+		p.extents[len(p.extents)-1].stmt = true
+	}
+}
+
+func (p *parser) scopeClosed() {
+	if !p.cursor.IsValid() {
+		return
+	}
+	for i := len(p.extents) - 1; i >= 0; i-- {
+		e := &p.extents[i]
+		if e.scope != p.topScope || e.end.IsValid() {
+			continue
+		}
+		switch {
+		case e.stmt:
+			// Statement scopes are closed after the statement, which
+			// may include a semicolon; they end with their last
+			// nested scope (the body).
+			e.end = p.prevEnd
+			for _, c := range p.extents[i+1:] {
+				if c.scope.Outer == e.scope {
+					e.end = c.end
+				}
+			}
+		case p.tok == token.RBRACE || p.tok == token.EOF:
+			// blocks are closed before their closing brace (if any)
+			// is consumed
+			e.end = p.pos + 1
+		default:
+			e.end = p.prevEnd
+		}
+		return
+	}
+}
+
+// objectsAt returns the objects in scope at the cursor.
+//
+func (p *parser) objectsAt(f *ast.File) []*ast.Object {
+	// innermost scope containing the cursor
+	var inner *scopeExtent
+	for i := range p.extents {
+		e := &p.extents[i]
+		if e.start <= p.cursor && (!e.end.IsValid() || p.cursor < e.end) {
+			if inner == nil || e.start >= inner.start {
+				inner = e
+			}
+		}
+	}
+
+	var list []*ast.Object
+	seen := make(map[string]bool)
+	add := func(scope *ast.Scope, local bool) {
+		var objs []*ast.Object
+		for name, obj := range scope.Objects {
+			if !seen[name] && (!local || declaredBefore(obj, p.cursor)) {
+				objs = append(objs, obj)
+			}
+		}
+		sort.Sort(byName(objs))
+		for _, obj := range objs {
+			seen[obj.Name] = true
+		}
+		list = append(list, objs...)
+	}
+	if inner != nil {
+		for s := inner.scope; s != nil && s != f.Scope; s = s.Outer {
+			add(s, true)
+		}
+	}
+	if f.Scope != nil {
+		add(f.Scope, false)
+	}
+	return list
+}
+
+// declaredBefore reports whether the local object obj is in scope at
+// pos: its declaration must end before pos, except for types, which are
+// in scope in their own declaration.
+//
+func declaredBefore(obj *ast.Object, pos token.Pos) bool {
+	end := obj.Pos()
+	switch d := obj.Decl.(type) {
+	case *ast.AssignStmt:
+		end = d.End()
+	case *ast.ValueSpec:
+		end = d.End()
+	}
+	return end.IsValid() && end < pos
+}
+
+type byName []*ast.Object
+
+func (a byName) Len() int           { return len(a) }
+func (a byName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byName) Less(i, j int) bool { return a[i].Name < a[j].Name }
+
+// ----------------------------------------------------------------------------
+// Context
+
+// pathTo returns the nodes enclosing pos, from the file to the
+// innermost node.
+//
+func pathTo(f *ast.File, pos token.Pos) []ast.Node {
+	var path []ast.Node
+	ast.Inspect(f, func(n ast.Node) bool {
+		if n == nil || !(n.Pos() <= pos && pos <= n.End()) {
+			return false
+		}
+		if _, ok := n.(*ast.BadExpr); ok {
+			return false
+		}
+		if b, ok := n.(*ast.BlockStmt); ok && b.Rbrace.IsValid() && pos > b.Rbrace {
+			return false // after the closing brace
+		}
+		path = append(path, n)
+		return true
+	})
+	return path
+}
+
+// classify sets the kind of c from the path of nodes enclosing pos.
+//
+func (c *Completion) classify(path []ast.Node, pos token.Pos) {
+	if len(path) == 0 {
+		return
+	}
+	inner := path[len(path)-1]
+	if id, ok := inner.(*ast.Ident); ok && id.Name != "_" && pos <= id.End() {
+		c.Prefix = id.Name[:pos-id.Pos()]
+	}
+
+	for i := len(path) - 1; i >= 0; i-- {
+		var child ast.Node
+		if i+1 < len(path) {
+			child = path[i+1]
+		}
+		switch n := path[i].(type) {
+		case *ast.BasicLit:
+			if i > 0 && n.Kind == token.STRING && pos > n.Pos() {
+				if spec, ok := path[i-1].(*ast.ImportSpec); ok && spec.Path == n {
+					c.Kind = CompletionImport
+					end := int(pos - n.Pos())
+					if end > len(n.Value) {
+						end = len(n.Value)
+					}
+					c.Prefix = n.Value[1:end]
+					return
+				}
+			}
+			return
+
+		case *ast.SelectorExpr:
+			if pos > n.X.End() {
+				c.Kind = CompletionSelector
+				c.X = n.X
+				if n.Sel.Name == "_" && n.Sel.Pos() >= pos {
+					c.Prefix = "" // placeholder of an incomplete selector
+				}
+				return
+			}
+
+		case *ast.CompositeLit:
+			if child != nil && child == n.Type {
+				c.Kind = CompletionType
+				return
+			}
+			switch n.Type.(type) {
+			case *ast.ArrayType, *ast.MapType:
+				// elements are values
+			default:
+				if kv, ok := child.(*ast.KeyValueExpr); child == nil || ok && i+2 < len(path) && path[i+2] == kv.Key {
+					c.Kind = CompletionField
+					c.Lit = n
+					return
+				}
+				if _, ok := child.(*ast.Ident); ok {
+					c.Kind = CompletionField
+					c.Lit = n
+					return
+				}
+			}
+
+		case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+			if child == nil {
+				if _, ok := n.(*ast.BlockStmt); ok || pos > colonPos(n) {
+					c.Kind = CompletionStmt
+				}
+				return
+			}
+			if s, ok := child.(*ast.ExprStmt); ok && i+2 < len(path) && path[i+2] == s.X {
+				if _, ok := s.X.(*ast.Ident); ok && len(path) == i+3 {
+					c.Kind = CompletionStmt
+					return
+				}
+			}
+
+		case *ast.Field, *ast.ValueSpec, *ast.TypeSpec, *ast.ArrayType, *ast.MapType,
+			*ast.ChanType, *ast.TypeAssertExpr, *ast.Ellipsis:
+			if typ := typeSlot(n); child != nil && child == typ {
+				c.Kind = CompletionType
+				return
+			}
+			if m, ok := n.(*ast.MapType); ok && child != nil && child == m.Key {
+				c.Kind = CompletionType
+				return
+			}
+
+		case *ast.StarExpr:
+			// keep looking: *T is a type if it is in a type position
+
+		case *ast.File, *ast.GenDecl, *ast.FuncDecl, *ast.FuncType, *ast.FieldList, *ast.StructType:
+			if child == nil {
+				return
+			}
+		}
+	}
+	if _, ok := inner.(*ast.Ident); ok && c.Kind == CompletionNone {
+		c.Kind = CompletionExpr
+	}
+}
+
+// typeSlot returns the child of n that is a type, if any.
+//
+func typeSlot(n ast.Node) ast.Expr {
+	switch n := n.(type) {
+	case *ast.Field:
+		return n.Type
+	case *ast.ValueSpec:
+		return n.Type
+	case *ast.TypeSpec:
+		return n.Type
+	case *ast.ArrayType:
+		return n.Elt
+	case *ast.MapType:
+		return n.Value
+	case *ast.ChanType:
+		return n.Value
+	case *ast.TypeAssertExpr:
+		return n.Type
+	case *ast.Ellipsis:
+		return n.Elt
+	}
+	return nil
+}
+
+// colonPos returns the position of the colon of a case clause.
+//
+func colonPos(n ast.Node) token.Pos {
+	switch n := n.(type) {
+	case *ast.CaseClause:
+		return n.Colon
+	case *ast.CommClause:
+		return n.Colon
+	}
+	return token.NoPos
+}
@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	for _, test := range []struct {
+		src     string // @ marks the cursor
+		kind    CompletionKind
+		prefix  string
+		objects string // names of the objects in scope
+	}{
+		{"package p; import \"fm@\"", CompletionImport, "fm", ""},
+		{"package p; import (\n\t\"fmt\"\n\t\"net/@\"\n)", CompletionImport, "net/", ""},
+		{"package p; var _ = fmt.@", CompletionSelector, "", ""},
+		{"package p; var _ = fmt.@\ntype X int", CompletionSelector, "", ""}, // type X is skipped by error recovery
+		{"package p; func f() { fmt.Pr@ }", CompletionSelector, "Pr", "f"},
+		{"package p; var x = T{Na@}", CompletionField, "Na", "x"},
+		{"package p; var x = T{Name: 1, @}", CompletionField, "", "x"},
+		{"package p; var x = T{Name: y@}", CompletionExpr, "y", "x"},
+		{"package p; var x = []T{@}", CompletionNone, "", "x"},
+		{"package p; var x ma@", CompletionType, "ma", "x"},
+		{"package p; func f(a i@) {}", CompletionType, "i", "f"},
+		{"package p; func f(a *i@) {}", CompletionType, "i", "f"},
+		{"package p; type T struct { a map[s@]int }", CompletionType, "s", "T"},
+		{"package p; var x = y.(s@)", CompletionType, "s", "x"},
+		{"package p; var x = y + z@", CompletionExpr, "z", "x"},
+		{"package p; func f(a int) {\n\tb := 1\n\t@\n\td := 2\n}", CompletionStmt, "", "a b f"},
+		{"package p; func f(a int) {\n\tb := 1\n\tc@\n\td := 2\n}", CompletionStmt, "c", "a b f"},
+		{"package p; func f(a int) {\n\tb := b@\n}", CompletionExpr, "b", "a f"},
+		{"package p; func f() {\n\tif x := 1; x > 0 {\n\t\ty := 2\n\t\t@\n\t}\n}", CompletionStmt, "", "y x f"},
+		{"package p; func f() {\n\tif x := 1; x > 0 {\n\t}@\n}", CompletionNone, "", "f"},
+		{"package p; func f() {\n\tfor i := range s {\n\t@", CompletionStmt, "", "i f"},
+		{"package p; func f(a int) {\n\tswitch {\n\tcase a > 0:\n\t\tb := 1\n\t\t@\n\t}\n}", CompletionStmt, "", "b a f"},
+		{"package p; func f(a int) {\n\tg := func(a string) {\n\t\t@\n\t}\n}", CompletionStmt, "", "a f"},
+		{"package p; var a, b int; func f() { var a int; _ = @ }", CompletionNone, "", "a b f"},
+	} {
+		offs := strings.Index(test.src, "@")
+		src := test.src[:offs] + test.src[offs+1:]
+		c, err := Complete(token.NewFileSet(), "", src, offs)
+		if err != nil {
+			t.Errorf("%q: %v", test.src, err)
+			continue
+		}
+		var names []string
+		for _, obj := range c.Objects {
+			names = append(names, obj.Name)
+		}
+		if c.Kind != test.kind || c.Prefix != test.prefix || strings.Join(names, " ") != test.objects {
+			t.Errorf("%q: got %s %q [%s]; want %s %q [%s]", test.src, c.Kind, c.Prefix, strings.Join(names, " "), test.kind, test.prefix, test.objects)
+		}
+	}
+}
+
+func TestCompleteOperands(t *testing.T) {
+	src := "package p; var _ = a.b.c@"
+	offs := strings.Index(src, "@")
+	c, err := Complete(token.NewFileSet(), "", src[:offs], offs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel, ok := c.X.(*ast.SelectorExpr); c.Kind != CompletionSelector || !ok || sel.Sel.Name != "b" {
+		t.Errorf("got %s with X %#v; want selector on a.b", c.Kind, c.X)
+	}
+
+	src = "package p; var _ = T{x: 1, @}"
+	offs = strings.Index(src, "@")
+	c, err = Complete(token.NewFileSet(), "", src[:offs]+src[offs+1:], offs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Lit == nil || c.Lit.Type.(*ast.Ident).Name != "T" {
+		t.Errorf("got literal %#v; want T{...}", c.Lit)
+	}
+
+	if _, err := Complete(token.NewFileSet(), "", "package p", 10); err == nil {
+		t.Error("no error for cursor out of range")
+	}
+}
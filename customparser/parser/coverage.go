@@ -0,0 +1,182 @@
+// This file implements grammar coverage: the productions of the parser
+// and the error call sites reached by the files of a parse session,
+// recorded through the hooks used for tracing.
+
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// An ErrorSite is a call site of the parser's error reporting functions
+// in the parser's source.
+//
+type ErrorSite struct {
+	File string // base name of the source file, e.g. "parser.go"
+	Line int
+	Func string // name of the enclosing function or method, e.g. "parseOperand"
+}
+
+func (s ErrorSite) String() string {
+	return fmt.Sprintf("%s:%d (%s)", s.File, s.Line, s.Func)
+}
+
+// A Coverage records the grammar productions (as named by the Trace
+// mode) and the error call sites reached while parsing with a Config
+// referring to it. A Coverage may be shared by concurrent parses; its
+// fields must not be accessed while files are being parsed.
+//
+type Coverage struct {
+	mu sync.Mutex
+
+	Productions map[string]int    // number of times each production was parsed
+	Errors      map[ErrorSite]int // number of errors reported at each call site
+}
+
+// coverage holds the counts of a single parse, which are added to the
+// Coverage at the end of the parse.
+type coverage struct {
+	productions map[string]int
+	errors      map[ErrorSite]int
+}
+
+func (p *parser) initCoverage() {
+	p.cov = &coverage{
+		productions: make(map[string]int),
+		errors:      make(map[ErrorSite]int),
+	}
+	p.trace = true
+}
+
+func (c *Coverage) add(cov *coverage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Productions == nil {
+		c.Productions = make(map[string]int)
+	}
+	if c.Errors == nil {
+		c.Errors = make(map[ErrorSite]int)
+	}
+	for name, n := range cov.productions {
+		c.Productions[name] += n
+	}
+	for site, n := range cov.errors {
+		c.Errors[site] += n
+	}
+}
+
+// errorSite records the call site of p.error or p.errorExpected; skip is
+// the number of frames from the caller of errorSite to that call site.
+// Calls of p.error by p.errorExpected are recorded at the call site of
+// p.errorExpected only.
+//
+func (c *coverage) errorSite(skip int) {
+	pc, file, line, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return
+	}
+	name := ""
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		name = funcName(fn.Name())
+	}
+	if name == "errorExpected" {
+		return
+	}
+	c.errors[ErrorSite{filepath.Base(file), line, name}]++
+}
+
+// funcName returns the function or method name of a qualified function
+// name as reported by the runtime, e.g. "parseOperand" for
+// ".../parser.(*parser).parseOperand.func1".
+//
+func funcName(qualified string) string {
+	parts := strings.Split(qualified[strings.LastIndex(qualified, "/")+1:], ".")
+	for i := len(parts) - 1; i > 0; i-- {
+		part := parts[i]
+		if strings.HasPrefix(part, "func") || isNumber(part) {
+			continue // function literal
+		}
+		return part
+	}
+	return qualified
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// ----------------------------------------------------------------------------
+// Reports
+
+//go:generate go test -run=TestGrammarTable -update-grammar
+
+// Grammar returns the names of the productions traced by the parser and
+// the call sites of its error reporting functions, sorted. They are
+// listed in grammar.go, which is generated from the parser's source
+// files by go generate.
+//
+func Grammar() (productions []string, sites []ErrorSite) {
+	return append([]string(nil), grammarProductions...), append([]ErrorSite(nil), grammarSites...)
+}
+
+// Unreached returns the productions and error call sites of the parser
+// (see Grammar) that were not reached.
+//
+func (c *Coverage) Unreached() (productions []string, sites []ErrorSite) {
+	allProductions, allSites := Grammar()
+	for _, name := range allProductions {
+		if c.Productions[name] == 0 {
+			productions = append(productions, name)
+		}
+	}
+	reached := make(map[ErrorSite]bool)
+	for site := range c.Errors {
+		reached[ErrorSite{site.File, site.Line, ""}] = true
+	}
+	for _, site := range allSites {
+		if !reached[ErrorSite{site.File, site.Line, ""}] {
+			sites = append(sites, site)
+		}
+	}
+	return productions, sites
+}
+
+// WriteReport writes a coverage report to w: the percentages of
+// productions and error call sites reached, followed by the lists of
+// those never reached.
+//
+func (c *Coverage) WriteReport(w io.Writer) error {
+	allProductions, allSites := Grammar()
+	productions, sites := c.Unreached()
+	percent := func(unreached, all int) float64 {
+		if all == 0 {
+			return 100
+		}
+		return 100 * float64(all-unreached) / float64(all)
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "productions: %d/%d reached (%.1f%%)\n", len(allProductions)-len(productions), len(allProductions), percent(len(productions), len(allProductions)))
+	fmt.Fprintf(bw, "error sites: %d/%d reached (%.1f%%)\n", len(allSites)-len(sites), len(allSites), percent(len(sites), len(allSites)))
+	if len(productions) > 0 {
+		fmt.Fprintf(bw, "\nproductions never reached:\n")
+		for _, name := range productions {
+			fmt.Fprintf(bw, "\t%s\n", name)
+		}
+	}
+	if len(sites) > 0 {
+		fmt.Fprintf(bw, "\nerror sites never reached:\n")
+		for _, site := range sites {
+			fmt.Fprintf(bw, "\t%s\n", site)
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,270 @@
+package parser
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+	var cov Coverage
+	conf := Config{Mode: AllErrors, Coverage: &cov}
+	fset := token.NewFileSet()
+	conf.ParseFile(fset, "a.go", "package p; func f() { for {} }")
+	conf.ParseFile(fset, "b.go", "package p; func f() { x := ; if x := 1 {} }")
+
+	if n := cov.Productions["File"]; n != 2 {
+		t.Errorf("File parsed %d times; want 2", n)
+	}
+	if n := cov.Productions["ForStmt"]; n != 1 {
+		t.Errorf("ForStmt parsed %d times; want 1", n)
+	}
+	if n := cov.Productions["SwitchStmt"]; n != 0 {
+		t.Errorf("SwitchStmt parsed %d times; want 0", n)
+	}
+
+	// the errors are recorded at their call sites
+	funcs := make(map[string]int)
+	for site, n := range cov.Errors {
+		if site.File != "parser.go" || site.Line == 0 {
+			t.Errorf("got error site %s", site)
+		}
+		funcs[site.Func] += n
+	}
+	for _, fn := range []string{"parseOperand", "makeExpr"} {
+		if funcs[fn] == 0 {
+			t.Errorf("no error recorded in %s; got %v", fn, funcs)
+		}
+	}
+	if funcs["errorExpected"] != 0 || funcs["error"] != 0 {
+		t.Errorf("errors recorded in the error functions: %v", funcs)
+	}
+
+	productions, sites := cov.Unreached()
+	unreached := make(map[string]bool)
+	for _, name := range productions {
+		unreached[name] = true
+	}
+	if !unreached["SwitchStmt"] || unreached["ForStmt"] {
+		t.Errorf("got unreached productions %v", productions)
+	}
+	for _, site := range sites {
+		for reached := range cov.Errors {
+			if site.File == reached.File && site.Line == reached.Line {
+				t.Errorf("reached site %s reported as unreached", site)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := cov.WriteReport(&buf); err != nil {
+		t.Fatal(err)
+	}
+	report := buf.String()
+	for _, s := range []string{"productions: ", "error sites: ", "\nproductions never reached:\n", "\tSwitchStmt\n", "\nerror sites never reached:\n"} {
+		if !strings.Contains(report, s) {
+			t.Errorf("report does not contain %q:\n%s", s, report)
+		}
+	}
+}
+
+func TestGrammar(t *testing.T) {
+	productions, sites := Grammar()
+	found := make(map[string]bool)
+	for _, name := range productions {
+		found[name] = true
+	}
+	for _, name := range []string{"File", "Operand", "IfStmt", "SelectStmt", "GenDecl(import)", "varSpec"} {
+		if !found[name] {
+			t.Errorf("production %s not found", name)
+		}
+	}
+	for _, name := range []string{"importSpec", "typeSpec"} {
+		if found[name] {
+			t.Errorf("production %s found", name)
+		}
+	}
+	if len(sites) < 50 {
+		t.Errorf("found %d error sites; want at least 50", len(sites))
+	}
+	for _, site := range sites {
+		if site.Func == "errorExpected" {
+			t.Errorf("got site %s in errorExpected", site)
+		}
+	}
+}
+
+var updateGrammar = flag.Bool("update-grammar", false, "update grammar.go")
+
+// TestGrammarTable checks that grammar.go lists the productions and
+// error call sites of the parser's source files. It is run by go
+// generate with -update-grammar to rewrite grammar.go.
+//
+func TestGrammarTable(t *testing.T) {
+	productions, sites, err := scanGrammar(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by go test -run=TestGrammarTable -update-grammar; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package parser\n\n")
+	fmt.Fprintf(&buf, "// grammarProductions lists the productions of the parser, sorted.\n")
+	fmt.Fprintf(&buf, "var grammarProductions = []string{\n")
+	for _, name := range productions {
+		fmt.Fprintf(&buf, "%q,\n", name)
+	}
+	fmt.Fprintf(&buf, "}\n\n")
+	fmt.Fprintf(&buf, "// grammarSites lists the error call sites of the parser, sorted.\n")
+	fmt.Fprintf(&buf, "var grammarSites = []ErrorSite{\n")
+	for _, site := range sites {
+		fmt.Fprintf(&buf, "{%q, %d, %q},\n", site.File, site.Line, site.Func)
+	}
+	fmt.Fprintf(&buf, "}\n")
+	got, err := format.Source(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const filename = "grammar.go"
+	if *updateGrammar {
+		if err := ioutil.WriteFile(filename, got, 0666); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s is out of date: run go generate", filename)
+	}
+}
+
+// scanGrammar parses the non-test Go files of dir and returns the
+// productions passed to trace and the call sites of p.error and
+// p.errorExpected, except those in errorExpected.
+//
+func scanGrammar(dir string) (productions []string, sites []ErrorSite, err error) {
+	filenames, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, nil, err
+	}
+	seen := make(map[string]bool)
+	fset := token.NewFileSet()
+	for _, filename := range filenames {
+		if strings.HasSuffix(filename, "_test.go") {
+			continue
+		}
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		f, err := ParseFile(fset, filename, src, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil || fn.Name.Name == "errorExpected" {
+				continue
+			}
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				switch fun := call.Fun.(type) {
+				case *ast.Ident:
+					if fun.Name != "trace" || len(call.Args) != 2 {
+						break
+					}
+					for _, name := range traceNames(call.Args[1], declKeywords[fn.Name.Name]) {
+						if !seen[name] {
+							seen[name] = true
+							productions = append(productions, name)
+						}
+					}
+				case *ast.SelectorExpr:
+					if x, ok := fun.X.(*ast.Ident); ok && x.Name == "p" && (fun.Sel.Name == "error" || fun.Sel.Name == "errorExpected") {
+						pos := fset.Position(call.Lparen)
+						sites = append(sites, ErrorSite{filepath.Base(filename), pos.Line, fn.Name.Name})
+					}
+				}
+				return true
+			})
+		}
+	}
+	sort.Strings(productions)
+	sort.Slice(sites, func(i, j int) bool {
+		if sites[i].File != sites[j].File {
+			return sites[i].File < sites[j].File
+		}
+		return sites[i].Line < sites[j].Line
+	})
+	// the call sites on a line are not distinguished
+	list := sites[:0]
+	for i, site := range sites {
+		if i == 0 || site.File != sites[i-1].File || site.Line != sites[i-1].Line {
+			list = append(list, site)
+		}
+	}
+	return productions, list, nil
+}
+
+// declKeywords lists the declaration keywords passed to the functions
+// whose production name depends on the keyword.
+var declKeywords = map[string][]string{
+	"parseGenDecl":   {"import", "const", "type", "var"},
+	"parseValueSpec": {"const", "var"},
+}
+
+// traceNames returns the production names the expression x passed to
+// trace evaluates to: string literals, and concatenations of literals and
+// declaration keywords (keyword.String(), one of keywords).
+//
+func traceNames(x ast.Expr, keywords []string) []string {
+	switch x := x.(type) {
+	case *ast.BasicLit:
+		if s, err := strconv.Unquote(x.Value); err == nil && x.Kind == token.STRING {
+			return []string{s}
+		}
+	case *ast.CallExpr:
+		if sel, ok := x.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "String" {
+			return keywords
+		}
+	case *ast.BinaryExpr:
+		if x.Op == token.ADD {
+			var list []string
+			for _, a := range traceNames(x.X, keywords) {
+				for _, b := range traceNames(x.Y, keywords) {
+					list = append(list, a+b)
+				}
+			}
+			return list
+		}
+	}
+	return nil
+}
+
+func TestFuncName(t *testing.T) {
+	for _, test := range []struct{ qualified, name string }{
+		{"github.com/yunabe/golang-codelab/customparser/parser.(*parser).parseOperand", "parseOperand"},
+		{"github.com/yunabe/golang-codelab/customparser/parser.(*parser).parseFile.func1", "parseFile"},
+		{"github.com/yunabe/golang-codelab/customparser/parser.checkCgo.func2.1", "checkCgo"},
+		{"main.main", "main"},
+	} {
+		if got := funcName(test.qualified); got != test.name {
+			t.Errorf("funcName(%q) = %q; want %q", test.qualified, got, test.name)
+		}
+	}
+}
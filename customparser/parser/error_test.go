@@ -2,180 +2,188 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// This file implements a parser test harness. The files in the testdata
-// directory are parsed and the errors reported are compared against the
-// error messages expected in the test files. The test files must end in
+// This file runs the parser test harness (see package parsertest). The
+// files in the testdata directory are parsed and the errors reported are
+// compared against the error messages expected in the test files, given
+// by comments of the form /* ERROR "rx" */. The test files must end in
 // .src rather than .go so that they are not disturbed by gofmt runs.
 //
-// Expected errors are indicated in the test files by putting a comment
-// of the form /* ERROR "rx" */ immediately following an offending token.
-// The harness will verify that an error matching the regular expression
-// rx is reported at that source position.
-//
-// For instance, the following test file indicates that a "not declared"
-// error should be reported for the undeclared variable x:
-//
-//	package p
-//	func f() {
-//		_ = x /* ERROR "not declared" */ + 1
-//	}
+// The files in the testdata/messages directory form a corpus pinning the
+// exact text of the messages of the catalog, in every language. For each
+// file name.src, the errors reported in language lang, with their
+// message IDs, are compared against the file name.lang.golden. The
+// golden files are rewritten by running the tests with -update-messages;
+// the changes must be reviewed.
 
 package parser
 
 import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
 	"go/scanner"
 	"go/token"
 	"io/ioutil"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"testing"
+
+	"github.com/yunabe/golang-codelab/customparser/parsertest"
 )
 
 const testdata = "testdata"
 
-// getFile assumes that each filename occurs at most once
-func getFile(fset *token.FileSet, filename string) (file *token.File) {
-	fset.Iterate(func(f *token.File) bool {
-		if f.Name() == filename {
-			if file != nil {
-				panic(filename + " used multiple times")
-			}
-			file = f
-		}
-		return true
-	})
-	return file
+var updateMessages = flag.Bool("update-messages", false, "update the golden files of testdata/messages")
+
+func checkErrors(t *testing.T, filename string, input interface{}) {
+	checkConfigErrors(t, &Config{Mode: DeclarationErrors | AllErrors}, filename, input)
 }
 
-func getPos(fset *token.FileSet, filename string, offset int) token.Pos {
-	if f := getFile(fset, filename); f != nil {
-		return f.Pos(offset)
+func checkConfigErrors(t *testing.T, conf *Config, filename string, input interface{}) {
+	src, err := readSource(filename, input)
+	if err != nil {
+		t.Error(err)
+		return
 	}
-	return token.NoPos
+	harness(conf).TestSource(t, filename, src)
 }
 
-// ERROR comments must be of the form /* ERROR "rx" */ and rx is
-// a regular expression that matches the expected error message.
-// The special form /* ERROR HERE "rx" */ must be used for error
-// messages that appear immediately after a token, rather than at
-// a token's position.
+// harness returns a test harness parsing with conf.
 //
-var errRx = regexp.MustCompile(`^/\* *ERROR *(HERE)? *"([^"]*)" *\*/$`)
+func harness(conf *Config) *parsertest.Config {
+	return &parsertest.Config{
+		Parse: func(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+			return conf.ParseFile(fset, filename, src)
+		},
+	}
+}
 
-// expectedErrors collects the regular expressions of ERROR comments found
-// in files and returns them as a map of error positions to error messages.
+func TestErrors(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join(testdata, "*.src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := harness(&Config{Mode: DeclarationErrors | AllErrors})
+	for _, filename := range files {
+		h.TestFiles(t, filename)
+	}
+}
+
+// messageLanguages lists the languages of the message corpus.
+var messageLanguages = []string{"en", "ja"}
+
+// corpusErrors returns the errors reported for the corpus file filename
+// in language lang, one per line, and records the message IDs used
+// (including the terms of the arguments) in ids.
 //
-func expectedErrors(t *testing.T, fset *token.FileSet, filename string, src []byte) map[token.Pos]string {
-	errors := make(map[token.Pos]string)
-
-	var s scanner.Scanner
-	// file was parsed already - do not add it again to the file
-	// set otherwise the position information returned here will
-	// not match the position information collected by the parser
-	s.Init(getFile(fset, filename), src, nil, scanner.ScanComments)
-	var prev token.Pos // position of last non-comment, non-semicolon token
-	var here token.Pos // position immediately after the token at position prev
-
-	for {
-		pos, tok, lit := s.Scan()
-		switch tok {
-		case token.EOF:
-			return errors
-		case token.COMMENT:
-			s := errRx.FindStringSubmatch(lit)
-			if len(s) == 3 {
-				pos := prev
-				if s[1] == "HERE" {
-					pos = here
+func corpusErrors(t *testing.T, filename, lang string, ids map[MessageID]bool) []byte {
+	info := &Info{}
+	conf := Config{
+		Mode:            DeclarationErrors | AllErrors | CheckTemplates | ParseCgo | ParseStructTags,
+		LanguageVersion: "go1.1",
+		Language:        lang,
+		Info:            info,
+	}
+	_, err := conf.ParseFile(token.NewFileSet(), filename, nil)
+	list, ok := err.(scanner.ErrorList)
+	if err != nil && !ok {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	for _, e := range list {
+		id := MessageID("-") // reported by go/scanner
+		if m, ok := info.Messages[e]; ok {
+			id = m.ID
+			ids[m.ID] = true
+			for _, a := range m.Args {
+				if term, ok := a.(MessageID); ok {
+					ids[term] = true
 				}
-				errors[pos] = string(s[2])
-			}
-		default:
-			prev = pos
-			var l int // token length
-			if tok.IsLiteral() {
-				l = len(lit)
-			} else {
-				l = len(tok.String())
 			}
-			here = prev + token.Pos(l)
 		}
+		msg := strings.NewReplacer("\n", `\n`, "\t", `\t`).Replace(e.Msg)
+		fmt.Fprintf(&buf, "%d:%d: %s: %s\n", e.Pos.Line, e.Pos.Column, id, msg)
 	}
+	return buf.Bytes()
 }
 
-// compareErrors compares the map of expected error messages with the list
-// of found errors and reports discrepancies.
-//
-func compareErrors(t *testing.T, fset *token.FileSet, expected map[token.Pos]string, found scanner.ErrorList) {
-	for _, error := range found {
-		// error.Pos is a token.Position, but we want
-		// a token.Pos so we can do a map lookup
-		pos := getPos(fset, error.Pos.Filename, error.Pos.Offset)
-		if msg, found := expected[pos]; found {
-			// we expect a message at pos; check if it matches
-			rx, err := regexp.Compile(msg)
-			if err != nil {
-				t.Errorf("%s: %v", error.Pos, err)
+func TestMessages(t *testing.T) {
+	dir := filepath.Join(testdata, "messages")
+	files, err := filepath.Glob(filepath.Join(dir, "*.src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[MessageID]bool)
+	for _, filename := range files {
+		for _, lang := range messageLanguages {
+			got := corpusErrors(t, filename, lang, ids)
+			golden := strings.TrimSuffix(filename, ".src") + "." + lang + ".golden"
+			if *updateMessages {
+				if err := ioutil.WriteFile(golden, got, 0666); err != nil {
+					t.Fatal(err)
+				}
 				continue
 			}
-			if match := rx.MatchString(error.Msg); !match {
-				t.Errorf("%s: %q does not match %q", error.Pos, error.Msg, msg)
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Error(err)
 				continue
 			}
-			// we have a match - eliminate this error
-			delete(expected, pos)
-		} else {
-			// To keep in mind when analyzing failed test output:
-			// If the same error position occurs multiple times in errors,
-			// this message will be triggered (because the first error at
-			// the position removes this position from the expected errors).
-			t.Errorf("%s: unexpected error: %s", error.Pos, error.Msg)
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s: got\n%s\nwant\n%s", golden, got, want)
+			}
 		}
 	}
 
-	// there should be no expected errors left
-	if len(expected) > 0 {
-		t.Errorf("%d errors not reported:", len(expected))
-		for pos, msg := range expected {
-			t.Errorf("%s: %s\n", fset.Position(pos), msg)
+	// every message of the catalog is pinned by the corpus, except
+	// MsgRedeclared: declared objects always have a position
+	var missing []string
+	for id := range english {
+		if !ids[id] && id != MsgRedeclared {
+			missing = append(missing, string(id))
 		}
 	}
+	sort.Strings(missing)
+	if len(missing) > 0 {
+		t.Errorf("messages not covered by %s: %s", dir, strings.Join(missing, ", "))
+	}
 }
 
-func checkErrors(t *testing.T, filename string, input interface{}) {
-	src, err := readSource(filename, input)
-	if err != nil {
-		t.Error(err)
-		return
+func TestCatalogs(t *testing.T) {
+	verbs := regexp.MustCompile(`%\[\d\][a-z]`)
+	for lang, cat := range catalogs {
+		for id, en := range english {
+			text, ok := cat[id]
+			if !ok {
+				t.Errorf("%s: missing message %s", lang, id)
+				continue
+			}
+			want := verbs.FindAllString(en, -1)
+			got := verbs.FindAllString(text, -1)
+			sort.Strings(want)
+			sort.Strings(got)
+			if strings.Join(got, " ") != strings.Join(want, " ") {
+				t.Errorf("%s: message %s has verbs %v; want %v", lang, id, got, want)
+			}
+		}
+		for id := range cat {
+			if _, ok := english[id]; !ok {
+				t.Errorf("%s: unknown message %s", lang, id)
+			}
+		}
 	}
 
-	fset := token.NewFileSet()
-	_, err = ParseFile(fset, filename, src, DeclarationErrors|AllErrors)
-	found, ok := err.(scanner.ErrorList)
-	if err != nil && !ok {
-		t.Error(err)
-		return
+	if got := (Message{MsgExpectedFound, []interface{}{TermOperand, "')'"}}).Text("ja-JP"); got != "オペランド が必要ですが、')' があります" {
+		t.Errorf("got %q", got)
 	}
-	found.RemoveMultiples()
-
-	// we are expecting the following errors
-	// (collect these after parsing a file so that it is found in the file set)
-	expected := expectedErrors(t, fset, filename, src)
-
-	// verify errors returned by the parser
-	compareErrors(t, fset, expected, found)
-}
-
-func TestErrors(t *testing.T) {
-	list, err := ioutil.ReadDir(testdata)
-	if err != nil {
-		t.Fatal(err)
+	if got := (Message{MsgExpected, []interface{}{TermType}}).Text("xx"); got != "expected type" {
+		t.Errorf("got %q; want English fallback", got)
 	}
-	for _, fi := range list {
-		name := fi.Name()
-		if !fi.IsDir() && !strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".src") {
-			checkErrors(t, filepath.Join(testdata, name), nil)
-		}
+	conf := Config{Language: "xx"}
+	if _, err := conf.ParseFile(token.NewFileSet(), "p.go", "package p"); err == nil {
+		t.Error("no error for unsupported language")
 	}
 }
@@ -0,0 +1,128 @@
+// Code generated by go test -run=TestGrammarTable -update-grammar; DO NOT EDIT.
+
+package parser
+
+// grammarProductions lists the productions of the parser, sorted.
+var grammarProductions = []string{
+	"ArrayType",
+	"BinaryExpr",
+	"BlockStmt",
+	"Body",
+	"BranchStmt",
+	"CallOrConversion",
+	"CaseClause",
+	"ChanType",
+	"CommClause",
+	"Declaration",
+	"DeferStmt",
+	"Element",
+	"ElementList",
+	"Expression",
+	"ExpressionList",
+	"FieldDecl",
+	"File",
+	"ForStmt",
+	"FuncType",
+	"FuncTypeOrLit",
+	"FunctionDecl",
+	"GenDecl(const)",
+	"GenDecl(import)",
+	"GenDecl(type)",
+	"GenDecl(var)",
+	"GoStmt",
+	"IdentList",
+	"IfStmt",
+	"ImportSpec",
+	"IndexOrSlice",
+	"InterfaceType",
+	"LiteralValue",
+	"MapType",
+	"MethodSpec",
+	"Operand",
+	"ParameterList",
+	"Parameters",
+	"PointerType",
+	"PrimaryExpr",
+	"Result",
+	"ReturnStmt",
+	"SelectStmt",
+	"Selector",
+	"Signature",
+	"SimpleStmt",
+	"SkippedBody",
+	"Statement",
+	"StatementList",
+	"StructType",
+	"SwitchStmt",
+	"Type",
+	"TypeAssertion",
+	"TypeList",
+	"TypeName",
+	"TypeSpec",
+	"UnaryExpr",
+	"constSpec",
+	"varSpec",
+}
+
+// grammarSites lists the error call sites of the parser, sorted.
+var grammarSites = []ErrorSite{
+	{"cgo.go", 125, "parseCgoDirective"},
+	{"cgo.go", 134, "parseCgoDirective"},
+	{"cgo.go", 139, "parseCgoDirective"},
+	{"cgo.go", 144, "parseCgoDirective"},
+	{"cgo.go", 150, "parseCgoDirective"},
+	{"cgo.go", 158, "parseCgoDirective"},
+	{"cgo.go", 163, "parseCgoDirective"},
+	{"lazy.go", 54, "skipBody"},
+	{"parser.go", 155, "closeLabelScope"},
+	{"parser.go", 178, "declare"},
+	{"parser.go", 180, "declare"},
+	{"parser.go", 207, "shortVarDecl"},
+	{"parser.go", 211, "shortVarDecl"},
+	{"parser.go", 470, "checkVersion"},
+	{"parser.go", 501, "expect"},
+	{"parser.go", 512, "expectClosing"},
+	{"parser.go", 525, "expectSemi"},
+	{"parser.go", 539, "expectSemi"},
+	{"parser.go", 552, "atComma"},
+	{"parser.go", 554, "atComma"},
+	{"parser.go", 744, "parseType"},
+	{"parser.go", 801, "makeIdentList"},
+	{"parser.go", 839, "parseFieldDecl"},
+	{"parser.go", 842, "parseFieldDecl"},
+	{"parser.go", 910, "tryVarType"},
+	{"parser.go", 923, "parseVarType"},
+	{"parser.go", 1291, "parseOperand"},
+	{"parser.go", 1385, "parseIndexOrSlice"},
+	{"parser.go", 1389, "parseIndexOrSlice"},
+	{"parser.go", 1539, "checkExpr"},
+	{"parser.go", 1602, "checkExprOrType"},
+	{"parser.go", 1633, "parsePrimaryExpr"},
+	{"parser.go", 1709, "parseUnaryExpr"},
+	{"parser.go", 1716, "parseUnaryExpr"},
+	{"parser.go", 1842, "parseSimpleStmt"},
+	{"parser.go", 1865, "parseSimpleStmt"},
+	{"parser.go", 1893, "parseCallExpr"},
+	{"parser.go", 1969, "makeExpr"},
+	{"parser.go", 2014, "parseIfStmt"},
+	{"parser.go", 2080, "isTypeSwitchGuard"},
+	{"parser.go", 2162, "parseCommClause"},
+	{"parser.go", 2174, "parseCommClause"},
+	{"parser.go", 2189, "parseCommClause"},
+	{"parser.go", 2281, "parseForStmt"},
+	{"parser.go", 2359, "parseStmt"},
+	{"parser.go", 2409, "parseImportSpec"},
+	{"parser.go", 2448, "parseValueSpec"},
+	{"parser.go", 2452, "parseValueSpec"},
+	{"parser.go", 2599, "parseDecl"},
+	{"parser.go", 2628, "parseFile"},
+	{"structtag.go", 96, "parseStructTag"},
+	{"structtag.go", 108, "parseStructTag"},
+	{"structtag.go", 110, "parseStructTag"},
+	{"structtag.go", 127, "parseStructTag"},
+	{"structtag.go", 133, "parseStructTag"},
+	{"structtag.go", 138, "parseStructTag"},
+	{"structtag.go", 166, "checkTagOptions"},
+	{"templates.go", 85, "checkTemplateCall"},
+	{"templates.go", 154, "checkEmbeddedTemplates"},
+}
@@ -9,13 +9,18 @@ package parser
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"go/ast"
+	"go/scanner"
 	"go/token"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"unicode"
 )
 
 // If src != nil, readSource converts src to a []byte if possible;
@@ -53,15 +58,28 @@ func readSource(filename string, src interface{}) ([]byte, error) {
 type Mode uint
 
 const (
-	PackageClauseOnly Mode             = 1 << iota // stop parsing after package clause
-	ImportsOnly                                    // stop parsing after import declarations
-	ParseComments                                  // parse comments and add them to AST
-	Trace                                          // print a trace of parsed productions
-	DeclarationErrors                              // report declaration errors
-	SpuriousErrors                                 // same as AllErrors, for backward-compatibility
-	AllErrors         = SpuriousErrors             // report all errors (not just the first 10 on different lines)
+	PackageClauseOnly      Mode             = 1 << iota // stop parsing after package clause
+	ImportsOnly                                         // stop parsing after import declarations
+	ParseComments                                       // parse comments and add them to AST
+	Trace                                               // print a trace of parsed productions
+	DeclarationErrors                                   // report declaration errors
+	SpuriousErrors                                      // same as AllErrors, for backward-compatibility
+	CheckTemplates                                      // parse text/template bodies and report their errors
+	ParseCgo                                            // parse cgo preambles and validate #cgo directives
+	ParseStructTags                                     // parse struct field tags and validate them
+	ParallelFunctionBodies                              // parse the bodies of function declarations concurrently
+	SkipFunctionBodies                                  // skip the bodies of function declarations, to be parsed on demand
+	AllErrors              = SpuriousErrors             // report all errors (not just the first 10 on different lines)
 )
 
+// Version identifies the output of the parser. It must be changed whenever
+// a change to the parser alters the AST or the errors produced for some
+// input, so that stored parse results are invalidated; the tests check
+// the output for a fixed corpus against the one recorded for Version.
+// Package parsecache also tells the builds of the parser apart.
+//
+const Version = "customparser-2"
+
 // ParseFile parses the source code of a single Go source file and returns
 // the corresponding ast.File node. The source code may be provided via
 // the filename of the source file, or via the src parameter.
@@ -75,6 +93,39 @@ const (
 // optional parser functionality. Position information is recorded in the
 // file set fset, which must not be nil.
 //
+// With the CheckTemplates mode, the string literals passed to the Parse
+// method of a template created by template.New (of text/template or
+// html/template), and the .tmpl files embedded with //go:embed directives
+// (found if comments are parsed), are parsed as templates, and their
+// syntax errors are reported along with those of the Go source.
+//
+// With the ParseCgo mode, which implies ParseComments, the doc comments
+// of import "C" declarations are parsed as cgo preambles, and malformed
+// #cgo directives are reported at their position in the comment. The
+// preambles are recorded in Config.Info.
+//
+// With the ParseStructTags mode, struct field tags are parsed into
+// key:"value" pairs, as by reflect.StructTag, and malformed tags (bad
+// quoting, duplicate keys, unknown json or xml options) are reported at
+// their position within the tag literal. The tags are recorded in
+// Config.Info.
+//
+// With the ParallelFunctionBodies mode, the bodies of the function
+// declarations are parsed concurrently once the rest of the file has
+// been parsed. The result is identical to that of a serial parse: if
+// the file has syntax errors, it is parsed again serially, so the mode
+// only pays off for large files without errors, such as generated code.
+// The mode is ignored with Trace, with a Config.Coverage, and if
+// GOMAXPROCS is 1.
+//
+// With the SkipFunctionBodies mode, the bodies of the function
+// declarations are skipped by brace matching: the body of each
+// declaration is an empty ast.BlockStmt with the positions of its braces,
+// and the comments and syntax errors within the bodies are not reported
+// (but for those of the scanner). The bodies are recorded in
+// Config.Info, from which they can be parsed on demand; the other passes
+// enabled by Mode do not see them. ParallelFunctionBodies is ignored.
+//
 // If the source couldn't be read, the returned AST is nil and the error
 // indicates the specific failure. If the source was read but syntax
 // errors were found, the result is a partial AST (with ast.Bad* nodes
@@ -82,10 +133,91 @@ const (
 // are returned via a scanner.ErrorList which is sorted by file position.
 //
 func ParseFile(fset *token.FileSet, filename string, src interface{}, mode Mode) (f *ast.File, err error) {
+	conf := Config{Mode: mode}
+	return conf.ParseFile(fset, filename, src)
+}
+
+// A Config specifies how Go source files are parsed. The zero Config
+// parses with Mode 0 and accepts all syntax supported by the parser.
+//
+type Config struct {
+	// Mode controls the amount of source text parsed and other optional
+	// parser functionality.
+	Mode Mode
+
+	// LanguageVersion is the version of the Go language the source must
+	// conform to, of the form "go1.N" or "1.N" (optionally followed by
+	// a patch version). Syntax introduced by later versions, such as
+	// binary literals (go1.13) in go1.12 source, is reported as an
+	// error "... requires go1.N or later". If LanguageVersion is empty,
+	// all syntax is accepted, except that ParseDir uses the version of
+	// the go directive in the go.mod file of the directory.
+	//
+	// The parser does not support type aliases and generics regardless
+	// of the language version.
+	LanguageVersion string
+
+	// Language is the language of the error messages, a language tag
+	// such as "en" or "ja" (the region of tags such as "ja-JP" is
+	// ignored). The empty language is English. Errors reported by
+	// go/scanner, such as illegal characters, are always in English.
+	Language string
+
+	// If Info is not nil, the results of the optional passes enabled by
+	// Mode are recorded in it.
+	Info *Info
+
+	// If Coverage is not nil, the productions and error call sites of
+	// the parser reached while parsing are counted in it.
+	Coverage *Coverage
+
+	// TraceOutput is where the Trace mode prints the trace of the parsed
+	// productions, including those of the bodies parsed on demand with
+	// SkipFunctionBodies. If TraceOutput is nil, the trace is printed
+	// to os.Stdout.
+	TraceOutput io.Writer
+}
+
+// Info holds the results of the optional passes of the parser.
+//
+type Info struct {
+	// Cgo maps the import "C" specs to their preamble (ParseCgo mode).
+	// A spec without doc comment has an empty preamble.
+	Cgo map[*ast.ImportSpec]*CgoPreamble
+
+	// Tags maps the struct field tag literals to the parsed tags
+	// (ParseStructTags mode). Tags that are not valid string literals
+	// are not recorded.
+	Tags map[*ast.BasicLit]*StructTag
+
+	// Bodies maps the function declarations to their skipped bodies
+	// (SkipFunctionBodies mode).
+	Bodies map[*ast.FuncDecl]*FuncBody
+
+	// Messages maps the errors reported by the parser to their catalog
+	// message, from which they can be formatted in other languages.
+	// Errors reported by go/scanner have no message.
+	Messages map[*scanner.Error]Message
+}
+
+// ParseFile is like the package-level function ParseFile, with the mode,
+// the language version and the message language taken from the config.
+// If the language version or the message language is invalid, the
+// returned AST is nil.
+//
+func (conf *Config) ParseFile(fset *token.FileSet, filename string, src interface{}) (f *ast.File, err error) {
 	if fset == nil {
 		panic("parser.ParseFile: no token.FileSet provided (fset == nil)")
 	}
 
+	goVersion, err := parseLanguageVersion(conf.LanguageVersion)
+	if err != nil {
+		return nil, err
+	}
+	if catalog(conf.Language) == nil {
+		return nil, fmt.Errorf("parser: unsupported message language %q", conf.Language)
+	}
+
 	// get source
 	text, err := readSource(filename, src)
 	if err != nil {
@@ -112,17 +244,80 @@ func ParseFile(fset *token.FileSet, filename string, src interface{}, mode Mode)
 			}
 		}
 
+		if p.cov != nil {
+			conf.Coverage.add(p.cov)
+		}
+
 		p.errors.Sort()
 		err = p.errors.Err()
 	}()
 
 	// parse source
+	mode := conf.Mode
+	if mode&ParseCgo != 0 {
+		mode |= ParseComments
+	}
+	if conf.Coverage != nil {
+		p.initCoverage()
+	}
 	p.init(fset, filename, text, mode)
-	f = p.parseFile()
+	p.goVersion = goVersion
+	p.lang = conf.Language
+	p.info = conf.Info
+	p.out = conf.TraceOutput
+	if mode&(ParallelFunctionBodies|SkipFunctionBodies) == ParallelFunctionBodies && mode&Trace == 0 && p.cov == nil && runtime.GOMAXPROCS(0) > 1 {
+		f = p.parseFileParallel(text)
+	}
+	if f == nil {
+		f = p.parseFile()
+	}
+	if f == nil {
+		// invalid package clause
+		return
+	}
+	if mode&CheckTemplates != 0 {
+		p.checkTemplates(f, filename)
+	}
+	if mode&ParseCgo != 0 {
+		p.checkCgo(f, conf.Info)
+	}
+	if mode&ParseStructTags != 0 {
+		p.checkStructTags(f, conf.Info)
+	}
+	if mode&SkipFunctionBodies != 0 && conf.Info != nil {
+		p.recordBodies(f, text, conf.Info)
+	}
 
 	return
 }
 
+// parseLanguageVersion returns the minor version of the Go 1 language
+// version v, or 0 if v is empty.
+//
+func parseLanguageVersion(v string) (int, error) {
+	if v == "" {
+		return 0, nil
+	}
+	s := strings.TrimPrefix(v, "go")
+	if !strings.HasPrefix(s, "1.") {
+		return 0, fmt.Errorf("invalid language version %q", v)
+	}
+	s = s[len("1."):]
+	i := 0
+	for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+		i++
+	}
+	minor, err := strconv.Atoi(s[:i])
+	if err != nil || (i < len(s) && s[i] != '.' && !unicode.IsLetter(rune(s[i]))) {
+		return 0, fmt.Errorf("invalid language version %q", v)
+	}
+	if minor == 0 {
+		// go1.0 predates all version-gated syntax; 0 means unrestricted
+		minor = -1
+	}
+	return minor, nil
+}
+
 // ParseDir calls ParseFile for all files with names ending in ".go" in the
 // directory specified by path and returns a map of package name -> package
 // AST with all the packages found.
@@ -137,6 +332,16 @@ func ParseFile(fset *token.FileSet, filename string, src interface{}, mode Mode)
 // first error encountered are returned.
 //
 func ParseDir(fset *token.FileSet, path string, filter func(os.FileInfo) bool, mode Mode) (pkgs map[string]*ast.Package, first error) {
+	conf := Config{Mode: mode}
+	return conf.ParseDir(fset, path, filter)
+}
+
+// ParseDir is like the package-level function ParseDir, with the mode
+// and the language version taken from the config. If the language
+// version is empty, the version of the go directive of the go.mod file
+// in the directory path or its closest parent having one is used.
+//
+func (conf *Config) ParseDir(fset *token.FileSet, path string, filter func(os.FileInfo) bool) (pkgs map[string]*ast.Package, first error) {
 	fd, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -148,11 +353,16 @@ func ParseDir(fset *token.FileSet, path string, filter func(os.FileInfo) bool, m
 		return nil, err
 	}
 
+	fileConf := *conf
+	if fileConf.LanguageVersion == "" {
+		fileConf.LanguageVersion = modGoVersion(path)
+	}
+
 	pkgs = make(map[string]*ast.Package)
 	for _, d := range list {
 		if strings.HasSuffix(d.Name(), ".go") && (filter == nil || filter(d)) {
 			filename := filepath.Join(path, d.Name())
-			if src, err := ParseFile(fset, filename, nil, mode); err == nil {
+			if src, err := fileConf.ParseFile(fset, filename, nil); err == nil {
 				name := src.Name.Name
 				pkg, found := pkgs[name]
 				if !found {
@@ -172,6 +382,37 @@ func ParseDir(fset *token.FileSet, path string, filter func(os.FileInfo) bool, m
 	return
 }
 
+// modGoVersion returns the language version of the module containing
+// the directory dir, as declared by the go directive of its go.mod file,
+// or "" if there is no go.mod file. A go.mod file without go directive
+// declares go1.16, like for the go command.
+//
+func modGoVersion(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if i := strings.Index(line, "//"); i >= 0 {
+					line = line[:i]
+				}
+				if f := strings.Fields(line); len(f) == 2 && f[0] == "go" {
+					return f[1]
+				}
+			}
+			return "1.16"
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
 // ParseExprFrom is a convenience function for parsing an expression.
 // The arguments have the same meaning as for ParseFile, but the source must
 // be a valid Go (type or value) expression. Specifically, fset must not
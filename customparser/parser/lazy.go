@@ -0,0 +1,159 @@
+// This file implements the SkipFunctionBodies mode: the bodies of the
+// function declarations are skipped by brace matching, and parsed on
+// demand by FuncBody.Materialize.
+
+package parser
+
+import (
+	"go/ast"
+	"go/token"
+	"io"
+	"sort"
+)
+
+// A FuncBody is the unparsed body of a function declaration, recorded in
+// Info.Bodies with the SkipFunctionBodies mode. Until it is materialized,
+// the body of Decl is an empty BlockStmt with the positions of the
+// braces.
+//
+type FuncBody struct {
+	Decl           *ast.FuncDecl
+	Lbrace, Rbrace token.Pos
+
+	body         *ast.BlockStmt // placeholder, Decl.Body
+	scope        *ast.Scope     // function scope, with the parameters
+	file         *ast.File
+	tfile        *token.File
+	src          []byte // source of the file
+	mode         Mode
+	goVersion    int
+	lang         string
+	out          io.Writer           // tracing output
+	declOrder    map[*ast.Object]int // order of declaration of the package objects
+	decls        int                 // number of package objects declared before the body
+	materialized bool
+}
+
+// skipBody skips the body of a function declaration by brace matching,
+// without collecting its comments, and returns an empty placeholder.
+//
+func (p *parser) skipBody(scope *ast.Scope) *ast.BlockStmt {
+	if p.trace {
+		defer un(trace(p, "SkippedBody"))
+	}
+
+	body := &ast.BlockStmt{Lbrace: p.pos}
+	depth := 0
+	for {
+		switch p.tok {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+		case token.EOF:
+			p.errorExpected(p.pos, "'}'")
+			body.Rbrace = p.pos
+			return body
+		}
+		if depth == 0 {
+			break
+		}
+		p.next0() // comments are part of the body
+	}
+	body.Rbrace = p.pos
+	p.skipped = append(p.skipped, &FuncBody{Lbrace: body.Lbrace, Rbrace: body.Rbrace, body: body, scope: scope, decls: len(p.declOrder)})
+	p.next()
+
+	return body
+}
+
+// recordBodies records the skipped bodies of f, parsed from src, in info.
+//
+func (p *parser) recordBodies(f *ast.File, src []byte, info *Info) {
+	bodies := make(map[*ast.BlockStmt]*FuncBody, len(p.skipped))
+	for _, b := range p.skipped {
+		bodies[b.body] = b
+	}
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || bodies[fn.Body] == nil {
+			continue
+		}
+		b := bodies[fn.Body]
+		b.Decl = fn
+		b.file = f
+		b.tfile = p.file
+		b.src = src
+		b.mode = p.mode
+		b.goVersion = p.goVersion
+		b.lang = p.lang
+		b.out = p.out
+		b.declOrder = p.declOrder
+		if info.Bodies == nil {
+			info.Bodies = make(map[*ast.FuncDecl]*FuncBody)
+		}
+		info.Bodies[fn] = b
+	}
+}
+
+// Materialize parses the body into Decl.Body and returns it. Identifiers
+// are resolved in the scopes of the function and of the file, as by a
+// parse without SkipFunctionBodies; the unresolved identifiers and, with
+// the ParseComments mode, the comments of the body are added to those of
+// the file, in source order. The syntax errors of the body are returned
+// as a scanner.ErrorList; the body is partial then. Materialize parses
+// the body once, and must not be called concurrently for bodies of the
+// same file.
+//
+func (b *FuncBody) Materialize() (body *ast.BlockStmt, err error) {
+	if b.materialized {
+		return b.body, nil
+	}
+	b.materialized = true
+
+	var q parser
+	defer func() {
+		if e := recover(); e != nil {
+			// resume same panic if it's not a bailout
+			if _, ok := e.(bailout); !ok {
+				panic(e)
+			}
+			body = b.body
+		}
+		q.errors.Sort()
+		err = q.errors.Err()
+	}()
+	q.initBody(b.tfile, b.src, b.tfile.Offset(b.Lbrace), b.tfile.Offset(b.Rbrace), b.mode)
+	q.goVersion = b.goVersion
+	q.lang = b.lang
+	q.out = b.out
+	q.pkgScope = b.file.Scope
+	q.bodyOrder = b.declOrder
+	q.bodyDecls = b.decls
+	q.next()
+
+	*b.body = *q.parseBody(b.scope)
+
+	// resolve global identifiers within the same file, as parseFile does
+	f := b.file
+	unresolved := q.unresolved[:0]
+	for _, ident := range q.unresolved {
+		if ident.Obj = f.Scope.Lookup(ident.Name); ident.Obj == nil {
+			unresolved = append(unresolved, ident)
+		}
+	}
+	if f.Unresolved == nil && q.unresolved != nil {
+		f.Unresolved = []*ast.Ident{} // as after a parse collecting these identifiers
+	}
+	i := len(f.Unresolved)
+	for i > 0 && f.Unresolved[i-1].Pos() > b.Rbrace {
+		i--
+	}
+	f.Unresolved = append(f.Unresolved[:i], append(unresolved, f.Unresolved[i:]...)...)
+	if len(q.comments) > 0 {
+		i := sort.Search(len(f.Comments), func(i int) bool { return f.Comments[i].Pos() > b.Rbrace })
+		f.Comments = append(f.Comments[:i], append(q.comments, f.Comments[i:]...)...)
+	}
+
+	return b.body, nil
+}
@@ -0,0 +1,176 @@
+package parser
+
+import (
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"testing"
+)
+
+// TestSkipFunctionBodies checks that materializing all the skipped bodies
+// of the parser's source yields the file of a full parse.
+func TestSkipFunctionBodies(t *testing.T) {
+	src, err := readSource("parser.go", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const mode = ParseComments | DeclarationErrors
+
+	fset := token.NewFileSet()
+	conf := Config{Mode: mode | SkipFunctionBodies, Info: new(Info)}
+	f, err := conf.ParseFile(fset, "parser.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := ParseFile(token.NewFileSet(), "parser.go", src, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Comments) >= len(full.Comments) {
+		t.Errorf("got %d comments with skipped bodies; want fewer than %d", len(f.Comments), len(full.Comments))
+	}
+	n := 0
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		n++
+		b := conf.Info.Bodies[fn]
+		if b == nil {
+			t.Fatalf("no body recorded for %s", fn.Name.Name)
+		}
+		if fn.Body.List != nil || b.Lbrace != fn.Body.Lbrace || b.Rbrace != fn.Body.Rbrace || b.Decl != fn {
+			t.Errorf("%s: got body %+v, recorded %+v", fn.Name.Name, fn.Body, b)
+		}
+	}
+	if n == 0 || len(conf.Info.Bodies) != n {
+		t.Errorf("got %d bodies recorded for %d functions", len(conf.Info.Bodies), n)
+	}
+
+	checkMaterialized(t, "parser.go", src, mode)
+}
+
+// checkMaterialized parses src with SkipFunctionBodies, materializes all
+// the bodies, in reverse order, which must not matter, and checks that
+// the file is identical to the file of a full parse.
+func checkMaterialized(t *testing.T, filename string, src []byte, mode Mode) {
+	t.Helper()
+	fset1 := token.NewFileSet()
+	full, err := ParseFile(fset1, filename, src, mode)
+	if err != nil {
+		return // the syntax errors of the bodies are reported by Materialize
+	}
+	fset2 := token.NewFileSet()
+	conf := Config{Mode: mode | SkipFunctionBodies, Info: new(Info)}
+	f, err := conf.ParseFile(fset2, filename, src)
+	if err != nil {
+		t.Fatalf("%s: %v", filename, err)
+	}
+	for i := len(f.Decls) - 1; i >= 0; i-- {
+		fn, ok := f.Decls[i].(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		body, err := conf.Info.Bodies[fn].Materialize()
+		if err != nil {
+			t.Fatalf("%s: %v", filename, err)
+		}
+		if body != fn.Body {
+			t.Errorf("%s: %s: Materialize returned another body", filename, fn.Name.Name)
+		}
+	}
+	if d1, d2 := dump(fset1, full), dump(fset2, f); d1 != d2 {
+		t.Errorf("%s: materialized file differs from full parse", filename)
+	}
+}
+
+func TestMaterializeFiles(t *testing.T) {
+	for _, filename := range parallelCorpus(t) {
+		src, err := readSource(filename, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkMaterialized(t, filename, src, ParseComments)
+	}
+	for i, test := range parallelTests {
+		checkMaterialized(t, fmt.Sprintf("test%d.go", i), []byte(test.src), ParseComments)
+	}
+}
+
+const lazySrc = `package p
+
+func f(a int) int {
+	b := a // copy
+	return b + g()
+}
+
+func g() int { return undefined }
+
+func h() {
+	x := )
+}
+`
+
+func TestMaterialize(t *testing.T) {
+	fset := token.NewFileSet()
+	conf := Config{Mode: ParseComments | SkipFunctionBodies, Info: new(Info)}
+	f, err := conf.ParseFile(fset, "lazy.go", lazySrc)
+	if err != nil {
+		t.Fatalf("syntax errors in skipped bodies reported: %v", err)
+	}
+	if len(f.Comments) != 0 || len(f.Unresolved) != 3 { // int of the signatures
+		t.Errorf("got comments %v, unresolved %v before materializing", f.Comments, f.Unresolved)
+	}
+	bodies := make(map[string]*FuncBody)
+	for fn, b := range conf.Info.Bodies {
+		bodies[fn.Name.Name] = b
+	}
+
+	// scopes
+	fdecl := bodies["f"].Decl
+	body, err := bodies["f"].Materialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assign := body.List[0].(*ast.AssignStmt)
+	if a := assign.Rhs[0].(*ast.Ident); a.Obj == nil || a.Obj != fdecl.Type.Params.List[0].Names[0].Obj {
+		t.Errorf("a is not resolved to the parameter: %v", a.Obj)
+	}
+	ret := body.List[1].(*ast.ReturnStmt).Results[0].(*ast.BinaryExpr)
+	if b := ret.X.(*ast.Ident); b.Obj != assign.Lhs[0].(*ast.Ident).Obj {
+		t.Errorf("b is not resolved to the local variable")
+	}
+	if g := ret.Y.(*ast.CallExpr).Fun.(*ast.Ident); g.Obj == nil || g.Obj.Decl != bodies["g"].Decl {
+		t.Errorf("g is not resolved to the function")
+	}
+	if len(f.Comments) != 1 || f.Comments[0].Text() != "copy\n" {
+		t.Errorf("got comments %v", f.Comments)
+	}
+	if again, err := bodies["f"].Materialize(); again != body || err != nil {
+		t.Errorf("second Materialize: got %v, %v", again, err)
+	}
+
+	// unresolved identifiers
+	if _, err := bodies["g"].Materialize(); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, ident := range f.Unresolved {
+		names = append(names, ident.Name)
+	}
+	if len(names) != 4 || names[2] != "int" || names[3] != "undefined" {
+		t.Errorf("got unresolved %v", names)
+	}
+
+	// errors
+	_, err = bodies["h"].Materialize()
+	list, ok := err.(scanner.ErrorList)
+	if !ok || len(list) == 0 {
+		t.Fatalf("got %v; want syntax errors", err)
+	}
+	if pos := list[0].Pos; pos.Filename != "lazy.go" || pos.Line != 11 || pos.Column != 7 {
+		t.Errorf("got error %v; want at lazy.go:11:7", list[0])
+	}
+}
@@ -0,0 +1,289 @@
+// This file implements the message catalog: the errors reported by the
+// parser are identified by a MessageID and formatted from per-language
+// templates, so that they can be localized.
+
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A MessageID identifies a message of the catalog. The IDs of the form
+// "term-..." are terms used as arguments of other messages.
+//
+type MessageID string
+
+// Messages.
+const (
+	MsgExpected            MessageID = "expected"
+	MsgExpectedFound       MessageID = "expected-found"
+	MsgMissingComma        MessageID = "missing-comma"
+	MsgMissingCommaNewline MessageID = "missing-comma-newline"
+	MsgLabelUndefined      MessageID = "label-undefined"
+	MsgRedeclared          MessageID = "redeclared"
+	MsgRedeclaredAt        MessageID = "redeclared-at"
+	MsgNoNewVariables      MessageID = "no-new-variables"
+	MsgRequiresVersion     MessageID = "requires-version"
+	MsgVariadicMissingType MessageID = "variadic-missing-type"
+	MsgSlice2ndIndex       MessageID = "slice-2nd-index"
+	MsgSlice3rdIndex       MessageID = "slice-3rd-index"
+	MsgIllegalLabel        MessageID = "illegal-label"
+	MsgMustInvoke          MessageID = "must-invoke"
+	MsgSimpleStmt          MessageID = "simple-stmt"
+	MsgInvalidImportPath   MessageID = "invalid-import-path"
+	MsgMissingVarType      MessageID = "missing-var-type"
+	MsgMissingConstValue   MessageID = "missing-const-value"
+	MsgInvalidPackageName  MessageID = "invalid-package-name"
+
+	MsgTemplate         MessageID = "template"
+	MsgEmbeddedTemplate MessageID = "embedded-template"
+
+	MsgCgoExpectedFunction MessageID = "cgo-expected-function"
+	MsgCgoMissingColon     MessageID = "cgo-missing-colon"
+	MsgCgoMissingVerb      MessageID = "cgo-missing-verb"
+	MsgCgoVerb             MessageID = "cgo-verb"
+	MsgCgoCondition        MessageID = "cgo-condition"
+	MsgCgoUnclosedQuote    MessageID = "cgo-unclosed-quote"
+	MsgCgoUnfinishedEscape MessageID = "cgo-unfinished-escape"
+	MsgPkgConfigName       MessageID = "pkg-config-name"
+
+	MsgTagNotSeparated  MessageID = "tag-not-separated"
+	MsgTagKeySyntax     MessageID = "tag-key-syntax"
+	MsgTagPairSyntax    MessageID = "tag-pair-syntax"
+	MsgTagValueUnclosed MessageID = "tag-value-unclosed"
+	MsgTagValueSyntax   MessageID = "tag-value-syntax"
+	MsgTagDuplicateKey  MessageID = "tag-duplicate-key"
+	MsgTagUnknownOption MessageID = "tag-unknown-option"
+)
+
+// Terms.
+const (
+	TermNewline              MessageID = "term-newline"
+	TermIdentifier           MessageID = "term-identifier"
+	TermIdentOnLeft          MessageID = "term-ident-on-left"
+	TermType                 MessageID = "term-type"
+	TermAnonymousField       MessageID = "term-anonymous-field"
+	TermOperand              MessageID = "term-operand"
+	TermExpression           MessageID = "term-expression"
+	TermSelectorOrAssertion  MessageID = "term-selector-or-assertion"
+	TermChannelType          MessageID = "term-channel-type"
+	TermOneExpression        MessageID = "term-one-expression"
+	TermOneOrTwoExpressions  MessageID = "term-one-or-two-expressions"
+	TermAtMostTwoExpressions MessageID = "term-at-most-two-expressions"
+	TermIfOrBlock            MessageID = "term-if-or-block"
+	TermStatement            MessageID = "term-statement"
+	TermDeclaration          MessageID = "term-declaration"
+	TermArrayLength          MessageID = "term-array-length"
+	TermParameterList        MessageID = "term-parameter-list"
+	TermArgumentList         MessageID = "term-argument-list"
+	TermCompositeLiteral     MessageID = "term-composite-literal"
+	TermBooleanExpression    MessageID = "term-boolean-expression"
+	TermSwitchExpression     MessageID = "term-switch-expression"
+	TermBoolOrRange          MessageID = "term-bool-or-range"
+	TermBinaryLiteral        MessageID = "term-binary-literal"
+	TermOctalLiteral         MessageID = "term-octal-literal"
+	TermHexFloat             MessageID = "term-hex-float"
+	TermHexImaginary         MessageID = "term-hex-imaginary"
+	TermNumberSeparator      MessageID = "term-number-separator"
+	TermFullSlice            MessageID = "term-full-slice"
+	TermRangeWithoutVars     MessageID = "term-range-without-vars"
+)
+
+// English messages, the default.
+var english = map[MessageID]string{
+	MsgExpected:            "expected %[1]s",
+	MsgExpectedFound:       "expected %[1]s, found %[2]s",
+	MsgMissingComma:        "missing ',' in %[1]s",
+	MsgMissingCommaNewline: "missing ',' before newline in %[1]s",
+	MsgLabelUndefined:      "label %[1]s undefined",
+	MsgRedeclared:          "%[1]s redeclared in this block",
+	MsgRedeclaredAt:        "%[1]s redeclared in this block\n\tprevious declaration at %[2]s",
+	MsgNoNewVariables:      "no new variables on left side of :=",
+	MsgRequiresVersion:     "%[1]s requires go1.%[2]d or later",
+	MsgVariadicMissingType: "'...' parameter is missing type",
+	MsgSlice2ndIndex:       "2nd index required in 3-index slice",
+	MsgSlice3rdIndex:       "3rd index required in 3-index slice",
+	MsgIllegalLabel:        "illegal label declaration",
+	MsgMustInvoke:          "function must be invoked in %[1]s statement",
+	MsgSimpleStmt:          "expected %[1]s, found simple statement (missing parentheses around composite literal?)",
+	MsgInvalidImportPath:   "invalid import path: %[1]s",
+	MsgMissingVarType:      "missing variable type or initialization",
+	MsgMissingConstValue:   "missing constant value",
+	MsgInvalidPackageName:  "invalid package name _",
+
+	MsgTemplate:         "template: %[1]s",
+	MsgEmbeddedTemplate: "template %[1]s:%[2]d: %[3]s",
+
+	MsgCgoExpectedFunction: "invalid #cgo line: expected #cgo %[1]s function",
+	MsgCgoMissingColon:     "invalid #cgo line: missing ':'",
+	MsgCgoMissingVerb:      "invalid #cgo line: missing verb",
+	MsgCgoVerb:             "invalid #cgo verb: %[1]s",
+	MsgCgoCondition:        "invalid #cgo condition: %[1]s",
+	MsgCgoUnclosedQuote:    "malformed #cgo argument: unclosed quote %[1]s",
+	MsgCgoUnfinishedEscape: "malformed #cgo argument: unfinished escaping",
+	MsgPkgConfigName:       "invalid pkg-config package name: %[1]s",
+
+	MsgTagNotSeparated:  "struct tag pairs not separated by spaces",
+	MsgTagKeySyntax:     "bad syntax for struct tag key",
+	MsgTagPairSyntax:    "bad syntax for struct tag pair",
+	MsgTagValueUnclosed: "bad syntax for struct tag value: missing closing quote",
+	MsgTagValueSyntax:   "bad syntax for struct tag value",
+	MsgTagDuplicateKey:  "struct tag has duplicate key %[1]q",
+	MsgTagUnknownOption: "unknown %[1]s option %[2]q",
+
+	TermNewline:              "newline",
+	TermIdentifier:           "identifier",
+	TermIdentOnLeft:          "identifier on left side of :=",
+	TermType:                 "type",
+	TermAnonymousField:       "anonymous field",
+	TermOperand:              "operand",
+	TermExpression:           "expression",
+	TermSelectorOrAssertion:  "selector or type assertion",
+	TermChannelType:          "channel type",
+	TermOneExpression:        "1 expression",
+	TermOneOrTwoExpressions:  "1 or 2 expressions",
+	TermAtMostTwoExpressions: "at most 2 expressions",
+	TermIfOrBlock:            "if statement or block",
+	TermStatement:            "statement",
+	TermDeclaration:          "declaration",
+	TermArrayLength:          "array length",
+	TermParameterList:        "parameter list",
+	TermArgumentList:         "argument list",
+	TermCompositeLiteral:     "composite literal",
+	TermBooleanExpression:    "boolean expression",
+	TermSwitchExpression:     "switch expression",
+	TermBoolOrRange:          "boolean or range expression",
+	TermBinaryLiteral:        "binary literal",
+	TermOctalLiteral:         "0o/0O-style octal literal",
+	TermHexFloat:             "hexadecimal floating-point literal",
+	TermHexImaginary:         "hexadecimal imaginary literal",
+	TermNumberSeparator:      "'_' separator in number literal",
+	TermFullSlice:            "full slice expression",
+	TermRangeWithoutVars:     "range clause without variables",
+}
+
+// Japanese messages.
+var japanese = map[MessageID]string{
+	MsgExpected:            "%[1]s が必要です",
+	MsgExpectedFound:       "%[1]s が必要ですが、%[2]s があります",
+	MsgMissingComma:        "%[1]s に ',' がありません",
+	MsgMissingCommaNewline: "%[1]s の改行の前に ',' がありません",
+	MsgLabelUndefined:      "ラベル %[1]s が定義されていません",
+	MsgRedeclared:          "%[1]s はこのブロックで再宣言されています",
+	MsgRedeclaredAt:        "%[1]s はこのブロックで再宣言されています\n\t以前の宣言: %[2]s",
+	MsgNoNewVariables:      ":= の左辺に新しい変数がありません",
+	MsgRequiresVersion:     "%[1]s には go1.%[2]d 以降が必要です",
+	MsgVariadicMissingType: "'...' パラメータに型がありません",
+	MsgSlice2ndIndex:       "3 インデックスのスライスには 2 番目のインデックスが必要です",
+	MsgSlice3rdIndex:       "3 インデックスのスライスには 3 番目のインデックスが必要です",
+	MsgIllegalLabel:        "不正なラベル宣言です",
+	MsgMustInvoke:          "%[1]s 文では関数を呼び出す必要があります",
+	MsgSimpleStmt:          "%[1]s が必要ですが、単純文があります (複合リテラルを括弧で囲んでいないのでは?)",
+	MsgInvalidImportPath:   "不正なインポートパスです: %[1]s",
+	MsgMissingVarType:      "変数の型または初期化がありません",
+	MsgMissingConstValue:   "定数の値がありません",
+	MsgInvalidPackageName:  "不正なパッケージ名 _ です",
+
+	MsgTemplate:         "テンプレート: %[1]s",
+	MsgEmbeddedTemplate: "テンプレート %[1]s:%[2]d: %[3]s",
+
+	MsgCgoExpectedFunction: "不正な #cgo 行です: #cgo %[1]s の後に関数名が必要です",
+	MsgCgoMissingColon:     "不正な #cgo 行です: ':' がありません",
+	MsgCgoMissingVerb:      "不正な #cgo 行です: 動詞がありません",
+	MsgCgoVerb:             "不正な #cgo 動詞です: %[1]s",
+	MsgCgoCondition:        "不正な #cgo 条件です: %[1]s",
+	MsgCgoUnclosedQuote:    "不正な #cgo 引数です: 引用符 %[1]s が閉じていません",
+	MsgCgoUnfinishedEscape: "不正な #cgo 引数です: エスケープが終わっていません",
+	MsgPkgConfigName:       "不正な pkg-config パッケージ名です: %[1]s",
+
+	MsgTagNotSeparated:  "構造体タグの組が空白で区切られていません",
+	MsgTagKeySyntax:     "構造体タグのキーの構文が不正です",
+	MsgTagPairSyntax:    "構造体タグの組の構文が不正です",
+	MsgTagValueUnclosed: "構造体タグの値の構文が不正です: 閉じる引用符がありません",
+	MsgTagValueSyntax:   "構造体タグの値の構文が不正です",
+	MsgTagDuplicateKey:  "構造体タグのキー %[1]q が重複しています",
+	MsgTagUnknownOption: "不明な %[1]s オプション %[2]q です",
+
+	TermNewline:              "改行",
+	TermIdentifier:           "識別子",
+	TermIdentOnLeft:          ":= の左辺の識別子",
+	TermType:                 "型",
+	TermAnonymousField:       "匿名フィールド",
+	TermOperand:              "オペランド",
+	TermExpression:           "式",
+	TermSelectorOrAssertion:  "セレクタまたは型アサーション",
+	TermChannelType:          "チャネル型",
+	TermOneExpression:        "1 個の式",
+	TermOneOrTwoExpressions:  "1 個または 2 個の式",
+	TermAtMostTwoExpressions: "2 個以下の式",
+	TermIfOrBlock:            "if 文またはブロック",
+	TermStatement:            "文",
+	TermDeclaration:          "宣言",
+	TermArrayLength:          "配列の長さ",
+	TermParameterList:        "パラメータリスト",
+	TermArgumentList:         "引数リスト",
+	TermCompositeLiteral:     "複合リテラル",
+	TermBooleanExpression:    "真偽値の式",
+	TermSwitchExpression:     "switch 式",
+	TermBoolOrRange:          "真偽値の式または range 式",
+	TermBinaryLiteral:        "2 進数リテラル",
+	TermOctalLiteral:         "0o/0O 形式の 8 進数リテラル",
+	TermHexFloat:             "16 進浮動小数点数リテラル",
+	TermHexImaginary:         "16 進虚数リテラル",
+	TermNumberSeparator:      "数値リテラルの '_' 区切り",
+	TermFullSlice:            "完全スライス式",
+	TermRangeWithoutVars:     "変数のない range 節",
+}
+
+var catalogs = map[string]map[MessageID]string{
+	"en": english,
+	"ja": japanese,
+}
+
+// catalog returns the messages of the language lang, a language tag
+// such as "ja" or "ja-JP" whose region is ignored, or nil if there are
+// none. The empty language is English.
+//
+func catalog(lang string) map[MessageID]string {
+	if lang == "" {
+		return english
+	}
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	return catalogs[strings.ToLower(lang)]
+}
+
+// A Message is an error message of the catalog with its arguments.
+//
+type Message struct {
+	ID   MessageID
+	Args []interface{} // MessageID arguments are terms, localized with the message
+}
+
+// Text returns the text of the message in the language lang (see
+// Config.Language). Messages missing in the catalog of lang, or if there
+// is no such catalog, are in English.
+//
+func (m Message) Text(lang string) string {
+	cat := catalog(lang)
+	args := make([]interface{}, len(m.Args))
+	for i, a := range m.Args {
+		if id, ok := a.(MessageID); ok {
+			a = lookup(cat, id)
+		}
+		args[i] = a
+	}
+	return fmt.Sprintf(lookup(cat, m.ID), args...)
+}
+
+func lookup(cat map[MessageID]string, id MessageID) string {
+	if s, ok := cat[id]; ok {
+		return s
+	}
+	if s, ok := english[id]; ok {
+		return s
+	}
+	return string(id)
+}
@@ -0,0 +1,296 @@
+// This file implements the ParallelFunctionBodies mode: a prescan finds
+// the bodies of the function declarations, the file is parsed with the
+// bodies blanked out, and the bodies are then parsed concurrently and
+// stitched into the file.
+
+package parser
+
+import (
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// A bodyQueue holds the function bodies found by the prescan of a file
+// and those deferred by the parser.
+type bodyQueue struct {
+	src    []byte      // original source
+	rbrace map[int]int // offset of the closing brace of each body, by offset of the opening brace
+	jobs   []*bodyJob  // deferred bodies, in source order
+	failed bool        // the speculative parse must be discarded
+
+	lineDirectives bool // the file has line directives
+}
+
+// A bodyJob is a function body to be parsed concurrently.
+type bodyJob struct {
+	body  *ast.BlockStmt // placeholder in the function declaration
+	scope *ast.Scope     // function scope, with the parameters
+	decls int            // number of package objects declared before the body
+
+	// indices of p.comments and p.unresolved at which the comments and
+	// the unresolved identifiers of the body are inserted
+	commentIndex    int
+	unresolvedIndex int
+
+	ok         bool
+	comments   []*ast.CommentGroup
+	unresolved []*ast.Ident
+}
+
+// parseFileParallel parses the file with the ParallelFunctionBodies mode.
+// It returns nil, leaving p untouched, if the file has fewer than two
+// function bodies or syntax errors; the file must then be parsed serially.
+//
+func (p *parser) parseFileParallel(src []byte) (f *ast.File) {
+	rbrace, blanked, lineDirectives := prescanBodies(p.file, src)
+	if len(rbrace) < 2 {
+		return nil
+	}
+
+	q := &parser{bodies: &bodyQueue{src: src, rbrace: rbrace, lineDirectives: lineDirectives}}
+	q.initFile(p.file, blanked, p.mode)
+	q.goVersion = p.goVersion
+	q.lang = p.lang
+
+	defer func() {
+		if e := recover(); e != nil {
+			if _, ok := e.(bailout); !ok {
+				panic(e)
+			}
+			f = nil
+		}
+	}()
+	f = q.parseFile()
+	if q.errors.Len() != 0 || q.bodies.failed {
+		return nil
+	}
+	return f
+}
+
+// prescanBodies returns the offsets of the braces of the bodies of the
+// function declarations of src, found by brace matching, a copy of src
+// in which the bodies are blanked out (but for newlines), and whether
+// src has line directives. Scanning the whole source also records the
+// lines and the line directives of the file, so that later scanners
+// need not add them in order.
+//
+func prescanBodies(file *token.File, src []byte) (rbrace map[int]int, blanked []byte, lineDirectives bool) {
+	var s scanner.Scanner
+	s.Init(file, src, nil, scanner.ScanComments)
+
+	rbrace = make(map[int]int)
+	depth := 0              // nesting of parentheses, brackets and braces
+	prev := token.SEMICOLON // previous token
+	inFunc := false         // in the signature of a function declaration
+	for {
+		pos, tok, lit := s.Scan()
+		switch tok {
+		case token.COMMENT:
+			if strings.HasPrefix(lit, "//line ") || strings.HasPrefix(lit, "/*line ") {
+				lineDirectives = true
+			}
+			continue
+		case token.EOF:
+			blanked = make([]byte, len(src))
+			copy(blanked, src)
+			for l, r := range rbrace {
+				for i := l + 1; i < r; i++ {
+					if blanked[i] != '\n' {
+						blanked[i] = ' '
+					}
+				}
+			}
+			return
+		case token.FUNC:
+			inFunc = depth == 0 && prev == token.SEMICOLON
+		case token.LPAREN, token.LBRACK:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.SEMICOLON:
+			if depth == 0 {
+				inFunc = false
+			}
+		case token.LBRACE:
+			if !inFunc || depth != 0 || prev == token.STRUCT || prev == token.INTERFACE {
+				depth++
+				break
+			}
+			// function body
+			inFunc = false
+			l := file.Offset(pos)
+			n := 1
+			for n > 0 {
+				pos, tok, lit = s.Scan()
+				switch tok {
+				case token.COMMENT:
+					if strings.HasPrefix(lit, "//line ") || strings.HasPrefix(lit, "/*line ") {
+						lineDirectives = true
+					}
+				case token.LBRACE:
+					n++
+				case token.RBRACE:
+					n--
+				case token.EOF:
+					return nil, src, lineDirectives // unbalanced; left to the serial parse
+				}
+			}
+			rbrace[l] = file.Offset(pos)
+		}
+		prev = tok
+	}
+}
+
+// deferBody skips the body of a function declaration found by the
+// prescan and queues it, returning a placeholder. It returns nil if the
+// body is to be parsed now.
+//
+func (p *parser) deferBody(scope *ast.Scope) *ast.BlockStmt {
+	if p.bodies == nil {
+		return nil
+	}
+	rbrace, ok := p.bodies.rbrace[p.file.Offset(p.pos)]
+	if !ok {
+		return nil
+	}
+	body := &ast.BlockStmt{Lbrace: p.pos}
+	p.next() // the body is blank
+	if p.tok != token.RBRACE || p.file.Offset(p.pos) != rbrace {
+		p.bodies.failed = true
+		return body
+	}
+	body.Rbrace = p.pos
+	p.bodies.jobs = append(p.bodies.jobs, &bodyJob{
+		body:            body,
+		scope:           scope,
+		decls:           len(p.declOrder),
+		commentIndex:    len(p.comments),
+		unresolvedIndex: len(p.unresolved),
+	})
+	p.next()
+	return body
+}
+
+// parseBodies parses the deferred bodies concurrently and merges their
+// comments and unresolved identifiers into those of the file, in source
+// order. The package scope is complete and no longer modified; the
+// bodies only see the objects declared before them (see visible), and
+// their unresolved identifiers are resolved with those of the file, as
+// in a serial parse.
+//
+func (p *parser) parseBodies() {
+	jobs := p.bodies.jobs
+	if len(jobs) != len(p.bodies.rbrace) {
+		p.bodies.failed = true // some blanked source was not a body
+		return
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+	queue := make(chan *bodyJob)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				p.parseDeferredBody(job)
+			}
+		}()
+	}
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+
+	var comments []*ast.CommentGroup
+	var unresolved []*ast.Ident
+	c, u := 0, 0
+	for _, job := range jobs {
+		if !job.ok {
+			p.bodies.failed = true
+			return
+		}
+		comments = append(comments, p.comments[c:job.commentIndex]...)
+		comments = append(comments, job.comments...)
+		c = job.commentIndex
+		unresolved = append(unresolved, p.unresolved[u:job.unresolvedIndex]...)
+		unresolved = append(unresolved, job.unresolved...)
+		u = job.unresolvedIndex
+	}
+	p.comments = append(comments, p.comments[c:]...)
+	p.unresolved = append(unresolved, p.unresolved[u:]...)
+}
+
+// initBody initializes p to parse the function body src[lbrace:rbrace+1]
+// of file. The scanner scans the body only, in a file of a private file
+// set whose base makes the positions those of file; the private file is
+// returned. The scanner errors are reported at their position in file.
+//
+func (p *parser) initBody(file *token.File, src []byte, lbrace, rbrace int, mode Mode) *token.File {
+	src = src[lbrace : rbrace+1]
+	bodyFile := token.NewFileSet().AddFile(file.Name(), file.Base()+lbrace, len(src))
+	var m scanner.Mode
+	if mode&ParseComments != 0 {
+		m = scanner.ScanComments
+	}
+	eh := func(pos token.Position, msg string) {
+		p.errors.Add(file.Position(file.Pos(lbrace+pos.Offset)), msg)
+	}
+	p.scanner.Init(bodyFile, src, eh, m)
+	p.file = file
+	p.mode = mode
+	p.trace = mode&Trace != 0
+	return bodyFile
+}
+
+// parseDeferredBody parses the body of job with a parser of its own. The
+// lines of its private file (see initBody) are those of the body,
+// numbered from 1, which is all the parser needs to group comments (it
+// only compares line numbers) unless line directives renumber the lines;
+// p.file is used then. Errors are only counted: the serial parse reports
+// them.
+//
+func (p *parser) parseDeferredBody(job *bodyJob) {
+	var q parser
+	defer func() {
+		if e := recover(); e != nil {
+			// a bailout, or an internal error the serial parse reproduces
+			job.ok = false
+		}
+	}()
+	lbrace, rbrace := p.file.Offset(job.body.Lbrace), p.file.Offset(job.body.Rbrace)
+	file := q.initBody(p.file, p.bodies.src, lbrace, rbrace, p.mode)
+	if !p.bodies.lineDirectives {
+		lines := []int{0}
+		for i, c := range p.bodies.src[lbrace:rbrace] {
+			if c == '\n' {
+				lines = append(lines, i+1)
+			}
+		}
+		file.SetLines(lines)
+		q.file = file
+	}
+	q.goVersion = p.goVersion
+	q.lang = p.lang
+	q.pkgScope = p.pkgScope
+	q.bodyOrder = p.declOrder
+	q.bodyDecls = job.decls
+	q.next()
+
+	body := q.parseBody(job.scope)
+	if q.errors.Len() != 0 || body.Rbrace != job.body.Rbrace {
+		return
+	}
+	*job.body = *body
+	job.comments = q.comments
+	job.unresolved = q.unresolved
+	job.ok = true
+}
@@ -0,0 +1,204 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// dump prints f with its positions. Scopes are printed as their sorted
+// names, since ast.Fprint prints maps in random order.
+func dump(fset *token.FileSet, f *ast.File) string {
+	var buf bytes.Buffer
+	ast.Fprint(&buf, fset, f, func(name string, v reflect.Value) bool {
+		return name != "Scope" && ast.NotNilFilter(name, v)
+	})
+	var names []string
+	for name, obj := range f.Scope.Objects {
+		names = append(names, fmt.Sprintf("%s %s %s", name, obj.Kind, fset.Position(obj.Pos())))
+	}
+	sort.Strings(names)
+	fmt.Fprintln(&buf, names)
+	return buf.String()
+}
+
+// checkParallel parses src serially and with ParallelFunctionBodies, and
+// checks that the files and errors are identical.
+func checkParallel(t *testing.T, filename string, src []byte, mode Mode) {
+	t.Helper()
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4)) // the mode is ignored on a single processor
+	fset1 := token.NewFileSet()
+	f1, err1 := ParseFile(fset1, filename, src, mode)
+	fset2 := token.NewFileSet()
+	f2, err2 := ParseFile(fset2, filename, src, mode|ParallelFunctionBodies)
+	if fmt.Sprint(err1) != fmt.Sprint(err2) {
+		t.Errorf("%s: got errors\n%v\nwant\n%v", filename, err2, err1)
+	}
+	if d1, d2 := dump(fset1, f1), dump(fset2, f2); d1 != d2 {
+		t.Errorf("%s: parallel parse differs from serial parse", filename)
+	}
+}
+
+// parallelCorpus lists the files of TestParallelFiles: the Go files of
+// the repository and, unless in short mode, some of the standard library.
+func parallelCorpus(t *testing.T) []string {
+	patterns := []string{"*.go", "testdata/*.src", "../*/*.go", "../cmd/*/*.go"}
+	if !testing.Short() {
+		for _, dir := range []string{"compress/flate", "go/*", "cmd/pprof"} {
+			patterns = append(patterns, filepath.Join(runtime.GOROOT(), "src", dir, "*.go"))
+		}
+	}
+	var filenames []string
+	for _, pattern := range patterns {
+		list, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filenames = append(filenames, list...)
+	}
+	return filenames
+}
+
+func TestParallelFiles(t *testing.T) {
+	for _, filename := range parallelCorpus(t) {
+		src, err := readSource(filename, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkParallel(t, filename, src, 0)
+		checkParallel(t, filename, src, ParseComments|DeclarationErrors)
+		// the non-test files of the package, but for the generated
+		// ones, have at least two function bodies
+		if filepath.Dir(filename) == "." && !strings.HasSuffix(filename, "_test.go") && !bytes.HasPrefix(src, []byte("// Code generated")) && !speculative(src, ParseComments) {
+			t.Errorf("%s: speculative parse failed", filename)
+		}
+	}
+}
+
+// speculative reports whether the speculative parallel parse of src
+// succeeds, without falling back to the serial parse.
+func speculative(src []byte, mode Mode) bool {
+	var p parser
+	p.init(token.NewFileSet(), "", src, mode)
+	return p.parseFileParallel(src) != nil
+}
+
+var parallelTests = []struct {
+	src        string
+	speculated bool // the speculative parse succeeds
+}{
+	// result types with braces, comments around bodies, labels
+	{`package p
+
+// f returns a struct.
+func f() struct{ x int } { /* first */ return struct{ x int }{g()} } // after
+
+func g() int {
+	// lead
+	x := later // later is declared below
+L:
+	for {
+		break L
+	}
+	return x + undefined1
+}
+
+var h = func() interface{} { return undefined2 }
+
+func (T) m(a, b int) (c int) { c = a + b; return }
+
+type T struct{}
+
+var later = 1
+
+func init() { _ = undefined3 }
+func init() { _ = undefined1 }
+`, true},
+
+	// line directives in bodies
+	{`package p
+
+func f() {
+//line gen.y:10
+	a := 1
+	_ = a
+}
+
+func g() {
+	_ = 2
+}
+`, true},
+
+	// syntax errors in a body and in a declaration
+	{`package p
+
+func f() {
+	x :=
+}
+
+var = 1
+
+func g() { return ) }
+`, false},
+
+	// unbalanced braces
+	{`package p
+
+func f() {}
+
+func g() {
+`, false},
+
+	// bodies without declarations around them
+	{`package p; func a() {}; func b() {}; func c() { { { } } }`, true},
+
+	// keys and identifiers naming package objects declared before or
+	// after the body
+	{`package p
+
+var Before int
+
+func f() T {
+	return T{Before: Later, Later: Before, f: nil, g: nil}
+}
+
+func g() { _ = map[string]int{Later: 1, g: 2} }
+
+type T struct{ Before, Later, f, g interface{} }
+
+var Later int
+`, true},
+}
+
+func TestParallel(t *testing.T) {
+	for i, test := range parallelTests {
+		src := []byte(test.src)
+		for _, mode := range []Mode{0, ParseComments, ParseComments | DeclarationErrors | AllErrors} {
+			checkParallel(t, fmt.Sprintf("test%d.go", i), src, mode)
+			if got := speculative(src, mode); got != test.speculated {
+				t.Errorf("test%d.go, mode %d: speculative parse succeeded = %v; want %v", i, mode, got, test.speculated)
+			}
+		}
+	}
+}
+
+func BenchmarkParseParallel(b *testing.B) {
+	src, err := readSource("parser.go", nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	b.SetBytes(int64(len(src)))
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseFile(token.NewFileSet(), "", src, ParseComments|ParallelFunctionBodies); err != nil {
+			b.Fatalf("benchmark failed due to parse error: %s", err)
+		}
+	}
+}
@@ -21,6 +21,8 @@ import (
 	"go/ast"
 	"go/scanner"
 	"go/token"
+	"io"
+	"os"
 	"strconv"
 	"strings"
 	"unicode"
@@ -33,9 +35,11 @@ type parser struct {
 	scanner scanner.Scanner
 
 	// Tracing/debugging
-	mode   Mode // parsing mode
-	trace  bool // == (mode & Trace != 0)
-	indent int  // indentation used for tracing output
+	mode   Mode      // parsing mode
+	trace  bool      // == (mode & Trace != 0 || cov != nil)
+	indent int       // indentation used for tracing output
+	out    io.Writer // tracing output, or nil for os.Stdout
+	cov    *coverage // grammar coverage of the parse, or nil
 
 	// Comments
 	comments    []*ast.CommentGroup
@@ -58,6 +62,19 @@ type parser struct {
 	exprLev int  // < 0: in control clause, >= 0: in expression
 	inRhs   bool // if set, the parser is parsing a rhs expression
 
+	// Language version
+	goVersion int // minor Go 1 version the source must conform to; 0 if unrestricted
+
+	// Messages
+	lang string // language of the error messages
+	info *Info  // records the messages of the errors, if not nil
+
+	// Completion support
+	// (the extents of the scopes are only recorded if cursor is valid)
+	cursor  token.Pos     // completion cursor, or NoPos
+	prevEnd token.Pos     // end of the last consumed token
+	extents []scopeExtent // extents of the scopes opened so far
+
 	// Ordinary identifier scopes
 	pkgScope   *ast.Scope        // pkgScope.Outer == nil
 	topScope   *ast.Scope        // top-most scope; may be pkgScope
@@ -68,10 +85,25 @@ type parser struct {
 	// (maintained by open/close LabelScope)
 	labelScope  *ast.Scope     // label scope for current function
 	targetStack [][]*ast.Ident // stack of unresolved labels
+
+	// Deferred function bodies
+	bodies    *bodyQueue          // function bodies parsed after the file, or nil
+	skipped   []*FuncBody         // function bodies skipped with SkipFunctionBodies
+	declOrder map[*ast.Object]int // order of declaration of the package objects, if bodies are deferred or skipped
+
+	// Package objects visible in a deferred or skipped body (see visible)
+	bodyOrder map[*ast.Object]int // declOrder of the file, or nil if not parsing a body
+	bodyDecls int                 // number of package objects declared before the body
 }
 
 func (p *parser) init(fset *token.FileSet, filename string, src []byte, mode Mode) {
-	p.file = fset.AddFile(filename, -1, len(src))
+	p.initFile(fset.AddFile(filename, -1, len(src)), src, mode)
+}
+
+// initFile is like init for a file already added to the file set.
+//
+func (p *parser) initFile(file *token.File, src []byte, mode Mode) {
+	p.file = file
 	var m scanner.Mode
 	if mode&ParseComments != 0 {
 		m = scanner.ScanComments
@@ -80,7 +112,10 @@ func (p *parser) init(fset *token.FileSet, filename string, src []byte, mode Mod
 	p.scanner.Init(p.file, src, eh, m)
 
 	p.mode = mode
-	p.trace = mode&Trace != 0 // for convenience (p.trace is used frequently)
+	p.trace = mode&Trace != 0 || p.cov != nil // for convenience (p.trace is used frequently)
+	if mode&(ParallelFunctionBodies|SkipFunctionBodies) != 0 {
+		p.declOrder = make(map[*ast.Object]int)
+	}
 
 	p.next()
 }
@@ -90,9 +125,18 @@ func (p *parser) init(fset *token.FileSet, filename string, src []byte, mode Mod
 
 func (p *parser) openScope() {
 	p.topScope = ast.NewScope(p.topScope)
+	p.scopeOpened()
+}
+
+// openStmtScope is like openScope for the scope of an if, switch or for
+// statement, which ends with the body of the statement.
+func (p *parser) openStmtScope() {
+	p.openScope()
+	p.stmtScopeOpened()
 }
 
 func (p *parser) closeScope() {
+	p.scopeClosed()
 	p.topScope = p.topScope.Outer
 }
 
@@ -108,7 +152,7 @@ func (p *parser) closeLabelScope() {
 	for _, ident := range p.targetStack[n] {
 		ident.Obj = scope.Lookup(ident.Name)
 		if ident.Obj == nil && p.mode&DeclarationErrors != 0 {
-			p.error(ident.Pos(), fmt.Sprintf("label %s undefined", ident.Name))
+			p.error(ident.Pos(), MsgLabelUndefined, ident.Name)
 		}
 	}
 	// pop label scope
@@ -125,13 +169,16 @@ func (p *parser) declare(decl, data interface{}, scope *ast.Scope, kind ast.ObjK
 		obj.Decl = decl
 		obj.Data = data
 		ident.Obj = obj
+		if scope == p.pkgScope && p.declOrder != nil {
+			p.declOrder[obj] = len(p.declOrder)
+		}
 		if ident.Name != "_" {
 			if alt := scope.Insert(obj); alt != nil && p.mode&DeclarationErrors != 0 {
-				prevDecl := ""
 				if pos := alt.Pos(); pos.IsValid() {
-					prevDecl = fmt.Sprintf("\n\tprevious declaration at %s", p.file.Position(pos))
+					p.error(ident.Pos(), MsgRedeclaredAt, ident.Name, p.file.Position(pos))
+				} else {
+					p.error(ident.Pos(), MsgRedeclared, ident.Name)
 				}
-				p.error(ident.Pos(), fmt.Sprintf("%s redeclared in this block%s", ident.Name, prevDecl))
 			}
 		}
 	}
@@ -157,11 +204,11 @@ func (p *parser) shortVarDecl(decl *ast.AssignStmt, list []ast.Expr) {
 				}
 			}
 		} else {
-			p.errorExpected(x.Pos(), "identifier on left side of :=")
+			p.errorExpected(x.Pos(), TermIdentOnLeft)
 		}
 	}
 	if n == 0 && p.mode&DeclarationErrors != 0 {
-		p.error(list[0].Pos(), "no new variables on left side of :=")
+		p.error(list[0].Pos(), MsgNoNewVariables)
 	}
 }
 
@@ -187,7 +234,7 @@ func (p *parser) tryResolve(x ast.Expr, collectUnresolved bool) {
 	}
 	// try to resolve the identifier
 	for s := p.topScope; s != nil; s = s.Outer {
-		if obj := s.Lookup(ident.Name); obj != nil {
+		if obj := s.Lookup(ident.Name); obj != nil && (s != p.pkgScope || p.visible(obj)) {
 			ident.Obj = obj
 			return
 		}
@@ -202,6 +249,22 @@ func (p *parser) tryResolve(x ast.Expr, collectUnresolved bool) {
 	}
 }
 
+// visible reports whether the package object obj is declared at the
+// current position. A deferred or skipped body is parsed once the
+// package scope is complete, but only the objects declared before the
+// body are visible in it, so that its identifiers resolve as in a serial
+// parse: those declared later are collected as unresolved and resolved
+// at the end of the file (or by Materialize), and the keys of composite
+// literals, which are not collected, remain unresolved.
+//
+func (p *parser) visible(obj *ast.Object) bool {
+	if p.bodyOrder == nil {
+		return true
+	}
+	n, ok := p.bodyOrder[obj]
+	return ok && n < p.bodyDecls
+}
+
 func (p *parser) resolve(x ast.Expr) {
 	p.tryResolve(x, true)
 }
@@ -212,28 +275,39 @@ func (p *parser) resolve(x ast.Expr) {
 func (p *parser) printTrace(a ...interface{}) {
 	const dots = ". . . . . . . . . . . . . . . . . . . . . . . . . . . . . . . . "
 	const n = len(dots)
+	w := p.out
+	if w == nil {
+		w = os.Stdout
+	}
 	pos := p.file.Position(p.pos)
-	fmt.Printf("%5d:%3d: ", pos.Line, pos.Column)
+	fmt.Fprintf(w, "%5d:%3d: ", pos.Line, pos.Column)
 	i := 2 * p.indent
 	for i > n {
-		fmt.Print(dots)
+		fmt.Fprint(w, dots)
 		i -= n
 	}
 	// i <= n
-	fmt.Print(dots[0:i])
-	fmt.Println(a...)
+	fmt.Fprint(w, dots[0:i])
+	fmt.Fprintln(w, a...)
 }
 
 func trace(p *parser, msg string) *parser {
-	p.printTrace(msg, "(")
-	p.indent++
+	if p.cov != nil {
+		p.cov.productions[msg]++
+	}
+	if p.mode&Trace != 0 {
+		p.printTrace(msg, "(")
+		p.indent++
+	}
 	return p
 }
 
 // Usage pattern: defer un(trace(p, "..."))
 func un(p *parser) {
-	p.indent--
-	p.printTrace(")")
+	if p.mode&Trace != 0 {
+		p.indent--
+		p.printTrace(")")
+	}
 }
 
 // Advance to the next token.
@@ -242,7 +316,7 @@ func (p *parser) next0() {
 	// when tracing as it provides a more readable output. The
 	// very first token (!p.pos.IsValid()) is not initialized
 	// (it is token.ILLEGAL), so don't print it .
-	if p.trace && p.pos.IsValid() {
+	if p.mode&Trace != 0 && p.pos.IsValid() {
 		s := p.tok.String()
 		switch {
 		case p.tok.IsLiteral():
@@ -314,6 +388,9 @@ func (p *parser) consumeCommentGroup(n int) (comments *ast.CommentGroup, endline
 // stored in the AST.
 //
 func (p *parser) next() {
+	if p.cursor.IsValid() {
+		p.prevEnd = p.pos + token.Pos(tokenLen(p.tok, p.lit))
+	}
 	p.leadComment = nil
 	p.lineComment = nil
 	prev := p.pos
@@ -327,9 +404,11 @@ func (p *parser) next() {
 			// The comment is on same line as the previous token; it
 			// cannot be a lead comment but may be a line comment.
 			comment, endline = p.consumeCommentGroup(0)
-			if p.file.Line(p.pos) != endline {
+			if p.file.Line(p.pos) != endline || p.tok == token.SEMICOLON || p.tok == token.EOF {
 				// The next token is on a different line, thus
 				// the last comment group is a line comment.
+				// (The scanner reports the automatically inserted
+				// semicolon at the end of the line, after the comment.)
 				p.lineComment = comment
 			}
 		}
@@ -351,7 +430,12 @@ func (p *parser) next() {
 // A bailout panic is raised to indicate early termination.
 type bailout struct{}
 
-func (p *parser) error(pos token.Pos, msg string) {
+// error reports the catalog message id with the given arguments at pos.
+//
+func (p *parser) error(pos token.Pos, id MessageID, args ...interface{}) {
+	if p.cov != nil {
+		p.cov.errorSite(1)
+	}
 	epos := p.file.Position(pos)
 
 	// If AllErrors is not set, discard errors reported on the same line
@@ -367,24 +451,48 @@ func (p *parser) error(pos token.Pos, msg string) {
 		}
 	}
 
-	p.errors.Add(epos, msg)
+	m := Message{ID: id, Args: args}
+	p.errors.Add(epos, m.Text(p.lang))
+	if p.info != nil {
+		if p.info.Messages == nil {
+			p.info.Messages = make(map[*scanner.Error]Message)
+		}
+		p.info.Messages[p.errors[len(p.errors)-1]] = m
+	}
+}
+
+// checkVersion reports an error at pos if the source is restricted to a
+// language version older than go1.minor, which introduced the syntax
+// described by the term what.
+//
+func (p *parser) checkVersion(pos token.Pos, minor int, what MessageID) {
+	if p.goVersion != 0 && p.goVersion < minor {
+		p.error(pos, MsgRequiresVersion, what, minor)
+	}
 }
 
-func (p *parser) errorExpected(pos token.Pos, msg string) {
-	msg = "expected " + msg
+// errorExpected reports that what, a term or a quoted token, was
+// expected at pos.
+//
+func (p *parser) errorExpected(pos token.Pos, what interface{}) {
+	if p.cov != nil {
+		p.cov.errorSite(1)
+	}
 	if pos == p.pos {
 		// the error happened at the current position;
 		// make the error message more specific
 		if p.tok == token.SEMICOLON && p.lit == "\n" {
-			msg += ", found newline"
+			p.error(pos, MsgExpectedFound, what, TermNewline)
 		} else {
-			msg += ", found '" + p.tok.String() + "'"
+			found := "'" + p.tok.String() + "'"
 			if p.tok.IsLiteral() {
-				msg += " " + p.lit
+				found += " " + p.lit
 			}
+			p.error(pos, MsgExpectedFound, what, found)
 		}
+		return
 	}
-	p.error(pos, msg)
+	p.error(pos, MsgExpected, what)
 }
 
 func (p *parser) expect(tok token.Token) token.Pos {
@@ -399,15 +507,16 @@ func (p *parser) expect(tok token.Token) token.Pos {
 // expectClosing is like expect but provides a better error message
 // for the common case of a missing comma before a newline.
 //
-func (p *parser) expectClosing(tok token.Token, context string) token.Pos {
+func (p *parser) expectClosing(tok token.Token, context MessageID) token.Pos {
 	if p.tok != tok && p.tok == token.SEMICOLON && p.lit == "\n" {
-		p.error(p.pos, "missing ',' before newline in "+context)
+		p.error(p.pos, MsgMissingCommaNewline, context)
 		p.next()
 	}
 	return p.expect(tok)
 }
 
-func (p *parser) expectSemi() {
+// expectSemi consumes a semicolon and returns the applicable line comment.
+func (p *parser) expectSemi() (comment *ast.CommentGroup) {
 	// semicolon is optional before a closing ')' or '}'
 	if p.tok != token.RPAREN && p.tok != token.RBRACE {
 		switch p.tok {
@@ -416,24 +525,34 @@ func (p *parser) expectSemi() {
 			p.errorExpected(p.pos, "';'")
 			fallthrough
 		case token.SEMICOLON:
-			p.next()
+			if p.lit == ";" {
+				// explicit semicolon
+				p.next()
+				comment = p.lineComment // use following comments
+			} else {
+				// artificial semicolon
+				comment = p.lineComment // use preceding comments
+				p.next()
+			}
+			return comment
 		default:
 			p.errorExpected(p.pos, "';'")
 			syncStmt(p)
 		}
 	}
+	return nil
 }
 
-func (p *parser) atComma(context string, follow token.Token) bool {
+func (p *parser) atComma(context MessageID, follow token.Token) bool {
 	if p.tok == token.COMMA {
 		return true
 	}
 	if p.tok != follow {
-		msg := "missing ','"
 		if p.tok == token.SEMICOLON && p.lit == "\n" {
-			msg += " before newline"
+			p.error(p.pos, MsgMissingCommaNewline, context)
+		} else {
+			p.error(p.pos, MsgMissingComma, context)
 		}
-		p.error(p.pos, msg+" in "+context)
 		return true // "insert" comma and continue
 	}
 	return false
@@ -622,7 +741,7 @@ func (p *parser) parseType() ast.Expr {
 
 	if typ == nil {
 		pos := p.pos
-		p.errorExpected(pos, "type")
+		p.errorExpected(pos, TermType)
 		p.next() // make progress
 		return &ast.BadExpr{From: pos, To: p.pos}
 	}
@@ -679,7 +798,7 @@ func (p *parser) makeIdentList(list []ast.Expr) []*ast.Ident {
 		if !isIdent {
 			if _, isBad := x.(*ast.BadExpr); !isBad {
 				// only report error if it's a new one
-				p.errorExpected(x.Pos(), "identifier")
+				p.errorExpected(x.Pos(), TermIdentifier)
 			}
 			ident = &ast.Ident{NamePos: x.Pos(), Name: "_"}
 		}
@@ -717,10 +836,10 @@ func (p *parser) parseFieldDecl(scope *ast.Scope) *ast.Field {
 		// ["*"] TypeName (AnonymousField)
 		typ = list[0] // we always have at least one element
 		if n := len(list); n > 1 {
-			p.errorExpected(p.pos, "type")
+			p.errorExpected(p.pos, TermType)
 			typ = &ast.BadExpr{From: p.pos, To: p.pos}
 		} else if !isTypeName(deref(typ)) {
-			p.errorExpected(typ.Pos(), "anonymous field")
+			p.errorExpected(typ.Pos(), TermAnonymousField)
 			typ = &ast.BadExpr{From: typ.Pos(), To: p.safePos(typ.End())}
 		}
 	}
@@ -732,9 +851,9 @@ func (p *parser) parseFieldDecl(scope *ast.Scope) *ast.Field {
 		p.next()
 	}
 
-	p.expectSemi() // call before accessing p.linecomment
+	comment := p.expectSemi()
 
-	field := &ast.Field{Doc: doc, Names: idents, Type: typ, Tag: tag, Comment: p.lineComment}
+	field := &ast.Field{Doc: doc, Names: idents, Type: typ, Tag: tag, Comment: comment}
 	p.declare(field, nil, scope, ast.Var, idents...)
 	p.resolve(typ)
 
@@ -788,7 +907,7 @@ func (p *parser) tryVarType(isParam bool) ast.Expr {
 		if typ != nil {
 			p.resolve(typ)
 		} else {
-			p.error(pos, "'...' parameter is missing type")
+			p.error(pos, MsgVariadicMissingType)
 			typ = &ast.BadExpr{From: pos, To: p.pos}
 		}
 		return &ast.Ellipsis{Ellipsis: pos, Elt: typ}
@@ -801,7 +920,7 @@ func (p *parser) parseVarType(isParam bool) ast.Expr {
 	typ := p.tryVarType(isParam)
 	if typ == nil {
 		pos := p.pos
-		p.errorExpected(pos, "type")
+		p.errorExpected(pos, TermType)
 		p.next() // make progress
 		typ = &ast.BadExpr{From: pos, To: p.pos}
 	}
@@ -837,7 +956,7 @@ func (p *parser) parseParameterList(scope *ast.Scope, ellipsisOk bool) (params [
 		// parameter or result variable is the function body.
 		p.declare(field, nil, scope, ast.Var, idents...)
 		p.resolve(typ)
-		if !p.atComma("parameter list", token.RPAREN) {
+		if !p.atComma(TermParameterList, token.RPAREN) {
 			return
 		}
 		p.next()
@@ -850,7 +969,7 @@ func (p *parser) parseParameterList(scope *ast.Scope, ellipsisOk bool) (params [
 			// parameter or result variable is the function body.
 			p.declare(field, nil, scope, ast.Var, idents...)
 			p.resolve(typ)
-			if !p.atComma("parameter list", token.RPAREN) {
+			if !p.atComma(TermParameterList, token.RPAREN) {
 				break
 			}
 			p.next()
@@ -944,9 +1063,9 @@ func (p *parser) parseMethodSpec(scope *ast.Scope) *ast.Field {
 		typ = x
 		p.resolve(typ)
 	}
-	p.expectSemi() // call before accessing p.linecomment
+	comment := p.expectSemi()
 
-	spec := &ast.Field{Doc: doc, Names: idents, Type: typ, Comment: p.lineComment}
+	spec := &ast.Field{Doc: doc, Names: idents, Type: typ, Comment: comment}
 	p.declare(spec, nil, scope, ast.Fun, idents...)
 
 	return spec
@@ -1077,6 +1196,7 @@ func (p *parser) parseBody(scope *ast.Scope) *ast.BlockStmt {
 
 	lbrace := p.expect(token.LBRACE)
 	p.topScope = scope // open function scope
+	p.scopeOpened()
 	p.openLabelScope()
 	list := p.parseStmtList()
 	p.closeLabelScope()
@@ -1140,6 +1260,9 @@ func (p *parser) parseOperand(lhs bool) ast.Expr {
 
 	case token.INT, token.FLOAT, token.IMAG, token.CHAR, token.STRING:
 		x := &ast.BasicLit{ValuePos: p.pos, Kind: p.tok, Value: p.lit}
+		if p.goVersion != 0 && x.Kind != token.CHAR && x.Kind != token.STRING {
+			p.checkNumber(x)
+		}
 		p.next()
 		return x
 
@@ -1165,11 +1288,38 @@ func (p *parser) parseOperand(lhs bool) ast.Expr {
 
 	// we have an error
 	pos := p.pos
-	p.errorExpected(pos, "operand")
+	p.errorExpected(pos, TermOperand)
 	syncStmt(p)
 	return &ast.BadExpr{From: pos, To: p.pos}
 }
 
+// checkNumber checks that the number literal x conforms to the language
+// version.
+//
+func (p *parser) checkNumber(x *ast.BasicLit) {
+	lit := x.Value
+	if len(lit) >= 2 && lit[0] == '0' {
+		switch lower(lit[1]) {
+		case 'b':
+			p.checkVersion(x.ValuePos, 13, TermBinaryLiteral)
+		case 'o':
+			p.checkVersion(x.ValuePos, 13, TermOctalLiteral)
+		case 'x':
+			switch x.Kind {
+			case token.FLOAT:
+				p.checkVersion(x.ValuePos, 13, TermHexFloat)
+			case token.IMAG:
+				p.checkVersion(x.ValuePos, 13, TermHexImaginary)
+			}
+		}
+	}
+	if strings.Contains(lit, "_") {
+		p.checkVersion(x.ValuePos, 13, TermNumberSeparator)
+	}
+}
+
+func lower(ch byte) byte { return ('a' - 'A') | ch }
+
 func (p *parser) parseSelector(x ast.Expr) ast.Expr {
 	if p.trace {
 		defer un(trace(p, "Selector"))
@@ -1228,14 +1378,15 @@ func (p *parser) parseIndexOrSlice(x ast.Expr) ast.Expr {
 		slice3 := false
 		if ncolons == 2 {
 			slice3 = true
+			p.checkVersion(colons[1], 2, TermFullSlice)
 			// Check presence of 2nd and 3rd index here rather than during type-checking
 			// to prevent erroneous programs from passing through gofmt (was issue 7305).
 			if index[1] == nil {
-				p.error(colons[0], "2nd index required in 3-index slice")
+				p.error(colons[0], MsgSlice2ndIndex)
 				index[1] = &ast.BadExpr{From: colons[0] + 1, To: colons[1]}
 			}
 			if index[2] == nil {
-				p.error(colons[1], "3rd index required in 3-index slice")
+				p.error(colons[1], MsgSlice3rdIndex)
 				index[2] = &ast.BadExpr{From: colons[1] + 1, To: rbrack}
 			}
 		}
@@ -1260,13 +1411,13 @@ func (p *parser) parseCallOrConversion(fun ast.Expr) *ast.CallExpr {
 			ellipsis = p.pos
 			p.next()
 		}
-		if !p.atComma("argument list", token.RPAREN) {
+		if !p.atComma(TermArgumentList, token.RPAREN) {
 			break
 		}
 		p.next()
 	}
 	p.exprLev--
-	rparen := p.expectClosing(token.RPAREN, "argument list")
+	rparen := p.expectClosing(token.RPAREN, TermArgumentList)
 
 	return &ast.CallExpr{Fun: fun, Lparen: lparen, Args: list, Ellipsis: ellipsis, Rparen: rparen}
 }
@@ -1335,7 +1486,7 @@ func (p *parser) parseElementList() (list []ast.Expr) {
 
 	for p.tok != token.RBRACE && p.tok != token.EOF {
 		list = append(list, p.parseElement())
-		if !p.atComma("composite literal", token.RBRACE) {
+		if !p.atComma(TermCompositeLiteral, token.RBRACE) {
 			break
 		}
 		p.next()
@@ -1356,7 +1507,7 @@ func (p *parser) parseLiteralValue(typ ast.Expr) ast.Expr {
 		elts = p.parseElementList()
 	}
 	p.exprLev--
-	rbrace := p.expectClosing(token.RBRACE, "composite literal")
+	rbrace := p.expectClosing(token.RBRACE, TermCompositeLiteral)
 	return &ast.CompositeLit{Type: typ, Lbrace: lbrace, Elts: elts, Rbrace: rbrace}
 }
 
@@ -1385,7 +1536,7 @@ func (p *parser) checkExpr(x ast.Expr) ast.Expr {
 	case *ast.BinaryExpr:
 	default:
 		// all other nodes are not proper expressions
-		p.errorExpected(x.Pos(), "expression")
+		p.errorExpected(x.Pos(), TermExpression)
 		x = &ast.BadExpr{From: x.Pos(), To: p.safePos(x.End())}
 	}
 	return x
@@ -1448,7 +1599,7 @@ func (p *parser) checkExprOrType(x ast.Expr) ast.Expr {
 	case *ast.UnaryExpr:
 	case *ast.ArrayType:
 		if len, isEllipsis := t.Len.(*ast.Ellipsis); isEllipsis {
-			p.error(len.Pos(), "expected array length, found '...'")
+			p.error(len.Pos(), MsgExpectedFound, TermArrayLength, "'...'")
 			x = &ast.BadExpr{From: x.Pos(), To: p.safePos(x.End())}
 		}
 	}
@@ -1479,7 +1630,7 @@ L:
 				x = p.parseTypeAssertion(p.checkExpr(x))
 			default:
 				pos := p.pos
-				p.errorExpected(pos, "selector or type assertion")
+				p.errorExpected(pos, TermSelectorOrAssertion)
 				p.next() // make progress
 				sel := &ast.Ident{NamePos: pos, Name: "_"}
 				x = &ast.SelectorExpr{X: x, Sel: sel}
@@ -1562,7 +1713,7 @@ func (p *parser) parseUnaryExpr(lhs bool) ast.Expr {
 				typ, ok = typ.Value.(*ast.ChanType)
 			}
 			if dir == ast.SEND {
-				p.errorExpected(arrow, "channel type")
+				p.errorExpected(arrow, TermChannelType)
 			}
 
 			return x
@@ -1688,7 +1839,7 @@ func (p *parser) parseSimpleStmt(mode int) (ast.Stmt, bool) {
 	}
 
 	if len(x) > 1 {
-		p.errorExpected(x[0].Pos(), "1 expression")
+		p.errorExpected(x[0].Pos(), TermOneExpression)
 		// continue with first expression
 	}
 
@@ -1711,7 +1862,7 @@ func (p *parser) parseSimpleStmt(mode int) (ast.Stmt, bool) {
 		// ported for the line is the illegal label error instead of the token
 		// before the ':' that caused the problem. Thus, use the (latest) colon
 		// position for error reporting.
-		p.error(colon, "illegal label declaration")
+		p.error(colon, MsgIllegalLabel)
 		return &ast.BadStmt{From: x[0].Pos(), To: colon + 1}, false
 
 	case token.ARROW:
@@ -1739,7 +1890,7 @@ func (p *parser) parseCallExpr(callType string) *ast.CallExpr {
 	}
 	if _, isBad := x.(*ast.BadExpr); !isBad {
 		// only report error if it's a new one
-		p.error(p.safePos(x.End()), fmt.Sprintf("function must be invoked in %s statement", callType))
+		p.error(p.safePos(x.End()), MsgMustInvoke, callType)
 	}
 	return nil
 }
@@ -1808,14 +1959,14 @@ func (p *parser) parseBranchStmt(tok token.Token) *ast.BranchStmt {
 	return &ast.BranchStmt{TokPos: pos, Tok: tok, Label: label}
 }
 
-func (p *parser) makeExpr(s ast.Stmt, kind string) ast.Expr {
+func (p *parser) makeExpr(s ast.Stmt, kind MessageID) ast.Expr {
 	if s == nil {
 		return nil
 	}
 	if es, isExpr := s.(*ast.ExprStmt); isExpr {
 		return p.checkExpr(es.X)
 	}
-	p.error(s.Pos(), fmt.Sprintf("expected %s, found simple statement (missing parentheses around composite literal?)", kind))
+	p.error(s.Pos(), MsgSimpleStmt, kind)
 	return &ast.BadExpr{From: s.Pos(), To: p.safePos(s.End())}
 }
 
@@ -1825,7 +1976,7 @@ func (p *parser) parseIfStmt() *ast.IfStmt {
 	}
 
 	pos := p.expect(token.IF)
-	p.openScope()
+	p.openStmtScope()
 	defer p.closeScope()
 
 	var s ast.Stmt
@@ -1842,7 +1993,7 @@ func (p *parser) parseIfStmt() *ast.IfStmt {
 				p.next()
 				x = p.parseRhs()
 			} else {
-				x = p.makeExpr(s, "boolean expression")
+				x = p.makeExpr(s, TermBooleanExpression)
 				s = nil
 			}
 		}
@@ -1860,7 +2011,7 @@ func (p *parser) parseIfStmt() *ast.IfStmt {
 			else_ = p.parseBlockStmt()
 			p.expectSemi()
 		default:
-			p.errorExpected(p.pos, "if statement or block")
+			p.errorExpected(p.pos, TermIfOrBlock)
 			else_ = &ast.BadStmt{From: p.pos, To: p.pos}
 		}
 	} else {
@@ -1926,7 +2077,7 @@ func (p *parser) isTypeSwitchGuard(s ast.Stmt) bool {
 			switch t.Tok {
 			case token.ASSIGN:
 				// permit v = x.(type) but complain
-				p.error(t.TokPos, "expected ':=', found '='")
+				p.error(t.TokPos, MsgExpectedFound, "':='", "'='")
 				fallthrough
 			case token.DEFINE:
 				return true
@@ -1942,7 +2093,7 @@ func (p *parser) parseSwitchStmt() ast.Stmt {
 	}
 
 	pos := p.expect(token.SWITCH)
-	p.openScope()
+	p.openStmtScope()
 	defer p.closeScope()
 
 	var s1, s2 ast.Stmt
@@ -1969,7 +2120,7 @@ func (p *parser) parseSwitchStmt() ast.Stmt {
 				//
 				// If we don't have a type switch, s2 must be an expression.
 				// Having the extra nested but empty scope won't affect it.
-				p.openScope()
+				p.openStmtScope()
 				defer p.closeScope()
 				s2, _ = p.parseSimpleStmt(basic)
 			}
@@ -1991,7 +2142,7 @@ func (p *parser) parseSwitchStmt() ast.Stmt {
 		return &ast.TypeSwitchStmt{Switch: pos, Init: s1, Assign: s2, Body: body}
 	}
 
-	return &ast.SwitchStmt{Switch: pos, Init: s1, Tag: p.makeExpr(s2, "switch expression"), Body: body}
+	return &ast.SwitchStmt{Switch: pos, Init: s1, Tag: p.makeExpr(s2, TermSwitchExpression), Body: body}
 }
 
 func (p *parser) parseCommClause() *ast.CommClause {
@@ -2008,7 +2159,7 @@ func (p *parser) parseCommClause() *ast.CommClause {
 		if p.tok == token.ARROW {
 			// SendStmt
 			if len(lhs) > 1 {
-				p.errorExpected(lhs[0].Pos(), "1 expression")
+				p.errorExpected(lhs[0].Pos(), TermOneExpression)
 				// continue with first expression
 			}
 			arrow := p.pos
@@ -2020,7 +2171,7 @@ func (p *parser) parseCommClause() *ast.CommClause {
 			if tok := p.tok; tok == token.ASSIGN || tok == token.DEFINE {
 				// RecvStmt with assignment
 				if len(lhs) > 2 {
-					p.errorExpected(lhs[0].Pos(), "1 or 2 expressions")
+					p.errorExpected(lhs[0].Pos(), TermOneOrTwoExpressions)
 					// continue with first two expressions
 					lhs = lhs[0:2]
 				}
@@ -2035,7 +2186,7 @@ func (p *parser) parseCommClause() *ast.CommClause {
 			} else {
 				// lhs must be single receive operation
 				if len(lhs) > 1 {
-					p.errorExpected(lhs[0].Pos(), "1 expression")
+					p.errorExpected(lhs[0].Pos(), TermOneExpression)
 					// continue with first expression
 				}
 				comm = &ast.ExprStmt{X: lhs[0]}
@@ -2076,7 +2227,7 @@ func (p *parser) parseForStmt() ast.Stmt {
 	}
 
 	pos := p.expect(token.FOR)
-	p.openScope()
+	p.openStmtScope()
 	defer p.closeScope()
 
 	var s1, s2, s3 ast.Stmt
@@ -2088,6 +2239,7 @@ func (p *parser) parseForStmt() ast.Stmt {
 			if p.tok == token.RANGE {
 				// "for range x" (nil lhs in assignment)
 				pos := p.pos
+				p.checkVersion(pos, 4, TermRangeWithoutVars)
 				p.next()
 				y := []ast.Expr{&ast.UnaryExpr{OpPos: pos, Op: token.RANGE, X: p.parseRhs()}}
 				s2 = &ast.AssignStmt{Rhs: y}
@@ -2126,7 +2278,7 @@ func (p *parser) parseForStmt() ast.Stmt {
 		case 2:
 			key, value = as.Lhs[0], as.Lhs[1]
 		default:
-			p.errorExpected(as.Lhs[len(as.Lhs)-1].Pos(), "at most 2 expressions")
+			p.errorExpected(as.Lhs[len(as.Lhs)-1].Pos(), TermAtMostTwoExpressions)
 			return &ast.BadStmt{From: pos, To: p.safePos(body.End())}
 		}
 		// parseSimpleStmt returned a right-hand side that
@@ -2147,7 +2299,7 @@ func (p *parser) parseForStmt() ast.Stmt {
 	return &ast.ForStmt{
 		For:  pos,
 		Init: s1,
-		Cond: p.makeExpr(s2, "boolean or range expression"),
+		Cond: p.makeExpr(s2, TermBoolOrRange),
 		Post: s3,
 		Body: body,
 	}
@@ -2204,7 +2356,7 @@ func (p *parser) parseStmt() (s ast.Stmt) {
 	default:
 		// no statement found
 		pos := p.pos
-		p.errorExpected(pos, "statement")
+		p.errorExpected(pos, TermStatement)
 		syncStmt(p)
 		s = &ast.BadStmt{From: pos, To: p.pos}
 	}
@@ -2218,14 +2370,21 @@ func (p *parser) parseStmt() (s ast.Stmt) {
 type parseSpecFunction func(doc *ast.CommentGroup, keyword token.Token, iota int) ast.Spec
 
 func isValidImport(lit string) bool {
-	const illegalChars = `!"#$%&'()*,:;<=>?[\]^{|}` + "`\uFFFD"
 	s, _ := strconv.Unquote(lit) // go/scanner returns a legal string literal
-	for _, r := range s {
+	return ValidImportPath(s)
+}
+
+// ValidImportPath reports whether path, an unquoted import path, is
+// accepted by the parser.
+//
+func ValidImportPath(path string) bool {
+	const illegalChars = `!"#$%&'()*,:;<=>?[\]^{|}` + "`\uFFFD"
+	for _, r := range path {
 		if !unicode.IsGraphic(r) || unicode.IsSpace(r) || strings.ContainsRune(illegalChars, r) {
 			return false
 		}
 	}
-	return s != ""
+	return path != ""
 }
 
 func (p *parser) parseImportSpec(doc *ast.CommentGroup, _ token.Token, _ int) ast.Spec {
@@ -2247,20 +2406,20 @@ func (p *parser) parseImportSpec(doc *ast.CommentGroup, _ token.Token, _ int) as
 	if p.tok == token.STRING {
 		path = p.lit
 		if !isValidImport(path) {
-			p.error(pos, "invalid import path: "+path)
+			p.error(pos, MsgInvalidImportPath, path)
 		}
 		p.next()
 	} else {
 		p.expect(token.STRING) // use expect() error handling
 	}
-	p.expectSemi() // call before accessing p.linecomment
+	comment := p.expectSemi()
 
 	// collect imports
 	spec := &ast.ImportSpec{
 		Doc:     doc,
 		Name:    ident,
 		Path:    &ast.BasicLit{ValuePos: pos, Kind: token.STRING, Value: path},
-		Comment: p.lineComment,
+		Comment: comment,
 	}
 	p.imports = append(p.imports, spec)
 
@@ -2281,16 +2440,16 @@ func (p *parser) parseValueSpec(doc *ast.CommentGroup, keyword token.Token, iota
 		p.next()
 		values = p.parseRhsList()
 	}
-	p.expectSemi() // call before accessing p.linecomment
+	comment := p.expectSemi()
 
 	switch keyword {
 	case token.VAR:
 		if typ == nil && values == nil {
-			p.error(pos, "missing variable type or initialization")
+			p.error(pos, MsgMissingVarType)
 		}
 	case token.CONST:
 		if values == nil && (iota == 0 || typ != nil) {
-			p.error(pos, "missing constant value")
+			p.error(pos, MsgMissingConstValue)
 		}
 	}
 
@@ -2303,7 +2462,7 @@ func (p *parser) parseValueSpec(doc *ast.CommentGroup, keyword token.Token, iota
 		Names:   idents,
 		Type:    typ,
 		Values:  values,
-		Comment: p.lineComment,
+		Comment: comment,
 	}
 	kind := ast.Con
 	if keyword == token.VAR {
@@ -2329,8 +2488,7 @@ func (p *parser) parseTypeSpec(doc *ast.CommentGroup, _ token.Token, _ int) ast.
 	p.declare(spec, nil, p.topScope, ast.Typ, ident)
 
 	spec.Type = p.parseType()
-	p.expectSemi() // call before accessing p.linecomment
-	spec.Comment = p.lineComment
+	spec.Comment = p.expectSemi()
 
 	return spec
 }
@@ -2386,7 +2544,11 @@ func (p *parser) parseFuncDecl() *ast.FuncDecl {
 
 	var body *ast.BlockStmt
 	if p.tok == token.LBRACE {
-		body = p.parseBody(scope)
+		if p.mode&SkipFunctionBodies != 0 {
+			body = p.skipBody(scope)
+		} else if body = p.deferBody(scope); body == nil {
+			body = p.parseBody(scope)
+		}
 	}
 	p.expectSemi()
 
@@ -2434,7 +2596,7 @@ func (p *parser) parseDecl(sync func(*parser)) ast.Decl {
 
 	default:
 		pos := p.pos
-		p.errorExpected(pos, "declaration")
+		p.errorExpected(pos, TermDeclaration)
 		sync(p)
 		return &ast.BadDecl{From: pos, To: p.pos}
 	}
@@ -2463,7 +2625,7 @@ func (p *parser) parseFile() *ast.File {
 	// the package name does not appear in any scope.
 	ident := p.parseIdent()
 	if ident.Name == "_" && p.mode&DeclarationErrors != 0 {
-		p.error(p.pos, "invalid package name _")
+		p.error(p.pos, MsgInvalidPackageName)
 	}
 	p.expectSemi()
 
@@ -2493,6 +2655,10 @@ func (p *parser) parseFile() *ast.File {
 	assert(p.topScope == nil, "unbalanced scopes")
 	assert(p.labelScope == nil, "unbalanced label scopes")
 
+	if p.bodies != nil {
+		p.parseBodies()
+	}
+
 	// resolve global identifiers within the same file
 	i := 0
 	for _, ident := range p.unresolved {
@@ -6,10 +6,16 @@ package parser
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"flag"
 	"fmt"
 	"go/ast"
 	"go/token"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
 	"strings"
 	"testing"
 )
@@ -66,6 +72,114 @@ func TestParseDir(t *testing.T) {
 	}
 }
 
+func TestParseDirModVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0777); err != nil {
+		t.Fatal(err)
+	}
+	write := func(filename, data string) {
+		if err := ioutil.WriteFile(filename, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(sub, "a.go"), "package p\n\nconst x = 0b1\n")
+
+	for _, test := range []struct {
+		gomod, version string
+		ok             bool
+	}{
+		{"", "", true}, // no go.mod
+		{"module m\n\ngo 1.13\n", "", true},
+		{"module m // comment\ngo 1.12 // comment\n", "", false},
+		{"module m\n", "", true}, // go1.16
+		{"module m\ngo 1.12\n", "go1.13", true},
+	} {
+		os.Remove(filepath.Join(dir, "go.mod"))
+		if test.gomod != "" {
+			write(filepath.Join(dir, "go.mod"), test.gomod)
+		}
+		conf := Config{LanguageVersion: test.version}
+		pkgs, err := conf.ParseDir(token.NewFileSet(), sub, nil)
+		if test.ok && (err != nil || pkgs["p"] == nil) {
+			t.Errorf("go.mod %q, version %q: got %v, %v", test.gomod, test.version, pkgs, err)
+		}
+		if !test.ok && (err == nil || !strings.Contains(err.Error(), "requires go1.13")) {
+			t.Errorf("go.mod %q, version %q: got error %v; want requires go1.13", test.gomod, test.version, err)
+		}
+	}
+}
+
+var updateVersion = flag.Bool("update-version", false, "update testdata/version.golden")
+
+// TestVersion checks that the output of the parser for a fixed corpus
+// only changes with Version: testdata/version.golden records Version and
+// a hash of the ASTs and errors produced for the corpus in various
+// modes, and of the files with their skipped bodies materialized. After
+// changing Version, run the test with -update-version.
+//
+func TestVersion(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join(testdata, "*.src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	more, err := filepath.Glob(filepath.Join(testdata, "messages", "*.src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4)) // ParallelFunctionBodies is ignored on a single processor
+	h := sha256.New()
+	for _, filename := range append(files, more...) {
+		for _, mode := range []Mode{
+			0,
+			ParseComments | DeclarationErrors | AllErrors,
+			ParseComments | ParseCgo | ParseStructTags,
+			ParseComments | ParallelFunctionBodies,
+			ParseComments | SkipFunctionBodies,
+			ImportsOnly,
+		} {
+			fset := token.NewFileSet()
+			conf := Config{Mode: mode, Info: new(Info)}
+			f, err := conf.ParseFile(fset, filename, nil)
+			fmt.Fprintf(h, "%s %d\n%s\nerror: %v\n", filename, mode, dump(fset, f), err)
+			if len(conf.Info.Bodies) == 0 {
+				continue
+			}
+			for _, decl := range f.Decls {
+				if fn, ok := decl.(*ast.FuncDecl); ok && conf.Info.Bodies[fn] != nil {
+					_, err := conf.Info.Bodies[fn].Materialize()
+					fmt.Fprintf(h, "%s: %v\n", fn.Name.Name, err)
+				}
+			}
+			fmt.Fprintf(h, "materialized\n%s\n", dump(fset, f))
+		}
+	}
+	got := fmt.Sprintf("%s %x\n", Version, h.Sum(nil))
+
+	golden := filepath.Join(testdata, "version.golden")
+	if *updateVersion {
+		if err := ioutil.WriteFile(golden, []byte(got), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		if strings.Fields(got)[0] == strings.Fields(string(want))[0] {
+			t.Errorf("output of the parser changed: change Version and run the test with -update-version")
+		} else {
+			t.Errorf("Version changed: run the test with -update-version")
+		}
+	}
+}
+
 func TestParseExpr(t *testing.T) {
 	// just kicking the tires:
 	// a valid arithmetic expression
@@ -446,6 +560,50 @@ type T struct {
 	}
 }
 
+// TestLineComments checks the line comments of the fields and the specs.
+// The scanner reports the semicolon automatically inserted at the end of
+// a line after the comments of the line, and a comment followed by such
+// a semicolon or by EOF is a line comment, but one followed by another
+// token on the same line, including an explicit semicolon, is not.
+func TestLineComments(t *testing.T) {
+	for _, test := range []struct {
+		src  string
+		want []string // line comments of the fields and specs, in source order
+	}{
+		{"type T struct {\n\tA int // a\n\tB int /* b */\n\tC int\n}\n", []string{"", "// a", "/* b */", ""}},
+		{"type T struct{ A int /* a */ }\n", []string{"", ""}},
+		{"type I interface {\n\tM() // m\n}\n", []string{"", "// m"}},
+		{"import \"fmt\" // fmt\n", []string{"// fmt"}},
+		{"const (\n\tA = 1 // a\n\tB = 2 /* b */\n)\n", []string{"// a", "/* b */"}},
+		{"var x = 1 // x\nvar y = 2 /* y */; var z = 3 // z\n", []string{"// x", "", "// z"}},
+		{"type T int; /* c */ type U int\n", []string{"", ""}},
+		{"type T int // t", []string{"// t"}}, // at EOF
+	} {
+		src := "package p\n\n" + test.src
+		f, err := ParseFile(token.NewFileSet(), "", src, ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.Field:
+				got = append(got, commentText(n.Comment))
+			case *ast.ImportSpec:
+				got = append(got, commentText(n.Comment))
+			case *ast.ValueSpec:
+				got = append(got, commentText(n.Comment))
+			case *ast.TypeSpec:
+				got = append(got, commentText(n.Comment))
+			}
+			return true
+		})
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got line comments %q; want %q", src, got, test.want)
+		}
+	}
+}
+
 // TestIssue9979 verifies that empty statements are contained within their enclosing blocks.
 func TestIssue9979(t *testing.T) {
 	for _, src := range []string{
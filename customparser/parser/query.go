@@ -0,0 +1,253 @@
+// This file implements a small query layer on top of the identifier
+// resolution performed by the parser: finding the declaration of an
+// identifier, all references to an object, and the target of a branch
+// statement. It works on the ast.Objects recorded by the parser and does
+// not require type-checking.
+
+package parser
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+// An Index answers definition and reference queries over a set of files
+// belonging to the same package. Identifiers that the parser could not
+// resolve within their own file (ast.File.Unresolved) are looked up in
+// the package scope formed by the top-level declarations of all files.
+//
+// An Index does not modify the ASTs it is built from.
+//
+type Index struct {
+	fset     *token.FileSet
+	files    []*ast.File
+	pkgScope *ast.Scope
+	objs     map[*ast.Ident]*ast.Object // objects of package-level unresolved identifiers
+	refs     map[*ast.Object][]*ast.Ident
+}
+
+// NewIndex returns an Index for the given files, which must have been
+// parsed with fset and belong to the same package.
+//
+func NewIndex(fset *token.FileSet, files ...*ast.File) *Index {
+	ix := &Index{
+		fset:     fset,
+		files:    files,
+		pkgScope: ast.NewScope(nil),
+		objs:     make(map[*ast.Ident]*ast.Object),
+		refs:     make(map[*ast.Object][]*ast.Ident),
+	}
+
+	// collect package-level objects of all files
+	for _, f := range files {
+		if f.Scope == nil {
+			continue
+		}
+		for _, obj := range f.Scope.Objects {
+			ix.pkgScope.Insert(obj) // keep the first declaration
+		}
+	}
+
+	// resolve identifiers left unresolved by the parser
+	for _, f := range files {
+		for _, ident := range f.Unresolved {
+			if obj := ix.pkgScope.Lookup(ident.Name); obj != nil {
+				ix.objs[ident] = obj
+			}
+		}
+	}
+
+	// collect references
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok {
+				if obj := ix.ObjectOf(ident); obj != nil {
+					ix.refs[obj] = append(ix.refs[obj], ident)
+				}
+			}
+			return true
+		})
+	}
+	for _, list := range ix.refs {
+		sort.Sort(byPos(list))
+	}
+
+	return ix
+}
+
+// NewPackageIndex is like NewIndex but takes the files of a package
+// as returned by ParseDir.
+//
+func NewPackageIndex(fset *token.FileSet, pkg *ast.Package) *Index {
+	names := make([]string, 0, len(pkg.Files))
+	for name := range pkg.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names) // deterministic order for redeclared objects
+	files := make([]*ast.File, len(names))
+	for i, name := range names {
+		files[i] = pkg.Files[name]
+	}
+	return NewIndex(fset, files...)
+}
+
+type byPos []*ast.Ident
+
+func (a byPos) Len() int           { return len(a) }
+func (a byPos) Less(i, j int) bool { return a[i].Pos() < a[j].Pos() }
+func (a byPos) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// File returns the indexed file containing pos, or nil.
+func (ix *Index) File(pos token.Pos) *ast.File {
+	for _, f := range ix.files {
+		// use the extent of the token.File rather than f.End(),
+		// which doesn't include trailing comments
+		if tf := ix.fset.File(f.Pos()); tf != nil && tf.Base() <= int(pos) && int(pos) <= tf.Base()+tf.Size() {
+			return f
+		}
+	}
+	return nil
+}
+
+// IdentAt returns the identifier whose source range contains pos,
+// or nil if there is none. A position immediately after an identifier
+// (as for a cursor placed at the end of a word) also selects it.
+//
+func (ix *Index) IdentAt(pos token.Pos) *ast.Ident {
+	f := ix.File(pos)
+	if f == nil {
+		return nil
+	}
+	var found *ast.Ident
+	ast.Inspect(f, func(n ast.Node) bool {
+		if n == nil || found != nil || pos < n.Pos() || n.End() < pos {
+			return false
+		}
+		if ident, ok := n.(*ast.Ident); ok {
+			found = ident
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// ObjectOf returns the object denoted by ident, or nil if the object is
+// not declared in the indexed files (e.g., predeclared identifiers,
+// package names, struct fields, and methods).
+//
+func (ix *Index) ObjectOf(ident *ast.Ident) *ast.Object {
+	if obj := ix.objs[ident]; obj != nil {
+		return obj
+	}
+	if ident.Obj != nil && ident.Obj.Kind != ast.Bad {
+		return ident.Obj
+	}
+	return nil
+}
+
+// Definition returns the identifier declaring the object denoted by the
+// identifier at pos, or nil if there is no such identifier or it denotes
+// an object not declared in the indexed files. If the identifier at pos
+// is itself a declaration, it is returned.
+//
+func (ix *Index) Definition(pos token.Pos) *ast.Ident {
+	ident := ix.IdentAt(pos)
+	if ident == nil {
+		return nil
+	}
+	obj := ix.ObjectOf(ident)
+	if obj == nil {
+		return nil
+	}
+	return ix.declIdent(obj)
+}
+
+// declIdent returns the identifier declaring obj.
+func (ix *Index) declIdent(obj *ast.Object) *ast.Ident {
+	dpos := obj.Pos()
+	if !dpos.IsValid() {
+		return nil
+	}
+	for _, ident := range ix.refs[obj] {
+		if ident.Pos() == dpos {
+			return ident
+		}
+	}
+	return nil
+}
+
+// References returns all identifiers in the indexed files denoting obj,
+// including the declaring identifier, in source order.
+//
+func (ix *Index) References(obj *ast.Object) []*ast.Ident {
+	return ix.refs[obj]
+}
+
+// ReferencesAt is like References for the object denoted by the
+// identifier at pos.
+//
+func (ix *Index) ReferencesAt(pos token.Pos) []*ast.Ident {
+	if ident := ix.IdentAt(pos); ident != nil {
+		if obj := ix.ObjectOf(ident); obj != nil {
+			return ix.References(obj)
+		}
+	}
+	return nil
+}
+
+// BranchTarget returns the statement a break, continue or goto
+// statement transfers control to. For labeled branches, the labeled
+// statement is returned. For unlabeled break and continue statements,
+// the innermost enclosing for, range, switch, type switch or select
+// statement (for only, in the case of continue) is returned. The result
+// is nil if the target cannot be determined.
+//
+func (ix *Index) BranchTarget(branch *ast.BranchStmt) ast.Stmt {
+	if branch.Label != nil {
+		if obj := branch.Label.Obj; obj != nil {
+			if stmt, ok := obj.Decl.(*ast.LabeledStmt); ok {
+				return stmt
+			}
+		}
+		return nil
+	}
+	if branch.Tok != token.BREAK && branch.Tok != token.CONTINUE {
+		return nil
+	}
+	f := ix.File(branch.Pos())
+	if f == nil {
+		return nil
+	}
+	path := pathEnclosing(f, branch.Pos())
+	for i := len(path) - 1; i >= 0; i-- {
+		switch n := path[i].(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+			return n.(ast.Stmt)
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			if branch.Tok == token.BREAK {
+				return n.(ast.Stmt)
+			}
+		case *ast.FuncLit, *ast.FuncDecl:
+			// branches don't cross function boundaries
+			return nil
+		}
+	}
+	return nil
+}
+
+// pathEnclosing returns the list of nodes enclosing pos, starting
+// with the root node.
+//
+func pathEnclosing(root ast.Node, pos token.Pos) []ast.Node {
+	var path []ast.Node
+	ast.Inspect(root, func(n ast.Node) bool {
+		if n == nil || pos < n.Pos() || n.End() <= pos {
+			return false
+		}
+		path = append(path, n)
+		return true
+	})
+	return path
+}
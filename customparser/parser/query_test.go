@@ -0,0 +1,199 @@
+package parser
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+const querySrc0 = `package p
+
+var global = 1
+
+func f(x int) int {
+	y := x + global
+	return helper(y)
+}
+
+func g() {
+outer:
+	for i := 0; i < 10; i++ {
+		switch i {
+		case 1:
+			break
+		case 2:
+			continue outer
+		}
+		for range []int{} {
+			break outer
+		}
+	}
+	goto outer
+}
+`
+
+const querySrc1 = `package p
+
+func helper(v int) int { return v + global }
+`
+
+// posOf returns the position of the n'th occurrence (starting at 0)
+// of s in the file src parsed as file.
+func posOf(t *testing.T, fset *token.FileSet, file *ast.File, src, s string, n int) token.Pos {
+	offs := -1
+	for i := 0; i <= n; i++ {
+		j := strings.Index(src[offs+1:], s)
+		if j < 0 {
+			t.Fatalf("occurrence %d of %q not found", n, s)
+		}
+		offs += j + 1
+	}
+	return fset.File(file.Pos()).Pos(offs)
+}
+
+func parseQueryFiles(t *testing.T) (*token.FileSet, *ast.File, *ast.File) {
+	fset := token.NewFileSet()
+	f0, err := ParseFile(fset, "f0.go", querySrc0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f1, err := ParseFile(fset, "f1.go", querySrc1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fset, f0, f1
+}
+
+func TestDefinition(t *testing.T) {
+	fset, f0, f1 := parseQueryFiles(t)
+	ix := NewIndex(fset, f0, f1)
+
+	for _, test := range []struct {
+		file     *ast.File
+		src, s   string
+		n        int
+		defFile  *ast.File
+		defSrc   string
+		defN     int // occurrence of s in defSrc; -1 if no definition
+		wantName string
+	}{
+		{f0, querySrc0, "x", 1, f0, querySrc0, 0, "x"},           // parameter
+		{f0, querySrc0, "y", 1, f0, querySrc0, 0, "y"},           // short variable
+		{f0, querySrc0, "global", 1, f0, querySrc0, 0, "global"}, // package-level, same file
+		{f0, querySrc0, "helper", 0, f1, querySrc1, 0, "helper"}, // package-level, other file
+		{f1, querySrc1, "global", 0, f0, querySrc0, 0, "global"}, // package-level, other file
+		{f0, querySrc0, "outer", 1, f0, querySrc0, 0, "outer"},   // label
+		{f0, querySrc0, "int", 0, nil, "", -1, ""},               // predeclared
+		{f0, querySrc0, "global", 0, f0, querySrc0, 0, "global"}, // declaration itself
+		{f0, querySrc0, "return", 0, nil, "", -1, ""},            // not an identifier
+		{f0, querySrc0, "f(", 0, f0, querySrc0, 0, "f"},          // function
+	} {
+		pos := posOf(t, fset, test.file, test.src, test.s, test.n)
+		def := ix.Definition(pos)
+		if test.defN < 0 {
+			if def != nil {
+				t.Errorf("%s: got definition %s; want none", fset.Position(pos), def.Name)
+			}
+			continue
+		}
+		if def == nil {
+			t.Errorf("%s: no definition found for %s", fset.Position(pos), test.s)
+			continue
+		}
+		want := posOf(t, fset, test.defFile, test.defSrc, test.s, test.defN)
+		if def.Pos() != want || def.Name != test.wantName {
+			t.Errorf("%s: got definition %s at %s; want %s", fset.Position(pos), def.Name, fset.Position(def.Pos()), fset.Position(want))
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	fset, f0, f1 := parseQueryFiles(t)
+	ix := NewIndex(fset, f0, f1)
+
+	for _, test := range []struct {
+		file *ast.File
+		src  string
+		s    string // text starting with the identifier
+		want int
+	}{
+		{f0, querySrc0, "global =", 3},
+		{f1, querySrc1, "helper(", 2},
+		{f0, querySrc0, "outer:", 4},
+		{f1, querySrc1, "v int", 2},
+		{f0, querySrc0, "i :=", 4},
+	} {
+		name := test.s[:strings.IndexAny(test.s, " (:")]
+		refs := ix.ReferencesAt(posOf(t, fset, test.file, test.src, test.s, 0))
+		if len(refs) != test.want {
+			t.Errorf("%s: got %d references; want %d", name, len(refs), test.want)
+		}
+		for i, ref := range refs {
+			if ref.Name != name {
+				t.Errorf("%s: got reference to %s", name, ref.Name)
+			}
+			if i > 0 && fset.File(refs[i-1].Pos()) == fset.File(ref.Pos()) && refs[i-1].Pos() >= ref.Pos() {
+				t.Errorf("%s: references not sorted", name)
+			}
+		}
+	}
+}
+
+func TestBranchTarget(t *testing.T) {
+	fset, f0, f1 := parseQueryFiles(t)
+	ix := NewIndex(fset, f0, f1)
+
+	var branches []*ast.BranchStmt
+	ast.Inspect(f0, func(n ast.Node) bool {
+		if b, ok := n.(*ast.BranchStmt); ok {
+			branches = append(branches, b)
+		}
+		return true
+	})
+	if len(branches) != 4 {
+		t.Fatalf("got %d branch statements; want 4", len(branches))
+	}
+
+	want := []string{"*ast.SwitchStmt", "*ast.LabeledStmt", "*ast.LabeledStmt", "*ast.LabeledStmt"}
+	for i, b := range branches {
+		target := ix.BranchTarget(b)
+		if got := fmt.Sprintf("%T", target); got != want[i] {
+			t.Errorf("%s: got target %s; want %s", fset.Position(b.Pos()), got, want[i])
+		}
+	}
+}
+
+func TestPackageIndex(t *testing.T) {
+	fset := token.NewFileSet()
+	pkgs, err := ParseDir(fset, ".", dirFilter, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix := NewPackageIndex(fset, pkgs["parser"])
+
+	// ParseFile is declared in interface.go and used in parser_test.go
+	var use *ast.Ident
+	for name, f := range pkgs["parser"].Files {
+		if !strings.HasSuffix(name, "parser_test.go") {
+			continue
+		}
+		for _, ident := range f.Unresolved {
+			if ident.Name == "ParseFile" {
+				use = ident
+				break
+			}
+		}
+	}
+	if use == nil {
+		t.Fatal("no use of ParseFile found")
+	}
+	def := ix.Definition(use.Pos())
+	if def == nil {
+		t.Fatal("no definition found for ParseFile")
+	}
+	if pos := fset.Position(def.Pos()); !strings.HasSuffix(pos.Filename, "interface.go") {
+		t.Errorf("ParseFile defined at %s; want interface.go", pos)
+	}
+}
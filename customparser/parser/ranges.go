@@ -0,0 +1,202 @@
+// This file implements the computation of structural source ranges
+// (folding ranges and selection ranges) from the positions recorded
+// in the AST.
+
+package parser
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+// A Range is a half-open interval [Pos, End) of source positions.
+type Range struct {
+	Pos, End token.Pos
+}
+
+// Contains reports whether pos lies within r.
+func (r Range) Contains(pos token.Pos) bool {
+	return r.Pos <= pos && pos < r.End
+}
+
+func nodeRange(n ast.Node) Range {
+	return Range{n.Pos(), n.End()}
+}
+
+// A FoldingKind describes the kind of a folding range.
+type FoldingKind int
+
+const (
+	FoldRegion  FoldingKind = iota // block, literal, list or declaration group
+	FoldImports                    // import declaration group
+	FoldComment                    // comment group
+)
+
+// A FoldingRange is a foldable region of a file. Pos and End are the
+// positions of the opening and closing delimiters (or the start and end
+// of a comment group); only the text between them is meant to be hidden.
+//
+type FoldingRange struct {
+	Kind     FoldingKind
+	Pos, End token.Pos
+}
+
+// FoldingRanges returns the foldable regions of f spanning more than one
+// line, ordered by start position: parenthesized declaration groups
+// (including import blocks), function bodies and other blocks, case
+// clauses, composite literals, struct and interface types, parameter
+// and argument lists, and comment groups. Regions with missing
+// delimiters, as produced by error recovery, are skipped.
+//
+func FoldingRanges(fset *token.FileSet, f *ast.File) []FoldingRange {
+	var ranges []FoldingRange
+	add := func(kind FoldingKind, pos, end token.Pos) {
+		if !pos.IsValid() || !end.IsValid() || end <= pos {
+			return
+		}
+		if fset.Position(pos).Line < fset.Position(end).Line {
+			ranges = append(ranges, FoldingRange{kind, pos, end})
+		}
+	}
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.GenDecl:
+			kind := FoldRegion
+			if n.Tok == token.IMPORT {
+				kind = FoldImports
+			}
+			add(kind, n.Lparen, n.Rparen)
+		case *ast.BlockStmt:
+			add(FoldRegion, n.Lbrace, n.Rbrace)
+		case *ast.CaseClause:
+			if len(n.Body) > 0 {
+				add(FoldRegion, n.Colon, n.Body[len(n.Body)-1].End())
+			}
+		case *ast.CommClause:
+			if len(n.Body) > 0 {
+				add(FoldRegion, n.Colon, n.Body[len(n.Body)-1].End())
+			}
+		case *ast.CompositeLit:
+			add(FoldRegion, n.Lbrace, n.Rbrace)
+		case *ast.FieldList:
+			add(FoldRegion, n.Opening, n.Closing)
+		case *ast.CallExpr:
+			add(FoldRegion, n.Lparen, n.Rparen)
+		}
+		return true
+	})
+	for _, g := range f.Comments {
+		add(FoldComment, g.Pos(), g.End())
+	}
+
+	sort.Stable(byStart(ranges))
+	return ranges
+}
+
+type byStart []FoldingRange
+
+func (a byStart) Len() int           { return len(a) }
+func (a byStart) Less(i, j int) bool { return a[i].Pos < a[j].Pos }
+func (a byStart) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// SelectionRanges returns the chain of syntactic ranges containing pos,
+// innermost first, as used to expand a selection step by step. The chain
+// consists of the ranges of the AST nodes enclosing pos and, for blocks,
+// composite literals and calls, the range of their statements, elements
+// or arguments. A comment group containing pos contributes the comment
+// and the group. Each range appears only once, and ranges are clipped
+// to the extent of the file (the end positions of nodes with missing
+// closing delimiters may be past the end of the file). The result is
+// empty if pos is not within f.
+//
+// Unlike for Range.Contains, the end of a range is within it, so that a
+// cursor right after an identifier selects the identifier. Of two
+// adjacent nodes, the one starting at pos is preferred.
+//
+func SelectionRanges(fset *token.FileSet, f *ast.File, pos token.Pos) []Range {
+	file := fset.File(f.Pos())
+	if file == nil {
+		return nil
+	}
+	eof := token.Pos(file.Base() + file.Size())
+
+	within := func(r Range) bool {
+		return r.Pos <= pos && pos <= r.End
+	}
+	var chain []Range // outermost first
+	push := func(r Range) {
+		if r.End > eof {
+			r.End = eof
+		}
+		if !within(r) {
+			return
+		}
+		for _, c := range chain {
+			if c == r {
+				return
+			}
+		}
+		chain = append(chain, r)
+	}
+
+	var visit func(n ast.Node)
+	visit = func(n ast.Node) {
+		push(nodeRange(n))
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			if len(n.List) > 0 {
+				push(Range{n.List[0].Pos(), n.List[len(n.List)-1].End()})
+			}
+		case *ast.CompositeLit:
+			if len(n.Elts) > 0 {
+				push(Range{n.Elts[0].Pos(), n.Elts[len(n.Elts)-1].End()})
+			}
+		case *ast.CallExpr:
+			if len(n.Args) > 0 {
+				push(Range{n.Args[0].Pos(), n.Args[len(n.Args)-1].End()})
+			}
+		}
+
+		// descend into the (first) child containing pos, or else
+		// ending at pos
+		var child, before ast.Node
+		ast.Inspect(n, func(c ast.Node) bool {
+			if c == n {
+				return true
+			}
+			if c == nil {
+				return false
+			}
+			if r := nodeRange(c); child == nil && r.Contains(pos) {
+				child = c
+			} else if before == nil && r.End == pos {
+				before = c
+			}
+			return false
+		})
+		if child == nil {
+			child = before
+		}
+		if child != nil {
+			visit(child)
+		}
+	}
+	visit(f)
+
+	for _, g := range f.Comments {
+		if within(nodeRange(g)) {
+			push(nodeRange(g))
+			for _, c := range g.List {
+				push(nodeRange(c))
+			}
+		}
+	}
+
+	// reverse to innermost first
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain
+}
@@ -0,0 +1,215 @@
+package parser
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const rangesSrc = `package p
+
+import (
+	"fmt"
+	"os"
+)
+
+/*
+Block comment.
+*/
+
+type T struct {
+	x int
+}
+
+func f(
+	a int,
+) {
+	v := []int{
+		1,
+	}
+	switch {
+	case true:
+		fmt.Println(
+			v, a)
+		os.Exit(0)
+	}
+}
+`
+
+func foldingString(fset *token.FileSet, ranges []FoldingRange) string {
+	var list []string
+	for _, r := range ranges {
+		kind := ""
+		switch r.Kind {
+		case FoldImports:
+			kind = "imports"
+		case FoldComment:
+			kind = "comment"
+		}
+		list = append(list, fmt.Sprintf("%d-%d%s", fset.Position(r.Pos).Line, fset.Position(r.End).Line, kind))
+	}
+	return strings.Join(list, " ")
+}
+
+func TestFoldingRanges(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "", rangesSrc, ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := foldingString(fset, FoldingRanges(fset, f))
+	want := "3-6imports 8-10comment 12-14 16-18 18-28 19-21 22-27 23-26 24-25"
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestSelectionRanges(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "", rangesSrc, ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := fset.File(f.Pos())
+	text := func(r Range) string {
+		return rangesSrc[file.Offset(r.Pos):file.Offset(r.End)]
+	}
+
+	// selection chain starting at "a" in "v, a)"
+	offs := strings.Index(rangesSrc, "v, a)") + 3
+	var got []string
+	for _, r := range SelectionRanges(fset, f, file.Pos(offs)) {
+		s := text(r)
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			s = s[:i] + "..."
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		"a",
+		"v, a",            // arguments
+		"fmt.Println(...", // call
+		"case true:...",   // case clause
+		"{...",            // switch body
+		"switch {...",
+		"v := []int{...", // statement list of the function body
+		"{...",           // function body
+		"func f(...",
+		"package p...",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got\n\t%q\nwant\n\t%q", got, want)
+	}
+
+	// a cursor right after "a" selects it too
+	if after := SelectionRanges(fset, f, file.Pos(offs+1)); len(after) == 0 || text(after[0]) != "a" || len(after) != len(want) {
+		var got []string
+		for _, r := range after {
+			got = append(got, text(r))
+		}
+		t.Errorf("after \"a\": got %q; want the chain of \"a\"", got)
+	}
+
+	offs = strings.Index(rangesSrc, "fmt.Println") + len("fmt")
+	if rs := SelectionRanges(fset, f, file.Pos(offs)); len(rs) < 2 || text(rs[0]) != "fmt" || text(rs[1]) != "fmt.Println" {
+		t.Errorf("after \"fmt\": got %d ranges; want fmt and fmt.Println first", len(rs))
+	}
+
+	// of two adjacent nodes, the one starting at the cursor is selected
+	src := "package p; var x = -y"
+	fset2 := token.NewFileSet()
+	f2, err := ParseFile(fset2, "", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := SelectionRanges(fset2, f2, fset2.File(f2.Pos()).Pos(strings.Index(src, "y")))
+	if len(rs) == 0 || rs[0] != (Range{f2.Pos() + token.Pos(strings.Index(src, "y")), f2.Pos() + token.Pos(len(src))}) {
+		t.Errorf("before \"y\": got %v; want y first", rs)
+	}
+
+	// inside a comment
+	offs = strings.Index(rangesSrc, "Block comment")
+	rs = SelectionRanges(fset, f, file.Pos(offs))
+	if len(rs) != 2 || !strings.HasPrefix(text(rs[0]), "/*") || !strings.HasPrefix(text(rs[1]), "package p") {
+		t.Errorf("got %d ranges in comment; want comment and file", len(rs))
+	}
+
+	// the chain is strictly nested
+	for offs := 0; offs < len(rangesSrc); offs++ {
+		rs := SelectionRanges(fset, f, file.Pos(offs))
+		for i := 1; i < len(rs); i++ {
+			if rs[i].Pos > rs[i-1].Pos || rs[i].End < rs[i-1].End || rs[i] == rs[i-1] {
+				t.Fatalf("offset %d: ranges %v and %v not nested", offs, rs[i-1], rs[i])
+			}
+		}
+	}
+}
+
+// checkRanges verifies that the folding and selection ranges computed for
+// f are well-formed.
+func checkRanges(t *testing.T, fset *token.FileSet, f *ast.File, filename string) {
+	file := fset.File(f.Pos())
+	if file == nil {
+		return
+	}
+	valid := func(pos token.Pos) bool {
+		return file.Base() <= int(pos) && int(pos) <= file.Base()+file.Size()
+	}
+
+	prev := token.NoPos
+	for _, r := range FoldingRanges(fset, f) {
+		if !valid(r.Pos) || !valid(r.End) || r.End <= r.Pos || r.Pos < prev {
+			t.Errorf("%s: invalid folding range %v", filename, r)
+		}
+		prev = r.Pos
+	}
+	for offs := 0; offs < file.Size(); offs++ {
+		rs := SelectionRanges(fset, f, file.Pos(offs))
+		for i, r := range rs {
+			if pos := file.Pos(offs); !valid(r.Pos) || !valid(r.End) || pos < r.Pos || pos > r.End {
+				t.Errorf("%s: offset %d: invalid selection range %v", filename, offs, r)
+			}
+			if i > 0 && (r.Pos > rs[i-1].Pos || r.End < rs[i-1].End) {
+				t.Errorf("%s: offset %d: ranges %v and %v not nested", filename, offs, rs[i-1], r)
+			}
+		}
+	}
+}
+
+func TestRangesTestdata(t *testing.T) {
+	list, err := ioutil.ReadDir(testdata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range list {
+		if !strings.HasSuffix(fi.Name(), ".src") {
+			continue
+		}
+		filename := filepath.Join(testdata, fi.Name())
+		fset := token.NewFileSet()
+		f, _ := ParseFile(fset, filename, nil, AllErrors|ParseComments)
+		checkRanges(t, fset, f, filename)
+	}
+}
+
+func TestRangesBroken(t *testing.T) {
+	for _, src := range []string{
+		"package p; func f() {",
+		"package p; func f() { x := []int{1, 2",
+		"package p; import (\n\"fmt\"\n",
+		"package p; type T struct {\n\tx int\n",
+		"package p; func f() {\n\tswitch {\n\tcase 1:\n\t\tg(\n\t}\n}",
+		rangesSrc[:len(rangesSrc)/2],
+	} {
+		fset := token.NewFileSet()
+		f, err := ParseFile(fset, "", src, AllErrors|ParseComments)
+		if err == nil {
+			t.Errorf("%q: expected syntax errors", src)
+		}
+		checkRanges(t, fset, f, fmt.Sprintf("%q", src))
+	}
+}
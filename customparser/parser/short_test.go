@@ -6,7 +6,13 @@
 
 package parser
 
-import "testing"
+import (
+	"flag"
+	"fmt"
+	"go/token"
+	"os"
+	"testing"
+)
 
 var valids = []string{
 	"package p\n",
@@ -132,3 +138,88 @@ func TestInvalid(t *testing.T) {
 		checkErrors(t, src, src)
 	}
 }
+
+var grammarCoverage = flag.Bool("grammar-coverage", false, "print the grammar coverage of the valids and invalids tests")
+
+// TestGrammarCoverage prints the productions and error call sites of the
+// parser that are not exercised by valids and invalids.
+func TestGrammarCoverage(t *testing.T) {
+	if !*grammarCoverage {
+		t.Skip("run with -grammar-coverage to print the grammar coverage")
+	}
+	var cov Coverage
+	conf := &Config{Mode: DeclarationErrors | AllErrors, Coverage: &cov}
+	for _, src := range append(valids[:len(valids):len(valids)], invalids...) {
+		conf.ParseFile(token.NewFileSet(), "", src)
+	}
+	if err := cov.WriteReport(os.Stdout); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// versioned lists programs valid as of a Go language version, with the
+// errors reported when parsing them as source of the previous version.
+var versioned = []struct {
+	version string
+	src     string
+}{
+	{"go1.2", `package p; func f() { var s []int; _ = s[i:j: /* ERROR "full slice expression requires go1.2 or later" */ k] };`},
+	{"go1.4", `package p; func _(x []int) { for range /* ERROR "range clause without variables requires go1.4 or later" */ x {} }`},
+	{"go1.13", `package p; const _ = 0b1010 /* ERROR "binary literal requires go1.13 or later" */`},
+	{"go1.13", `package p; const _ = 0O17 /* ERROR "0o/0O-style octal literal requires go1.13 or later" */`},
+	{"go1.13", `package p; const _ = 0x1p-2 /* ERROR "hexadecimal floating-point literal requires go1.13 or later" */`},
+	{"go1.13", `package p; const _ = 0x1i /* ERROR "hexadecimal imaginary literal requires go1.13 or later" */`},
+	{"go1.13", `package p; const _ = 1_000_000 /* ERROR "'_' separator in number literal requires go1.13 or later" */`},
+}
+
+func TestVersioned(t *testing.T) {
+	for _, test := range versioned {
+		minor, err := parseLanguageVersion(test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prev := fmt.Sprintf("go1.%d", minor-1)
+		checkConfigErrors(t, &Config{Mode: DeclarationErrors | AllErrors, LanguageVersion: prev}, test.src, test.src)
+
+		// valid as of the version, and without version
+		for _, version := range []string{test.version, ""} {
+			conf := Config{LanguageVersion: version}
+			if _, err := conf.ParseFile(token.NewFileSet(), "", test.src); err != nil {
+				t.Errorf("%s (version %q): %v", test.src, version, err)
+			}
+		}
+	}
+}
+
+func TestLanguageVersion(t *testing.T) {
+	for _, test := range []struct {
+		version string
+		minor   int
+	}{
+		{"", 0},
+		{"go1.0", -1},
+		{"go1.12", 12},
+		{"1.12", 12},
+		{"1.12.3", 12},
+		{"go1.21rc1", 21},
+		{"go1", -2},
+		{"go2.1", -2},
+		{"1.x", -2},
+		{"1.12-x", -2},
+		{"12", -2},
+	} {
+		minor, err := parseLanguageVersion(test.version)
+		if test.minor == -2 {
+			if err == nil {
+				t.Errorf("parseLanguageVersion(%q): expected error", test.version)
+			}
+		} else if err != nil || minor != test.minor {
+			t.Errorf("parseLanguageVersion(%q) = %d, %v; want %d", test.version, minor, err, test.minor)
+		}
+	}
+
+	conf := Config{LanguageVersion: "1.x"}
+	if f, err := conf.ParseFile(token.NewFileSet(), "", "package p"); f != nil || err == nil {
+		t.Errorf("got %v, %v for invalid language version", f, err)
+	}
+}
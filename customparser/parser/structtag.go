@@ -0,0 +1,170 @@
+// This file implements the ParseStructTags pass: the tags of struct
+// fields are parsed into key:"value" pairs, following the conventions of
+// reflect.StructTag, and malformed tags are reported at the offending
+// offset within the tag literal.
+
+package parser
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// A StructTag is a parsed struct field tag.
+//
+type StructTag struct {
+	Lit    *ast.BasicLit     // tag literal
+	Fields []*StructTagField // key:"value" pairs, in source order
+}
+
+// Lookup returns the value associated with key in the tag, if any, like
+// reflect.StructTag.Lookup.
+//
+func (tag *StructTag) Lookup(key string) (value string, ok bool) {
+	for _, f := range tag.Fields {
+		if f.Key == key {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+// A StructTagField is a key:"value" pair of a struct tag.
+//
+type StructTagField struct {
+	KeyPos   token.Pos // position of the key
+	Key      string
+	ValuePos token.Pos // position of the quoted value
+	Value    string    // value, unquoted
+}
+
+// knownTagOptions lists the options accepted after the name of tags
+// whose values are of the form "name,opt1,opt2".
+var knownTagOptions = map[string]map[string]bool{
+	"json": {"omitempty": true, "omitzero": true, "string": true},
+	"xml":  {"attr": true, "cdata": true, "chardata": true, "innerxml": true, "comment": true, "any": true, "omitempty": true},
+}
+
+// checkStructTags parses the field tags of the struct types in f,
+// records them in info (if not nil), and reports malformed tags.
+//
+func (p *parser) checkStructTags(f *ast.File, info *Info) {
+	ast.Inspect(f, func(n ast.Node) bool {
+		if st, ok := n.(*ast.StructType); ok && st.Fields != nil {
+			for _, field := range st.Fields.List {
+				if field.Tag == nil || field.Tag.Kind != token.STRING {
+					continue
+				}
+				tag := p.parseStructTag(field.Tag)
+				if tag != nil && info != nil {
+					if info.Tags == nil {
+						info.Tags = make(map[*ast.BasicLit]*StructTag)
+					}
+					info.Tags[field.Tag] = tag
+				}
+			}
+		}
+		return true
+	})
+}
+
+// parseStructTag parses the tag literal lit. It returns nil if lit is
+// not a valid string literal, which the scanner reported already. The
+// pairs before the first syntax error are kept.
+//
+func (p *parser) parseStructTag(lit *ast.BasicLit) *StructTag {
+	text, offsets, err := unquoteOffsets(lit.Value)
+	if err != nil {
+		return nil
+	}
+	tag := &StructTag{Lit: lit}
+	pos := func(i int) token.Pos { return lit.ValuePos + token.Pos(offsets[i]) }
+	seen := make(map[string]bool)
+
+	i := 0
+	for {
+		// skip leading space
+		for i < len(text) && text[i] == ' ' {
+			i++
+		}
+		if i == len(text) {
+			break
+		}
+		if i > 0 && text[i-1] != ' ' {
+			p.error(pos(i), MsgTagNotSeparated)
+			break
+		}
+
+		// scan to colon; a space, a quote or a control character is
+		// a syntax error
+		start := i
+		for i < len(text) && text[i] > ' ' && text[i] != ':' && text[i] != '"' && text[i] != 0x7f {
+			i++
+		}
+		if i == start || i+1 >= len(text) || text[i] != ':' || text[i+1] != '"' {
+			if i == start {
+				p.error(pos(i), MsgTagKeySyntax)
+			} else {
+				p.error(pos(i), MsgTagPairSyntax)
+			}
+			break
+		}
+		key := text[start:i]
+		i++
+
+		// scan quoted string to find value
+		vstart := i
+		i++
+		for i < len(text) && text[i] != '"' {
+			if text[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(text) {
+			p.error(pos(vstart), MsgTagValueUnclosed)
+			break
+		}
+		i++
+		value, err := strconv.Unquote(text[vstart:i])
+		if err != nil {
+			p.error(pos(vstart), MsgTagValueSyntax)
+			break
+		}
+
+		if seen[key] {
+			p.error(pos(start), MsgTagDuplicateKey, key)
+		}
+		seen[key] = true
+		if opts := knownTagOptions[key]; opts != nil && !strings.ContainsRune(text[vstart:i], '\\') {
+			// value offsets are only known for values without escapes
+			p.checkTagOptions(key, value, opts, func(offs int) token.Pos { return pos(vstart + 1 + offs) })
+		}
+		tag.Fields = append(tag.Fields, &StructTagField{
+			KeyPos:   pos(start),
+			Key:      key,
+			ValuePos: pos(vstart),
+			Value:    value,
+		})
+	}
+	return tag
+}
+
+// checkTagOptions reports the unknown options of the tag value
+// "name,opt1,opt2" of the given key. The position of the byte at offset
+// offs in value is pos(offs).
+//
+func (p *parser) checkTagOptions(key, value string, opts map[string]bool, pos func(offs int) token.Pos) {
+	offs := strings.IndexByte(value, ',')
+	if offs < 0 {
+		return
+	}
+	for _, opt := range strings.Split(value[offs+1:], ",") {
+		if opt != "" && !opts[opt] {
+			p.error(pos(offs+1), MsgTagUnknownOption, key, opt)
+		}
+		offs += len(opt) + 1
+	}
+}
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+// structTagSrc uses ´ for backquotes.
+var structTagSrc = strings.Replace(`package p
+
+type T struct {
+	Name  string ´protobuf:"bytes,1,opt,name=name" json:"name,omitempty"´
+	A     int    ´json:"a,omitempty,bogus" xml:"a,attr"´
+	B     int    ´json:"b" json:"c"´
+	C     int    ´json:"c"xml:"c"´
+	D     int    ´json:c´
+	E     int    ´json:"e´
+	F     int    "json:\"f,strnig\""
+	G     int    ´ :"g"´
+	H, I  int    ´json:"-,"´
+	J     struct {
+		K int ´json:",string"´
+	}
+}
+`, "´", "`", -1)
+
+func TestParseStructTags(t *testing.T) {
+	fset := token.NewFileSet()
+	info := &Info{}
+	conf := Config{Mode: ParseStructTags | AllErrors, Info: info}
+	f, err := conf.ParseFile(fset, "p.go", structTagSrc)
+	list, ok := err.(scanner.ErrorList)
+	if !ok {
+		t.Fatalf("got %v; want errors", err)
+	}
+	want := []string{
+		`p.go:5:34: unknown json option "bogus"`,
+		`p.go:6:25: struct tag has duplicate key "json"`,
+		`p.go:7:24: struct tag pairs not separated by spaces`,
+		`p.go:8:20: bad syntax for struct tag pair`,
+		`p.go:9:21: bad syntax for struct tag value: missing closing quote`,
+		`p.go:10:25: unknown json option "strnig"`,
+		`p.go:11:17: bad syntax for struct tag key`,
+	}
+	var got []string
+	for _, err := range list {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got errors\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	fields := f.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec).Type.(*ast.StructType).Fields.List
+	if len(info.Tags) != 10 {
+		t.Errorf("got %d tags; want 10", len(info.Tags))
+	}
+	tag := info.Tags[fields[0].Tag]
+	if tag == nil || len(tag.Fields) != 2 {
+		t.Fatalf("got %+v; want 2 fields", tag)
+	}
+	if v, ok := tag.Lookup("protobuf"); !ok || v != "bytes,1,opt,name=name" {
+		t.Errorf(`Lookup("protobuf") = %q, %v`, v, ok)
+	}
+	if v, ok := tag.Lookup("xml"); ok {
+		t.Errorf(`Lookup("xml") = %q, %v; want none`, v, ok)
+	}
+	if got := fset.Position(tag.Fields[1].KeyPos).String(); got != "p.go:4:49" {
+		t.Errorf("got key position %s; want p.go:4:49", got)
+	}
+	if got := fset.Position(tag.Fields[1].ValuePos).String(); got != "p.go:4:54" {
+		t.Errorf("got value position %s; want p.go:4:54", got)
+	}
+
+	// the pairs before a syntax error are kept
+	if tag := info.Tags[fields[3].Tag]; len(tag.Fields) != 1 || tag.Fields[0].Value != "c" {
+		t.Errorf("got %+v; want the json pair", tag)
+	}
+	if tag := info.Tags[fields[6].Tag]; len(tag.Fields) != 1 || tag.Fields[0].Value != `f,strnig` {
+		t.Errorf("got %+v; want the json pair", tag)
+	}
+
+	// without the mode, tags are not checked
+	if _, err := ParseFile(token.NewFileSet(), "p.go", structTagSrc, 0); err != nil {
+		t.Errorf("got %v without ParseStructTags", err)
+	}
+}
@@ -0,0 +1,233 @@
+// This file implements the extraction of a document outline from a
+// parsed file.
+
+package parser
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// A SymbolKind describes the kind of declaration a Symbol stands for.
+type SymbolKind int
+
+const (
+	BadSymbol       SymbolKind = iota
+	ConstSymbol                // constant
+	VarSymbol                  // variable
+	TypeSymbol                 // type other than struct or interface
+	StructSymbol               // struct type
+	InterfaceSymbol            // interface type
+	FuncSymbol                 // function
+	MethodSymbol               // method or interface method
+	FieldSymbol                // struct field, or embedded type
+)
+
+var symbolKindStrings = [...]string{
+	BadSymbol:       "bad",
+	ConstSymbol:     "const",
+	VarSymbol:       "var",
+	TypeSymbol:      "type",
+	StructSymbol:    "struct",
+	InterfaceSymbol: "interface",
+	FuncSymbol:      "func",
+	MethodSymbol:    "method",
+	FieldSymbol:     "field",
+}
+
+func (kind SymbolKind) String() string {
+	if 0 <= kind && int(kind) < len(symbolKindStrings) {
+		return symbolKindStrings[kind]
+	}
+	return "bad"
+}
+
+// A Symbol is an entry of a file outline.
+type Symbol struct {
+	Name     string
+	Kind     SymbolKind
+	Recv     string // receiver type of a method declaration, e.g. "*T"; or ""
+	Exported bool   // whether Name is exported
+	Doc      string // text of the associated doc comment; or ""
+
+	Pos, End         token.Pos // extent of the declaration
+	NamePos, NameEnd token.Pos // extent of the declared name
+
+	Children []*Symbol // fields and methods of types
+}
+
+// Symbols returns the outline of f: its constants, variables, types and
+// functions in source order. Struct fields and interface methods are
+// children of their type; methods are children of their receiver base
+// type if the type is declared in f, and top-level symbols otherwise.
+//
+// Symbols tolerates the partial ASTs produced for files with syntax
+// errors: erroneous declarations are skipped, and declarations whose
+// name is missing are reported with the name "_".
+//
+func Symbols(f *ast.File) []*Symbol {
+	var syms []*Symbol
+	types := make(map[string]*Symbol)
+	var methods []*Symbol
+
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Name == nil {
+				continue
+			}
+			sym := newSymbol(decl.Name, FuncSymbol, decl, decl.Doc)
+			if decl.Recv != nil {
+				sym.Kind = MethodSymbol
+				if len(decl.Recv.List) > 0 {
+					sym.Recv = recvString(decl.Recv.List[0].Type)
+				}
+				methods = append(methods, sym)
+			}
+			syms = append(syms, sym)
+
+		case *ast.GenDecl:
+			// the doc comment and extent of an ungrouped declaration
+			// belong to the declaration rather than its only spec
+			grouped := decl.Lparen.IsValid()
+			for _, spec := range decl.Specs {
+				var node ast.Node = spec
+				if !grouped {
+					node = decl
+				}
+				switch spec := spec.(type) {
+				case *ast.ValueSpec:
+					kind := VarSymbol
+					if decl.Tok == token.CONST {
+						kind = ConstSymbol
+					}
+					doc := spec.Doc
+					if !grouped && doc == nil {
+						doc = decl.Doc
+					}
+					for _, name := range spec.Names {
+						syms = append(syms, newSymbol(name, kind, node, doc))
+					}
+				case *ast.TypeSpec:
+					doc := spec.Doc
+					if !grouped && doc == nil {
+						doc = decl.Doc
+					}
+					sym := newSymbol(spec.Name, TypeSymbol, node, doc)
+					addTypeMembers(sym, spec.Type)
+					if _, dup := types[sym.Name]; !dup {
+						types[sym.Name] = sym
+					}
+					syms = append(syms, sym)
+				}
+			}
+		}
+	}
+
+	// move methods to their receiver base types
+	if len(methods) == 0 {
+		return syms
+	}
+	moved := make(map[*Symbol]bool)
+	for _, m := range methods {
+		if typ := types[baseTypeName(m.Recv)]; typ != nil {
+			typ.Children = append(typ.Children, m)
+			moved[m] = true
+		}
+	}
+	list := syms[:0]
+	for _, sym := range syms {
+		if !moved[sym] {
+			list = append(list, sym)
+		}
+	}
+	return list
+}
+
+func newSymbol(name *ast.Ident, kind SymbolKind, node ast.Node, doc *ast.CommentGroup) *Symbol {
+	sym := &Symbol{
+		Name:     name.Name,
+		Kind:     kind,
+		Exported: name.IsExported(),
+		Pos:      node.Pos(),
+		End:      node.End(),
+		NamePos:  name.Pos(),
+		NameEnd:  name.End(),
+	}
+	if doc != nil {
+		sym.Doc = doc.Text()
+	}
+	return sym
+}
+
+// addTypeMembers sets the kind of the type symbol sym according to its
+// type and adds struct fields or interface methods as children.
+func addTypeMembers(sym *Symbol, typ ast.Expr) {
+	var fields *ast.FieldList
+	switch t := typ.(type) {
+	case *ast.StructType:
+		sym.Kind, fields = StructSymbol, t.Fields
+	case *ast.InterfaceType:
+		sym.Kind, fields = InterfaceSymbol, t.Methods
+	}
+	if fields == nil {
+		return
+	}
+	for _, field := range fields.List {
+		kind := FieldSymbol
+		if _, isFunc := field.Type.(*ast.FuncType); isFunc {
+			kind = MethodSymbol
+		}
+		doc := field.Doc
+		if doc == nil {
+			doc = field.Comment
+		}
+		names := field.Names
+		if len(names) == 0 {
+			// embedded field or interface
+			if name := embeddedName(field.Type); name != nil {
+				names = []*ast.Ident{name}
+			}
+		}
+		for _, name := range names {
+			sym.Children = append(sym.Children, newSymbol(name, kind, field, doc))
+		}
+	}
+}
+
+// embeddedName returns the type name of an embedded field type.
+func embeddedName(x ast.Expr) *ast.Ident {
+	switch t := x.(type) {
+	case *ast.Ident:
+		return t
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel
+	}
+	return nil
+}
+
+// recvString returns the source form of a receiver type such as "*T".
+// Invalid receiver types are returned as "".
+func recvString(x ast.Expr) string {
+	switch t := x.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		if s := recvString(t.X); s != "" {
+			return "*" + s
+		}
+	case *ast.ParenExpr:
+		return recvString(t.X)
+	}
+	return ""
+}
+
+// baseTypeName returns the type name of a receiver type string.
+func baseTypeName(recv string) string {
+	for len(recv) > 0 && recv[0] == '*' {
+		recv = recv[1:]
+	}
+	return recv
+}
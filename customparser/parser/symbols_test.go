@@ -0,0 +1,153 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+// outline returns a textual representation of syms, one symbol per line.
+func outline(fset *token.FileSet, syms []*Symbol) string {
+	var buf bytes.Buffer
+	var print func(indent string, syms []*Symbol)
+	print = func(indent string, syms []*Symbol) {
+		for _, s := range syms {
+			name := s.Name
+			if s.Recv != "" {
+				name = "(" + s.Recv + ")." + name
+			}
+			fmt.Fprintf(&buf, "%s%s %s %d-%d", indent, s.Kind, name, fset.Position(s.Pos).Line, fset.Position(s.End).Line)
+			if s.Exported {
+				buf.WriteString(" exported")
+			}
+			if s.Doc != "" {
+				fmt.Fprintf(&buf, " %q", s.Doc)
+			}
+			buf.WriteByte('\n')
+			print(indent+"\t", s.Children)
+		}
+	}
+	print("", syms)
+	return buf.String()
+}
+
+func TestSymbols(t *testing.T) {
+	const src = `package p
+
+// Pi is a constant.
+const Pi = 3.14
+
+const (
+	// A is a.
+	A, b = 1, 2
+	c    = 3 // not a doc comment
+)
+
+var v int
+
+// T is a struct.
+type T struct {
+	// X is a field.
+	X, y int
+	// Embedded is embedded.
+	*Embedded
+}
+
+// M is a method.
+func (t *T) M() {}
+
+type (
+	I interface {
+		M()
+		fmt.Stringer
+	}
+	N int
+)
+
+func f() {}
+
+func (N) m() {}
+
+func (u U) m() {}
+`
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "", src, ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `const Pi 4-4 exported "Pi is a constant.\n"
+const A 8-8 exported "A is a.\n"
+const b 8-8 "A is a.\n"
+const c 9-9
+var v 12-12
+struct T 15-20 exported "T is a struct.\n"
+	field X 17-17 exported "X is a field.\n"
+	field y 17-17 "X is a field.\n"
+	field Embedded 19-19 exported "Embedded is embedded.\n"
+	method (*T).M 23-23 exported "M is a method.\n"
+interface I 26-29 exported
+	method M 27-27 exported
+	field Stringer 28-28 exported
+type N 30-30 exported
+	method (N).m 35-35
+func f 33-33
+method (U).m 37-37
+`
+	if got := outline(fset, Symbols(f)); got != want {
+		t.Errorf("got outline\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSymbolsRanges(t *testing.T) {
+	const src = "package p\n\nfunc (t *T) Method() {}\n"
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syms := Symbols(f)
+	if len(syms) != 1 {
+		t.Fatalf("got %d symbols; want 1", len(syms))
+	}
+	s := syms[0]
+	file := fset.File(f.Pos())
+	if got, want := src[file.Offset(s.Pos):file.Offset(s.End)], "func (t *T) Method() {}"; got != want {
+		t.Errorf("got range %q; want %q", got, want)
+	}
+	if got, want := src[file.Offset(s.NamePos):file.Offset(s.NameEnd)], "Method"; got != want {
+		t.Errorf("got selection range %q; want %q", got, want)
+	}
+}
+
+func TestSymbolsBroken(t *testing.T) {
+	const src = `package p
+
+type T struct {
+	x int
+	y
+}
+
+func f( {
+}
+
+var = 1
+
+func (*) g() {}
+
+const K = 1
+`
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "", src, AllErrors|ParseComments)
+	if err == nil {
+		t.Fatal("expected syntax errors")
+	}
+	got := outline(fset, Symbols(f))
+	// the declarations following the errors must still be found
+	for _, want := range []string{"struct T", "\tfield x", "func f", "const K"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("outline does not contain %q:\n%s", want, got)
+		}
+	}
+}
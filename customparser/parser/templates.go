@@ -0,0 +1,273 @@
+// This file implements the CheckTemplates pass: text/template and
+// html/template bodies found in a parsed file are parsed with
+// text/template/parse, and their syntax errors are reported at positions
+// within the Go source.
+
+package parser
+
+import (
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// checkTemplates parses the templates of the file f: string literals
+// passed to the Parse method of a template created by template.New, and
+// the .tmpl files embedded with //go:embed (relative to the directory of
+// filename). Embedded files are only found if comments are parsed.
+//
+func (p *parser) checkTemplates(f *ast.File, filename string) {
+	pkgs := templatePackages(f)
+	if len(pkgs) > 0 {
+		ast.Inspect(f, func(n ast.Node) bool {
+			if call, ok := n.(*ast.CallExpr); ok {
+				p.checkTemplateCall(call, pkgs)
+			}
+			return true
+		})
+	}
+	for _, d := range f.Decls {
+		if d, ok := d.(*ast.GenDecl); ok && d.Tok == token.VAR {
+			p.checkEmbeddedTemplates(d.Doc, filename)
+			for _, s := range d.Specs {
+				p.checkEmbeddedTemplates(s.(*ast.ValueSpec).Doc, filename)
+			}
+		}
+	}
+}
+
+// templatePackages returns the names under which the template packages
+// are imported by f.
+//
+func templatePackages(f *ast.File) map[string]bool {
+	pkgs := make(map[string]bool)
+	for _, spec := range f.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil || (path != "text/template" && path != "html/template") {
+			continue
+		}
+		name := "template"
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		pkgs[name] = true
+	}
+	return pkgs
+}
+
+// checkTemplateCall checks the template of call if it is of the form
+// template.New(...)....Parse(lit) with a string literal lit.
+//
+func (p *parser) checkTemplateCall(call *ast.CallExpr, pkgs map[string]bool) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Parse" || len(call.Args) != 1 {
+		return
+	}
+	lit, ok := call.Args[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return
+	}
+	var left, right string
+	if !templateChain(sel.X, pkgs, &left, &right) {
+		return
+	}
+	text, offsets, err := unquoteOffsets(lit.Value)
+	if err != nil {
+		return
+	}
+	if line, msg, ok := parseTemplate(text, left, right); !ok {
+		offs := offsets[lineStart(text, line)]
+		p.error(lit.ValuePos+token.Pos(offs), MsgTemplate, msg)
+	}
+}
+
+// templateChain reports whether x is a call of template.New, possibly
+// followed by calls of methods returning the template. The delimiters
+// set by the last call of Delims with literal arguments are stored in
+// left and right.
+//
+func templateChain(x ast.Expr, pkgs map[string]bool, left, right *string) bool {
+	call, ok := x.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	if id, ok := sel.X.(*ast.Ident); ok && id.Obj == nil && pkgs[id.Name] {
+		return sel.Sel.Name == "New"
+	}
+	switch sel.Sel.Name {
+	case "Delims":
+		if *left == "" && *right == "" && len(call.Args) == 2 {
+			l, lok := stringLit(call.Args[0])
+			r, rok := stringLit(call.Args[1])
+			if lok && rok {
+				*left, *right = l, r
+			}
+		}
+	case "Funcs", "Option", "New":
+	default:
+		return false
+	}
+	return templateChain(sel.X, pkgs, left, right)
+}
+
+func stringLit(x ast.Expr) (string, bool) {
+	if lit, ok := x.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+		s, err := strconv.Unquote(lit.Value)
+		return s, err == nil
+	}
+	return "", false
+}
+
+// checkEmbeddedTemplates checks the .tmpl files embedded by the
+// //go:embed directives of the comment group doc.
+//
+func (p *parser) checkEmbeddedTemplates(doc *ast.CommentGroup, filename string) {
+	if doc == nil {
+		return
+	}
+	dir := filepath.Dir(filename)
+	for _, c := range doc.List {
+		if !strings.HasPrefix(c.Text, "//go:embed ") {
+			continue
+		}
+		for _, pat := range embedPatterns(c.Text[len("//go:embed "):], len("//go:embed ")) {
+			matches, _ := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pat.pattern)))
+			for _, m := range matches {
+				if filepath.Ext(m) != ".tmpl" {
+					continue
+				}
+				data, err := ioutil.ReadFile(m)
+				if err != nil {
+					continue
+				}
+				if line, msg, ok := parseTemplate(string(data), "", ""); !ok {
+					rel, _ := filepath.Rel(dir, m)
+					p.error(c.Slash+token.Pos(pat.offset), MsgEmbeddedTemplate, filepath.ToSlash(rel), line, msg)
+				}
+			}
+		}
+	}
+}
+
+type embedPattern struct {
+	pattern string
+	offset  int // offset in the comment
+}
+
+// embedPatterns splits the arguments of a //go:embed directive, starting
+// at offset base in the comment, into patterns. Patterns may be quoted.
+//
+func embedPatterns(args string, base int) []embedPattern {
+	var list []embedPattern
+	i := 0
+	for {
+		for i < len(args) && (args[i] == ' ' || args[i] == '\t') {
+			i++
+		}
+		if i == len(args) {
+			return list
+		}
+		start := i
+		var pat string
+		if args[i] == '"' || args[i] == '`' {
+			q, err := strconv.QuotedPrefix(args[i:])
+			if err != nil {
+				return list
+			}
+			pat, _ = strconv.Unquote(q)
+			i += len(q)
+		} else {
+			for i < len(args) && args[i] != ' ' && args[i] != '\t' {
+				i++
+			}
+			pat = args[start:i]
+		}
+		list = append(list, embedPattern{pat, base + start})
+	}
+}
+
+var templateErrorRx = regexp.MustCompile(`^template: .*?:(\d+): (.*)$`)
+
+// parseTemplate parses the template text with the given delimiters
+// (defaults if empty). If the template is invalid, it returns the line
+// of the error within text (1-based) and the error message.
+//
+func parseTemplate(text, left, right string) (line int, msg string, ok bool) {
+	t := parse.New("")
+	t.Mode = parse.ParseComments | parse.SkipFuncCheck
+	_, err := t.Parse(text, left, right, make(map[string]*parse.Tree))
+	if err == nil {
+		return 0, "", true
+	}
+	msg = err.Error()
+	line = 1
+	if m := templateErrorRx.FindStringSubmatch(msg); m != nil {
+		line, _ = strconv.Atoi(m[1])
+		msg = m[2]
+	}
+	return line, msg, false
+}
+
+// lineStart returns the offset of the start of the given line in text.
+//
+func lineStart(text string, line int) int {
+	offs := 0
+	for ; line > 1; line-- {
+		i := strings.IndexByte(text[offs:], '\n')
+		if i < 0 {
+			break
+		}
+		offs += i + 1
+	}
+	return offs
+}
+
+// unquoteOffsets unquotes the Go string literal lit. It also returns the
+// offsets in lit of the bytes of the string, with an additional entry
+// for the end of the string.
+//
+func unquoteOffsets(lit string) (string, []int, error) {
+	if len(lit) < 2 {
+		return "", nil, strconv.ErrSyntax
+	}
+	var buf []byte
+	var offsets []int
+	if lit[0] == '`' {
+		// raw string: carriage returns are discarded
+		for i := 1; i < len(lit)-1; i++ {
+			if lit[i] != '\r' {
+				buf = append(buf, lit[i])
+				offsets = append(offsets, i)
+			}
+		}
+		return string(buf), append(offsets, len(lit)-1), nil
+	}
+	s := lit[1 : len(lit)-1]
+	for len(s) > 0 {
+		offs := len(lit) - 1 - len(s)
+		r, multibyte, tail, err := strconv.UnquoteChar(s, lit[0])
+		if err != nil {
+			return "", nil, err
+		}
+		n := len(buf)
+		if r < 0x80 || !multibyte {
+			buf = append(buf, byte(r))
+		} else {
+			buf = append(buf, string(r)...)
+		}
+		for ; n < len(buf); n++ {
+			offsets = append(offsets, offs)
+		}
+		s = tail
+	}
+	return string(buf), append(offsets, len(lit)-1), nil
+}
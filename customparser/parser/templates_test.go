@@ -0,0 +1,140 @@
+package parser
+
+import (
+	"go/scanner"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// templateSrc uses ´ for backquotes.
+var templateSrc = strings.Replace(`package p
+
+import (
+	"html/template"
+	tt "text/template"
+)
+
+var a = template.Must(template.New("a").Parse(´line 1
+	{{if .X}}
+{{.Y}´))
+
+var b, _ = tt.New("b").Funcs(nil).Delims("<<", ">>").Parse("ok {{ <<.X>> \n\t<<end>>")
+
+var c, _ = tt.New("c").Parse("é\t{{undefinedFunc .}} {{/* ok */}}")
+
+var d, _ = template.New("d").Parse("x{{")
+
+func f(t *template.Template) {
+	t.Parse("{{") // unknown receiver
+	template.New("e").Parse(´{{range}}´)
+}
+`, "´", "`", -1)
+
+func TestCheckTemplates(t *testing.T) {
+	fset := token.NewFileSet()
+	_, err := ParseFile(fset, "p.go", templateSrc, CheckTemplates|AllErrors)
+	list, ok := err.(scanner.ErrorList)
+	if !ok {
+		t.Fatalf("got %v; want errors", err)
+	}
+	want := []string{
+		`p.go:10:1: template: bad character U+007D '}'`,
+		`p.go:12:76: template: unexpected <<end>>`,
+		`p.go:16:37: template: unclosed action`,
+		`p.go:20:27: template: missing value for range`,
+	}
+	var got []string
+	for _, err := range list {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got errors\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// without the mode, only Go syntax is checked
+	if _, err := ParseFile(token.NewFileSet(), "p.go", templateSrc, 0); err != nil {
+		t.Errorf("got %v without CheckTemplates", err)
+	}
+}
+
+func TestCheckEmbeddedTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"ok.tmpl":        "{{.X}}\n",
+		"tmpl/bad.tmpl":  "line 1\n{{if}}\n",
+		"tmpl/other.txt": "{{",
+	}
+	for name, data := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(name), 0777)
+		if err := ioutil.WriteFile(name, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const src = `package p
+
+import "embed"
+
+//go:embed ok.tmpl "tmpl/*"
+var fs embed.FS
+
+var (
+	//go:embed tmpl/bad.tmpl
+	s string
+)
+`
+	filename := filepath.Join(dir, "p.go")
+	_, err = ParseFile(token.NewFileSet(), filename, src, CheckTemplates|ParseComments)
+	want := []string{
+		filename + `:5:20: template tmpl/bad.tmpl:2: missing value for if`,
+		filename + `:9:13: template tmpl/bad.tmpl:2: missing value for if`,
+	}
+	list, _ := err.(scanner.ErrorList)
+	var got []string
+	for _, err := range list {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got errors\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestUnquoteOffsets(t *testing.T) {
+	for _, test := range []struct {
+		lit     string
+		text    string
+		offsets []int
+	}{
+		{"``", "", []int{1}},
+		{"`a\r\nb`", "a\nb", []int{1, 3, 4, 5}},
+		{`"a\nb"`, "a\nb", []int{1, 2, 4, 5}},
+		{`"éx"`, "éx", []int{1, 1, 3, 4}},
+		{`"\xffé"`, "\xffé", []int{1, 5, 5, 7}},
+	} {
+		text, offsets, err := unquoteOffsets(test.lit)
+		if err != nil || text != test.text || !equalInts(offsets, test.offsets) {
+			t.Errorf("unquoteOffsets(%s) = %q, %v, %v; want %q, %v", test.lit, text, offsets, err, test.text, test.offsets)
+		}
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
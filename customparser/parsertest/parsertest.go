@@ -0,0 +1,338 @@
+// Package parsertest implements a test harness for parsers, parser
+// extensions, linters and code generators working on Go source: the
+// diagnostics reported for test files are compared against the
+// expectations written as comments in the files themselves.
+//
+// Expected diagnostics are indicated by putting a comment of the form
+// /* ERROR "rx" */ or /* WARNING "rx" */ immediately following an
+// offending token. The harness verifies that an error (respectively a
+// warning) matching the regular expression rx is reported at that
+// source position. For instance, the following test file indicates that
+// a "not declared" error should be reported for the undeclared
+// variable x:
+//
+//	package p
+//	func f() {
+//		_ = x /* ERROR "not declared" */ + 1
+//	}
+//
+// The special forms /* ERROR HERE "rx" */ and /* WARNING HERE "rx" */
+// must be used for diagnostics that are reported immediately after a
+// token, rather than at a token's position.
+//
+// Test files are parsed by the function provided in the Config. Parse
+// errors are error diagnostics; the optional Check function reports
+// additional diagnostics for the files of a package, and may produce an
+// output (such as generated code) that is compared against a golden
+// file. The golden files are rewritten when tests run with the
+// -update-golden flag.
+package parsertest
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update-golden", false, "rewrite the golden files of parsertest tests")
+
+// Severity is the severity of a diagnostic.
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+func (s Severity) String() string {
+	if s == Warning {
+		return "WARNING"
+	}
+	return "ERROR"
+}
+
+// A Diagnostic is a message reported at a position.
+type Diagnostic struct {
+	Pos      token.Pos
+	Severity Severity
+	Msg      string
+}
+
+// A Config specifies how the files of a test are processed.
+type Config struct {
+	// Parse parses a file. It must add the file to fset under the
+	// given name. Its errors of type scanner.ErrorList are reported
+	// as error diagnostics; other errors fail the test.
+	Parse func(fset *token.FileSet, filename string, src []byte) (*ast.File, error)
+
+	// If Check is not nil, it is called with the files of each package
+	// tested, in the order of their names, and returns additional
+	// diagnostics. If output is not nil, it is compared against the
+	// golden file of the package.
+	Check func(fset *token.FileSet, files []*ast.File) (diags []Diagnostic, output []byte)
+}
+
+// Run runs the tests of the directory dir: each .src file in dir is a
+// single-file package, and each subdirectory containing .src files is a
+// package made of these files. The golden file of name.src, or of the
+// package directory name, is name.golden in dir.
+func (conf *Config) Run(t testing.TB, dir string) {
+	t.Helper()
+	list, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range list {
+		name := fi.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		switch {
+		case fi.IsDir():
+			files, err := filepath.Glob(filepath.Join(path, "*.src"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) > 0 {
+				conf.test(t, path+".golden", files)
+			}
+		case strings.HasSuffix(name, ".src"):
+			conf.test(t, strings.TrimSuffix(path, ".src")+".golden", []string{path})
+		}
+	}
+}
+
+// TestFiles tests the package made of the given files. The golden file
+// is that of the first file, with the extension .golden.
+func (conf *Config) TestFiles(t testing.TB, filenames ...string) {
+	t.Helper()
+	if len(filenames) == 0 {
+		return
+	}
+	golden := strings.TrimSuffix(filenames[0], filepath.Ext(filenames[0])) + ".golden"
+	conf.test(t, golden, filenames)
+}
+
+func (conf *Config) test(t testing.TB, golden string, filenames []string) {
+	t.Helper()
+	srcs := make([][]byte, len(filenames))
+	for i, filename := range filenames {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		srcs[i] = src
+	}
+	conf.check(t, golden, filenames, srcs)
+}
+
+// TestSource tests the single-file package of source src. The filename
+// is only used for positions; there is no golden file.
+func (conf *Config) TestSource(t testing.TB, filename string, src []byte) {
+	t.Helper()
+	conf.check(t, "", []string{filename}, [][]byte{src})
+}
+
+// An expectation identifies an expected diagnostic; it maps to the
+// regular expression its message must match.
+type expectation struct {
+	pos      token.Pos
+	severity Severity
+}
+
+func (conf *Config) check(t testing.TB, golden string, filenames []string, srcs [][]byte) {
+	t.Helper()
+	fset := token.NewFileSet()
+	var files []*ast.File
+	var found []Diagnostic
+	for i, filename := range filenames {
+		f, err := conf.Parse(fset, filename, srcs[i])
+		if err != nil {
+			list, ok := err.(scanner.ErrorList)
+			if !ok {
+				t.Error(err)
+				return
+			}
+			list.RemoveMultiples()
+			for _, e := range list {
+				found = append(found, Diagnostic{getPos(fset, e.Pos.Filename, e.Pos.Offset), Error, e.Msg})
+			}
+		}
+		if f != nil {
+			files = append(files, f)
+		}
+	}
+
+	var output []byte
+	if conf.Check != nil {
+		diags, out := conf.Check(fset, files)
+		found = append(found, diags...)
+		output = out
+	}
+
+	// we are expecting the following diagnostics
+	// (collect these after parsing the files so that they are found in
+	// the file set)
+	expected := make(map[expectation]string)
+	for i, filename := range filenames {
+		expectedDiagnostics(fset, filename, srcs[i], expected)
+	}
+
+	compareDiagnostics(t, fset, expected, found)
+
+	if output != nil && golden != "" {
+		compareGolden(t, golden, output)
+	}
+}
+
+// getFile returns the file of the given name; it assumes that each
+// filename occurs at most once.
+func getFile(fset *token.FileSet, filename string) (file *token.File) {
+	fset.Iterate(func(f *token.File) bool {
+		if f.Name() == filename {
+			if file != nil {
+				panic(filename + " used multiple times")
+			}
+			file = f
+		}
+		return true
+	})
+	return file
+}
+
+func getPos(fset *token.FileSet, filename string, offset int) token.Pos {
+	if f := getFile(fset, filename); f != nil {
+		return f.Pos(offset)
+	}
+	return token.NoPos
+}
+
+// Annotations must be of the form /* ERROR "rx" */ or /* WARNING "rx" */,
+// optionally with HERE before the regular expression rx.
+var annotationRx = regexp.MustCompile(`^/\* *(ERROR|WARNING) *(HERE)? *"([^"]*)" *\*/$`)
+
+// expectedDiagnostics collects the regular expressions of the
+// annotations found in the file filename into expected.
+func expectedDiagnostics(fset *token.FileSet, filename string, src []byte, expected map[expectation]string) {
+	file := getFile(fset, filename)
+	if file == nil {
+		return
+	}
+	var s scanner.Scanner
+	// file was parsed already - do not add it again to the file
+	// set otherwise the position information returned here will
+	// not match the position information collected by the parser
+	s.Init(file, src, nil, scanner.ScanComments)
+	var prev token.Pos // position of last non-comment, non-semicolon token
+	var here token.Pos // position immediately after the token at position prev
+
+	for {
+		pos, tok, lit := s.Scan()
+		switch tok {
+		case token.EOF:
+			return
+		case token.COMMENT:
+			m := annotationRx.FindStringSubmatch(lit)
+			if m == nil {
+				continue
+			}
+			pos := prev
+			if m[2] == "HERE" {
+				pos = here
+			}
+			severity := Error
+			if m[1] == "WARNING" {
+				severity = Warning
+			}
+			expected[expectation{pos, severity}] = m[3]
+		default:
+			prev = pos
+			var l int // token length
+			if tok.IsLiteral() {
+				l = len(lit)
+			} else {
+				l = len(tok.String())
+			}
+			here = prev + token.Pos(l)
+		}
+	}
+}
+
+// compareDiagnostics compares the expected messages with the found
+// diagnostics and reports discrepancies.
+func compareDiagnostics(t testing.TB, fset *token.FileSet, expected map[expectation]string, found []Diagnostic) {
+	t.Helper()
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Pos < found[j].Pos })
+	for _, d := range found {
+		key := expectation{d.Pos, d.Severity}
+		if msg, ok := expected[key]; ok {
+			// we expect a message at pos; check if it matches
+			rx, err := regexp.Compile(msg)
+			if err != nil {
+				t.Errorf("%s: %v", fset.Position(d.Pos), err)
+				continue
+			}
+			if !rx.MatchString(d.Msg) {
+				t.Errorf("%s: %s %q does not match %q", fset.Position(d.Pos), d.Severity, d.Msg, msg)
+				continue
+			}
+			// we have a match - eliminate this expectation
+			delete(expected, key)
+		} else {
+			// To keep in mind when analyzing failed test output:
+			// If the same position occurs multiple times in the
+			// diagnostics, this message will be triggered (because
+			// the first one at the position removes the expectation).
+			t.Errorf("%s: unexpected %s: %s", fset.Position(d.Pos), strings.ToLower(d.Severity.String()), d.Msg)
+		}
+	}
+
+	// there should be no expected diagnostics left
+	if len(expected) > 0 {
+		var list []string
+		for key, msg := range expected {
+			list = append(list, fmt.Sprintf("%s: %s %s", fset.Position(key.pos), key.severity, msg))
+		}
+		sort.Strings(list)
+		t.Errorf("%d diagnostics not reported:", len(expected))
+		for _, s := range list {
+			t.Error(s)
+		}
+	}
+}
+
+// compareGolden compares output with the content of the golden file, or
+// rewrites the golden file with the -update-golden flag.
+func compareGolden(t testing.TB, golden string, output []byte) {
+	t.Helper()
+	if *update {
+		if err := ioutil.WriteFile(golden, output, 0666); err != nil {
+			t.Error(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(golden)
+	if os.IsNotExist(err) {
+		t.Errorf("%s does not exist; run the tests with -update-golden to create it", golden)
+		return
+	}
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(output, want) {
+		t.Errorf("output does not match %s:\ngot\n%s\nwant\n%s", golden, output, want)
+	}
+}
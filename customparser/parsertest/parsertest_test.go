@@ -0,0 +1,77 @@
+package parsertest_test
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/yunabe/golang-codelab/customparser/parser"
+	"github.com/yunabe/golang-codelab/customparser/parsertest"
+)
+
+func parse(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+	return parser.ParseFile(fset, filename, src, parser.AllErrors)
+}
+
+// check warns about identifiers named bad and outputs the names of the
+// functions of the files.
+func check(fset *token.FileSet, files []*ast.File) ([]parsertest.Diagnostic, []byte) {
+	var diags []parsertest.Diagnostic
+	var buf bytes.Buffer
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.Ident:
+				if n.Name == "bad" {
+					diags = append(diags, parsertest.Diagnostic{Pos: n.Pos(), Severity: parsertest.Warning, Msg: "identifier bad"})
+				}
+			case *ast.FuncDecl:
+				fmt.Fprintf(&buf, "%s: func %s\n", fset.Position(n.Pos()), n.Name.Name)
+			}
+			return true
+		})
+	}
+	return diags, buf.Bytes()
+}
+
+func TestRun(t *testing.T) {
+	conf := &parsertest.Config{Parse: parse, Check: check}
+	conf.Run(t, "testdata")
+}
+
+// recorder records the errors of a test.
+type recorder struct {
+	*testing.T
+	errors []string
+}
+
+func (r *recorder) Error(args ...interface{}) { r.errors = append(r.errors, fmt.Sprint(args...)) }
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestMismatches(t *testing.T) {
+	const src = `package p
+
+var _ = bad /* ERROR "identifier bad" */
+var _ = x /* WARNING "unused" */
+var _ = ) /* ERROR "expected type" */
+`
+	r := &recorder{T: t}
+	conf := &parsertest.Config{Parse: parse, Check: check}
+	conf.TestSource(r, "p.src", []byte(src))
+	want := []string{
+		`p.src:3:9: unexpected warning: identifier bad`,
+		`p.src:5:9: ERROR "expected operand, found ')'" does not match "expected type"`,
+		`3 diagnostics not reported:`,
+		`p.src:3:9: ERROR identifier bad`,
+		`p.src:4:9: WARNING unused`,
+		`p.src:5:9: ERROR expected type`,
+	}
+	if got := strings.Join(r.errors, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("got errors\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,414 @@
+// Package rewrite implements pattern-based rewriting of Go source files
+// parsed with github.com/yunabe/golang-codelab/customparser/parser.
+//
+// A rule has the form
+//
+//	pattern -> replacement
+//
+// where pattern and replacement are Go expressions, or sequences of Go
+// statements separated by semicolons, that may contain metavariables
+// written as $name. For example:
+//
+//	fmt.Sprintf("%s", $x) -> $x
+//	if $err != nil { return $err }; return nil -> return $err
+//
+// A metavariable in the pattern matches any expression, or any statement
+// if it stands alone as a statement; all occurrences of the same
+// metavariable must match structurally equal code. A statement pattern
+// matches a run of consecutive statements of a block, case clause or
+// select clause.
+//
+// Matches are replaced with minimal textual edits: the source outside
+// the matched code is left untouched, and the code bound to a
+// metavariable is copied into the replacement verbatim, comments
+// included. Comments within the matched code but outside the bound code
+// are dropped.
+package rewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yunabe/golang-codelab/customparser/parser"
+	"github.com/yunabe/golang-codelab/customparser/textedit"
+)
+
+// metaPrefix is the identifier prefix standing for "$" in the parsed
+// pattern and replacement.
+const metaPrefix = "ᐅrewrite_"
+
+var metaRx = regexp.MustCompile(`\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// A Rule is a parsed rewrite rule.
+type Rule struct {
+	pattern     template
+	replacement template
+}
+
+// A template is a parsed pattern or replacement. Exactly one of expr and
+// stmts is set.
+type template struct {
+	src   string // source with metavariables replaced by identifiers
+	file  *token.File
+	expr  ast.Expr
+	stmts []ast.Stmt
+}
+
+// ParseRule parses a rule of the form "pattern -> replacement". The
+// pattern and replacement must both be expressions or both be statement
+// lists, and the replacement may only use metavariables bound by the
+// pattern.
+func ParseRule(rule string) (*Rule, error) {
+	f := splitRule(rule)
+	if len(f) != 2 {
+		return nil, fmt.Errorf("rewrite rule must be of the form 'pattern -> replacement'")
+	}
+	pattern, err := parseTemplate(strings.TrimSpace(f[0]), false)
+	if err != nil {
+		return nil, fmt.Errorf("pattern: %v", err)
+	}
+	// a replacement like "$x" is an expression or a statement depending
+	// on the pattern
+	replacement, err := parseTemplate(strings.TrimSpace(f[1]), pattern.expr == nil)
+	if err != nil {
+		return nil, fmt.Errorf("replacement: %v", err)
+	}
+	if (pattern.expr == nil) != (replacement.expr == nil) {
+		return nil, fmt.Errorf("pattern and replacement must both be expressions or both be statements")
+	}
+	bound := make(map[string]bool)
+	for _, name := range metaRx.FindAllStringSubmatch(f[0], -1) {
+		bound[name[1]] = true
+	}
+	for _, name := range metaRx.FindAllStringSubmatch(f[1], -1) {
+		if !bound[name[1]] {
+			return nil, fmt.Errorf("replacement uses unbound metavariable $%s", name[1])
+		}
+	}
+	return &Rule{pattern, replacement}, nil
+}
+
+// splitRule splits rule at the "->" separators outside literals and
+// comments.
+func splitRule(rule string) []string {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(rule))
+	s.Init(file, []byte(rule), func(token.Position, string) {}, scanner.ScanComments)
+	var f []string
+	start, minus := 0, -1 // offset of a preceding "-", or -1
+	for {
+		pos, tok, _ := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		offs := file.Offset(pos)
+		if tok == token.GTR && minus >= 0 && offs == minus+1 {
+			f = append(f, rule[start:minus])
+			start = offs + 1
+		}
+		minus = -1
+		if tok == token.SUB {
+			minus = offs
+		}
+	}
+	return append(f, rule[start:])
+}
+
+// parseTemplate parses s as an expression or, failing that or if stmts
+// is set, as a list of statements.
+func parseTemplate(s string, stmts bool) (template, error) {
+	t := template{src: metaRx.ReplaceAllString(s, metaPrefix+"$1")}
+	fset := token.NewFileSet()
+	if !stmts {
+		if x, err := parser.ParseExprFrom(fset, "", t.src, 0); err == nil {
+			t.expr, t.file = x, fset.File(x.Pos())
+			return t, nil
+		}
+	}
+	// parse as the body of a function; the statements are offset by the
+	// length of the prefix
+	const prefix = "package p; func _() {\n"
+	fset = token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", prefix+t.src+"\n}", 0)
+	if err != nil {
+		return t, err
+	}
+	t.src, t.file = prefix+t.src, fset.File(f.Pos())
+	t.stmts = f.Decls[0].(*ast.FuncDecl).Body.List
+	if len(t.stmts) == 0 {
+		return t, fmt.Errorf("empty template")
+	}
+	return t, nil
+}
+
+// metaName returns the name of the metavariable x stands for, or "".
+func metaName(x interface{}) string {
+	if id, ok := x.(*ast.Ident); ok && strings.HasPrefix(id.Name, metaPrefix) {
+		return id.Name[len(metaPrefix):]
+	}
+	return ""
+}
+
+// Apply returns the edits rewriting the matches of r in f, which must
+// have been parsed from src with positions recorded in fset. Matches
+// nested in or overlapping with preceding matches are ignored.
+func (r *Rule) Apply(fset *token.FileSet, f *ast.File, src []byte) []textedit.Edit {
+	file := fset.File(f.Pos())
+	var matches []textedit.Edit
+	var parents []ast.Node
+	ast.Inspect(f, func(n ast.Node) bool {
+		if n == nil {
+			parents = parents[:len(parents)-1]
+			return true
+		}
+		var parent ast.Node
+		if len(parents) > 0 {
+			parent = parents[len(parents)-1]
+		}
+		parents = append(parents, n)
+
+		if r.pattern.expr != nil {
+			if x, ok := n.(ast.Expr); ok {
+				if m := make(bindings); match(m, reflect.ValueOf(r.pattern.expr), reflect.ValueOf(x)) {
+					matches = append(matches, r.edit(file, src, m, x.Pos(), x.End(), parent, x))
+				}
+			}
+			return true
+		}
+		list := stmtList(n)
+		for i, k := 0, len(r.pattern.stmts); i+k <= len(list); i++ {
+			if m := make(bindings); match(m, reflect.ValueOf(r.pattern.stmts), reflect.ValueOf(list[i:i+k])) {
+				matches = append(matches, r.edit(file, src, m, list[i].Pos(), list[i+k-1].End(), nil, nil))
+			}
+		}
+		return true
+	})
+
+	// keep the outermost, leftmost matches
+	sort.Stable(byRange(matches))
+	var edits []textedit.Edit
+	for _, e := range matches {
+		if len(edits) == 0 || e.Start >= edits[len(edits)-1].End {
+			edits = append(edits, e)
+		}
+	}
+	return edits
+}
+
+// byRange sorts edits by start offset, longer ranges first.
+type byRange []textedit.Edit
+
+func (a byRange) Len() int      { return len(a) }
+func (a byRange) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byRange) Less(i, j int) bool {
+	if a[i].Start != a[j].Start {
+		return a[i].Start < a[j].Start
+	}
+	return a[i].End > a[j].End
+}
+
+// stmtList returns the statement list of a block, case clause or select
+// clause, or nil.
+func stmtList(n ast.Node) []ast.Stmt {
+	switch n := n.(type) {
+	case *ast.BlockStmt:
+		return n.List
+	case *ast.CaseClause:
+		return n.Body
+	case *ast.CommClause:
+		return n.Body
+	}
+	return nil
+}
+
+// edit returns the edit replacing the source range [pos, end) with the
+// replacement instantiated with the bindings m. If the matched code is
+// the expression x with the given parent, the replacement is
+// parenthesized as needed.
+func (r *Rule) edit(file *token.File, src []byte, m bindings, pos, end token.Pos, parent ast.Node, x ast.Expr) textedit.Edit {
+	repl := r.replacement
+	tfile := repl.file
+
+	// substitute the metavariables of the replacement
+	var subst []textedit.Edit
+	var parents []ast.Node
+	var roots []ast.Node
+	if repl.expr != nil {
+		roots = []ast.Node{repl.expr}
+	} else {
+		for _, s := range repl.stmts {
+			roots = append(roots, s)
+		}
+	}
+	for _, root := range roots {
+		ast.Inspect(root, func(n ast.Node) bool {
+			if n == nil {
+				parents = parents[:len(parents)-1]
+				return true
+			}
+			if name := metaName(n); name != "" {
+				b := m[name]
+				text := string(src[file.Offset(b.Pos()):file.Offset(b.End())])
+				var p ast.Node
+				if len(parents) > 0 {
+					p = parents[len(parents)-1]
+				}
+				if bx, ok := b.(ast.Expr); ok && needsParens(p, n.(ast.Expr), bx) {
+					text = "(" + text + ")"
+				}
+				subst = append(subst, textedit.Edit{Start: tfile.Offset(n.Pos()), End: tfile.Offset(n.End()), New: text})
+			}
+			parents = append(parents, n)
+			return true
+		})
+	}
+	start := tfile.Offset(roots[0].Pos())
+	stop := tfile.Offset(roots[len(roots)-1].End())
+	text, err := textedit.Apply([]byte(repl.src[start:stop]), shift(subst, -start))
+	if err != nil {
+		panic(err) // metavariables never overlap
+	}
+
+	s := string(text)
+	if repl.expr != nil && needsParens(parent, x, repl.expr) {
+		s = "(" + s + ")"
+	}
+	return textedit.Edit{Start: file.Offset(pos), End: file.Offset(end), New: s}
+}
+
+func shift(edits []textedit.Edit, delta int) []textedit.Edit {
+	for i := range edits {
+		edits[i].Start += delta
+		edits[i].End += delta
+	}
+	return edits
+}
+
+// needsParens reports whether the expression x of parent, when replaced
+// by y, must be parenthesized.
+func needsParens(parent ast.Node, x, y ast.Expr) bool {
+	var prec int // precedence of the operand context; 0 if none
+	switch p := parent.(type) {
+	case *ast.BinaryExpr:
+		prec = p.Op.Precedence()
+		if p.Y == x {
+			prec++ // right operands of equal precedence need parens
+		}
+	case *ast.UnaryExpr, *ast.StarExpr:
+		prec = token.UnaryPrec
+	case *ast.SelectorExpr, *ast.IndexExpr, *ast.SliceExpr, *ast.TypeAssertExpr:
+		prec = token.HighestPrec
+	case *ast.CallExpr:
+		if p.Fun == x {
+			prec = token.HighestPrec
+		}
+	}
+	if prec == 0 {
+		return false
+	}
+	switch y := y.(type) {
+	case *ast.BinaryExpr:
+		return y.Op.Precedence() < prec
+	case *ast.UnaryExpr, *ast.StarExpr:
+		return token.UnaryPrec < prec
+	case *ast.KeyValueExpr, *ast.FuncLit, *ast.CompositeLit:
+		return true
+	}
+	return false
+}
+
+// bindings maps metavariable names to the nodes they matched.
+type bindings map[string]ast.Node
+
+var (
+	identType    = reflect.TypeOf((*ast.Ident)(nil))
+	objectType   = reflect.TypeOf((*ast.Object)(nil))
+	scopeType    = reflect.TypeOf((*ast.Scope)(nil))
+	commentsType = reflect.TypeOf((*ast.CommentGroup)(nil))
+	positionType = reflect.TypeOf(token.NoPos)
+	exprStmtType = reflect.TypeOf((*ast.ExprStmt)(nil))
+)
+
+// match reports whether the pattern matches val, recording the bindings
+// of metavariables in m. Positions, comments and resolved objects are
+// ignored.
+func match(m bindings, pattern, val reflect.Value) bool {
+	// a metavariable matches any expression, and a metavariable statement
+	// any statement
+	if pattern.IsValid() && pattern.Type() == exprStmtType && !pattern.IsNil() {
+		if name := metaName(pattern.Interface().(*ast.ExprStmt).X); name != "" {
+			if s, ok := val.Interface().(ast.Stmt); ok && !val.IsNil() {
+				return bind(m, name, s)
+			}
+		}
+	}
+	if pattern.IsValid() && pattern.Type() == identType && !pattern.IsNil() {
+		if name := metaName(pattern.Interface()); name != "" && val.IsValid() && val.CanInterface() {
+			if x, ok := val.Interface().(ast.Expr); ok && !val.IsNil() {
+				return bind(m, name, x)
+			}
+			return false
+		}
+	}
+
+	if !pattern.IsValid() || !val.IsValid() {
+		return !pattern.IsValid() && !val.IsValid()
+	}
+	if pattern.Type() != val.Type() {
+		return false
+	}
+	switch pattern.Type() {
+	case identType:
+		// identifiers match by name only
+		p, v := pattern.Interface().(*ast.Ident), val.Interface().(*ast.Ident)
+		if p == nil || v == nil {
+			return p == v
+		}
+		return p.Name == v.Name
+	case objectType, scopeType, commentsType, positionType:
+		return true
+	}
+
+	switch p := pattern; p.Kind() {
+	case reflect.Slice:
+		if p.Len() != val.Len() {
+			return false
+		}
+		for i := 0; i < p.Len(); i++ {
+			if !match(m, p.Index(i), val.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := 0; i < p.NumField(); i++ {
+			if !match(m, p.Field(i), val.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Ptr, reflect.Interface:
+		if p.IsNil() || val.IsNil() {
+			return p.IsNil() && val.IsNil()
+		}
+		return match(m, p.Elem(), val.Elem())
+	}
+	return reflect.DeepEqual(pattern.Interface(), val.Interface())
+}
+
+// bind binds the metavariable name to n, or reports whether n matches
+// the node name is already bound to.
+func bind(m bindings, name string, n ast.Node) bool {
+	if b, ok := m[name]; ok {
+		return match(bindings{}, reflect.ValueOf(b), reflect.ValueOf(n))
+	}
+	m[name] = n
+	return true
+}
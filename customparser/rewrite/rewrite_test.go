@@ -0,0 +1,158 @@
+package rewrite
+
+import (
+	"go/token"
+	"testing"
+
+	"github.com/yunabe/golang-codelab/customparser/parser"
+	"github.com/yunabe/golang-codelab/customparser/textedit"
+)
+
+func rewriteSource(t *testing.T, rule, src string) string {
+	r, err := ParseRule(rule)
+	if err != nil {
+		t.Fatalf("%s: %v", rule, err)
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := textedit.Apply([]byte(src), r.Apply(fset, f, []byte(src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(res)
+}
+
+var rewriteTests = []struct {
+	rule, src, want string
+}{
+	// expressions
+	{
+		`fmt.Sprintf("%s", $x) -> $x`,
+		`package p; var s = fmt.Sprintf("%s", f(a /* keep */)) + fmt.Sprintf("%d", n)`,
+		`package p; var s = f(a /* keep */) + fmt.Sprintf("%d", n)`,
+	},
+	{
+		`$x + $x -> 2 * $x`,
+		`package p; var _, _ = a + a, (b + c) + (b+c)`,
+		`package p; var _, _ = 2 * a, 2 * (b + c)`,
+	},
+	{
+		// consistent bindings and parenthesization of bound code
+		`$x * 2 -> $x << 1`,
+		`package p; var _, _ = (a + b) * 2, f(x) * 2`,
+		`package p; var _, _ = (a + b) << 1, f(x) << 1`,
+	},
+	{
+		`$a - $b -> $b - $a`,
+		`package p; var _ = x - (y - z)`,
+		`package p; var _ = (y - z) - x`,
+	},
+	{
+		// parenthesization of the replacement in operand position
+		`min($a, $b) -> $a + $b`,
+		`package p; var _ = min(x, y) * 2`,
+		`package p; var _ = (x + y) * 2`,
+	},
+	{
+		// outermost matches only
+		`f($x) -> g($x)`,
+		`package p; var _ = f(f(1)) // comment`,
+		`package p; var _ = g(f(1)) // comment`,
+	},
+	{
+		// identifiers in non-expression position
+		`$x.Println -> $x.Print`,
+		`package p; func f() { fmt.Println(1); log.Println(2) }`,
+		`package p; func f() { fmt.Print(1); log.Print(2) }`,
+	},
+
+	// statements
+	{
+		`if $err != nil { return $err }; return nil -> return $err`,
+		`package p
+
+func f() error {
+	err := g()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+`,
+		`package p
+
+func f() error {
+	err := g()
+	return err
+}
+`,
+	},
+	{
+		`$s; $s -> $s`,
+		`package p
+
+func f() {
+	switch {
+	case true:
+		x++
+		x++ // second
+		y()
+	}
+}
+`,
+		`package p
+
+func f() {
+	switch {
+	case true:
+		x++ // second
+		y()
+	}
+}
+`,
+	},
+	{
+		// "->" within literals and comments
+		`fmt.Sprintf("a->b") -> x /* -> */`,
+		`package p; var _ = fmt.Sprintf("a->b") + y`,
+		`package p; var _ = x + y`,
+	},
+	{
+		`f('-', $x) -> f($x-1)`,
+		`package p; var _ = f('-', a)`,
+		`package p; var _ = f(a-1)`,
+	},
+	{
+		// no match
+		`$x + $x -> 2 * $x`,
+		`package p; var _ = a + b`,
+		`package p; var _ = a + b`,
+	},
+}
+
+func TestRewrite(t *testing.T) {
+	for _, test := range rewriteTests {
+		if got := rewriteSource(t, test.rule, test.src); got != test.want {
+			t.Errorf("%s:\ngot\n%s\nwant\n%s", test.rule, got, test.want)
+		}
+	}
+}
+
+func TestParseRuleErrors(t *testing.T) {
+	for _, rule := range []string{
+		"f($x)",
+		"f($x) -> g($y)",
+		"f($x) -> return $x",
+		"f($x -> $x",
+		"a -> b -> c",
+		"> b",
+		"a - > b",
+	} {
+		if _, err := ParseRule(rule); err == nil {
+			t.Errorf("%q: expected error", rule)
+		}
+	}
+}
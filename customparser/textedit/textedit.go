@@ -0,0 +1,325 @@
+// Package textedit implements minimal textual edits of source files and
+// the unified diffs describing them.
+package textedit
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// An Edit replaces the bytes in the range [Start, End) of a source with New.
+// An insertion has Start == End.
+type Edit struct {
+	Start, End int
+	New        string
+}
+
+// Apply returns a copy of src with edits applied. Insertions at the same
+// offset are applied in the order in which they appear in edits. Apply
+// returns an error if edits overlap or are out of range.
+func Apply(src []byte, edits []Edit) ([]byte, error) {
+	sorted := make([]Edit, len(edits))
+	copy(sorted, edits)
+	sort.Stable(byStart(sorted))
+
+	var buf bytes.Buffer
+	offs := 0
+	for _, e := range sorted {
+		if e.Start < offs || e.End < e.Start || e.End > len(src) {
+			return nil, fmt.Errorf("textedit: invalid or overlapping edit [%d, %d)", e.Start, e.End)
+		}
+		buf.Write(src[offs:e.Start])
+		buf.WriteString(e.New)
+		offs = e.End
+	}
+	buf.Write(src[offs:])
+	return buf.Bytes(), nil
+}
+
+type byStart []Edit
+
+func (a byStart) Len() int           { return len(a) }
+func (a byStart) Less(i, j int) bool { return a[i].Start < a[j].Start }
+func (a byStart) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// contextLines is the number of unchanged lines shown around each change
+// in a unified diff.
+const contextLines = 3
+
+// Diff returns a unified diff of old and new, labeled with oldName and
+// newName. The result is empty if old and new are equal.
+func Diff(oldName string, old []byte, newName string, new []byte) []byte {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+	a, b := splitLines(old), splitLines(new)
+	ops := diffLines(a, b)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldName, newName)
+	for i := 0; i < len(ops); {
+		// find the next change
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		// extend the hunk while changes are separated by at most
+		// 2*contextLines unchanged lines
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			j := end
+			for j < len(ops) && ops[j].kind == ' ' {
+				j++
+			}
+			if j == len(ops) || j-end > 2*contextLines {
+				end += contextLines
+				if end > len(ops) {
+					end = len(ops)
+				}
+				break
+			}
+			end = j
+		}
+		writeHunk(&buf, ops[start:end])
+		i = end
+	}
+	return buf.Bytes()
+}
+
+// An op is a line of a diff: kind is ' ' for an unchanged line, '-' for a
+// deleted line and '+' for an inserted line. aLine and bLine are the
+// 0-based line numbers in the old and new text before the op.
+type op struct {
+	kind         byte
+	line         string
+	aLine, bLine int
+}
+
+func writeHunk(buf *bytes.Buffer, ops []op) {
+	na, nb := 0, 0
+	for _, o := range ops {
+		if o.kind != '+' {
+			na++
+		}
+		if o.kind != '-' {
+			nb++
+		}
+	}
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(ops[0].aLine, na), hunkRange(ops[0].bLine, nb))
+	for _, o := range ops {
+		buf.WriteByte(o.kind)
+		buf.WriteString(o.line)
+		if len(o.line) == 0 || o.line[len(o.line)-1] != '\n' {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(line, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", line)
+	}
+	if n == 1 {
+		return fmt.Sprint(line + 1)
+	}
+	return fmt.Sprintf("%d,%d", line+1, n)
+}
+
+// splitLines splits src into lines, each including its terminating newline.
+func splitLines(src []byte) []string {
+	var lines []string
+	for len(src) > 0 {
+		i := bytes.IndexByte(src, '\n') + 1
+		if i == 0 {
+			i = len(src)
+		}
+		lines = append(lines, string(src[:i]))
+		src = src[i:]
+	}
+	return lines
+}
+
+// diffLines computes a minimal line diff of a and b with the linear
+// space variant of Myers' O(ND) algorithm, "An O(ND) Difference Algorithm
+// and Its Variations" (1986). Within each change, deleted lines precede
+// inserted lines.
+func diffLines(a, b []string) []op {
+	// compare lines by number
+	ids := make(map[string]int)
+	number := func(lines []string) []int {
+		x := make([]int, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			x[i] = id
+		}
+		return x
+	}
+	d := &differ{a: number(a), b: number(b)}
+	d.compare(0, len(a), 0, len(b))
+
+	ops := make([]op, 0, len(d.kinds))
+	ai, bi := 0, 0
+	for i := 0; i < len(d.kinds); {
+		if d.kinds[i] == ' ' {
+			ops = append(ops, op{' ', a[ai], ai, bi})
+			ai++
+			bi++
+			i++
+			continue
+		}
+		j := i
+		for j < len(d.kinds) && d.kinds[j] != ' ' {
+			j++
+		}
+		for _, kind := range d.kinds[i:j] {
+			if kind == '-' {
+				ops = append(ops, op{'-', a[ai], ai, bi})
+				ai++
+			}
+		}
+		for _, kind := range d.kinds[i:j] {
+			if kind == '+' {
+				ops = append(ops, op{'+', b[bi], ai, bi})
+				bi++
+			}
+		}
+		i = j
+	}
+	return ops
+}
+
+// A differ computes the kinds of the ops of a diff of the lines a and b,
+// numbered so that equal lines have equal numbers.
+type differ struct {
+	a, b   []int
+	kinds  []byte
+	vf, vb []int // furthest reaching paths of split, reused
+}
+
+func (d *differ) emit(kind byte, n int) {
+	for ; n > 0; n-- {
+		d.kinds = append(d.kinds, kind)
+	}
+}
+
+// compare appends the ops turning a[x0:x1] into b[y0:y1].
+func (d *differ) compare(x0, x1, y0, y1 int) {
+	prefix := 0
+	for x0 < x1 && y0 < y1 && d.a[x0] == d.b[y0] {
+		x0++
+		y0++
+		prefix++
+	}
+	suffix := 0
+	for x0 < x1 && y0 < y1 && d.a[x1-1] == d.b[y1-1] {
+		x1--
+		y1--
+		suffix++
+	}
+	d.emit(' ', prefix)
+	switch {
+	case x0 == x1:
+		d.emit('+', y1-y0)
+	case y0 == y1:
+		d.emit('-', x1-x0)
+	default:
+		x, y := d.split(x0, x1, y0, y1)
+		d.compare(x0, x, y0, y)
+		d.compare(x, x1, y, y1)
+	}
+	d.emit(' ', suffix)
+}
+
+// split returns a point of a shortest edit script turning a[x0:x1] into
+// b[y0:y1] other than its ends, by searching from both ends for the
+// middle snake. The first and the last lines of both ranges must differ.
+func (d *differ) split(x0, x1, y0, y1 int) (x, y int) {
+	n, m := x1-x0, y1-y0
+	max := (n + m + 1) / 2
+	// vf[off+k] is the furthest x of a forward path on the diagonal
+	// k = x-y, and vb[off+k] the furthest distance from x1 of a backward
+	// path on the diagonal k = (x1-x)-(y1-y), all relative to (x0, y0)
+	off, size := max+1, 2*max+3
+	if cap(d.vf) < size {
+		d.vf, d.vb = make([]int, size), make([]int, size)
+	}
+	vf, vb := d.vf[:size], d.vb[:size]
+	for i := range vf {
+		vf[i], vb[i] = -1, -1
+	}
+	vf[off+1], vb[off+1] = 0, 0
+	delta := n - m
+	odd := delta%2 != 0
+	// bounds of the diagonals still within the ranges
+	fstart, fend, bstart, bend := 0, 0, 0, 0
+	for step := 0; step < max; step++ {
+		for k := -step + fstart; k <= step-fend; k += 2 {
+			var x int
+			if k == -step || k != step && vf[off+k-1] < vf[off+k+1] {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[x0+x] == d.b[y0+y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+			switch {
+			case x > n:
+				fend += 2
+			case y > m:
+				fstart += 2
+			case odd:
+				if i := off + delta - k; 0 <= i && i < size && 0 <= vb[i] && vb[i] <= n && x >= n-vb[i] {
+					return x0 + x, y0 + y
+				}
+			}
+		}
+		for k := -step + bstart; k <= step-bend; k += 2 {
+			var x int
+			if k == -step || k != step && vb[off+k-1] < vb[off+k+1] {
+				x = vb[off+k+1]
+			} else {
+				x = vb[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[x1-1-x] == d.b[y1-1-y] {
+				x++
+				y++
+			}
+			vb[off+k] = x
+			switch {
+			case x > n:
+				bend += 2
+			case y > m:
+				bstart += 2
+			case !odd:
+				if i := off + delta - k; 0 <= i && i < size && 0 <= vf[i] && vf[i] >= n-x {
+					fx, fy := vf[i], vf[i]-(i-off)
+					if fx <= n && 0 <= fy && fy <= m {
+						return x0 + fx, y0 + fy
+					}
+				}
+			}
+		}
+	}
+	// not reached for a shortest edit script; any split is correct
+	return x1, y0
+}
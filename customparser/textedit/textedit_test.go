@@ -0,0 +1,92 @@
+package textedit
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	src := []byte("hello, world")
+	got, err := Apply(src, []Edit{
+		{Start: 7, End: 12, New: "gopher"},
+		{Start: 0, End: 0, New: "<"},
+		{Start: 0, End: 5, New: "bye"},
+		{Start: 12, End: 12, New: ">"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<bye, gopher>"; string(got) != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+
+	for _, edits := range [][]Edit{
+		{{Start: 0, End: 5}, {Start: 4, End: 6}},
+		{{Start: 5, End: 4}},
+		{{Start: 10, End: 13}},
+	} {
+		if _, err := Apply(src, edits); err == nil {
+			t.Errorf("%v: expected error", edits)
+		}
+	}
+}
+
+var diffTests = []struct {
+	old, new, want string
+}{
+	{"a\nb\n", "a\nb\n", ""},
+	{
+		"a\nb\nc\n", "a\nB\nc\n",
+		"--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+	},
+	{
+		"", "a\n",
+		"--- old\n+++ new\n@@ -0,0 +1 @@\n+a\n",
+	},
+	{
+		"a\n", "a",
+		"--- old\n+++ new\n@@ -1 +1 @@\n-a\n+a\n\\ No newline at end of file\n",
+	},
+	{
+		// two hunks
+		"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n", "1\nx\n3\n4\n5\n6\n7\n8\n9\n10\n11\ny\n",
+		"--- old\n+++ new\n@@ -1,5 +1,5 @@\n 1\n-2\n+x\n 3\n 4\n 5\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+y\n",
+	},
+	{
+		// one hunk, changes separated by 6 lines
+		"1\n2\n3\n4\n5\n6\n7\n8\n", "x\n2\n3\n4\n5\n6\n7\ny\n",
+		"--- old\n+++ new\n@@ -1,8 +1,8 @@\n-1\n+x\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+y\n",
+	},
+}
+
+func TestDiff(t *testing.T) {
+	for _, test := range diffTests {
+		got := string(Diff("old", []byte(test.old), "new", []byte(test.new)))
+		if got != test.want {
+			t.Errorf("Diff(%q, %q):\ngot\n%s\nwant\n%s", test.old, test.new, got, test.want)
+		}
+	}
+}
+
+func TestDiffLarge(t *testing.T) {
+	// a quadratic diff would need tens of GB
+	var old, new bytes.Buffer
+	const n = 100000
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&old, "%d\n", i)
+		switch i {
+		case 0:
+			new.WriteString("first\n")
+		case n - 1:
+			new.WriteString("last\n")
+		default:
+			fmt.Fprintf(&new, "%d\n", i)
+		}
+	}
+	got := string(Diff("old", old.Bytes(), "new", new.Bytes()))
+	want := "--- old\n+++ new\n@@ -1,4 +1,4 @@\n-0\n+first\n 1\n 2\n 3\n@@ -99997,4 +99997,4 @@\n 99996\n 99997\n 99998\n-99999\n+last\n"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}